@@ -0,0 +1,307 @@
+/*
+	全局熔断开关
+	触发后禁止新的下单和改单，撤销所有挂单，可选市价平仓，并记录审计日志
+	同一个 Controller 可同时设置为 REST 客户端和 WsClient 的下单前检查
+*/
+package killswitch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"v5sdk_go/risk"
+	"v5sdk_go/trade"
+)
+
+// 触发来源
+const (
+	SOURCE_MANUAL = "manual" // 手动触发
+	SOURCE_RISK   = "risk"   // 风控规则
+	SOURCE_ERRORS = "errors" // 连续错误
+	SOURCE_FILE   = "file"   // 文件触发
+	SOURCE_SIGNAL = "signal" // 信号触发
+)
+
+// 审计日志的动作
+const (
+	ACTION_TRIP    = "trip"    // 触发熔断
+	ACTION_BLOCK   = "block"   // 拒绝下单
+	ACTION_CANCEL  = "cancel"  // 撤销挂单
+	ACTION_FLATTEN = "flatten" // 市价平仓
+	ACTION_RESET   = "reset"   // 恢复交易
+)
+
+// 撤单和平仓的默认超时时间
+const DEFAULT_ACTION_TIMEOUT = 30 * time.Second
+
+var ErrTripped = errors.New("熔断已触发，禁止下单")
+
+// 熔断后控制器自身发出的撤单和平仓请求
+type actionKey struct{}
+
+/*
+	熔断配置
+	Flatten: 触发后是否市价平仓
+	TripRules: 触发熔断的风控规则 risk.RULE_XXX，为空时不因风控触发
+	MaxErrors: ErrorWindow 内上报的错误达到该次数时触发，为 0 时不启用
+	ErrorWindow: 错误计数的时间窗口
+	ActionTimeout: 自动触发时撤单和平仓的超时时间，为 0 时使用 DEFAULT_ACTION_TIMEOUT
+*/
+type Config struct {
+	Flatten       bool
+	TripRules     []string
+	MaxErrors     int
+	ErrorWindow   time.Duration
+	ActionTimeout time.Duration
+}
+
+/*
+	熔断后执行撤单和平仓的对象，由 RestTarget 或 WsTarget 创建
+*/
+type Target interface {
+	CancelAll(ctx context.Context) error
+	Flatten(ctx context.Context) error
+}
+
+/*
+	审计日志
+	Source: 触发来源 SOURCE_XXX，仅 ACTION_TRIP 和 ACTION_RESET 有
+	Msg: 触发原因或动作说明
+	Err: 动作执行失败时的错误
+*/
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Source string    `json:"source,omitempty"`
+	Msg    string    `json:"msg,omitempty"`
+	Err    string    `json:"err,omitempty"`
+}
+
+/*
+	熔断状态
+*/
+type Status struct {
+	Tripped bool
+	Source  string
+	Reason  string
+	Time    time.Time
+}
+
+/*
+	熔断控制器
+	例如:
+	ks := killswitch.New(killswitch.Config{Flatten: true, TripRules: []string{risk.RULE_MAX_POSITION}})
+	ks.SetCheck(riskManager)
+	ks.AddTarget(killswitch.RestTarget(restCli, ""))
+	restCli.SetPreTradeCheck(ks)
+	wsCli.SetPreTradeCheck(ks)
+	...
+	ks.Trip(ctx, killswitch.SOURCE_MANUAL, "停止交易")
+*/
+type Controller struct {
+	conf Config
+
+	lock    sync.Mutex
+	status  Status
+	check   trade.PreTradeCheck
+	targets []Target
+	errs    []time.Time
+	audit   []AuditEntry
+	writer  io.Writer
+}
+
+func New(conf Config) *Controller {
+	if conf.ActionTimeout <= 0 {
+		conf.ActionTimeout = DEFAULT_ACTION_TIMEOUT
+	}
+	return &Controller{
+		conf: conf,
+	}
+}
+
+/*
+	设置未熔断时执行的下单前检查，如 risk.Manager
+*/
+func (c *Controller) SetCheck(check trade.PreTradeCheck) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.check = check
+}
+
+func (c *Controller) AddTarget(t Target) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.targets = append(c.targets, t)
+}
+
+/*
+	审计日志同时以 JSON 行的格式写入 w
+*/
+func (c *Controller) SetAuditWriter(w io.Writer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.writer = w
+}
+
+func (c *Controller) Status() Status {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.status
+}
+
+/*
+	获取全部审计日志
+*/
+func (c *Controller) Audit() []AuditEntry {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]AuditEntry(nil), c.audit...)
+}
+
+/*
+	下单前检查，熔断后拒绝下单和改单，撤单和控制器自身的平仓不受限制
+	trade.SkipPreTradeCheck 只跳过 SetCheck 设置的检查，不能绕过熔断
+	未熔断时执行 SetCheck 设置的检查，违反 TripRules 中的风控规则时触发熔断
+*/
+func (c *Controller) CheckOrders(ctx context.Context, op string, args []map[string]interface{}) error {
+	own := ctx.Value(actionKey{}) != nil
+	c.lock.Lock()
+	status, check := c.status, c.check
+	if status.Tripped && !own && op != trade.OP_CANCEL_ORDER && op != trade.OP_MASS_CANCEL {
+		c.record(AuditEntry{Action: ACTION_BLOCK, Msg: fmt.Sprintf("%s %d个订单", op, len(args))})
+		c.lock.Unlock()
+		return fmt.Errorf("%w: %s", ErrTripped, status.Reason)
+	}
+	c.lock.Unlock()
+
+	if check == nil || trade.PreTradeCheckSkipped(ctx) {
+		return nil
+	}
+	err := check.CheckOrders(ctx, op, args)
+	if e, ok := risk.IsRiskError(err); ok && c.tripRule(e.Rule) {
+		go c.tripAsync(SOURCE_RISK, e.Error())
+	}
+	return err
+}
+
+func (c *Controller) tripRule(rule string) bool {
+	for _, r := range c.conf.TripRules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	上报交易错误，ErrorWindow 内达到 MaxErrors 次时触发熔断
+*/
+func (c *Controller) ReportError(err error) {
+	if err == nil || c.conf.MaxErrors <= 0 {
+		return
+	}
+
+	c.lock.Lock()
+	now := time.Now()
+	n := 0
+	for _, t := range c.errs {
+		if c.conf.ErrorWindow <= 0 || now.Sub(t) < c.conf.ErrorWindow {
+			c.errs[n] = t
+			n++
+		}
+	}
+	c.errs = append(c.errs[:n], now)
+	trip := !c.status.Tripped && len(c.errs) >= c.conf.MaxErrors
+	c.lock.Unlock()
+
+	if trip {
+		go c.tripAsync(SOURCE_ERRORS, fmt.Sprintf("连续%d次错误，最近一次:%v", c.conf.MaxErrors, err))
+	}
+}
+
+func (c *Controller) tripAsync(source, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.conf.ActionTimeout)
+	defer cancel()
+	if err := c.Trip(ctx, source, reason); err != nil {
+		log.Println("熔断处理失败!", err)
+	}
+}
+
+/*
+	触发熔断：禁止下单，撤销所有挂单，配置 Flatten 时撤单后市价平仓
+	已熔断时不重复执行，返回各动作的错误
+	source: 触发来源 SOURCE_XXX
+	reason: 触发原因
+*/
+func (c *Controller) Trip(ctx context.Context, source, reason string) error {
+	c.lock.Lock()
+	if c.status.Tripped {
+		c.lock.Unlock()
+		return nil
+	}
+	c.status = Status{Tripped: true, Source: source, Reason: reason, Time: time.Now()}
+	c.record(AuditEntry{Action: ACTION_TRIP, Source: source, Msg: reason})
+	targets := append([]Target(nil), c.targets...)
+	c.lock.Unlock()
+	log.Println("熔断已触发!", source, reason)
+
+	// 撤单和平仓不受熔断和风控检查限制
+	ctx = trade.SkipPreTradeCheck(context.WithValue(ctx, actionKey{}, true))
+	var errs []string
+	run := func(action string, fn func(Target) error) {
+		for i, t := range targets {
+			err := fn(t)
+			entry := AuditEntry{Action: action, Msg: fmt.Sprintf("target %d", i)}
+			if err != nil {
+				entry.Err = err.Error()
+				errs = append(errs, action+": "+err.Error())
+			}
+			c.lock.Lock()
+			c.record(entry)
+			c.lock.Unlock()
+		}
+	}
+	run(ACTION_CANCEL, func(t Target) error { return t.CancelAll(ctx) })
+	if c.conf.Flatten {
+		run(ACTION_FLATTEN, func(t Target) error { return t.Flatten(ctx) })
+	}
+
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+/*
+	恢复交易，需确认触发原因已解除
+*/
+func (c *Controller) Reset(reason string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.status.Tripped {
+		return
+	}
+	c.status = Status{}
+	c.errs = nil
+	c.record(AuditEntry{Action: ACTION_RESET, Source: SOURCE_MANUAL, Msg: reason})
+	log.Println("熔断已解除!", reason)
+}
+
+// 需持有锁
+func (c *Controller) record(entry AuditEntry) {
+	entry.Time = time.Now()
+	c.audit = append(c.audit, entry)
+	if c.writer == nil {
+		return
+	}
+	line, _ := json.Marshal(entry)
+	if _, err := c.writer.Write(append(line, '\n')); err != nil {
+		log.Println("写入审计日志失败!", err)
+	}
+}
@@ -0,0 +1,208 @@
+package killswitch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"v5sdk_go/rest"
+	"v5sdk_go/risk"
+	"v5sdk_go/trade"
+	"v5sdk_go/ws/wImpl"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTarget struct {
+	lock    sync.Mutex
+	calls   []string
+	skipped bool
+	err     error
+}
+
+func (t *fakeTarget) CancelAll(ctx context.Context) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.calls = append(t.calls, ACTION_CANCEL)
+	t.skipped = trade.PreTradeCheckSkipped(ctx)
+	return t.err
+}
+
+func (t *fakeTarget) Flatten(ctx context.Context) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.calls = append(t.calls, ACTION_FLATTEN)
+	return nil
+}
+
+func (t *fakeTarget) Calls() []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]string(nil), t.calls...)
+}
+
+func TestController(t *testing.T) {
+	ctx := context.Background()
+	args := []map[string]interface{}{{"instId": "BTC-USDT"}}
+
+	var buf bytes.Buffer
+	tgt := &fakeTarget{}
+	ks := New(Config{Flatten: true})
+	ks.AddTarget(tgt)
+	ks.SetAuditWriter(&buf)
+
+	assert.Nil(t, ks.CheckOrders(ctx, trade.OP_ORDER, args))
+	assert.Nil(t, ks.Trip(ctx, SOURCE_MANUAL, "停止交易"))
+	assert.Equal(t, []string{ACTION_CANCEL, ACTION_FLATTEN}, tgt.Calls())
+	assert.True(t, tgt.skipped)
+	st := ks.Status()
+	assert.True(t, st.Tripped)
+	assert.Equal(t, SOURCE_MANUAL, st.Source)
+
+	// 熔断后禁止下单和改单，撤单不受限制
+	err := ks.CheckOrders(ctx, trade.OP_ORDER, args)
+	assert.True(t, errors.Is(err, ErrTripped))
+	assert.True(t, errors.Is(ks.CheckOrders(ctx, trade.OP_AMEND_ORDER, args), ErrTripped))
+	assert.Nil(t, ks.CheckOrders(ctx, trade.OP_CANCEL_ORDER, args))
+	// 跳过风控检查不能绕过熔断
+	assert.True(t, errors.Is(ks.CheckOrders(trade.SkipPreTradeCheck(ctx), trade.OP_ORDER, args), ErrTripped))
+
+	// 重复触发不再执行
+	assert.Nil(t, ks.Trip(ctx, SOURCE_MANUAL, "again"))
+	assert.Equal(t, 2, len(tgt.Calls()))
+
+	ks.Reset("恢复")
+	assert.False(t, ks.Status().Tripped)
+	assert.Nil(t, ks.CheckOrders(ctx, trade.OP_ORDER, args))
+
+	var actions []string
+	for _, e := range ks.Audit() {
+		actions = append(actions, e.Action)
+	}
+	assert.Equal(t, []string{ACTION_TRIP, ACTION_CANCEL, ACTION_FLATTEN, ACTION_BLOCK, ACTION_BLOCK, ACTION_BLOCK, ACTION_RESET}, actions)
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	assert.Equal(t, len(actions), len(lines))
+	var entry AuditEntry
+	assert.Nil(t, json.Unmarshal(lines[0], &entry))
+	assert.Equal(t, AuditEntry{Time: entry.Time, Action: ACTION_TRIP, Source: SOURCE_MANUAL, Msg: "停止交易"}, entry)
+
+	// 动作失败时返回错误并记录
+	tgt.err = errors.New("timeout")
+	assert.NotNil(t, ks.Trip(ctx, SOURCE_MANUAL, "停止交易"))
+	audit := ks.Audit()
+	assert.Equal(t, "timeout", audit[len(audit)-2].Err)
+}
+
+func TestTriggers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	args := []map[string]interface{}{{"instId": "BTC-USDT"}}
+
+	// 风控规则
+	ks := New(Config{TripRules: []string{risk.RULE_MAX_POSITION}})
+	rule := risk.RULE_PRICE_BAND
+	ks.SetCheck(trade.PreTradeCheckFunc(func(ctx context.Context, op string, args []map[string]interface{}) error {
+		return &risk.Error{Rule: rule, InstId: "BTC-USDT"}
+	}))
+	_, ok := risk.IsRiskError(ks.CheckOrders(ctx, trade.OP_ORDER, args))
+	assert.True(t, ok)
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, ks.Status().Tripped)
+	rule = risk.RULE_MAX_POSITION
+	ks.CheckOrders(ctx, trade.OP_ORDER, args)
+	assert.Eventually(t, func() bool { return ks.Status().Source == SOURCE_RISK }, time.Second, 5*time.Millisecond)
+
+	// 连续错误
+	ks = New(Config{MaxErrors: 3, ErrorWindow: time.Minute})
+	ks.ReportError(nil)
+	ks.ReportError(errors.New("e1"))
+	ks.ReportError(errors.New("e2"))
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, ks.Status().Tripped)
+	ks.ReportError(errors.New("e3"))
+	assert.Eventually(t, func() bool { return ks.Status().Source == SOURCE_ERRORS }, time.Second, 5*time.Millisecond)
+
+	// 文件
+	dir, err := ioutil.TempDir("", "killswitch")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "KILL")
+	ks = New(Config{})
+	go ks.WatchFile(ctx, path, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, ks.Status().Tripped)
+	assert.Nil(t, ioutil.WriteFile(path, []byte("运维停机\n"), 0644))
+	assert.Eventually(t, func() bool { return ks.Status().Tripped }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, Status{Tripped: true, Source: SOURCE_FILE, Reason: "运维停机", Time: ks.Status().Time}, ks.Status())
+}
+
+func TestRestTarget(t *testing.T) {
+	var lock sync.Mutex
+	var paths []string
+	var placed []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		var data interface{}
+		switch r.URL.Path {
+		case trade.URI_ORDERS_PENDING:
+			data = []wImpl.OrderUpdate{{InstId: "BTC-USDT", OrdId: "1"}, {InstId: "ETH-USDT", OrdId: "2"}}
+		case trade.URI_BATCH_CANCEL_ORDERS:
+			// 订单2已撤销
+			data = []map[string]string{{"ordId": "1", "sCode": "0"}, {"ordId": "2", "sCode": "51401"}}
+		case rest.URI_ACCOUNT_POSITIONS:
+			data = []wImpl.PositionDetail{
+				{InstId: "BTC-USDT-SWAP", MgnMode: trade.TD_MODE_CROSS, PosSide: trade.POS_SIDE_NET, Pos: "-3"},
+				{InstId: "ETH-USDT-SWAP", MgnMode: trade.TD_MODE_ISOLATED, PosSide: trade.POS_SIDE_LONG, Pos: "2"},
+				{InstId: "LTC-USDT-SWAP", MgnMode: trade.TD_MODE_CROSS, PosSide: trade.POS_SIDE_NET, Pos: "0"},
+			}
+		case trade.URI_BATCH_ORDERS:
+			json.NewDecoder(r.Body).Decode(&placed)
+			var res []map[string]string
+			for i := range placed {
+				res = append(res, map[string]string{"ordId": string(rune('a' + i)), "sCode": "0"})
+			}
+			data = res
+		}
+		raw, _ := json.Marshal(map[string]interface{}{"code": "0", "msg": "", "data": data})
+		w.Write(raw)
+	}))
+	defer srv.Close()
+
+	cli := rest.NewRESTClient(srv.URL, &rest.APIKeyInfo{ApiKey: "k", SecKey: "s", PassPhrase: "p"}, true)
+	ks := New(Config{Flatten: true})
+	ks.AddTarget(RestTarget(cli, ""))
+	cli.SetPreTradeCheck(ks)
+
+	assert.Nil(t, ks.Trip(context.Background(), SOURCE_MANUAL, "停止交易"))
+	assert.Equal(t, []string{
+		"GET " + trade.URI_ORDERS_PENDING,
+		"POST " + trade.URI_BATCH_CANCEL_ORDERS,
+		"GET " + rest.URI_ACCOUNT_POSITIONS,
+		"POST " + trade.URI_BATCH_ORDERS,
+	}, paths)
+	assert.Equal(t, 2, len(placed))
+	assert.Equal(t, "BTC-USDT-SWAP", placed[0]["instId"])
+	assert.Equal(t, trade.SIDE_BUY, placed[0]["side"])
+	assert.Equal(t, "3", placed[0]["sz"])
+	assert.Equal(t, true, placed[0]["reduceOnly"])
+	assert.Equal(t, trade.SIDE_SELL, placed[1]["side"])
+	assert.Equal(t, trade.POS_SIDE_LONG, placed[1]["posSide"])
+	assert.Equal(t, trade.ORD_TYPE_MARKET, placed[1]["ordType"])
+
+	// 熔断后客户端的下单请求不再发送
+	_, _, err := cli.PlaceOrders(context.Background(), trade.PlaceOrderReq{InstId: "BTC-USDT", TdMode: trade.TD_MODE_CASH, Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_LIMIT, Px: "1", Sz: "1"})
+	assert.True(t, errors.Is(err, ErrTripped))
+	_, _, err = cli.PlaceOrders(trade.SkipPreTradeCheck(context.Background()), trade.PlaceOrderReq{InstId: "BTC-USDT", TdMode: trade.TD_MODE_CASH, Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_LIMIT, Px: "1", Sz: "1"})
+	assert.True(t, errors.Is(err, ErrTripped))
+	assert.Equal(t, 4, len(paths))
+}
@@ -0,0 +1,216 @@
+package killswitch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"v5sdk_go/rest"
+	"v5sdk_go/trade"
+	"v5sdk_go/ws"
+	"v5sdk_go/ws/wImpl"
+)
+
+// 订单已撤销或已完成，撤单失败时忽略
+var finishedCodes = map[string]bool{
+	"51400": true,
+	"51401": true,
+	"51402": true,
+}
+
+/*
+	批量撤单的范围，mass-cancel 目前仅支持期权
+*/
+type Scope struct {
+	InstType   string
+	InstFamily string
+}
+
+/*
+	未成交订单来源，如 oms.RestGateway
+*/
+type OrderSource interface {
+	PendingOrders(ctx context.Context) ([]wImpl.OrderUpdate, error)
+}
+
+/*
+	持仓来源，如 portfolio.RestSource
+*/
+type PositionSource interface {
+	Positions(ctx context.Context) ([]wImpl.PositionDetail, error)
+}
+
+type target struct {
+	scopes     []Scope
+	massCancel func(ctx context.Context, s Scope) error
+	orders     OrderSource
+	positions  PositionSource
+	cancel     func(ctx context.Context, orders []trade.CancelOrderReq) (trade.BatchResult, error)
+	place      func(ctx context.Context, orders []trade.PlaceOrderReq) (trade.BatchResult, error)
+}
+
+/*
+	使用 REST 接口撤单和平仓
+	instType: 撤单和平仓的产品类型，为空时为全部
+	scopes: 先按范围 mass-cancel，再逐个撤销剩余的挂单
+*/
+func RestTarget(cli *rest.RESTAPI, instType string, scopes ...Scope) Target {
+	return &target{
+		scopes: scopes,
+		massCancel: func(ctx context.Context, s Scope) error {
+			c := *cli
+			_, err := c.MassCancel(ctx, s.InstType, s.InstFamily)
+			return err
+		},
+		orders:    restOrders{cli, instType},
+		positions: restPositions{cli, instType},
+		cancel: func(ctx context.Context, orders []trade.CancelOrderReq) (trade.BatchResult, error) {
+			return cli.CancelOrdersChunked(ctx, trade.BatchOptions{}, orders...)
+		},
+		place: func(ctx context.Context, orders []trade.PlaceOrderReq) (trade.BatchResult, error) {
+			return cli.PlaceOrdersChunked(ctx, trade.BatchOptions{}, orders...)
+		},
+	}
+}
+
+/*
+	使用 WebSocket 撤单和平仓，需先登录
+	orders: 需撤销的挂单来源，为空时只按范围 mass-cancel
+	positions: 需平仓的持仓来源，为空时不平仓
+*/
+func WsTarget(cli *ws.WsClient, orders OrderSource, positions PositionSource, scopes ...Scope) Target {
+	return &target{
+		scopes: scopes,
+		massCancel: func(ctx context.Context, s Scope) error {
+			res, _, err := cli.MassCancelCtx(ctx, "", s.InstType, s.InstFamily)
+			if err == nil && !res {
+				err = errors.New("批量撤单失败")
+			}
+			return err
+		},
+		orders:    orders,
+		positions: positions,
+		cancel: func(ctx context.Context, orders []trade.CancelOrderReq) (trade.BatchResult, error) {
+			return cli.CancelOrdersChunkedCtx(ctx, trade.BatchOptions{}, orders...)
+		},
+		place: func(ctx context.Context, orders []trade.PlaceOrderReq) (trade.BatchResult, error) {
+			return cli.PlaceOrdersChunkedCtx(ctx, trade.BatchOptions{}, orders...)
+		},
+	}
+}
+
+func (t *target) CancelAll(ctx context.Context) error {
+	var errs []string
+	for _, s := range t.scopes {
+		if err := t.massCancel(ctx, s); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s: %v", s.InstType, s.InstFamily, err))
+		}
+	}
+
+	if t.orders != nil {
+		pending, err := t.orders.PendingOrders(ctx)
+		if err != nil {
+			errs = append(errs, "查询挂单失败: "+err.Error())
+		} else if len(pending) != 0 {
+			reqs := make([]trade.CancelOrderReq, 0, len(pending))
+			for _, o := range pending {
+				reqs = append(reqs, trade.CancelOrderReq{InstId: o.InstId, OrdId: o.OrdId})
+			}
+			res, err := t.cancel(ctx, reqs)
+			if err != nil {
+				errs = append(errs, err.Error())
+			} else if n := failed(res); n != 0 {
+				errs = append(errs, fmt.Sprintf("%d个订单撤单失败", n))
+			}
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (t *target) Flatten(ctx context.Context) error {
+	if t.positions == nil {
+		return nil
+	}
+	positions, err := t.positions.Positions(ctx)
+	if err != nil {
+		return errors.New("查询持仓失败: " + err.Error())
+	}
+	orders := CloseOrders(positions)
+	if len(orders) == 0 {
+		return nil
+	}
+	res, err := t.place(ctx, orders)
+	if err != nil {
+		return err
+	}
+	if n := failed(res); n != 0 {
+		return fmt.Errorf("%d个平仓订单失败", n)
+	}
+	return nil
+}
+
+func failed(res trade.BatchResult) (n int) {
+	for _, k := range res.Failed() {
+		if o := res[k]; o.Err != nil || !finishedCodes[o.SCode] {
+			n++
+		}
+	}
+	return
+}
+
+/*
+	生成市价平仓的订单，空仓忽略
+	买卖模式下为只减仓订单，开平仓模式下按持仓方向平仓
+*/
+func CloseOrders(positions []wImpl.PositionDetail) (orders []trade.PlaceOrderReq) {
+	for _, p := range positions {
+		pos, err := strconv.ParseFloat(p.Pos, 64)
+		if err != nil || pos == 0 {
+			continue
+		}
+		o := trade.PlaceOrderReq{
+			InstId:  p.InstId,
+			TdMode:  p.MgnMode,
+			PosSide: p.PosSide,
+			OrdType: trade.ORD_TYPE_MARKET,
+			Sz:      strings.TrimPrefix(p.Pos, "-"),
+		}
+		switch {
+		case p.PosSide == trade.POS_SIDE_LONG:
+			o.Side = trade.SIDE_SELL
+		case p.PosSide == trade.POS_SIDE_SHORT:
+			o.Side = trade.SIDE_BUY
+		case pos > 0:
+			o.Side, o.ReduceOnly = trade.SIDE_SELL, true
+		default:
+			o.Side, o.ReduceOnly = trade.SIDE_BUY, true
+		}
+		orders = append(orders, o)
+	}
+	return
+}
+
+type restOrders struct {
+	cli      *rest.RESTAPI
+	instType string
+}
+
+func (s restOrders) PendingOrders(ctx context.Context) ([]wImpl.OrderUpdate, error) {
+	cli := *s.cli
+	return cli.PendingOrders(ctx, s.instType, "")
+}
+
+type restPositions struct {
+	cli      *rest.RESTAPI
+	instType string
+}
+
+func (s restPositions) Positions(ctx context.Context) ([]wImpl.PositionDetail, error) {
+	cli := *s.cli
+	return cli.Positions(ctx, s.instType, "")
+}
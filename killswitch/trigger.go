@@ -0,0 +1,55 @@
+package killswitch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+/*
+	定时检查文件，文件存在时触发熔断，文件内容作为触发原因
+	删除文件后需调用 Reset 恢复交易，ctx 结束时停止检查
+	例如:
+	go ks.WatchFile(ctx, "/var/run/bot/KILL", time.Second)
+*/
+func (c *Controller) WatchFile(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := os.Stat(path); err == nil && !c.Status().Tripped {
+			reason := path
+			if b, err := ioutil.ReadFile(path); err == nil && len(strings.TrimSpace(string(b))) != 0 {
+				reason = strings.TrimSpace(string(b))
+			}
+			c.tripAsync(SOURCE_FILE, reason)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+/*
+	收到信号时触发熔断，ctx 结束时停止监听
+	例如:
+	go ks.WatchSignal(ctx, syscall.SIGUSR1)
+*/
+func (c *Controller) WatchSignal(ctx context.Context, sigs ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-ch:
+			c.tripAsync(SOURCE_SIGNAL, "收到信号:"+sig.String())
+		}
+	}
+}
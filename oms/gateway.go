@@ -0,0 +1,96 @@
+package oms
+
+import (
+	"context"
+	"v5sdk_go/rest"
+	"v5sdk_go/trade"
+	"v5sdk_go/ws"
+	"v5sdk_go/ws/wImpl"
+)
+
+/*
+	使用 websocket 发送交易请求，每次最多 trade.BATCH_MAX 个订单
+*/
+type WsGateway struct {
+	cli *ws.WsClient
+}
+
+func NewWsGateway(cli *ws.WsClient) *WsGateway {
+	return &WsGateway{cli: cli}
+}
+
+func (g *WsGateway) PlaceOrders(ctx context.Context, orders ...trade.PlaceOrderReq) ([]trade.OrderResult, error) {
+	_, detail, err := g.cli.PlaceOrdersCtx(ctx, "", orders...)
+	return wsResults(detail, len(orders), err)
+}
+
+func (g *WsGateway) CancelOrders(ctx context.Context, orders ...trade.CancelOrderReq) ([]trade.OrderResult, error) {
+	_, detail, err := g.cli.CancelOrdersCtx(ctx, "", orders...)
+	return wsResults(detail, len(orders), err)
+}
+
+func (g *WsGateway) AmendOrders(ctx context.Context, orders ...trade.AmendOrderReq) ([]trade.OrderResult, error) {
+	_, detail, err := g.cli.AmendOrdersCtx(ctx, "", orders...)
+	return wsResults(detail, len(orders), err)
+}
+
+/*
+	部分订单失败时请求返回错误，但仍有各订单的处理结果
+*/
+func wsResults(detail *ws.ProcessDetail, n int, err error) ([]trade.OrderResult, error) {
+	if detail != nil && len(detail.Orders) == n {
+		return detail.Orders, nil
+	}
+	if err == nil {
+		err = ErrResultMissing
+	}
+	return nil, err
+}
+
+/*
+	使用 REST 接口发送交易请求，同时可作为对账数据来源
+	instType: 对账时查询的产品类型，为空时查询全部
+*/
+type RestGateway struct {
+	cli      *rest.RESTAPI
+	instType string
+}
+
+func NewRestGateway(cli *rest.RESTAPI, instType string) *RestGateway {
+	return &RestGateway{cli: cli, instType: instType}
+}
+
+/*
+	RESTAPI 会保存每次请求的参数，并发调用时各请求使用副本
+*/
+func (g *RestGateway) client() *rest.RESTAPI {
+	cli := *g.cli
+	return &cli
+}
+
+func (g *RestGateway) PlaceOrders(ctx context.Context, orders ...trade.PlaceOrderReq) ([]trade.OrderResult, error) {
+	_, results, err := g.client().PlaceOrders(ctx, orders...)
+	return results, err
+}
+
+func (g *RestGateway) CancelOrders(ctx context.Context, orders ...trade.CancelOrderReq) ([]trade.OrderResult, error) {
+	_, results, err := g.client().CancelOrders(ctx, orders...)
+	return results, err
+}
+
+func (g *RestGateway) AmendOrders(ctx context.Context, orders ...trade.AmendOrderReq) ([]trade.OrderResult, error) {
+	_, results, err := g.client().AmendOrders(ctx, orders...)
+	return results, err
+}
+
+func (g *RestGateway) PendingOrders(ctx context.Context) ([]wImpl.OrderUpdate, error) {
+	return g.client().PendingOrders(ctx, g.instType, "")
+}
+
+func (g *RestGateway) GetOrder(ctx context.Context, instId, ordId, clOrdId string) (wImpl.OrderUpdate, error) {
+	order, err := g.client().GetOrder(ctx, instId, ordId, clOrdId)
+	if err == rest.ErrOrderNotFound {
+		err = ErrNotFound
+	}
+	return order, err
+}
@@ -0,0 +1,693 @@
+/*
+	客户端订单管理，跟踪每个订单的生命周期
+	订单状态由下单/改单/撤单的返回结果、orders 频道的推送以及 REST 对账共同维护
+*/
+package oms
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"v5sdk_go/trade"
+	"v5sdk_go/utils"
+	"v5sdk_go/ws/wImpl"
+)
+
+// 订单状态
+const (
+	STATE_PENDING          = "pending"   // 已发送，尚未确认
+	STATE_CANCELING        = "canceling" // 撤单请求已受理，等待交易所确认
+	STATE_LIVE             = wImpl.ORDER_STATE_LIVE
+	STATE_PARTIALLY_FILLED = wImpl.ORDER_STATE_PARTIALLY_FILLED
+	STATE_FILLED           = wImpl.ORDER_STATE_FILLED
+	STATE_CANCELED         = wImpl.ORDER_STATE_CANCELED
+	STATE_MMP_CANCELED     = wImpl.ORDER_STATE_MMP_CANCELED
+	STATE_REJECTED         = "rejected" // 交易所拒绝
+)
+
+/*
+	订单快照
+	Code/Msg: 被拒绝或查询失败的原因
+	Amends: 改单成功的次数
+*/
+type Order struct {
+	InstId    string
+	OrdId     string
+	ClOrdId   string
+	Tag       string
+	Side      string
+	PosSide   string
+	OrdType   string
+	TdMode    string
+	Px        string
+	Sz        string
+	AccFillSz string
+	AvgPx     string
+	State     string
+	Code      string
+	Msg       string
+	Amends    int
+	CTime     time.Time
+	UTime     time.Time
+}
+
+/*
+	订单是否已处于终态
+*/
+func (o Order) IsFinal() bool {
+	switch o.State {
+	case STATE_FILLED, STATE_CANCELED, STATE_MMP_CANCELED, STATE_REJECTED:
+		return true
+	}
+	return false
+}
+
+/*
+	订单是否仍在挂单或等待确认
+*/
+func (o Order) IsOpen() bool {
+	return !o.IsFinal()
+}
+
+// 成交明细
+type Fill struct {
+	TradeId string
+	FillPx  string
+	FillSz  string
+	Fee     string
+	FeeCcy  string
+	// 流动性方向 T:taker M:maker
+	ExecType string
+	Time     time.Time
+}
+
+type EventType int
+
+const (
+	EVENT_STATE   EventType = iota // 状态变化
+	EVENT_FILL                     // 成交
+	EVENT_AMENDED                  // 改单成功
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EVENT_STATE:
+		return "state"
+	case EVENT_FILL:
+		return "fill"
+	case EVENT_AMENDED:
+		return "amended"
+	}
+	return "unknown"
+}
+
+/*
+	订单事件
+	Order: 事件发生后的订单快照
+	PrevState: 状态变化前的状态，仅 EVENT_STATE 有效
+	Fill: 成交明细，仅 EVENT_FILL 有效
+*/
+type Event struct {
+	Type      EventType
+	Order     Order
+	PrevState string
+	Fill      *Fill
+}
+
+// 订单事件回调函数
+type EventCallback func(Event)
+
+/*
+	发送交易请求的通道，返回的结果需与请求顺序一致
+	请求整体失败(超时、网络错误等)且没有各订单结果时返回 err
+*/
+type Gateway interface {
+	PlaceOrders(ctx context.Context, orders ...trade.PlaceOrderReq) ([]trade.OrderResult, error)
+	CancelOrders(ctx context.Context, orders ...trade.CancelOrderReq) ([]trade.OrderResult, error)
+	AmendOrders(ctx context.Context, orders ...trade.AmendOrderReq) ([]trade.OrderResult, error)
+}
+
+/*
+	对账数据来源
+	GetOrder 在订单不存在时返回 ErrNotFound
+*/
+type Source interface {
+	PendingOrders(ctx context.Context) ([]wImpl.OrderUpdate, error)
+	GetOrder(ctx context.Context, instId, ordId, clOrdId string) (wImpl.OrderUpdate, error)
+}
+
+var (
+	ErrNotFound      = errors.New("订单不存在")
+	ErrResultMissing = errors.New("返回结果数量与订单数量不一致")
+)
+
+type entry struct {
+	order Order
+	// 已处理的成交ID，避免重复推送产生重复的成交事件
+	trades map[string]bool
+	// 交易所最近一次更新的时间，用于丢弃过期的推送
+	exTime time.Time
+	// 状态由本地推断而非交易所返回，之后交易所的结果仍可覆盖
+	guessed bool
+}
+
+type OMS struct {
+	gw Gateway
+
+	lock    sync.RWMutex
+	orders  map[string]*entry // key 为 clOrdId，外部下单且无 clOrdId 时为 ordId
+	byOrdId map[string]string // ordId -> key
+	hooks   []EventCallback
+}
+
+/*
+	创建订单管理
+	gw: 交易通道，见 NewWsGateway、NewRestGateway，只接收推送和对账时可为空
+	例如:
+	m := oms.New(oms.NewWsGateway(cli))
+	cli.AddOrderHook(m.OnOrderUpdate)
+	m.AddEventHook(func(e oms.Event) { fmt.Println(e.Type, e.Order.ClOrdId, e.Order.State) })
+	m.PlaceOrders(ctx, trade.PlaceOrderReq{...})
+*/
+func New(gw Gateway) *OMS {
+	return &OMS{
+		gw:      gw,
+		orders:  make(map[string]*entry),
+		byOrdId: make(map[string]string),
+	}
+}
+
+/*
+	添加订单事件的回调函数，回调函数在触发事件的协程中同步执行
+*/
+func (m *OMS) AddEventHook(fn EventCallback) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.hooks = append(m.hooks, fn)
+}
+
+/*
+	下单，未指定 clOrdId 的订单自动生成，订单在发送前即开始跟踪
+	请求未发送即被拒绝(trade.IsRejected)时订单标记为被拒绝，结果未知时保持 pending
+	results: 各订单的处理结果，顺序与请求一致
+*/
+func (m *OMS) PlaceOrders(ctx context.Context, orders ...trade.PlaceOrderReq) (results []trade.OrderResult, err error) {
+	if m.gw == nil {
+		err = errors.New("未设置交易通道")
+		return
+	}
+	orders = trade.FillClOrdIds(orders)
+	if _, err = trade.BatchKeys(trade.PlaceOrders(orders)); err != nil {
+		return
+	}
+
+	m.lock.Lock()
+	for _, o := range orders {
+		if _, ok := m.orders[o.ClOrdId]; ok {
+			m.lock.Unlock()
+			err = errors.New("clOrdId重复:" + o.ClOrdId)
+			return
+		}
+	}
+	now := time.Now()
+	for _, o := range orders {
+		m.orders[o.ClOrdId] = &entry{
+			order: Order{
+				InstId:  o.InstId,
+				ClOrdId: o.ClOrdId,
+				Tag:     o.Tag,
+				Side:    o.Side,
+				PosSide: o.PosSide,
+				OrdType: o.OrdType,
+				TdMode:  o.TdMode,
+				Px:      o.Px,
+				Sz:      o.Sz,
+				State:   STATE_PENDING,
+				CTime:   now,
+				UTime:   now,
+			},
+			trades: make(map[string]bool),
+		}
+	}
+	m.lock.Unlock()
+
+	results, err = m.gw.PlaceOrders(ctx, orders...)
+	if err == nil && len(results) != len(orders) {
+		err = ErrResultMissing
+	}
+	if trade.IsRejected(err) {
+		// 请求未发送，订单直接标记为被拒绝
+		var evts []Event
+		m.lock.Lock()
+		for _, o := range orders {
+			if e := m.orders[o.ClOrdId]; e != nil && e.order.State == STATE_PENDING {
+				evts = append(evts, m.setState(e, STATE_REJECTED, "", err.Error()))
+			}
+		}
+		m.lock.Unlock()
+		m.emit(evts)
+		return
+	}
+	if err != nil {
+		// 超时、网络错误等结果未知的订单保持 pending，等待推送或对账
+		return
+	}
+
+	var evts []Event
+	m.lock.Lock()
+	for i, r := range results {
+		e := m.orders[orders[i].ClOrdId]
+		if e == nil {
+			continue
+		}
+		if r.Success() {
+			m.bindOrdId(e, r.OrdId)
+			// 推送可能先于返回结果到达，对账可能已将其推断为被拒绝
+			if e.order.State == STATE_PENDING || e.guessed {
+				e.guessed = false
+				evts = append(evts, m.setState(e, STATE_LIVE, "", ""))
+			}
+		} else if e.order.State == STATE_PENDING {
+			evts = append(evts, m.setState(e, STATE_REJECTED, r.SCode, r.SMsg))
+		}
+	}
+	m.lock.Unlock()
+	m.emit(evts)
+	return
+}
+
+/*
+	撤单，撤单请求被受理的订单标记为撤单中
+	最终状态以交易所推送为准，撤单期间仍可能完全成交
+*/
+func (m *OMS) CancelOrders(ctx context.Context, orders ...trade.CancelOrderReq) (results []trade.OrderResult, err error) {
+	if m.gw == nil {
+		err = errors.New("未设置交易通道")
+		return
+	}
+	results, err = m.gw.CancelOrders(ctx, orders...)
+	if err == nil && len(results) != len(orders) {
+		err = ErrResultMissing
+	}
+	if err != nil {
+		return
+	}
+
+	var evts []Event
+	m.lock.Lock()
+	for i, r := range results {
+		if !r.Success() {
+			continue
+		}
+		e := m.find(orders[i].ClOrdId, orders[i].OrdId)
+		if e == nil || e.order.IsFinal() {
+			continue
+		}
+		m.bindOrdId(e, r.OrdId)
+		if e.order.State != STATE_CANCELING {
+			evts = append(evts, m.setState(e, STATE_CANCELING, "", ""))
+		}
+	}
+	m.lock.Unlock()
+	m.emit(evts)
+	return
+}
+
+/*
+	改单，改单成功时更新订单的价格和数量
+*/
+func (m *OMS) AmendOrders(ctx context.Context, orders ...trade.AmendOrderReq) (results []trade.OrderResult, err error) {
+	if m.gw == nil {
+		err = errors.New("未设置交易通道")
+		return
+	}
+	results, err = m.gw.AmendOrders(ctx, orders...)
+	if err == nil && len(results) != len(orders) {
+		err = ErrResultMissing
+	}
+	if err != nil {
+		return
+	}
+
+	var evts []Event
+	m.lock.Lock()
+	for i, r := range results {
+		if !r.Success() {
+			continue
+		}
+		e := m.find(orders[i].ClOrdId, orders[i].OrdId)
+		if e == nil || e.order.IsFinal() {
+			continue
+		}
+		m.bindOrdId(e, r.OrdId)
+		if orders[i].NewPx != "" {
+			e.order.Px = orders[i].NewPx
+		}
+		if orders[i].NewSz != "" {
+			e.order.Sz = orders[i].NewSz
+		}
+		e.order.Amends++
+		e.order.UTime = time.Now()
+		evts = append(evts, Event{Type: EVENT_AMENDED, Order: e.order})
+	}
+	m.lock.Unlock()
+	m.emit(evts)
+	return
+}
+
+/*
+	处理 orders 频道的推送，可直接作为 WsClient 的订单回调函数
+	例如:
+	cli.AddOrderHook(m.OnOrderUpdate)
+*/
+func (m *OMS) OnOrderUpdate(ts time.Time, u wImpl.OrderUpdate) error {
+	m.lock.Lock()
+	evts := m.apply(u)
+	m.lock.Unlock()
+	m.emit(evts)
+	return nil
+}
+
+/*
+	与交易所对账
+	1. 使用未成交订单列表更新订单状态，未跟踪的订单加入跟踪
+	2. 本地未完成但不在列表中的订单逐个查询最新状态
+	3. 查询不到的 pending 订单视为被拒绝，之后收到下单结果或推送时以交易所为准
+	对账开始后才创建的订单不参与对账
+	单个订单查询失败时继续处理其他订单，返回最后一个错误
+*/
+func (m *OMS) Reconcile(ctx context.Context, src Source) (err error) {
+	start := time.Now()
+	pending, err := src.PendingOrders(ctx)
+	if err != nil {
+		return
+	}
+
+	var evts []Event
+	live := make(map[string]bool, len(pending))
+	m.lock.Lock()
+	for _, u := range pending {
+		evts = append(evts, m.apply(u)...)
+		if e := m.find(u.ClOrdId, u.OrdId); e != nil {
+			live[m.keyOf(e)] = true
+		}
+	}
+	var missing []Order
+	for k, e := range m.orders {
+		if !live[k] && e.order.IsOpen() && e.order.CTime.Before(start) {
+			missing = append(missing, e.order)
+		}
+	}
+	m.lock.Unlock()
+	m.emit(evts)
+
+	for _, o := range missing {
+		u, qErr := src.GetOrder(ctx, o.InstId, o.OrdId, o.ClOrdId)
+		evts = nil
+		m.lock.Lock()
+		e := m.find(o.ClOrdId, o.OrdId)
+		switch {
+		case e == nil:
+		case qErr == nil:
+			evts = m.apply(u)
+		case qErr == ErrNotFound && e.order.State == STATE_PENDING:
+			e.guessed = true
+			evts = append(evts, m.setState(e, STATE_REJECTED, "", qErr.Error()))
+		default:
+			err = qErr
+		}
+		m.lock.Unlock()
+		m.emit(evts)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return
+}
+
+/*
+	按 clOrdId 获取订单
+*/
+func (m *OMS) Get(clOrdId string) (o Order, ok bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	e, ok := m.orders[clOrdId]
+	if ok {
+		o = e.order
+	}
+	return
+}
+
+/*
+	按 ordId 获取订单
+*/
+func (m *OMS) GetByOrdId(ordId string) (o Order, ok bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	e := m.find("", ordId)
+	if e != nil {
+		o, ok = e.order, true
+	}
+	return
+}
+
+/*
+	获取未完成的订单，按创建时间排序
+	instId: 产品ID，为空时返回全部
+*/
+func (m *OMS) OpenOrders(instId string) []Order {
+	return m.filter(func(o Order) bool {
+		return o.IsOpen() && (instId == "" || o.InstId == instId)
+	})
+}
+
+/*
+	获取全部订单，按创建时间排序
+*/
+func (m *OMS) Orders() []Order {
+	return m.filter(func(Order) bool { return true })
+}
+
+/*
+	清除创建时间早于 before 的已完成订单，返回清除的数量
+*/
+func (m *OMS) Prune(before time.Time) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	n := 0
+	for k, e := range m.orders {
+		if e.order.IsFinal() && e.order.CTime.Before(before) {
+			delete(m.orders, k)
+			if e.order.OrdId != "" {
+				delete(m.byOrdId, e.order.OrdId)
+			}
+			n++
+		}
+	}
+	return n
+}
+
+func (m *OMS) filter(fn func(Order) bool) []Order {
+	m.lock.RLock()
+	res := make([]Order, 0)
+	for _, e := range m.orders {
+		if fn(e.order) {
+			res = append(res, e.order)
+		}
+	}
+	m.lock.RUnlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CTime.Before(res[j].CTime)
+	})
+	return res
+}
+
+/*
+	按 clOrdId 或 ordId 查找订单，调用方需持有 m.lock
+*/
+func (m *OMS) find(clOrdId, ordId string) *entry {
+	if clOrdId != "" {
+		if e, ok := m.orders[clOrdId]; ok {
+			return e
+		}
+	}
+	if ordId != "" {
+		if k, ok := m.byOrdId[ordId]; ok {
+			return m.orders[k]
+		}
+	}
+	return nil
+}
+
+func (m *OMS) keyOf(e *entry) string {
+	if e.order.ClOrdId != "" {
+		return e.order.ClOrdId
+	}
+	return e.order.OrdId
+}
+
+func (m *OMS) bindOrdId(e *entry, ordId string) {
+	if ordId == "" || e.order.OrdId == ordId {
+		return
+	}
+	e.order.OrdId = ordId
+	m.byOrdId[ordId] = m.keyOf(e)
+}
+
+func (m *OMS) setState(e *entry, state, code, msg string) Event {
+	prev := e.order.State
+	e.order.State = state
+	if code != "" || msg != "" {
+		e.order.Code = code
+		e.order.Msg = msg
+	}
+	e.order.UTime = time.Now()
+	return Event{Type: EVENT_STATE, Order: e.order, PrevState: prev}
+}
+
+/*
+	用推送或查询得到的订单信息更新订单，调用方需持有 m.lock
+	交易所确认的终态不再改变，但仍记录迟到的成交
+	撤单中的订单只接受交易所的终态
+*/
+func (m *OMS) apply(u wImpl.OrderUpdate) (evts []Event) {
+	if u.OrdId == "" && u.ClOrdId == "" {
+		return
+	}
+	uTime := utils.MsTime(u.UTime)
+
+	e := m.find(u.ClOrdId, u.OrdId)
+	if e == nil {
+		cTime := utils.MsTime(u.CTime)
+		if cTime.IsZero() {
+			cTime = time.Now()
+		}
+		e = &entry{
+			order: Order{
+				ClOrdId: u.ClOrdId,
+				State:   STATE_PENDING,
+				CTime:   cTime,
+			},
+			trades: make(map[string]bool),
+		}
+		m.orders[m.keyOfUpdate(u)] = e
+	} else if uTime.Before(e.exTime) && !u.IsFill() {
+		// 过期的推送
+		return
+	}
+	m.bindOrdId(e, u.OrdId)
+	if uTime.After(e.exTime) {
+		e.exTime = uTime
+	}
+
+	o := &e.order
+	o.InstId = u.InstId
+	utils.SetNonEmpty(&o.Tag, u.Tag)
+	utils.SetNonEmpty(&o.Side, u.Side)
+	utils.SetNonEmpty(&o.PosSide, u.PosSide)
+	utils.SetNonEmpty(&o.OrdType, u.OrdType)
+	utils.SetNonEmpty(&o.TdMode, u.TdMode)
+	if greater(u.AccFillSz, o.AccFillSz) {
+		o.AccFillSz = u.AccFillSz
+		utils.SetNonEmpty(&o.AvgPx, u.AvgPx)
+	}
+	o.UTime = time.Now()
+	if !uTime.IsZero() {
+		o.UTime = uTime
+	}
+
+	if u.IsFill() && !e.trades[u.TradeId] {
+		e.trades[u.TradeId] = true
+		evts = append(evts, Event{
+			Type:  EVENT_FILL,
+			Order: *o,
+			Fill: &Fill{
+				TradeId:  u.TradeId,
+				FillPx:   u.FillPx,
+				FillSz:   u.FillSz,
+				Fee:      u.FillFee,
+				FeeCcy:   u.FillFeeCcy,
+				ExecType: u.ExecType,
+				Time:     utils.MsTime(u.FillTime),
+			},
+		})
+	}
+
+	if o.IsFinal() && !e.guessed {
+		return
+	}
+
+	// 价格或数量变化视为改单成功
+	if differ(u.Px, o.Px) || differ(u.Sz, o.Sz) {
+		utils.SetNonEmpty(&o.Px, u.Px)
+		utils.SetNonEmpty(&o.Sz, u.Sz)
+		o.Amends++
+		evts = append(evts, Event{Type: EVENT_AMENDED, Order: *o})
+	} else {
+		utils.SetNonEmpty(&o.Px, u.Px)
+		utils.SetNonEmpty(&o.Sz, u.Sz)
+	}
+
+	if u.State == "" {
+		return
+	}
+	e.guessed = false
+	if o.State == STATE_CANCELING && (u.State == STATE_LIVE || u.State == STATE_PARTIALLY_FILLED) {
+		return
+	}
+	if u.State != o.State {
+		prev := o.State
+		o.State = u.State
+		evts = append(evts, Event{Type: EVENT_STATE, Order: *o, PrevState: prev})
+	}
+	return
+}
+
+func (m *OMS) keyOfUpdate(u wImpl.OrderUpdate) string {
+	if u.ClOrdId != "" {
+		return u.ClOrdId
+	}
+	return u.OrdId
+}
+
+func (m *OMS) emit(evts []Event) {
+	if len(evts) == 0 {
+		return
+	}
+	m.lock.RLock()
+	hooks := m.hooks
+	m.lock.RUnlock()
+	for _, evt := range evts {
+		for _, fn := range hooks {
+			fn(evt)
+		}
+	}
+}
+
+func greater(a, b string) bool {
+	fa, err := strconv.ParseFloat(a, 64)
+	if err != nil {
+		return false
+	}
+	fb, _ := strconv.ParseFloat(b, 64)
+	return fa > fb
+}
+
+/*
+	两个数值是否不同，任一为空时视为相同
+*/
+func differ(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA != nil || errB != nil {
+		return a != b
+	}
+	return fa != fb
+}
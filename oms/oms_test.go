@@ -0,0 +1,304 @@
+package oms
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+	"v5sdk_go/trade"
+	"v5sdk_go/ws/wImpl"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeGateway struct {
+	// 下单时返回的错误码，key 为 clOrdId
+	reject map[string]string
+	err    error
+	seq    int
+	// 下单请求发出后、返回结果前调用
+	inFlight func()
+}
+
+func (g *fakeGateway) PlaceOrders(ctx context.Context, orders ...trade.PlaceOrderReq) (res []trade.OrderResult, err error) {
+	if g.inFlight != nil {
+		g.inFlight()
+	}
+	if g.err != nil {
+		return nil, g.err
+	}
+	for _, o := range orders {
+		g.seq++
+		r := trade.OrderResult{ClOrdId: o.ClOrdId, SCode: "0"}
+		if code, ok := g.reject[o.ClOrdId]; ok {
+			r.SCode, r.SMsg = code, "rejected"
+		} else {
+			r.OrdId = strconv.Itoa(g.seq)
+		}
+		res = append(res, r)
+	}
+	return
+}
+
+func (g *fakeGateway) CancelOrders(ctx context.Context, orders ...trade.CancelOrderReq) (res []trade.OrderResult, err error) {
+	for _, o := range orders {
+		res = append(res, trade.OrderResult{OrdId: o.OrdId, ClOrdId: o.ClOrdId, SCode: "0"})
+	}
+	return
+}
+
+func (g *fakeGateway) AmendOrders(ctx context.Context, orders ...trade.AmendOrderReq) (res []trade.OrderResult, err error) {
+	for _, o := range orders {
+		res = append(res, trade.OrderResult{OrdId: o.OrdId, ClOrdId: o.ClOrdId, SCode: "0"})
+	}
+	return
+}
+
+type fakeSource struct {
+	pending []wImpl.OrderUpdate
+	orders  map[string]wImpl.OrderUpdate
+	// 查询未成交订单列表时调用
+	onPending func()
+	queried   []string
+}
+
+func (s *fakeSource) PendingOrders(ctx context.Context) ([]wImpl.OrderUpdate, error) {
+	if s.onPending != nil {
+		s.onPending()
+	}
+	return s.pending, nil
+}
+
+func (s *fakeSource) GetOrder(ctx context.Context, instId, ordId, clOrdId string) (wImpl.OrderUpdate, error) {
+	s.queried = append(s.queried, clOrdId)
+	if u, ok := s.orders[clOrdId]; ok {
+		return u, nil
+	}
+	return wImpl.OrderUpdate{}, ErrNotFound
+}
+
+func limitOrder(clOrdId string) trade.PlaceOrderReq {
+	return trade.PlaceOrderReq{InstId: "BTC-USDT", TdMode: trade.TD_MODE_CASH, Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_LIMIT, Px: "100", Sz: "2", ClOrdId: clOrdId}
+}
+
+func TestOrderLifecycle(t *testing.T) {
+	gw := &fakeGateway{reject: map[string]string{"r1": "51008"}}
+	m := New(gw)
+	var evts []Event
+	m.AddEventHook(func(e Event) {
+		evts = append(evts, e)
+	})
+	ctx := context.Background()
+
+	results, err := m.PlaceOrders(ctx, limitOrder("a1"), limitOrder("r1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+	o, ok := m.Get("a1")
+	assert.True(t, ok)
+	assert.Equal(t, STATE_LIVE, o.State)
+	o, _ = m.Get("r1")
+	assert.Equal(t, STATE_REJECTED, o.State)
+	assert.Equal(t, "51008", o.Code)
+	assert.Equal(t, 2, len(evts))
+
+	// clOrdId 重复
+	_, err = m.PlaceOrders(ctx, limitOrder("a1"))
+	assert.NotNil(t, err)
+
+	// 部分成交，重复推送只产生一次成交事件
+	ordId := results[0].OrdId
+	u := wImpl.OrderUpdate{InstId: "BTC-USDT", OrdId: ordId, ClOrdId: "a1", Px: "100", Sz: "2", State: STATE_PARTIALLY_FILLED,
+		TradeId: "t1", FillPx: "100", FillSz: "1", AccFillSz: "1", AvgPx: "100", UTime: "1700000000000"}
+	evts = nil
+	m.OnOrderUpdate(time.Now(), u)
+	m.OnOrderUpdate(time.Now(), u)
+	assert.Equal(t, 2, len(evts))
+	assert.Equal(t, EVENT_FILL, evts[0].Type)
+	assert.Equal(t, "1", evts[0].Fill.FillSz)
+	assert.Equal(t, EVENT_STATE, evts[1].Type)
+	assert.Equal(t, STATE_LIVE, evts[1].PrevState)
+
+	// 过期的推送
+	evts = nil
+	stale := u
+	stale.TradeId, stale.FillSz, stale.State, stale.UTime = "", "", STATE_LIVE, "1690000000000"
+	m.OnOrderUpdate(time.Now(), stale)
+	assert.Equal(t, 0, len(evts))
+
+	// 改单
+	_, err = m.AmendOrders(ctx, trade.AmendOrderReq{InstId: "BTC-USDT", ClOrdId: "a1", NewPx: "101"})
+	assert.Nil(t, err)
+	o, _ = m.GetByOrdId(ordId)
+	assert.Equal(t, "101", o.Px)
+	assert.Equal(t, 1, o.Amends)
+	assert.Equal(t, EVENT_AMENDED, evts[0].Type)
+
+	// 推送的价格与改单结果一致时不再产生改单事件
+	evts = nil
+	u.TradeId, u.FillSz, u.Px, u.UTime = "", "", "101.0", "1700000001000"
+	m.OnOrderUpdate(time.Now(), u)
+	assert.Equal(t, 0, len(evts))
+
+	assert.Equal(t, 1, len(m.OpenOrders("BTC-USDT")))
+	assert.Equal(t, 0, len(m.OpenOrders("ETH-USDT")))
+
+	// 撤单受理后等待交易所确认
+	_, err = m.CancelOrders(ctx, trade.CancelOrderReq{InstId: "BTC-USDT", OrdId: ordId})
+	assert.Nil(t, err)
+	o, _ = m.Get("a1")
+	assert.Equal(t, STATE_CANCELING, o.State)
+	assert.Equal(t, 1, len(m.OpenOrders("")))
+
+	u.State, u.UTime = STATE_CANCELED, "1700000002000"
+	m.OnOrderUpdate(time.Now(), u)
+	o, _ = m.Get("a1")
+	assert.Equal(t, STATE_CANCELED, o.State)
+	assert.Equal(t, "1", o.AccFillSz)
+	assert.Equal(t, 0, len(m.OpenOrders("")))
+
+	// 终态后迟到的推送不改变状态，但记录迟到的成交
+	evts = nil
+	u.State, u.TradeId, u.FillSz, u.AccFillSz = STATE_PARTIALLY_FILLED, "t2", "0.5", "1.5"
+	m.OnOrderUpdate(time.Now(), u)
+	assert.Equal(t, 1, len(evts))
+	assert.Equal(t, EVENT_FILL, evts[0].Type)
+	o, _ = m.Get("a1")
+	assert.Equal(t, STATE_CANCELED, o.State)
+	assert.Equal(t, "1.5", o.AccFillSz)
+
+	assert.Equal(t, 2, m.Prune(time.Now().Add(time.Second)))
+	assert.Equal(t, 0, len(m.Orders()))
+}
+
+func TestReconcile(t *testing.T) {
+	gw := &fakeGateway{err: errors.New("timeout")}
+	m := New(gw)
+	ctx := context.Background()
+
+	// 请求超时，结果未知
+	_, err := m.PlaceOrders(ctx, limitOrder("p1"), limitOrder("p2"), limitOrder("p3"))
+	assert.NotNil(t, err)
+	o, _ := m.Get("p1")
+	assert.Equal(t, STATE_PENDING, o.State)
+
+	src := &fakeSource{
+		pending: []wImpl.OrderUpdate{
+			{InstId: "BTC-USDT", OrdId: "11", ClOrdId: "p1", State: STATE_LIVE},
+			// 外部下单的订单
+			{InstId: "ETH-USDT", OrdId: "99", State: STATE_LIVE, Px: "10", Sz: "1"},
+		},
+		orders: map[string]wImpl.OrderUpdate{
+			"p2": {InstId: "BTC-USDT", OrdId: "12", ClOrdId: "p2", State: STATE_FILLED, AccFillSz: "2"},
+		},
+	}
+	assert.Nil(t, m.Reconcile(ctx, src))
+
+	o, _ = m.Get("p1")
+	assert.Equal(t, STATE_LIVE, o.State)
+	assert.Equal(t, "11", o.OrdId)
+	o, _ = m.Get("p2")
+	assert.Equal(t, STATE_FILLED, o.State)
+	o, _ = m.Get("p3")
+	assert.Equal(t, STATE_REJECTED, o.State)
+	o, ok := m.GetByOrdId("99")
+	assert.True(t, ok)
+	assert.Equal(t, "ETH-USDT", o.InstId)
+	assert.Equal(t, 2, len(m.OpenOrders("")))
+}
+
+/*
+	请求未发送即被拒绝时订单直接标记为被拒绝
+*/
+func TestPlaceRejected(t *testing.T) {
+	rejected := errors.New("风控拒绝")
+	gw := &fakeGateway{err: trade.Rejected(rejected)}
+	m := New(gw)
+	ctx := context.Background()
+
+	_, err := m.PlaceOrders(ctx, limitOrder("r1"), limitOrder("r2"))
+	assert.True(t, errors.Is(err, rejected))
+	o, _ := m.Get("r1")
+	assert.Equal(t, STATE_REJECTED, o.State)
+	assert.Equal(t, rejected.Error(), o.Msg)
+	o, _ = m.Get("r2")
+	assert.Equal(t, STATE_REJECTED, o.State)
+	assert.Equal(t, 0, len(m.OpenOrders("")))
+}
+
+func TestCancelRace(t *testing.T) {
+	m := New(&fakeGateway{})
+	var evts []Event
+	m.AddEventHook(func(e Event) {
+		evts = append(evts, e)
+	})
+	ctx := context.Background()
+
+	results, err := m.PlaceOrders(ctx, limitOrder("c1"))
+	assert.Nil(t, err)
+	ordId := results[0].OrdId
+	_, err = m.CancelOrders(ctx, trade.CancelOrderReq{InstId: "BTC-USDT", OrdId: ordId})
+	assert.Nil(t, err)
+	o, _ := m.Get("c1")
+	assert.Equal(t, STATE_CANCELING, o.State)
+
+	// 撤单确认前的部分成交不改变撤单中的状态
+	evts = nil
+	u := wImpl.OrderUpdate{InstId: "BTC-USDT", OrdId: ordId, ClOrdId: "c1", Px: "100", Sz: "2", State: STATE_PARTIALLY_FILLED,
+		TradeId: "t1", FillPx: "100", FillSz: "1", AccFillSz: "1", UTime: "1700000000000"}
+	m.OnOrderUpdate(time.Now(), u)
+	assert.Equal(t, 1, len(evts))
+	assert.Equal(t, EVENT_FILL, evts[0].Type)
+	o, _ = m.Get("c1")
+	assert.Equal(t, STATE_CANCELING, o.State)
+
+	// 撤单未生效，订单完全成交
+	evts = nil
+	u.State, u.TradeId, u.AccFillSz, u.UTime = STATE_FILLED, "t2", "2", "1700000000100"
+	m.OnOrderUpdate(time.Now(), u)
+	assert.Equal(t, 2, len(evts))
+	assert.Equal(t, EVENT_STATE, evts[1].Type)
+	assert.Equal(t, STATE_CANCELING, evts[1].PrevState)
+	o, _ = m.Get("c1")
+	assert.Equal(t, STATE_FILLED, o.State)
+	assert.Equal(t, "2", o.AccFillSz)
+}
+
+func TestReconcileRace(t *testing.T) {
+	gw := &fakeGateway{}
+	m := New(gw)
+	ctx := context.Background()
+
+	// 对账期间新下的订单不参与对账
+	src := &fakeSource{}
+	src.onPending = func() {
+		src.onPending = nil
+		_, err := m.PlaceOrders(ctx, limitOrder("n1"))
+		assert.NotNil(t, err)
+	}
+	gw.err = errors.New("timeout")
+	assert.Nil(t, m.Reconcile(ctx, src))
+	assert.Equal(t, 0, len(src.queried))
+	o, _ := m.Get("n1")
+	assert.Equal(t, STATE_PENDING, o.State)
+
+	// 下单请求尚未返回时对账查询不到订单，之后的下单结果和推送仍然生效
+	gw.err = nil
+	gw.inFlight = func() {
+		gw.inFlight = nil
+		assert.Nil(t, m.Reconcile(ctx, &fakeSource{}))
+		o, _ := m.Get("f1")
+		assert.Equal(t, STATE_REJECTED, o.State)
+	}
+	results, err := m.PlaceOrders(ctx, limitOrder("f1"))
+	assert.Nil(t, err)
+	o, _ = m.Get("f1")
+	assert.Equal(t, STATE_LIVE, o.State)
+	assert.Equal(t, results[0].OrdId, o.OrdId)
+
+	m.OnOrderUpdate(time.Now(), wImpl.OrderUpdate{InstId: "BTC-USDT", OrdId: results[0].OrdId, ClOrdId: "f1", State: STATE_FILLED,
+		TradeId: "t1", FillPx: "100", FillSz: "2", AccFillSz: "2", UTime: "1700000000000"})
+	o, _ = m.Get("f1")
+	assert.Equal(t, STATE_FILLED, o.State)
+	assert.Equal(t, "2", o.AccFillSz)
+}
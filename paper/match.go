@@ -0,0 +1,820 @@
+package paper
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+	"v5sdk_go/trade"
+	"v5sdk_go/ws/wImpl"
+)
+
+// 数量的精度误差
+const EPSILON = 1e-9
+
+type balance struct {
+	ccy    string
+	cash   float64
+	frozen float64
+	uTime  time.Time
+}
+
+/*
+	持仓，买卖模式下空头持仓为负，开平仓模式下均为正
+*/
+type position struct {
+	instId   string
+	instType string
+	mgnMode  string
+	posSide  string
+	ccy      string
+	ctVal    float64
+	pos      float64
+	avgPx    float64
+	cTime    time.Time
+	uTime    time.Time
+}
+
+// 持仓方向，开平仓模式的空头为 -1
+func (p *position) dir() float64 {
+	if p.posSide == trade.POS_SIDE_SHORT {
+		return -1
+	}
+	return 1
+}
+
+type fill struct {
+	tradeId string
+	px      float64
+	sz      float64
+	fee     float64
+	maker   bool
+	ts      time.Time
+}
+
+type order struct {
+	trade.PlaceOrderReq
+	inst    instInfo
+	ordId   string
+	px      float64
+	sz      float64
+	quoteSz bool    // 现货市价单的 sz 为计价货币数量
+	remain  float64 // 未成交数量，单位与 sz 相同
+	filled  float64 // 累计成交数量
+	amount  float64 // 累计成交金额
+	fee     float64 // 累计手续费，正数为收取
+	feeCcy  string
+	pnl     float64
+	frozen  float64 // 冻结的余额
+	state   string
+	source  string // 撤单来源
+	reqId   string
+	amended bool
+	cTime   time.Time
+	uTime   time.Time
+}
+
+func (o *order) buy() bool {
+	return o.Side == trade.SIDE_BUY
+}
+
+func (o *order) market() bool {
+	return o.OrdType == trade.ORD_TYPE_MARKET || o.OrdType == trade.ORD_TYPE_OPTIMAL_LIMIT_IOC
+}
+
+func (o *order) isOpen() bool {
+	return o.state == wImpl.ORDER_STATE_LIVE || o.state == wImpl.ORDER_STATE_PARTIALLY_FILLED
+}
+
+// 合约订单是否会增加持仓，买卖模式下非只减仓的订单都按开仓处理
+func (o *order) opening() bool {
+	switch o.posSide() {
+	case trade.POS_SIDE_LONG:
+		return o.buy()
+	case trade.POS_SIDE_SHORT:
+		return !o.buy()
+	}
+	return !o.ReduceOnly
+}
+
+func (o *order) posSide() string {
+	if o.PosSide == "" {
+		return trade.POS_SIDE_NET
+	}
+	return o.PosSide
+}
+
+// 以 sz 的单位计的成交数量
+func (o *order) unit(px, sz float64) float64 {
+	if o.quoteSz {
+		return px * sz
+	}
+	return sz
+}
+
+// 按当前状态生成推送数据，f 为本次成交
+func (o *order) update(f *fill) wImpl.OrderUpdate {
+	u := wImpl.OrderUpdate{
+		InstType:     o.inst.instType,
+		InstId:       o.InstId,
+		TgtCcy:       o.TgtCcy,
+		OrdId:        o.ordId,
+		ClOrdId:      o.ClOrdId,
+		Tag:          o.Tag,
+		Px:           o.Px,
+		Sz:           fmtFloat(o.sz),
+		OrdType:      o.OrdType,
+		Side:         o.Side,
+		PosSide:      o.posSide(),
+		TdMode:       o.TdMode,
+		AccFillSz:    fmtFloat(o.filled),
+		State:        o.state,
+		StpMode:      o.StpMode,
+		FeeCcy:       o.feeCcy,
+		Fee:          fmtFloat(-o.fee),
+		Pnl:          fmtFloat(o.pnl),
+		CancelSource: o.source,
+		Category:     "normal",
+		ReduceOnly:   strconv.FormatBool(o.ReduceOnly),
+		ReqId:        o.reqId,
+		Code:         "0",
+		UTime:        msStr(o.uTime),
+		CTime:        msStr(o.cTime),
+	}
+	if o.inst.instType == INST_SPOT {
+		u.PosSide = ""
+	}
+	if o.filled > 0 {
+		u.AvgPx = fmtFloat(o.amount / o.filled)
+	}
+	if o.amended {
+		u.AmendResult = "0"
+	}
+	if f != nil {
+		u.TradeId = f.tradeId
+		u.FillPx = fmtFloat(f.px)
+		u.FillSz = fmtFloat(f.sz)
+		u.FillFee = fmtFloat(-f.fee)
+		u.FillFeeCcy = o.feeCcy
+		u.FillTime = msStr(f.ts)
+		u.LastPx = u.FillPx
+		u.ExecType = "T"
+		if f.maker {
+			u.ExecType = "M"
+		}
+	}
+	return u
+}
+
+/*
+	下单，与 oms.Gateway 相同
+	参数校验失败或下单前检查未通过时返回错误，否则返回各订单的处理结果
+*/
+func (e *Exchange) PlaceOrders(ctx context.Context, orders ...trade.PlaceOrderReq) (results []trade.OrderResult, err error) {
+	if err = e.checkOrders(ctx, trade.OP_ORDER, trade.PlaceOrders(orders)); err != nil {
+		return
+	}
+	if err = e.delay(ctx); err != nil {
+		return
+	}
+
+	e.lock.Lock()
+	for _, req := range orders {
+		results = append(results, e.place(req))
+	}
+	e.lock.Unlock()
+	e.drain()
+	return
+}
+
+/*
+	撤单，与 oms.Gateway 相同
+*/
+func (e *Exchange) CancelOrders(ctx context.Context, orders ...trade.CancelOrderReq) (results []trade.OrderResult, err error) {
+	if err = e.checkOrders(ctx, trade.OP_CANCEL_ORDER, trade.CancelOrders(orders)); err != nil {
+		return
+	}
+	if err = e.delay(ctx); err != nil {
+		return
+	}
+
+	e.lock.Lock()
+	for _, req := range orders {
+		res := trade.OrderResult{OrdId: req.OrdId, ClOrdId: req.ClOrdId, SCode: "0"}
+		o := e.find(req.InstId, req.OrdId, req.ClOrdId)
+		if o == nil || !o.isOpen() {
+			res.SCode, res.SMsg = CODE_CANCEL_FAILED, "订单不存在或已完成"
+		} else {
+			res.OrdId, res.ClOrdId = o.ordId, o.ClOrdId
+			e.cancel(o, CANCEL_SOURCE_USER)
+		}
+		results = append(results, res)
+	}
+	e.lock.Unlock()
+	e.drain()
+	return
+}
+
+/*
+	改单，与 oms.Gateway 相同
+	改单后的价格可成交时立即撮合，只做maker订单会成为taker时撤单
+*/
+func (e *Exchange) AmendOrders(ctx context.Context, orders ...trade.AmendOrderReq) (results []trade.OrderResult, err error) {
+	if err = e.checkOrders(ctx, trade.OP_AMEND_ORDER, trade.AmendOrders(orders)); err != nil {
+		return
+	}
+	if err = e.delay(ctx); err != nil {
+		return
+	}
+
+	e.lock.Lock()
+	for _, req := range orders {
+		results = append(results, e.amend(req))
+	}
+	e.lock.Unlock()
+	e.drain()
+	return
+}
+
+/*
+	以下方法调用方需持有 e.lock
+*/
+
+func (e *Exchange) find(instId, ordId, clOrdId string) *order {
+	o, ok := e.orders[ordId]
+	if !ok {
+		o, ok = e.clOrdIds[clOrdId]
+	}
+	if !ok || (instId != "" && o.InstId != instId) {
+		return nil
+	}
+	return o
+}
+
+func (e *Exchange) place(req trade.PlaceOrderReq) trade.OrderResult {
+	res := trade.OrderResult{ClOrdId: req.ClOrdId, Tag: req.Tag, SCode: "0"}
+	reject := func(code, msg string) trade.OrderResult {
+		res.SCode, res.SMsg = code, msg
+		return res
+	}
+
+	in, err := e.inst(req.InstId)
+	if err != nil {
+		return reject(CODE_PARAM_ERROR, err.Error())
+	}
+	if (in.instType == INST_SPOT) != (req.TdMode == trade.TD_MODE_CASH) {
+		return reject(CODE_PARAM_ERROR, "不支持的交易模式:"+req.TdMode)
+	}
+	if req.ClOrdId != "" && e.clOrdIds[req.ClOrdId] != nil {
+		return reject(CODE_DUP_CLORDID, "clOrdId重复")
+	}
+
+	o := &order{PlaceOrderReq: req, inst: in}
+	o.px, _ = strconv.ParseFloat(req.Px, 64)
+	o.sz, _ = strconv.ParseFloat(req.Sz, 64)
+	if in.instType == INST_SPOT && o.market() {
+		o.quoteSz = (o.buy() && req.TgtCcy != trade.TGT_CCY_BASE) || (!o.buy() && req.TgtCcy == trade.TGT_CCY_QUOTE)
+	}
+	o.remain = o.sz
+	o.feeCcy = in.quote
+	if in.instType == INST_SPOT && o.buy() {
+		o.feeCcy = in.base
+	}
+	if in.instType != INST_SPOT {
+		if code, msg := e.checkClose(o); code != "" {
+			return reject(code, msg)
+		}
+	}
+
+	fills, ok := e.takeable(o)
+	if o.market() && !ok {
+		return reject(CODE_NO_MARKET_DATA, "没有行情数据")
+	}
+	if in.instType != INST_SPOT {
+		notional := o.px * o.sz * in.ctVal
+		if o.market() {
+			notional = 0
+			for _, f := range fills {
+				notional += f.px * f.sz * in.ctVal
+			}
+		}
+		if code, msg := e.checkMargin(o, notional); code != "" {
+			return reject(code, msg)
+		}
+	}
+	if code, msg := e.freeze(o, fills); code != "" {
+		return reject(code, msg)
+	}
+
+	e.seq++
+	now := e.now()
+	o.ordId = strconv.FormatInt(e.seq, 10)
+	o.state = wImpl.ORDER_STATE_LIVE
+	o.cTime, o.uTime = now, now
+	e.orders[o.ordId] = o
+	if o.ClOrdId != "" {
+		e.clOrdIds[o.ClOrdId] = o
+	}
+	res.OrdId = o.ordId
+	e.pushOrder(now, o.update(nil))
+
+	e.execute(o, fills)
+	return res
+}
+
+/*
+	平仓订单的检查，返回错误码
+	开平仓模式下平仓数量不能超过持仓，买卖模式下只减仓订单的方向需与持仓相反
+*/
+func (e *Exchange) checkClose(o *order) (code, msg string) {
+	posSide := o.posSide()
+	p := e.positions[o.InstId+"|"+posSide]
+	var pos float64
+	if p != nil {
+		pos = p.pos
+	}
+	switch {
+	case posSide == trade.POS_SIDE_LONG && !o.buy(), posSide == trade.POS_SIDE_SHORT && o.buy():
+		if o.sz > pos+EPSILON {
+			return CODE_REDUCE_ONLY, "平仓数量超过持仓"
+		}
+	case posSide == trade.POS_SIDE_NET && o.ReduceOnly:
+		if (o.buy() && -pos < o.sz-EPSILON) || (!o.buy() && pos < o.sz-EPSILON) {
+			return CODE_REDUCE_ONLY, "只减仓订单超过可平持仓"
+		}
+	}
+	return "", ""
+}
+
+/*
+	合约开仓订单的保证金检查，返回错误码
+	notional 为订单的名义价值，所需保证金为 名义价值/杠杆 加上按 taker 费率计算的手续费，
+	不能超过 权益 - 持仓和其他挂单已占用的保证金
+*/
+func (e *Exchange) checkMargin(o *order, notional float64) (code, msg string) {
+	if !o.opening() {
+		return
+	}
+	ccy := o.inst.quote
+	need := notional/o.inst.lever + notional*e.fee(o.InstId).Taker
+	b := e.balance(ccy)
+	if b.cash+e.upl(ccy)-e.usedMargin(ccy, o) < need-EPSILON {
+		return CODE_INSUFFICIENT, "保证金不足"
+	}
+	return
+}
+
+// 结算币种为 ccy 的持仓和开仓挂单占用的保证金，不包括 except
+func (e *Exchange) usedMargin(ccy string, except *order) (used float64) {
+	for _, p := range e.positions {
+		if p.ccy == ccy {
+			used += math.Abs(p.pos) * p.ctVal * p.avgPx / e.lever(p.instId)
+		}
+	}
+	for _, o := range e.orders {
+		if o != except && o.isOpen() && o.inst.instType != INST_SPOT && o.inst.quote == ccy && o.opening() {
+			used += o.px * o.remain * o.inst.ctVal / o.inst.lever
+		}
+	}
+	return
+}
+
+/*
+	按订单簿计算新订单可立即成交的部分
+	ok 为 false 表示没有可用的订单簿
+*/
+func (e *Exchange) takeable(o *order) (fills []fill, ok bool) {
+	book := e.books[o.InstId]
+	if book == nil || !book.Ready() {
+		return
+	}
+	ok = true
+
+	bids, asks := book.Len()
+	levels := asks
+	if !o.buy() {
+		levels = bids
+	}
+	b, a := book.TopN(levels)
+	side := a
+	if !o.buy() {
+		side = b
+	}
+
+	remain := o.remain
+	for _, lv := range side {
+		if remain <= EPSILON*o.sz {
+			break
+		}
+		if !o.market() && ((o.buy() && lv.Px > o.px) || (!o.buy() && lv.Px < o.px)) {
+			break
+		}
+		sz := lv.Sz
+		if o.quoteSz {
+			sz = math.Min(sz, remain/lv.Px)
+		} else {
+			sz = math.Min(sz, remain)
+		}
+		remain -= o.unit(lv.Px, sz)
+		fills = append(fills, fill{px: lv.Px, sz: sz})
+	}
+	return
+}
+
+/*
+	现货订单冻结余额，返回错误码
+	限价单按委托价冻结全部数量，市价单检查可立即成交部分所需的余额
+*/
+func (e *Exchange) freeze(o *order, fills []fill) (code, msg string) {
+	if o.inst.instType != INST_SPOT {
+		return
+	}
+	ccy, need := o.inst.base, 0.0
+	if o.buy() {
+		ccy = o.inst.quote
+	}
+	switch {
+	case !o.market() && o.buy():
+		need = o.px * o.sz
+	case !o.market():
+		need = o.sz
+	default:
+		for _, f := range fills {
+			if o.buy() {
+				need += f.px * f.sz
+			} else {
+				need += f.sz
+			}
+		}
+	}
+
+	b := e.balance(ccy)
+	if b.cash-b.frozen < need-EPSILON {
+		return CODE_INSUFFICIENT, "余额不足"
+	}
+	if !o.market() {
+		o.frozen = need
+		b.frozen += need
+		b.uTime = e.now()
+		e.pushAccount(b.uTime, e.account([]string{ccy}))
+	}
+	return
+}
+
+/*
+	新订单立即成交后，按订单类型处理未成交部分
+*/
+func (e *Exchange) execute(o *order, fills []fill) {
+	var taken float64
+	for _, f := range fills {
+		taken += o.unit(f.px, f.sz)
+	}
+
+	switch o.OrdType {
+	case trade.ORD_TYPE_POST_ONLY:
+		if len(fills) != 0 {
+			e.cancel(o, CANCEL_SOURCE_POST_ONLY)
+			return
+		}
+	case trade.ORD_TYPE_FOK:
+		if taken < o.remain-EPSILON*o.sz {
+			e.cancel(o, CANCEL_SOURCE_IOC)
+			return
+		}
+	}
+
+	for _, f := range fills {
+		e.fill(o, f.px, f.sz, false)
+	}
+	if !o.isOpen() {
+		return
+	}
+	switch o.OrdType {
+	case trade.ORD_TYPE_IOC, trade.ORD_TYPE_FOK, trade.ORD_TYPE_MARKET, trade.ORD_TYPE_OPTIMAL_LIMIT_IOC:
+		e.cancel(o, CANCEL_SOURCE_IOC)
+	default:
+		e.open = append(e.open, o)
+	}
+}
+
+/*
+	订单簿更新后撮合挂单，按挂单时间先后依次使用穿过挂单价的深度
+*/
+func (e *Exchange) matchOpen(instId string) {
+	book := e.books[instId]
+	if book == nil || !book.Ready() {
+		return
+	}
+	var usedBids, usedAsks float64
+	for _, o := range append([]*order(nil), e.open...) {
+		if o.InstId != instId || !o.isOpen() {
+			continue
+		}
+		var depth float64
+		if o.buy() {
+			depth = book.CumDepth(wImpl.BOOK_ASKS, o.px) - usedAsks
+		} else {
+			depth = book.CumDepth(wImpl.BOOK_BIDS, o.px) - usedBids
+		}
+		sz := math.Min(depth, o.remain)
+		if sz <= EPSILON*o.sz {
+			continue
+		}
+		if o.buy() {
+			usedAsks += sz
+		} else {
+			usedBids += sz
+		}
+		e.fill(o, o.px, sz, true)
+	}
+}
+
+/*
+	成交，更新订单、余额和持仓并推送
+*/
+func (e *Exchange) fill(o *order, px, sz float64, maker bool) {
+	now := e.now()
+	fee := e.fee(o.InstId)
+	rate := fee.Taker
+	if maker {
+		rate = fee.Maker
+	}
+
+	e.tradeSeq++
+	f := fill{tradeId: strconv.FormatInt(e.tradeSeq, 10), px: px, sz: sz, maker: maker, ts: now}
+	ccys := []string{o.inst.quote}
+	in := o.inst
+	if in.instType == INST_SPOT {
+		base, quote := e.balance(in.base), e.balance(in.quote)
+		if o.buy() {
+			f.fee = sz * rate
+			quote.cash -= px * sz
+			base.cash += sz - f.fee
+			o.unfreeze(quote, o.px*sz)
+		} else {
+			f.fee = px * sz * rate
+			base.cash -= sz
+			quote.cash += px*sz - f.fee
+			o.unfreeze(base, sz)
+		}
+		base.uTime, quote.uTime = now, now
+		ccys = append(ccys, in.base)
+	} else {
+		settle := e.balance(in.quote)
+		f.fee = px * sz * in.ctVal * rate
+		pnl := e.applyPosition(o, px, sz, now)
+		settle.cash += pnl - f.fee
+		settle.uTime = now
+		o.pnl += pnl
+	}
+
+	o.remain -= o.unit(px, sz)
+	o.filled += sz
+	o.amount += px * sz
+	o.fee += f.fee
+	o.uTime = now
+	o.state = wImpl.ORDER_STATE_PARTIALLY_FILLED
+	if o.remain <= EPSILON*o.sz {
+		o.remain = 0
+		o.state = wImpl.ORDER_STATE_FILLED
+		e.close(o)
+	}
+	e.pushOrder(now, o.update(&f))
+	e.pushAccount(now, e.account(ccys))
+}
+
+func (o *order) unfreeze(b *balance, v float64) {
+	v = math.Min(v, o.frozen)
+	o.frozen -= v
+	b.frozen -= v
+}
+
+/*
+	更新合约持仓，返回平仓盈亏
+*/
+func (e *Exchange) applyPosition(o *order, px, sz float64, now time.Time) (pnl float64) {
+	key := o.InstId + "|" + o.posSide()
+	p, ok := e.positions[key]
+	if !ok {
+		p = &position{
+			instId:   o.InstId,
+			instType: o.inst.instType,
+			mgnMode:  o.TdMode,
+			posSide:  o.posSide(),
+			ccy:      o.inst.quote,
+			ctVal:    o.inst.ctVal,
+			cTime:    now,
+		}
+		e.positions[key] = p
+	}
+
+	// 按多空方向计算
+	exp, delta := p.pos*p.dir(), sz
+	if !o.buy() {
+		delta = -sz
+	}
+	if exp == 0 || (exp > 0) == (delta > 0) {
+		p.avgPx = (math.Abs(exp)*p.avgPx + sz*px) / (math.Abs(exp) + sz)
+	} else {
+		closed := math.Min(sz, math.Abs(exp))
+		pnl = closed * p.ctVal * (px - p.avgPx)
+		if exp < 0 {
+			pnl = -pnl
+		}
+		if sz > math.Abs(exp) {
+			// 反向开仓
+			p.avgPx = px
+		}
+	}
+	exp += delta
+	if math.Abs(exp) <= EPSILON*sz {
+		exp = 0
+	}
+	p.pos = exp * p.dir()
+	p.uTime = now
+
+	e.pushPosition(now, e.positionDetail(p))
+	if exp == 0 {
+		delete(e.positions, key)
+	}
+	return
+}
+
+func (e *Exchange) cancel(o *order, source string) {
+	now := e.now()
+	o.state = wImpl.ORDER_STATE_CANCELED
+	o.source = source
+	o.uTime = now
+	e.close(o)
+	e.pushOrder(now, o.update(nil))
+}
+
+/*
+	订单完成，从挂单列表中移除并解冻剩余余额
+*/
+func (e *Exchange) close(o *order) {
+	for i, v := range e.open {
+		if v == o {
+			e.open = append(e.open[:i:i], e.open[i+1:]...)
+			break
+		}
+	}
+	if o.frozen > 0 {
+		ccy := o.inst.base
+		if o.buy() {
+			ccy = o.inst.quote
+		}
+		b := e.balance(ccy)
+		b.frozen -= o.frozen
+		b.uTime = o.uTime
+		o.frozen = 0
+		e.pushAccount(o.uTime, e.account([]string{ccy}))
+	}
+}
+
+func (e *Exchange) amend(req trade.AmendOrderReq) trade.OrderResult {
+	res := trade.OrderResult{OrdId: req.OrdId, ClOrdId: req.ClOrdId, ReqId: req.ReqId, SCode: "0"}
+	o := e.find(req.InstId, req.OrdId, req.ClOrdId)
+	if o == nil || !o.isOpen() {
+		res.SCode, res.SMsg = CODE_AMEND_FAILED, "订单不存在或已完成"
+		return res
+	}
+	res.OrdId, res.ClOrdId = o.ordId, o.ClOrdId
+	fail := func(msg string) trade.OrderResult {
+		if req.CxlOnFail {
+			e.cancel(o, CANCEL_SOURCE_USER)
+		}
+		res.SCode, res.SMsg = CODE_AMEND_FAILED, msg
+		return res
+	}
+
+	px, sz := o.px, o.sz
+	if req.NewPx != "" {
+		px, _ = strconv.ParseFloat(req.NewPx, 64)
+	}
+	if req.NewSz != "" {
+		sz, _ = strconv.ParseFloat(req.NewSz, 64)
+	}
+	if sz <= o.filled+EPSILON {
+		return fail("改单数量需大于已成交数量")
+	}
+
+	// 现货按新的价格和数量重新冻结
+	if o.inst.instType == INST_SPOT {
+		ccy, need := o.inst.base, sz-o.filled
+		if o.buy() {
+			ccy, need = o.inst.quote, px*(sz-o.filled)
+		}
+		b := e.balance(ccy)
+		if b.cash-b.frozen+o.frozen < need-EPSILON {
+			return fail("余额不足")
+		}
+		b.frozen += need - o.frozen
+		o.frozen = need
+		b.uTime = e.now()
+		e.pushAccount(b.uTime, e.account([]string{ccy}))
+	} else if code, _ := e.checkMargin(o, px*(sz-o.filled)*o.inst.ctVal); code != "" {
+		return fail("保证金不足")
+	}
+
+	o.px, o.sz = px, sz
+	o.Px, o.Sz = fmtFloat(px), fmtFloat(sz)
+	o.remain = sz - o.filled
+	o.reqId, o.amended = req.ReqId, true
+	o.uTime = e.now()
+	e.pushOrder(o.uTime, o.update(nil))
+
+	fills, _ := e.takeable(o)
+	if len(fills) != 0 {
+		if o.OrdType == trade.ORD_TYPE_POST_ONLY {
+			e.cancel(o, CANCEL_SOURCE_POST_ONLY)
+		} else {
+			for _, f := range fills {
+				e.fill(o, f.px, f.sz, false)
+			}
+		}
+	}
+	return res
+}
+
+func (e *Exchange) balance(ccy string) *balance {
+	b, ok := e.balances[ccy]
+	if !ok {
+		b = &balance{ccy: ccy, uTime: e.now()}
+		e.balances[ccy] = b
+	}
+	return b
+}
+
+/*
+	账户推送数据，只包含指定的币种
+*/
+func (e *Exchange) account(ccys []string) wImpl.AccountDetail {
+	var uTime time.Time
+	acc := wImpl.AccountDetail{}
+	for _, ccy := range ccys {
+		b := e.balance(ccy)
+		upl := e.upl(ccy)
+		avail := fmtFloat(b.cash - b.frozen)
+		acc.Details = append(acc.Details, wImpl.AccountCcyBal{
+			Ccy:       ccy,
+			Eq:        fmtFloat(b.cash + upl),
+			CashBal:   fmtFloat(b.cash),
+			AvailBal:  avail,
+			AvailEq:   avail,
+			FrozenBal: fmtFloat(b.frozen),
+			OrdFrozen: fmtFloat(b.frozen),
+			Upl:       fmtFloat(upl),
+			UTime:     msStr(b.uTime),
+		})
+		if b.uTime.After(uTime) {
+			uTime = b.uTime
+		}
+	}
+	acc.UTime = msStr(uTime)
+	return acc
+}
+
+// 结算币种为 ccy 的持仓的未实现盈亏
+func (e *Exchange) upl(ccy string) (upl float64) {
+	for _, p := range e.positions {
+		if p.ccy == ccy {
+			upl += e.positionUpl(p)
+		}
+	}
+	return
+}
+
+func (e *Exchange) markPx(p *position) float64 {
+	if book := e.books[p.instId]; book != nil && book.Ready() {
+		if mid, ok := book.MidPrice(); ok {
+			return mid
+		}
+	}
+	return p.avgPx
+}
+
+func (e *Exchange) positionUpl(p *position) float64 {
+	return (e.markPx(p) - p.avgPx) * p.pos * p.dir() * p.ctVal
+}
+
+func (e *Exchange) positionDetail(p *position) wImpl.PositionDetail {
+	d := wImpl.PositionDetail{
+		InstType: p.instType,
+		MgnMode:  p.mgnMode,
+		PosId:    p.instId + "-" + p.posSide,
+		PosSide:  p.posSide,
+		Pos:      fmtFloat(p.pos),
+		AvailPos: fmtFloat(math.Abs(p.pos)),
+		Ccy:      p.ccy,
+		InstId:   p.instId,
+		MarkPx:   fmtFloat(e.markPx(p)),
+		Upl:      fmtFloat(e.positionUpl(p)),
+		CTime:    msStr(p.cTime),
+		UTime:    msStr(p.uTime),
+	}
+	if p.pos != 0 {
+		d.AvgPx = fmtFloat(p.avgPx)
+	}
+	return d
+}
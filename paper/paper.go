@@ -0,0 +1,497 @@
+/*
+	模拟交易所
+	使用 WebSocket 深度频道(实时或回放)的订单簿撮合订单，按配置收取手续费、模拟延迟，
+	并以交易所的格式推送 orders / positions / account 数据
+	Exchange 实现了 oms.Gateway、oms.Source、portfolio.Source 接口和私有频道的推送回调，
+	通过 oms.Gateway(实盘使用 oms.NewWsGateway 或 oms.NewRestGateway) 下单的策略可不做修改地切换到模拟交易，
+	直接调用 ws.WsClient 或 rest.RESTAPI 下单的代码需要改为使用 oms.Gateway
+*/
+package paper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"v5sdk_go/oms"
+	"v5sdk_go/portfolio"
+	"v5sdk_go/trade"
+	"v5sdk_go/ws"
+	"v5sdk_go/ws/wImpl"
+)
+
+// 产品类型
+const (
+	INST_SPOT    = "SPOT"
+	INST_SWAP    = "SWAP"
+	INST_FUTURES = "FUTURES"
+)
+
+// 订单处理失败的错误码，与交易所一致
+const (
+	CODE_PARAM_ERROR    = "51000" // 参数错误
+	CODE_INSUFFICIENT   = "51008" // 余额不足
+	CODE_DUP_CLORDID    = "51016" // clOrdId 重复
+	CODE_CANCEL_FAILED  = "51400" // 订单不存在或已完成，撤单失败
+	CODE_AMEND_FAILED   = "51503" // 订单不存在或已完成，改单失败
+	CODE_REDUCE_ONLY    = "51169" // 没有可平的持仓
+	CODE_NO_MARKET_DATA = "51001" // 没有行情数据
+)
+
+// 撤单来源
+const (
+	CANCEL_SOURCE_USER      = "1"  // 用户撤单
+	CANCEL_SOURCE_POST_ONLY = "31" // 只做maker订单会成为taker
+	CANCEL_SOURCE_IOC       = "14" // 未成交部分撤销(ioc/fok/市价单)
+)
+
+var (
+	_ oms.Gateway      = (*Exchange)(nil)
+	_ oms.Source       = (*Exchange)(nil)
+	_ portfolio.Source = (*Exchange)(nil)
+)
+
+/*
+	手续费率，正数为收取，负数为返佣
+	例如 Fee{Maker: 0.0008, Taker: 0.001}
+*/
+type Fee struct {
+	Maker float64
+	Taker float64
+}
+
+// 合约默认杠杆倍数
+const DEFAULT_LEVER = 10
+
+/*
+	产品配置
+	CtVal: 合约面值，默认为 1
+	Lever: 合约杠杆倍数，默认为 DEFAULT_LEVER
+*/
+type Inst struct {
+	CtVal float64
+	Lever float64
+}
+
+/*
+	模拟交易配置
+	Balances: 各币种的初始余额
+	Fee: 默认手续费率
+	InstFees: 各产品的手续费率
+	Insts: 各产品的配置
+	Latency: 请求到达交易所的延迟
+	Clock: 订单、成交等的时间，默认为 time.Now，回放历史数据时可使用订单簿时间
+*/
+type Config struct {
+	Balances map[string]float64
+	Fee      Fee
+	InstFees map[string]Fee
+	Insts    map[string]Inst
+	Latency  time.Duration
+	Clock    func() time.Time
+}
+
+// 推送数据
+type push struct {
+	ts       time.Time
+	order    *wImpl.OrderUpdate
+	position *wImpl.PositionDetail
+	account  *wImpl.AccountDetail
+}
+
+/*
+	模拟交易所
+	撮合规则：
+		新订单按对手方价位逐档成交(taker)，未成交的限价单挂单等待
+		订单簿更新后，价格穿过挂单价的深度按挂单价成交(maker)
+		模拟成交不改变订单簿，不考虑排队位置
+	仅支持币币(cash)和 U 本位永续/交割合约
+	合约开仓时按 名义价值/杠杆 检查保证金，权益不足时拒绝下单，但不冻结余额，也不模拟强平
+	例如:
+	ex := paper.New(paper.Config{Balances: map[string]float64{"USDT": 10000}, Fee: paper.Fee{Maker: 0.0008, Taker: 0.001}})
+	ex.Attach(cli)
+	cli.PubOrderBooks(ws.OP_SUBSCRIBE, "books5", []map[string]string{{"instId": "BTC-USDT"}})
+	// 或使用录制的数据回放: cli.StartReplay(path, false)
+	o := oms.New(ex)
+	ex.AddOrderHook(o.OnOrderUpdate)
+*/
+type Exchange struct {
+	conf Config
+
+	lock      sync.Mutex
+	books     map[string]*wImpl.OrderBook
+	orders    map[string]*order
+	clOrdIds  map[string]*order
+	open      []*order
+	balances  map[string]*balance
+	positions map[string]*position
+	seq       int64
+	tradeSeq  int64
+	preTrade  trade.PreTradeCheck
+
+	// 推送队列，按产生的顺序依次回调
+	qlock      sync.Mutex
+	queue      []push
+	pushing    bool
+	onOrder    ws.ReceivedOrderDataCallback
+	onPosition ws.ReceivedPositionDataCallback
+	onAccount  ws.ReceivedAccountDataCallback
+	onMessage  ws.ReceivedMsgDataCallback
+}
+
+func New(conf Config) *Exchange {
+	e := &Exchange{
+		conf:      conf,
+		books:     make(map[string]*wImpl.OrderBook),
+		orders:    make(map[string]*order),
+		clOrdIds:  make(map[string]*order),
+		balances:  make(map[string]*balance),
+		positions: make(map[string]*position),
+	}
+	now := e.now()
+	for ccy, v := range conf.Balances {
+		e.balances[ccy] = &balance{ccy: ccy, cash: v, uTime: now}
+	}
+	return e
+}
+
+func (e *Exchange) now() time.Time {
+	if e.conf.Clock != nil {
+		return e.conf.Clock()
+	}
+	return time.Now()
+}
+
+/*
+	设置下单前检查，与 REST 客户端和 WsClient 相同
+*/
+func (e *Exchange) SetPreTradeCheck(check trade.PreTradeCheck) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.preTrade = check
+}
+
+func (e *Exchange) checkOrders(ctx context.Context, op string, orders []trade.Order) error {
+	args, _, err := trade.BuildArgs(orders...)
+	if err != nil {
+		return trade.Rejected(err)
+	}
+	if len(args) > trade.BATCH_MAX {
+		return trade.Rejected(errors.New("批量请求最多" + strconv.Itoa(trade.BATCH_MAX) + "个订单"))
+	}
+	e.lock.Lock()
+	check := e.preTrade
+	e.lock.Unlock()
+	if check == nil {
+		return nil
+	}
+	return trade.Rejected(check.CheckOrders(ctx, op, args))
+}
+
+// 模拟请求到达交易所的延迟
+func (e *Exchange) delay(ctx context.Context) error {
+	if e.conf.Latency <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(e.conf.Latency)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+/*
+	订单频道的回调函数，与 WsClient.AddOrderHook 相同
+*/
+func (e *Exchange) AddOrderHook(fn ws.ReceivedOrderDataCallback) error {
+	e.qlock.Lock()
+	defer e.qlock.Unlock()
+	e.onOrder = fn
+	return nil
+}
+
+/*
+	持仓频道的回调函数，与 WsClient.AddPositionHook 相同
+*/
+func (e *Exchange) AddPositionHook(fn ws.ReceivedPositionDataCallback) error {
+	e.qlock.Lock()
+	defer e.qlock.Unlock()
+	e.onPosition = fn
+	return nil
+}
+
+/*
+	账户频道的回调函数，与 WsClient.AddAccountHook 相同
+*/
+func (e *Exchange) AddAccountHook(fn ws.ReceivedAccountDataCallback) error {
+	e.qlock.Lock()
+	defer e.qlock.Unlock()
+	e.onAccount = fn
+	return nil
+}
+
+/*
+	原始推送数据的回调函数，与 WsClient.AddBookMsgHook 相同
+	arg 中的 channel 为 orders、positions 或 account
+*/
+func (e *Exchange) AddMessageHook(fn ws.ReceivedMsgDataCallback) error {
+	e.qlock.Lock()
+	defer e.qlock.Unlock()
+	e.onMessage = fn
+	return nil
+}
+
+/*
+	调用方需持有 e.lock
+*/
+func (e *Exchange) enqueue(p push) {
+	e.qlock.Lock()
+	e.queue = append(e.queue, p)
+	e.qlock.Unlock()
+}
+
+func (e *Exchange) pushOrder(ts time.Time, u wImpl.OrderUpdate) {
+	e.enqueue(push{ts: ts, order: &u})
+}
+
+func (e *Exchange) pushPosition(ts time.Time, p wImpl.PositionDetail) {
+	e.enqueue(push{ts: ts, position: &p})
+}
+
+func (e *Exchange) pushAccount(ts time.Time, a wImpl.AccountDetail) {
+	e.enqueue(push{ts: ts, account: &a})
+}
+
+/*
+	依次执行推送回调，不能持有 e.lock
+	回调函数中可以再次下单，产生的推送由正在执行的循环处理
+*/
+func (e *Exchange) drain() {
+	e.qlock.Lock()
+	if e.pushing {
+		e.qlock.Unlock()
+		return
+	}
+	e.pushing = true
+	for len(e.queue) != 0 {
+		p := e.queue[0]
+		e.queue = e.queue[1:]
+		onOrder, onPosition, onAccount, onMessage := e.onOrder, e.onPosition, e.onAccount, e.onMessage
+		e.qlock.Unlock()
+
+		var err error
+		switch {
+		case p.order != nil:
+			if onOrder != nil {
+				err = onOrder(p.ts, *p.order)
+			}
+			deliverMsg(onMessage, p.ts, "orders", p.order)
+		case p.position != nil:
+			if onPosition != nil {
+				err = onPosition(p.ts, *p.position)
+			}
+			deliverMsg(onMessage, p.ts, "positions", p.position)
+		case p.account != nil:
+			if onAccount != nil {
+				err = onAccount(p.ts, *p.account)
+			}
+			deliverMsg(onMessage, p.ts, "account", p.account)
+		}
+		if err != nil {
+			log.Println("模拟交易推送回调函数执行失败！", err)
+		}
+
+		e.qlock.Lock()
+	}
+	e.pushing = false
+	e.qlock.Unlock()
+}
+
+func deliverMsg(fn ws.ReceivedMsgDataCallback, ts time.Time, channel string, v interface{}) {
+	if fn == nil {
+		return
+	}
+	raw, _ := json.Marshal(v)
+	var data map[string]interface{}
+	json.Unmarshal(raw, &data)
+	msg := wImpl.MsgData{
+		Arg:  map[string]string{"channel": channel},
+		Data: []interface{}{data},
+	}
+	if err := fn(ts, msg); err != nil {
+		log.Println("模拟交易推送回调函数执行失败！", err)
+	}
+}
+
+/*
+	设置 WsClient 的深度数据回调函数，使用其订阅的深度频道撮合
+	注：会替换 WsClient 上已设置的深度数据回调函数
+*/
+func (e *Exchange) Attach(cli *ws.WsClient) error {
+	return cli.AddDepthHook(e.OnDepth)
+}
+
+/*
+	处理深度频道的推送，可直接作为 WsClient 的深度数据回调函数
+	每个产品只使用最先收到的深度频道，数据校验失败时在收到全量数据前不撮合
+*/
+func (e *Exchange) OnDepth(ts time.Time, d wImpl.DepthData) error {
+	channel, instId := d.Arg["channel"], d.Arg["instId"]
+	if instId == "" || len(d.Data) == 0 {
+		return nil
+	}
+
+	e.lock.Lock()
+	book, ok := e.books[instId]
+	if !ok {
+		book = wImpl.NewOrderBook(channel, instId)
+		e.books[instId] = book
+	}
+	if book.Channel() != channel {
+		e.lock.Unlock()
+		return nil
+	}
+	err := book.Apply(d.Action, d.Data[0])
+	if err == nil {
+		e.matchOpen(instId)
+	}
+	e.lock.Unlock()
+	e.drain()
+	return err
+}
+
+/*
+	产品的订单簿，未收到深度数据时返回 nil
+*/
+func (e *Exchange) OrderBook(instId string) *wImpl.OrderBook {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.books[instId]
+}
+
+/*
+	查询未成交订单，与 oms.Source 相同
+*/
+func (e *Exchange) PendingOrders(ctx context.Context) (orders []wImpl.OrderUpdate, err error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, o := range e.open {
+		orders = append(orders, o.update(nil))
+	}
+	return
+}
+
+/*
+	查询订单，订单不存在时返回 oms.ErrNotFound
+*/
+func (e *Exchange) GetOrder(ctx context.Context, instId, ordId, clOrdId string) (order wImpl.OrderUpdate, err error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	o := e.find(instId, ordId, clOrdId)
+	if o == nil {
+		err = oms.ErrNotFound
+		return
+	}
+	order = o.update(nil)
+	return
+}
+
+/*
+	查询账户余额，与 portfolio.Source 相同
+*/
+func (e *Exchange) Balance(ctx context.Context) ([]wImpl.AccountDetail, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	ccys := make([]string, 0, len(e.balances))
+	for ccy := range e.balances {
+		ccys = append(ccys, ccy)
+	}
+	return []wImpl.AccountDetail{e.account(ccys)}, nil
+}
+
+/*
+	查询持仓，与 portfolio.Source 相同
+*/
+func (e *Exchange) Positions(ctx context.Context) (positions []wImpl.PositionDetail, err error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, p := range e.positions {
+		positions = append(positions, e.positionDetail(p))
+	}
+	return
+}
+
+/*
+	按产品ID解析产品类型和币种
+	币币为 BTC-USDT，永续合约为 BTC-USDT-SWAP，交割合约为 BTC-USDT-250328
+*/
+type instInfo struct {
+	instType string
+	base     string
+	quote    string
+	ctVal    float64
+	lever    float64
+}
+
+func (e *Exchange) inst(instId string) (in instInfo, err error) {
+	parts := strings.Split(instId, "-")
+	switch {
+	case len(parts) == 2:
+		in.instType = INST_SPOT
+	case len(parts) == 3 && parts[2] == "SWAP":
+		in.instType = INST_SWAP
+	case len(parts) == 3 && isDate(parts[2]):
+		in.instType = INST_FUTURES
+	default:
+		err = errors.New("不支持的产品:" + instId)
+		return
+	}
+	in.base, in.quote = parts[0], parts[1]
+	if in.instType != INST_SPOT && in.quote == "USD" {
+		err = errors.New("不支持币本位合约:" + instId)
+		return
+	}
+	in.ctVal = 1
+	if v := e.conf.Insts[instId].CtVal; v > 0 {
+		in.ctVal = v
+	}
+	in.lever = e.lever(instId)
+	return
+}
+
+func (e *Exchange) lever(instId string) float64 {
+	if v := e.conf.Insts[instId].Lever; v > 0 {
+		return v
+	}
+	return DEFAULT_LEVER
+}
+
+func isDate(s string) bool {
+	if len(s) != 6 {
+		return false
+	}
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+func (e *Exchange) fee(instId string) Fee {
+	if f, ok := e.conf.InstFees[instId]; ok {
+		return f
+	}
+	return e.conf.Fee
+}
+
+func fmtFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func msStr(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
@@ -0,0 +1,282 @@
+package paper
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+	"v5sdk_go/oms"
+	"v5sdk_go/portfolio"
+	"v5sdk_go/trade"
+	"v5sdk_go/ws/wImpl"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func books5(instId string, bids, asks [][]string) wImpl.DepthData {
+	return wImpl.DepthData{
+		Arg:  map[string]string{"channel": "books5", "instId": instId},
+		Data: []wImpl.DepthDetail{{Bids: bids, Asks: asks, Ts: "1"}},
+	}
+}
+
+func level(px, sz string) []string {
+	return []string{px, sz, "0", "1"}
+}
+
+func cash(t *testing.T, ex *Exchange, ccy string) (bal, avail float64) {
+	accs, err := ex.Balance(context.Background())
+	assert.Nil(t, err)
+	for _, d := range accs[0].Details {
+		if d.Ccy == ccy {
+			bal, _ = strconv.ParseFloat(d.CashBal, 64)
+			avail, _ = strconv.ParseFloat(d.AvailBal, 64)
+		}
+	}
+	return
+}
+
+func TestSpot(t *testing.T) {
+	ctx := context.Background()
+	ex := New(Config{
+		Balances: map[string]float64{"USDT": 1000},
+		Fee:      Fee{Maker: 0.001, Taker: 0.002},
+	})
+	var updates []wImpl.OrderUpdate
+	var msgs []wImpl.MsgData
+	ex.AddOrderHook(func(ts time.Time, u wImpl.OrderUpdate) error {
+		updates = append(updates, u)
+		return nil
+	})
+	ex.AddMessageHook(func(ts time.Time, m wImpl.MsgData) error {
+		msgs = append(msgs, m)
+		return nil
+	})
+
+	// 没有行情时市价单被拒绝
+	buy := trade.PlaceOrderReq{InstId: "BTC-USDT", TdMode: trade.TD_MODE_CASH, Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_MARKET, Sz: "1.5", TgtCcy: trade.TGT_CCY_BASE}
+	res, err := ex.PlaceOrders(ctx, buy)
+	assert.Nil(t, err)
+	assert.Equal(t, CODE_NO_MARKET_DATA, res[0].SCode)
+
+	assert.Nil(t, ex.OnDepth(time.Now(), books5("BTC-USDT",
+		[][]string{level("99", "1"), level("98", "2")},
+		[][]string{level("101", "1"), level("102", "2")})))
+
+	// 市价单逐档成交
+	res, err = ex.PlaceOrders(ctx, buy)
+	assert.Nil(t, err)
+	assert.True(t, res[0].Success())
+	var states, fills []string
+	for _, u := range updates {
+		states = append(states, u.State)
+		fills = append(fills, u.FillPx+"/"+u.FillSz)
+	}
+	assert.Equal(t, []string{wImpl.ORDER_STATE_LIVE, wImpl.ORDER_STATE_PARTIALLY_FILLED, wImpl.ORDER_STATE_FILLED}, states)
+	assert.Equal(t, []string{"/", "101/1", "102/0.5"}, fills)
+	last := updates[2]
+	assert.Equal(t, "T", last.ExecType)
+	assert.Equal(t, "BTC", last.FillFeeCcy)
+	assert.Equal(t, "-0.001", last.FillFee)
+	assert.Equal(t, "1.5", last.AccFillSz)
+	bal, _ := cash(t, ex, "USDT")
+	assert.InDelta(t, 1000-101-51, bal, 1e-9)
+	bal, _ = cash(t, ex, "BTC")
+	assert.InDelta(t, 1.5*(1-0.002), bal, 1e-9)
+
+	// 原始推送与交易所格式一致
+	assert.Equal(t, "orders", msgs[0].Arg["channel"])
+	assert.Equal(t, "BTC-USDT", msgs[0].Data[0].(map[string]interface{})["instId"])
+
+	// 限价单挂单冻结余额，订单簿穿过挂单价后按挂单价成交
+	updates = nil
+	sell := trade.PlaceOrderReq{InstId: "BTC-USDT", TdMode: trade.TD_MODE_CASH, Side: trade.SIDE_SELL, OrdType: trade.ORD_TYPE_LIMIT, Px: "103", Sz: "1", ClOrdId: "s1"}
+	res, _ = ex.PlaceOrders(ctx, sell)
+	assert.True(t, res[0].Success())
+	_, avail := cash(t, ex, "BTC")
+	assert.InDelta(t, 1.5*(1-0.002)-1, avail, 1e-9)
+	pending, _ := ex.PendingOrders(ctx)
+	assert.Equal(t, 1, len(pending))
+
+	ex.OnDepth(time.Now(), books5("BTC-USDT", [][]string{level("103.5", "0.4")}, [][]string{level("104", "1")}))
+	o, err := ex.GetOrder(ctx, "BTC-USDT", "", "s1")
+	assert.Nil(t, err)
+	assert.Equal(t, wImpl.ORDER_STATE_PARTIALLY_FILLED, o.State)
+	assert.Equal(t, "0.4", o.AccFillSz)
+	assert.Equal(t, "103", updates[len(updates)-1].FillPx)
+	assert.Equal(t, "M", updates[len(updates)-1].ExecType)
+
+	// 改单后立即成交
+	res, err = ex.AmendOrders(ctx, trade.AmendOrderReq{InstId: "BTC-USDT", ClOrdId: "s1", NewPx: "103.5", NewSz: "0.8"})
+	assert.Nil(t, err)
+	assert.True(t, res[0].Success())
+	o, _ = ex.GetOrder(ctx, "BTC-USDT", "", "s1")
+	assert.Equal(t, wImpl.ORDER_STATE_FILLED, o.State)
+	pending, _ = ex.PendingOrders(ctx)
+	assert.Equal(t, 0, len(pending))
+
+	// 余额不足、只做maker、撤单
+	big := trade.PlaceOrderReq{InstId: "BTC-USDT", TdMode: trade.TD_MODE_CASH, Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_LIMIT, Px: "100", Sz: "100"}
+	res, _ = ex.PlaceOrders(ctx, big)
+	assert.Equal(t, CODE_INSUFFICIENT, res[0].SCode)
+	post := big
+	post.OrdType, post.Px, post.Sz = trade.ORD_TYPE_POST_ONLY, "104", "1"
+	res, _ = ex.PlaceOrders(ctx, post)
+	o, _ = ex.GetOrder(ctx, "", res[0].OrdId, "")
+	assert.Equal(t, wImpl.ORDER_STATE_CANCELED, o.State)
+	assert.Equal(t, CANCEL_SOURCE_POST_ONLY, o.CancelSource)
+
+	post.Px = "100"
+	res, _ = ex.PlaceOrders(ctx, post)
+	_, avail = cash(t, ex, "USDT")
+	bal, _ = cash(t, ex, "USDT")
+	assert.InDelta(t, bal-100, avail, 1e-9)
+	res, _ = ex.CancelOrders(ctx, trade.CancelOrderReq{InstId: "BTC-USDT", OrdId: res[0].OrdId})
+	assert.True(t, res[0].Success())
+	_, avail = cash(t, ex, "USDT")
+	assert.InDelta(t, bal, avail, 1e-9)
+	res, _ = ex.CancelOrders(ctx, trade.CancelOrderReq{InstId: "BTC-USDT", OrdId: res[0].OrdId})
+	assert.Equal(t, CODE_CANCEL_FAILED, res[0].SCode)
+	_, err = ex.GetOrder(ctx, "BTC-USDT", "404", "")
+	assert.Equal(t, oms.ErrNotFound, err)
+}
+
+func TestSwap(t *testing.T) {
+	ctx := context.Background()
+	ex := New(Config{
+		Balances: map[string]float64{"USDT": 1000},
+		Fee:      Fee{Taker: 0.001},
+		Insts:    map[string]Inst{"BTC-USDT-SWAP": {CtVal: 0.01}},
+	})
+	var positions []wImpl.PositionDetail
+	ex.AddPositionHook(func(ts time.Time, p wImpl.PositionDetail) error {
+		positions = append(positions, p)
+		return nil
+	})
+	ex.OnDepth(time.Now(), books5("BTC-USDT-SWAP", [][]string{level("9990", "100")}, [][]string{level("10010", "100")}))
+
+	order := func(side string, sz string, reduceOnly bool) trade.OrderResult {
+		res, err := ex.PlaceOrders(ctx, trade.PlaceOrderReq{InstId: "BTC-USDT-SWAP", TdMode: trade.TD_MODE_CROSS, Side: side, OrdType: trade.ORD_TYPE_MARKET, Sz: sz, ReduceOnly: reduceOnly})
+		assert.Nil(t, err)
+		return res[0]
+	}
+
+	assert.Equal(t, CODE_REDUCE_ONLY, order(trade.SIDE_SELL, "1", true).SCode)
+	assert.True(t, order(trade.SIDE_BUY, "10", false).Success())
+	p := positions[len(positions)-1]
+	assert.Equal(t, "10", p.Pos)
+	assert.Equal(t, "10010", p.AvgPx)
+	assert.Equal(t, trade.POS_SIDE_NET, p.PosSide)
+	assert.Equal(t, "-1", p.Upl)
+
+	// 反向开仓
+	ex.OnDepth(time.Now(), books5("BTC-USDT-SWAP", [][]string{level("10110", "100")}, [][]string{level("10120", "100")}))
+	assert.True(t, order(trade.SIDE_SELL, "15", false).Success())
+	p = positions[len(positions)-1]
+	assert.Equal(t, "-5", p.Pos)
+	assert.Equal(t, "10110", p.AvgPx)
+	bal, _ := cash(t, ex, "USDT")
+	fee := 0.001 * 0.01 * (10*10010 + 15*10110)
+	assert.InDelta(t, 1000+10*0.01*100-fee, bal, 1e-9)
+
+	assert.True(t, order(trade.SIDE_BUY, "5", true).Success())
+	p = positions[len(positions)-1]
+	assert.Equal(t, "0", p.Pos)
+	all, _ := ex.Positions(ctx)
+	assert.Equal(t, 0, len(all))
+
+	// 开平仓模式
+	long := trade.PlaceOrderReq{InstId: "BTC-USDT-SWAP", TdMode: trade.TD_MODE_ISOLATED, Side: trade.SIDE_SELL, PosSide: trade.POS_SIDE_LONG, OrdType: trade.ORD_TYPE_MARKET, Sz: "1"}
+	res, _ := ex.PlaceOrders(ctx, long)
+	assert.Equal(t, CODE_REDUCE_ONLY, res[0].SCode)
+	short := long
+	short.PosSide = trade.POS_SIDE_SHORT
+	res, _ = ex.PlaceOrders(ctx, short)
+	assert.True(t, res[0].Success())
+	p = positions[len(positions)-1]
+	assert.Equal(t, "1", p.Pos)
+	assert.Equal(t, trade.POS_SIDE_SHORT, p.PosSide)
+	assert.Equal(t, "-0.05", p.Upl)
+}
+
+func TestMargin(t *testing.T) {
+	ctx := context.Background()
+	ex := New(Config{
+		Balances: map[string]float64{"USDT": 100},
+		Insts:    map[string]Inst{"BTC-USDT-SWAP": {CtVal: 0.01}, "ETH-USDT-SWAP": {CtVal: 0.1, Lever: 20}},
+	})
+	ex.OnDepth(time.Now(), books5("BTC-USDT-SWAP", [][]string{level("9990", "100")}, [][]string{level("10010", "100")}))
+	ex.OnDepth(time.Now(), books5("ETH-USDT-SWAP", [][]string{level("999", "100")}, [][]string{level("1001", "100")}))
+	place := func(req trade.PlaceOrderReq) trade.OrderResult {
+		res, err := ex.PlaceOrders(ctx, req)
+		assert.Nil(t, err)
+		return res[0]
+	}
+	buy := trade.PlaceOrderReq{InstId: "BTC-USDT-SWAP", TdMode: trade.TD_MODE_CROSS, Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_MARKET, Sz: "10"}
+
+	// 名义价值 1001，默认 10 倍杠杆需要 100.1 的保证金
+	assert.Equal(t, CODE_INSUFFICIENT, place(buy).SCode)
+	buy.Sz = "5"
+	assert.True(t, place(buy).Success())
+
+	// 挂单占用保证金
+	limit := trade.PlaceOrderReq{InstId: "ETH-USDT-SWAP", TdMode: trade.TD_MODE_CROSS, Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_LIMIT, Px: "900", Sz: "10"}
+	res := place(limit)
+	assert.True(t, res.Success())
+	assert.Equal(t, CODE_INSUFFICIENT, place(limit).SCode)
+	amend, _ := ex.AmendOrders(ctx, trade.AmendOrderReq{InstId: "ETH-USDT-SWAP", OrdId: res.OrdId, NewSz: "20"})
+	assert.Equal(t, CODE_AMEND_FAILED, amend[0].SCode)
+
+	// 平仓不检查保证金
+	sell := trade.PlaceOrderReq{InstId: "BTC-USDT-SWAP", TdMode: trade.TD_MODE_CROSS, Side: trade.SIDE_SELL, OrdType: trade.ORD_TYPE_MARKET, Sz: "5", ReduceOnly: true}
+	assert.True(t, place(sell).Success())
+	assert.True(t, place(limit).Success())
+}
+
+func TestStrategyUnchanged(t *testing.T) {
+	ctx := context.Background()
+	ex := New(Config{Balances: map[string]float64{"USDT": 1000}, Latency: 5 * time.Millisecond})
+	ex.OnDepth(time.Now(), books5("ETH-USDT", [][]string{level("99", "10")}, [][]string{level("101", "10")}))
+
+	// 订单管理和持仓跟踪与连接交易所时的用法相同
+	o := oms.New(ex)
+	ex.AddOrderHook(o.OnOrderUpdate)
+	tracker := portfolio.New()
+	ex.AddAccountHook(tracker.OnAccount)
+	assert.Nil(t, tracker.Seed(ctx, ex))
+
+	rejected := errors.New("rejected")
+	ex.SetPreTradeCheck(trade.PreTradeCheckFunc(func(ctx context.Context, op string, args []map[string]interface{}) error {
+		if args[0]["px"] == "1" {
+			return rejected
+		}
+		return nil
+	}))
+
+	start := time.Now()
+	res, err := o.PlaceOrders(ctx, trade.PlaceOrderReq{InstId: "ETH-USDT", TdMode: trade.TD_MODE_CASH, Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_LIMIT, Px: "100", Sz: "2"})
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) >= 5*time.Millisecond)
+	assert.True(t, res[0].Success())
+	got, ok := o.Get(res[0].ClOrdId)
+	assert.True(t, ok)
+	assert.Equal(t, oms.STATE_LIVE, got.State)
+	b, ok := tracker.Balance("USDT")
+	assert.True(t, ok)
+	assert.Equal(t, "800", b.AvailBal)
+
+	ex.OnDepth(time.Now(), books5("ETH-USDT", [][]string{level("99", "10")}, [][]string{level("100", "10")}))
+	got, _ = o.Get(res[0].ClOrdId)
+	assert.Equal(t, oms.STATE_FILLED, got.State)
+	b, _ = tracker.Balance("ETH")
+	assert.Equal(t, "2", b.CashBal)
+
+	_, err = ex.PlaceOrders(ctx, trade.PlaceOrderReq{InstId: "ETH-USDT", TdMode: trade.TD_MODE_CASH, Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_LIMIT, Px: "1", Sz: "2"})
+	assert.True(t, errors.Is(err, rejected) && trade.IsRejected(err))
+	res, err = o.PlaceOrders(ctx, trade.PlaceOrderReq{InstId: "ETH-USDT", TdMode: trade.TD_MODE_CASH, Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_LIMIT, Px: "1", Sz: "2", ClOrdId: "rejected1"})
+	assert.True(t, errors.Is(err, rejected))
+	got, _ = o.Get("rejected1")
+	assert.Equal(t, oms.STATE_REJECTED, got.State)
+	assert.Nil(t, o.Reconcile(ctx, ex))
+}
@@ -0,0 +1,455 @@
+/*
+	账户余额和持仓的本地视图
+	由 REST 接口初始化，之后由 account、positions、balance_and_position 频道的推送维护
+*/
+package portfolio
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"v5sdk_go/utils"
+	"v5sdk_go/ws/wImpl"
+)
+
+/*
+	账户整体信息
+	MgnRatio: 保证金率，逐仓和全仓的计算方式不同，见交易所文档
+*/
+type Account struct {
+	TotalEq     string
+	IsoEq       string
+	AdjEq       string
+	OrdFroz     string
+	Imr         string
+	Mmr         string
+	MgnRatio    string
+	NotionalUsd string
+	Upl         string
+	UTime       time.Time
+}
+
+/*
+	币种余额
+*/
+type Balance struct {
+	Ccy       string
+	Eq        string
+	CashBal   string
+	AvailBal  string
+	AvailEq   string
+	FrozenBal string
+	OrdFrozen string
+	Liab      string
+	Upl       string
+	MgnRatio  string
+	EqUsd     string
+	UTime     time.Time
+}
+
+/*
+	持仓，按 InstId 和 PosSide 区分
+*/
+type Position struct {
+	InstId   string
+	InstType string
+	PosSide  string
+	MgnMode  string
+	PosId    string
+	Ccy      string
+	Pos      string
+	AvailPos string
+	AvgPx    string
+	Upl      string
+	UplRatio string
+	Lever    string
+	LiqPx    string
+	MarkPx   string
+	Margin   string
+	MgnRatio string
+	Imr      string
+	Mmr      string
+	UTime    time.Time
+}
+
+/*
+	持仓数量是否为 0
+*/
+func (p Position) IsEmpty() bool {
+	f, err := strconv.ParseFloat(p.Pos, 64)
+	return err != nil || f == 0
+}
+
+type EventType int
+
+const (
+	EVENT_ACCOUNT  EventType = iota // 账户整体信息变化
+	EVENT_BALANCE                   // 币种余额变化
+	EVENT_POSITION                  // 持仓变化
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EVENT_ACCOUNT:
+		return "account"
+	case EVENT_BALANCE:
+		return "balance"
+	case EVENT_POSITION:
+		return "position"
+	}
+	return "unknown"
+}
+
+/*
+	变化事件，根据 Type 只有对应的字段有效
+	Closed: 持仓已全部平仓，Position 为平仓前的最后状态
+*/
+type Event struct {
+	Type     EventType
+	Account  Account
+	Balance  Balance
+	Position Position
+	Closed   bool
+}
+
+// 变化事件回调函数
+type EventCallback func(Event)
+
+/*
+	初始化数据来源
+*/
+type Source interface {
+	Balance(ctx context.Context) ([]wImpl.AccountDetail, error)
+	Positions(ctx context.Context) ([]wImpl.PositionDetail, error)
+}
+
+/*
+	账户余额和持仓跟踪，可被多个协程并发查询
+	例如:
+	p := portfolio.New()
+	p.Attach(cli)
+	p.Seed(ctx, portfolio.NewRestSource(restCli))
+	p.Subscribe(ctx, cli)
+	pos, ok := p.Position("BTC-USDT-SWAP", "long")
+*/
+type Tracker struct {
+	lock      sync.RWMutex
+	account   Account
+	balances  map[string]*Balance
+	positions map[string]*Position // key 为 posKey
+	hooks     []EventCallback
+}
+
+func New() *Tracker {
+	return &Tracker{
+		balances:  make(map[string]*Balance),
+		positions: make(map[string]*Position),
+	}
+}
+
+/*
+	添加变化事件的回调函数，回调函数在触发事件的协程中同步执行
+*/
+func (t *Tracker) AddEventHook(fn EventCallback) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.hooks = append(t.hooks, fn)
+}
+
+/*
+	使用 REST 接口查询的数据初始化
+	快照中不存在且在查询前未更新的持仓视为已平仓
+*/
+func (t *Tracker) Seed(ctx context.Context, src Source) error {
+	start := time.Now()
+	accounts, err := src.Balance(ctx)
+	if err != nil {
+		return err
+	}
+	positions, err := src.Positions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var evts []Event
+	t.lock.Lock()
+	for _, a := range accounts {
+		evts = append(evts, t.applyAccount(a)...)
+	}
+	seen := make(map[string]bool, len(positions))
+	for _, p := range positions {
+		seen[posKey(p.InstId, p.PosSide)] = true
+		evts = append(evts, t.applyPosition(p, true)...)
+	}
+	// 查询开始后有更新的持仓以推送为准
+	for k, p := range t.positions {
+		if !seen[k] && p.UTime.Before(start) {
+			delete(t.positions, k)
+			evts = append(evts, Event{Type: EVENT_POSITION, Position: *p, Closed: true})
+		}
+	}
+	t.lock.Unlock()
+	t.emit(evts)
+	return nil
+}
+
+/*
+	处理 account 频道的推送，可直接作为 WsClient 的账户回调函数
+*/
+func (t *Tracker) OnAccount(ts time.Time, a wImpl.AccountDetail) error {
+	t.lock.Lock()
+	evts := t.applyAccount(a)
+	t.lock.Unlock()
+	t.emit(evts)
+	return nil
+}
+
+/*
+	处理 positions 频道的推送，可直接作为 WsClient 的持仓回调函数
+*/
+func (t *Tracker) OnPosition(ts time.Time, p wImpl.PositionDetail) error {
+	t.lock.Lock()
+	evts := t.applyPosition(p, true)
+	t.lock.Unlock()
+	t.emit(evts)
+	return nil
+}
+
+/*
+	处理 balance_and_position 频道的推送，可直接作为 WsClient 的回调函数
+	该频道只包含余额和持仓数量、均价，其余字段保持不变
+*/
+func (t *Tracker) OnBalAndPos(ts time.Time, d wImpl.BalAndPosDetail) error {
+	var evts []Event
+	t.lock.Lock()
+	for _, b := range d.BalData {
+		evts = append(evts, t.applyBalance(wImpl.AccountCcyBal{Ccy: b.Ccy, CashBal: b.CashBal, UTime: b.UTime})...)
+	}
+	for _, p := range d.PosData {
+		evts = append(evts, t.applyPosition(wImpl.PositionDetail{
+			PosId:    p.PosId,
+			InstId:   p.InstId,
+			InstType: p.InstType,
+			MgnMode:  p.MgnMode,
+			PosSide:  p.PosSide,
+			Pos:      p.Pos,
+			Ccy:      p.Ccy,
+			PosCcy:   p.PosCcy,
+			AvgPx:    p.AvgPx,
+			UTime:    p.UTime,
+		}, false)...)
+	}
+	t.lock.Unlock()
+	t.emit(evts)
+	return nil
+}
+
+/*
+	获取账户整体信息
+*/
+func (t *Tracker) Account() Account {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.account
+}
+
+/*
+	获取币种余额
+*/
+func (t *Tracker) Balance(ccy string) (b Balance, ok bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	v, ok := t.balances[ccy]
+	if ok {
+		b = *v
+	}
+	return
+}
+
+/*
+	获取全部币种余额，按币种排序
+*/
+func (t *Tracker) Balances() []Balance {
+	t.lock.RLock()
+	res := make([]Balance, 0, len(t.balances))
+	for _, v := range t.balances {
+		res = append(res, *v)
+	}
+	t.lock.RUnlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Ccy < res[j].Ccy
+	})
+	return res
+}
+
+/*
+	获取持仓
+	posSide: 持仓方向，买卖模式下为 net
+*/
+func (t *Tracker) Position(instId, posSide string) (p Position, ok bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	v, ok := t.positions[posKey(instId, posSide)]
+	if ok {
+		p = *v
+	}
+	return
+}
+
+/*
+	获取持仓列表，按产品ID和持仓方向排序
+	instId: 产品ID，为空时返回全部
+*/
+func (t *Tracker) Positions(instId string) []Position {
+	t.lock.RLock()
+	res := make([]Position, 0)
+	for _, v := range t.positions {
+		if instId == "" || v.InstId == instId {
+			res = append(res, *v)
+		}
+	}
+	t.lock.RUnlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].InstId != res[j].InstId {
+			return res[i].InstId < res[j].InstId
+		}
+		return res[i].PosSide < res[j].PosSide
+	})
+	return res
+}
+
+func posKey(instId, posSide string) string {
+	return instId + "|" + posSide
+}
+
+/*
+	调用方需持有 t.lock
+*/
+func (t *Tracker) applyAccount(a wImpl.AccountDetail) (evts []Event) {
+	uTime := utils.MsTime(a.UTime)
+	if uTime.IsZero() || !uTime.Before(t.account.UTime) {
+		acc := &t.account
+		utils.SetNonEmpty(&acc.TotalEq, a.TotalEq)
+		utils.SetNonEmpty(&acc.IsoEq, a.IsoEq)
+		utils.SetNonEmpty(&acc.AdjEq, a.AdjEq)
+		utils.SetNonEmpty(&acc.OrdFroz, a.OrdFroz)
+		utils.SetNonEmpty(&acc.Imr, a.Imr)
+		utils.SetNonEmpty(&acc.Mmr, a.Mmr)
+		utils.SetNonEmpty(&acc.MgnRatio, a.MgnRatio)
+		utils.SetNonEmpty(&acc.NotionalUsd, a.NotionalUsd)
+		utils.SetNonEmpty(&acc.Upl, a.Upl)
+		if !uTime.IsZero() {
+			acc.UTime = uTime
+		}
+		evts = append(evts, Event{Type: EVENT_ACCOUNT, Account: *acc})
+	}
+
+	for _, b := range a.Details {
+		evts = append(evts, t.applyBalance(b)...)
+	}
+	return
+}
+
+/*
+	调用方需持有 t.lock
+*/
+func (t *Tracker) applyBalance(b wImpl.AccountCcyBal) (evts []Event) {
+	if b.Ccy == "" {
+		return
+	}
+	uTime := utils.MsTime(b.UTime)
+	v, ok := t.balances[b.Ccy]
+	if !ok {
+		v = &Balance{Ccy: b.Ccy}
+		t.balances[b.Ccy] = v
+	} else if uTime.Before(v.UTime) {
+		// 过期的推送
+		return
+	}
+
+	utils.SetNonEmpty(&v.Eq, b.Eq)
+	utils.SetNonEmpty(&v.CashBal, b.CashBal)
+	utils.SetNonEmpty(&v.AvailBal, b.AvailBal)
+	utils.SetNonEmpty(&v.AvailEq, b.AvailEq)
+	utils.SetNonEmpty(&v.FrozenBal, b.FrozenBal)
+	utils.SetNonEmpty(&v.OrdFrozen, b.OrdFrozen)
+	utils.SetNonEmpty(&v.Liab, b.Liab)
+	utils.SetNonEmpty(&v.Upl, b.Upl)
+	utils.SetNonEmpty(&v.MgnRatio, b.MgnRatio)
+	utils.SetNonEmpty(&v.EqUsd, b.EqUsd)
+	if !uTime.IsZero() {
+		v.UTime = uTime
+	}
+	evts = append(evts, Event{Type: EVENT_BALANCE, Balance: *v})
+	return
+}
+
+/*
+	持仓数量为 0 时删除持仓，调用方需持有 t.lock
+	full: 是否为完整的持仓数据，完整数据中为空的字段(如强平价)也会覆盖原值
+*/
+func (t *Tracker) applyPosition(p wImpl.PositionDetail, full bool) (evts []Event) {
+	if p.InstId == "" {
+		return
+	}
+	k := posKey(p.InstId, p.PosSide)
+	uTime := utils.MsTime(p.UTime)
+	v, ok := t.positions[k]
+	if !ok {
+		v = &Position{InstId: p.InstId, PosSide: p.PosSide}
+	} else if uTime.Before(v.UTime) {
+		// 过期的推送
+		return
+	}
+
+	utils.SetNonEmpty(&v.InstType, p.InstType)
+	utils.SetNonEmpty(&v.MgnMode, p.MgnMode)
+	utils.SetNonEmpty(&v.PosId, p.PosId)
+	utils.SetNonEmpty(&v.Ccy, p.Ccy)
+	utils.SetNonEmpty(&v.Pos, p.Pos)
+	utils.SetNonEmpty(&v.AvgPx, p.AvgPx)
+	if full {
+		v.AvailPos = p.AvailPos
+		v.Upl = p.Upl
+		v.UplRatio = p.UplRatio
+		v.Lever = p.Lever
+		v.LiqPx = p.LiqPx
+		v.MarkPx = p.MarkPx
+		v.Margin = p.Margin
+		v.MgnRatio = p.MgnRatio
+		v.Imr = p.Imr
+		v.Mmr = p.Mmr
+	}
+	if !uTime.IsZero() {
+		v.UTime = uTime
+	}
+
+	if v.IsEmpty() {
+		if ok {
+			delete(t.positions, k)
+			evts = append(evts, Event{Type: EVENT_POSITION, Position: *v, Closed: true})
+		}
+		return
+	}
+	t.positions[k] = v
+	evts = append(evts, Event{Type: EVENT_POSITION, Position: *v})
+	return
+}
+
+func (t *Tracker) emit(evts []Event) {
+	if len(evts) == 0 {
+		return
+	}
+	t.lock.RLock()
+	hooks := t.hooks
+	t.lock.RUnlock()
+	for _, evt := range evts {
+		for _, fn := range hooks {
+			fn(evt)
+		}
+	}
+}
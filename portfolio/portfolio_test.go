@@ -0,0 +1,92 @@
+package portfolio
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+	"v5sdk_go/ws/wImpl"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSource struct {
+	accounts  []wImpl.AccountDetail
+	positions []wImpl.PositionDetail
+}
+
+func (s *fakeSource) Balance(ctx context.Context) ([]wImpl.AccountDetail, error) {
+	return s.accounts, nil
+}
+
+func (s *fakeSource) Positions(ctx context.Context) ([]wImpl.PositionDetail, error) {
+	return s.positions, nil
+}
+
+func TestTracker(t *testing.T) {
+	p := New()
+	var lock sync.Mutex
+	var evts []Event
+	p.AddEventHook(func(e Event) {
+		lock.Lock()
+		evts = append(evts, e)
+		lock.Unlock()
+	})
+
+	// 推送早于初始化到达的持仓
+	p.OnPosition(time.Now(), wImpl.PositionDetail{InstId: "ETH-USDT-SWAP", PosSide: "net", Pos: "3", UTime: "1600000000000"})
+
+	src := &fakeSource{
+		accounts: []wImpl.AccountDetail{{
+			TotalEq: "10000", MgnRatio: "12.5", UTime: "1700000000000",
+			Details: []wImpl.AccountCcyBal{{Ccy: "USDT", Eq: "9000", CashBal: "9000", AvailBal: "8000", UTime: "1700000000000"}, {Ccy: "BTC", Eq: "0.1", CashBal: "0.1", UTime: "1700000000000"}},
+		}},
+		positions: []wImpl.PositionDetail{
+			{InstId: "BTC-USDT-SWAP", PosSide: "long", MgnMode: "cross", Pos: "2", AvgPx: "30000", Upl: "10", LiqPx: "20000", MgnRatio: "15", UTime: "1700000000000"},
+		},
+	}
+	assert.Nil(t, p.Seed(context.Background(), src))
+
+	assert.Equal(t, "12.5", p.Account().MgnRatio)
+	b, ok := p.Balance("USDT")
+	assert.True(t, ok)
+	assert.Equal(t, "8000", b.AvailBal)
+	assert.Equal(t, []string{"BTC", "USDT"}, []string{p.Balances()[0].Ccy, p.Balances()[1].Ccy})
+
+	pos, ok := p.Position("BTC-USDT-SWAP", "long")
+	assert.True(t, ok)
+	assert.Equal(t, "20000", pos.LiqPx)
+	// 快照中不存在的持仓已平仓
+	_, ok = p.Position("ETH-USDT-SWAP", "net")
+	assert.False(t, ok)
+	assert.True(t, evts[len(evts)-1].Closed)
+
+	// 余额和持仓频道只更新数量和均价
+	evts = nil
+	p.OnBalAndPos(time.Now(), wImpl.BalAndPosDetail{
+		BalData: []wImpl.BalDetail{{Ccy: "USDT", CashBal: "8500", UTime: "1700000001000"}},
+		PosData: []wImpl.PosDetail{{InstId: "BTC-USDT-SWAP", PosSide: "long", Pos: "3", AvgPx: "31000", UTime: "1700000001000"}},
+	})
+	assert.Equal(t, 2, len(evts))
+	b, _ = p.Balance("USDT")
+	assert.Equal(t, "8500", b.CashBal)
+	assert.Equal(t, "8000", b.AvailBal)
+	pos, _ = p.Position("BTC-USDT-SWAP", "long")
+	assert.Equal(t, "3", pos.Pos)
+	assert.Equal(t, "31000", pos.AvgPx)
+	assert.Equal(t, "20000", pos.LiqPx)
+
+	// 过期的推送
+	evts = nil
+	p.OnPosition(time.Now(), wImpl.PositionDetail{InstId: "BTC-USDT-SWAP", PosSide: "long", Pos: "1", UTime: "1690000000000"})
+	assert.Equal(t, 0, len(evts))
+	p.OnAccount(time.Now(), wImpl.AccountDetail{MgnRatio: "1", UTime: "1690000000000"})
+	assert.Equal(t, "12.5", p.Account().MgnRatio)
+
+	// 平仓
+	p.OnPosition(time.Now(), wImpl.PositionDetail{InstId: "BTC-USDT-SWAP", PosSide: "long", Pos: "0", UTime: "1700000002000"})
+	assert.Equal(t, 1, len(evts))
+	assert.Equal(t, EVENT_POSITION, evts[0].Type)
+	assert.True(t, evts[0].Closed)
+	assert.Equal(t, 0, len(p.Positions("")))
+}
@@ -0,0 +1,66 @@
+package portfolio
+
+import (
+	"context"
+	"errors"
+	"v5sdk_go/rest"
+	"v5sdk_go/ws"
+	"v5sdk_go/ws/wImpl"
+)
+
+/*
+	使用 REST 接口查询余额和持仓
+*/
+type RestSource struct {
+	cli *rest.RESTAPI
+}
+
+func NewRestSource(cli *rest.RESTAPI) *RestSource {
+	return &RestSource{cli: cli}
+}
+
+func (s *RestSource) Balance(ctx context.Context) ([]wImpl.AccountDetail, error) {
+	cli := *s.cli
+	return cli.Balance(ctx, "")
+}
+
+func (s *RestSource) Positions(ctx context.Context) ([]wImpl.PositionDetail, error) {
+	cli := *s.cli
+	return cli.Positions(ctx, "", "")
+}
+
+/*
+	设置 WsClient 的账户、持仓、账户余额和持仓频道的回调函数
+	注：会替换 WsClient 上已设置的这三个回调函数
+*/
+func (t *Tracker) Attach(cli *ws.WsClient) {
+	cli.AddAccountHook(t.OnAccount)
+	cli.AddPositionHook(t.OnPosition)
+	cli.AddBalAndPosHook(t.OnBalAndPos)
+}
+
+/*
+	订阅账户、全部持仓、账户余额和持仓频道，需先登录
+*/
+func (t *Tracker) Subscribe(ctx context.Context, cli *ws.WsClient) error {
+	all := []map[string]string{{}}
+	subs := []struct {
+		name string
+		fn   func(context.Context, string, []map[string]string) (bool, []*ws.Msg, error)
+		args []map[string]string
+	}{
+		{"账户频道", cli.PrivAccoutCtx, all},
+		{"持仓频道", cli.PrivPostionCtx, []map[string]string{{"instType": ws.ANY}}},
+		{"账户余额和持仓频道", cli.PrivBalAndPosCtx, all},
+	}
+	for _, sub := range subs {
+		res, _, err := sub.fn(ctx, ws.OP_SUBSCRIBE, sub.args)
+		if err == nil && !res {
+			err = errors.New("订阅" + sub.name + "失败")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ const (
 	OK_ACCESS_TIMESTAMP  = "OK-ACCESS-TIMESTAMP"
 	OK_ACCESS_PASSPHRASE = "OK-ACCESS-PASSPHRASE"
 	X_SIMULATE_TRADING   = "x-simulated-trading"
+	EXP_TIME             = "expTime"
 
 	CONTENT_TYPE = "Content-Type"
 	ACCEPT       = "Accept"
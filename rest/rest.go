@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"strings"
 	"time"
+	"v5sdk_go/trade"
 	. "v5sdk_go/utils"
 )
 
@@ -22,6 +23,14 @@ type RESTAPI struct {
 	Timeout    time.Duration
 	ApiKeyInfo *APIKeyInfo
 	isSimulate bool
+	// POST请求体，不为空时代替 Param，用于批量接口的数组参数
+	body interface{}
+	// 请求过期时间，毫秒时间戳
+	expTime string
+	// 分批下单/撤单/改单共用的限速器
+	limiter *RateLimiter
+	// 下单前检查
+	preTrade trade.PreTradeCheck
 }
 
 type APIKeyInfo struct {
@@ -62,6 +71,7 @@ func NewRESTClient(endPoint string, apiKey *APIKeyInfo, isSimulate bool) *RESTAP
 		ApiKeyInfo: apiKey,
 		isSimulate: isSimulate,
 		Timeout:    5 * time.Second,
+		limiter:    trade.NewOrderLimiter(),
 	}
 	return res
 }
@@ -129,9 +139,35 @@ func (this *RESTAPI) Get(ctx context.Context, uri string, param *map[string]inte
 		reqParam = *param
 	}
 	this.Param = reqParam
+	this.body = nil
+	this.expTime = ""
 	return this.Run(ctx)
 }
 
+/*
+	GET请求，将返回数据的 data 字段解析到 v
+	code: 返回码，请求成功但返回码不为 "0" 时 err 不为空
+*/
+func (this *RESTAPI) getData(ctx context.Context, uri string, param map[string]interface{}, v interface{}) (code string, err error) {
+	res, err := this.Get(ctx, uri, &param)
+	if err != nil {
+		return
+	}
+	rsp := res.V5Response
+	code = rsp.Code
+	if rsp.Code != "0" {
+		err = errors.New("请求失败:" + rsp.Code + " " + rsp.Msg)
+		return
+	}
+
+	raw, err := json.Marshal(rsp.Data)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(raw, v)
+	return
+}
+
 // POST请求
 func (this *RESTAPI) Post(ctx context.Context, uri string, param *map[string]interface{}) (res *RESTAPIResult, err error) {
 	this.Method = POST
@@ -143,6 +179,27 @@ func (this *RESTAPI) Post(ctx context.Context, uri string, param *map[string]int
 		reqParam = *param
 	}
 	this.Param = reqParam
+	this.body = nil
+	this.expTime = ""
+
+	// 直接调用交易接口时同样执行下单前检查
+	if err = this.checkOrders(ctx, trade.OpOfUri(uri), []map[string]interface{}{reqParam}); err != nil {
+		return
+	}
+
+	return this.Run(ctx)
+}
+
+/*
+	POST请求，请求体为任意可序列化的数据
+	expTime: 请求过期时间(毫秒时间戳)，为空时不设置
+*/
+func (this *RESTAPI) PostBody(ctx context.Context, uri string, body interface{}, expTime string) (res *RESTAPIResult, err error) {
+	this.Method = POST
+	this.Uri = uri
+	this.Param = nil
+	this.body = body
+	this.expTime = expTime
 
 	return this.Run(ctx)
 }
@@ -251,7 +308,11 @@ func (this *RESTAPI) GenReqInfo() (uri string, body string, err error) {
 	case POST:
 
 		var rawBody []byte
-		rawBody, err = json.Marshal(this.Param)
+		if this.body != nil {
+			rawBody, err = json.Marshal(this.body)
+		} else {
+			rawBody, err = json.Marshal(this.Param)
+		}
 		if err != nil {
 			return
 		}
@@ -297,6 +358,11 @@ func (this *RESTAPI) SetHeaders(request *http.Request, timestamp string, sign st
 	request.Header.Add(OK_ACCESS_PASSPHRASE, this.ApiKeyInfo.PassPhrase)
 	header += OK_ACCESS_PASSPHRASE + ":" + this.ApiKeyInfo.PassPhrase + "\n"
 
+	if this.expTime != "" {
+		request.Header.Add(EXP_TIME, this.expTime)
+		header += EXP_TIME + ":" + this.expTime + "\n"
+	}
+
 	//模拟盘交易标记
 	if this.isSimulate {
 		request.Header.Add(X_SIMULATE_TRADING, "1")
@@ -0,0 +1,42 @@
+package rest
+
+import (
+	"context"
+	"v5sdk_go/ws/wImpl"
+)
+
+// REST账户接口地址
+const (
+	URI_ACCOUNT_BALANCE   = "/api/v5/account/balance"
+	URI_ACCOUNT_POSITIONS = "/api/v5/account/positions"
+)
+
+/*
+	查询账户余额
+	ccy: 币种，多个币种用逗号分隔，为空时查询全部
+*/
+func (this *RESTAPI) Balance(ctx context.Context, ccy string) (accounts []wImpl.AccountDetail, err error) {
+	param := map[string]interface{}{}
+	if ccy != "" {
+		param["ccy"] = ccy
+	}
+	_, err = this.getData(ctx, URI_ACCOUNT_BALANCE, param, &accounts)
+	return
+}
+
+/*
+	查询持仓
+	instType: 产品类型，为空时查询全部
+	instId: 产品ID，为空时查询全部
+*/
+func (this *RESTAPI) Positions(ctx context.Context, instType, instId string) (positions []wImpl.PositionDetail, err error) {
+	param := map[string]interface{}{}
+	if instType != "" {
+		param["instType"] = instType
+	}
+	if instId != "" {
+		param["instId"] = instId
+	}
+	_, err = this.getData(ctx, URI_ACCOUNT_POSITIONS, param, &positions)
+	return
+}
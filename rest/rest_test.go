@@ -2,8 +2,19 @@ package rest
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+	"v5sdk_go/trade"
+
+	"github.com/stretchr/testify/assert"
 )
 
 /*
@@ -98,3 +109,198 @@ func TestRESTAPIPost(t *testing.T) {
 	fmt.Println("\terrMsg: ", rsp.V5Response.Msg)
 	fmt.Println("\tdata: ", rsp.V5Response.Data)
 }
+
+/*
+	类型化下单，批量时请求体为数组
+*/
+func TestPlaceOrders(t *testing.T) {
+	var body, uri, exp string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := ioutil.ReadAll(r.Body)
+		body = string(raw)
+		uri = r.URL.Path
+		exp = r.Header.Get(EXP_TIME)
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"clOrdId":"a1","ordId":"1","sCode":"0","sMsg":""},{"clOrdId":"a2","ordId":"","sCode":"51008","sMsg":"insufficient balance"}]}`))
+	}))
+	defer srv.Close()
+
+	cli := NewRESTClient(srv.URL, &APIKeyInfo{ApiKey: "k", SecKey: "s", PassPhrase: "p"}, true)
+	o := trade.PlaceOrderReq{InstId: "BTC-USDT", TdMode: trade.TD_MODE_CASH, Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_LIMIT, Px: "1", Sz: "1", ClOrdId: "a1"}
+	o2 := o
+	o2.ClOrdId = "a2"
+	o2.ExpTime = time.Unix(1700000000, 0)
+
+	_, results, err := cli.PlaceOrders(context.Background(), o, o2)
+	assert.Nil(t, err)
+	assert.Equal(t, trade.URI_BATCH_ORDERS, uri)
+	assert.True(t, strings.HasPrefix(body, "["))
+	assert.Equal(t, "1700000000000", exp)
+	assert.Equal(t, 2, len(results))
+	assert.True(t, results[0].Success())
+	assert.Equal(t, "51008", results[1].SCode)
+
+	// 单个订单请求体为对象
+	_, _, err = cli.PlaceOrders(context.Background(), o)
+	assert.Nil(t, err)
+	assert.Equal(t, trade.URI_ORDER, uri)
+	assert.True(t, strings.HasPrefix(body, "{"))
+	assert.Equal(t, "", exp)
+
+	// 参数错误时不发送请求
+	uri = ""
+	o.OrdType = "ordtype"
+	_, _, err = cli.PlaceOrders(context.Background(), o)
+	assert.NotNil(t, err)
+	assert.Equal(t, "", uri)
+}
+
+func TestCancelAllAfter(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := ioutil.ReadAll(r.Body)
+		body = string(raw)
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"triggerTime":"1700000060000","tag":"","ts":"1700000000000"}]}`))
+	}))
+	defer srv.Close()
+
+	cli := NewRESTClient(srv.URL, &APIKeyInfo{ApiKey: "k", SecKey: "s", PassPhrase: "p"}, true)
+	_, tm, err := cli.CancelAllAfter(context.Background(), 60*time.Second, "")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"timeOut":"60"}`, body)
+	assert.Equal(t, time.Unix(1700000060, 0), tm)
+
+	_, _, err = cli.CancelAllAfter(context.Background(), 5*time.Second, "")
+	assert.NotNil(t, err)
+
+	arm := cli.CancelAllAfterFunc("mm")
+	tm, err = arm(context.Background(), 60*time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"tag":"mm","timeOut":"60"}`, body)
+	assert.Equal(t, time.Unix(1700000060, 0), tm)
+}
+
+func TestPlaceOrdersChunked(t *testing.T) {
+	var reqs int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reqs, 1)
+		var args []map[string]interface{}
+		raw, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(raw, &args)
+		if len(args) == 0 || len(args) > trade.BATCH_MAX || r.URL.Path != trade.URI_BATCH_ORDERS {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		rsp := map[string]interface{}{"code": "0", "msg": ""}
+		var data []map[string]interface{}
+		for _, arg := range args {
+			data = append(data, map[string]interface{}{"clOrdId": arg["clOrdId"], "ordId": "1", "sCode": "0", "sMsg": ""})
+		}
+		rsp["data"] = data
+		raw, _ = json.Marshal(rsp)
+		w.Write(raw)
+	}))
+	defer srv.Close()
+
+	cli := NewRESTClient(srv.URL, &APIKeyInfo{ApiKey: "k", SecKey: "s", PassPhrase: "p"}, true)
+	assert.NotNil(t, cli.SetOrderRateLimit(300, 0))
+	o := trade.PlaceOrderReq{InstId: "BTC-USDT", TdMode: trade.TD_MODE_CASH, Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_LIMIT, Px: "1", Sz: "1"}
+	var orders []trade.PlaceOrderReq
+	for i := 0; i < 41; i++ {
+		orders = append(orders, o)
+	}
+	res, err := cli.PlaceOrdersChunked(context.Background(), trade.BatchOptions{}, orders...)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&reqs))
+	assert.Equal(t, 41, len(res))
+	assert.Equal(t, 0, len(res.Failed()))
+	for k, v := range res {
+		assert.Equal(t, k, v.ClOrdId)
+	}
+}
+
+func TestPendingOrders(t *testing.T) {
+	var afters []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path == trade.URI_ORDER {
+			w.Write([]byte(`{"code":"51603","msg":"Order does not exist","data":[]}`))
+			return
+		}
+		afters = append(afters, q.Get("after"))
+		n := PENDING_PAGE_LIMIT
+		if q.Get("after") != "" {
+			n = 1
+		}
+		var data []map[string]interface{}
+		for i := 0; i < n; i++ {
+			data = append(data, map[string]interface{}{"instId": q.Get("instId"), "ordId": fmt.Sprint(1000 - i), "state": "live"})
+		}
+		raw, _ := json.Marshal(map[string]interface{}{"code": "0", "msg": "", "data": data})
+		w.Write(raw)
+	}))
+	defer srv.Close()
+
+	cli := NewRESTClient(srv.URL, &APIKeyInfo{ApiKey: "k", SecKey: "s", PassPhrase: "p"}, true)
+	orders, err := cli.PendingOrders(context.Background(), "", "BTC-USDT")
+	assert.Nil(t, err)
+	assert.Equal(t, PENDING_PAGE_LIMIT+1, len(orders))
+	assert.Equal(t, []string{"", "901"}, afters)
+	assert.Equal(t, "BTC-USDT", orders[0].InstId)
+	assert.Equal(t, "live", orders[0].State)
+
+	_, err = cli.GetOrder(context.Background(), "BTC-USDT", "1", "")
+	assert.Equal(t, ErrOrderNotFound, err)
+}
+
+func TestPositions(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","posSide":"long","pos":"2","avgPx":"30000","liqPx":"20000","mgnRatio":"15"}]}`))
+	}))
+	defer srv.Close()
+
+	cli := NewRESTClient(srv.URL, &APIKeyInfo{ApiKey: "k", SecKey: "s", PassPhrase: "p"}, true)
+	positions, err := cli.Positions(context.Background(), "SWAP", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "instType=SWAP", query)
+	assert.Equal(t, 1, len(positions))
+	assert.Equal(t, "20000", positions[0].LiqPx)
+}
+
+func TestRestPreTradeCheck(t *testing.T) {
+	var reqs int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reqs, 1)
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"ordId":"1","sCode":"0","sMsg":""}]}`))
+	}))
+	defer srv.Close()
+
+	rejected := errors.New("rejected")
+	var ops []string
+	cli := NewRESTClient(srv.URL, &APIKeyInfo{ApiKey: "k", SecKey: "s", PassPhrase: "p"}, true)
+	cli.SetPreTradeCheck(trade.PreTradeCheckFunc(func(ctx context.Context, op string, args []map[string]interface{}) error {
+		ops = append(ops, op)
+		if args[0]["instId"] == "ETH-USDT" {
+			return rejected
+		}
+		return nil
+	}))
+
+	o := trade.PlaceOrderReq{InstId: "ETH-USDT", TdMode: trade.TD_MODE_CASH, Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_LIMIT, Px: "1", Sz: "1"}
+	_, _, err := cli.PlaceOrders(context.Background(), o)
+	assert.True(t, errors.Is(err, rejected) && trade.IsRejected(err))
+	param := o.ToMap()
+	_, err = cli.Post(context.Background(), trade.URI_ORDER, &param)
+	assert.True(t, errors.Is(err, rejected) && trade.IsRejected(err))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&reqs))
+
+	// 非交易接口不检查
+	_, err = cli.Post(context.Background(), "/api/v5/account/set-leverage", &param)
+	assert.Nil(t, err)
+	o.InstId = "BTC-USDT"
+	_, _, err = cli.AmendOrders(context.Background(), trade.AmendOrderReq{InstId: "BTC-USDT", OrdId: "1", NewPx: "2"})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&reqs))
+	assert.Equal(t, []string{trade.OP_ORDER, trade.OP_ORDER, trade.OP_AMEND_ORDER}, ops)
+}
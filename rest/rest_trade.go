@@ -0,0 +1,303 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+	"v5sdk_go/trade"
+	. "v5sdk_go/utils"
+	"v5sdk_go/ws/wImpl"
+)
+
+/*
+	使用类型化参数的交易请求，参数在本地校验后发送
+	单个订单时请求体为对象，批量时为数组，uri 与 batchUri 相同时始终为数组
+*/
+func (this *RESTAPI) orderReq(ctx context.Context, uri, batchUri string, orders []trade.Order) (res *RESTAPIResult, results []trade.OrderResult, err error) {
+	args, expTime, err := trade.BuildArgs(orders...)
+	if err != nil {
+		err = trade.Rejected(err)
+		return
+	}
+	if err = this.checkOrders(ctx, trade.OpOfUri(batchUri), args); err != nil {
+		return
+	}
+
+	var body interface{} = args
+	if len(args) == 1 && uri != batchUri {
+		body = args[0]
+	} else {
+		uri = batchUri
+	}
+
+	res, err = this.PostBody(ctx, uri, body, trade.ExpTimeString(expTime))
+	if err != nil {
+		return
+	}
+	results = trade.ParseResults(res.V5Response.Data)
+	return
+}
+
+/*
+	设置下单前检查，所有交易请求发送前执行，检查失败时不发送请求，返回 trade.RejectedError 包装的错误
+*/
+func (this *RESTAPI) SetPreTradeCheck(check trade.PreTradeCheck) *RESTAPI {
+	this.preTrade = check
+	return this
+}
+
+func (this *RESTAPI) checkOrders(ctx context.Context, op string, args []map[string]interface{}) error {
+	if this.preTrade == nil || op == "" {
+		return nil
+	}
+	return trade.Rejected(this.preTrade.CheckOrders(ctx, op, args))
+}
+
+/*
+	下单，多个订单时批量下单，最多 trade.BATCH_MAX 个
+	results: 各订单的处理结果，顺序与请求一致
+*/
+func (this *RESTAPI) PlaceOrders(ctx context.Context, orders ...trade.PlaceOrderReq) (res *RESTAPIResult, results []trade.OrderResult, err error) {
+	return this.orderReq(ctx, trade.URI_ORDER, trade.URI_BATCH_ORDERS, trade.PlaceOrders(orders))
+}
+
+/*
+	撤单，多个订单时批量撤单，最多 trade.BATCH_MAX 个
+*/
+func (this *RESTAPI) CancelOrders(ctx context.Context, orders ...trade.CancelOrderReq) (res *RESTAPIResult, results []trade.OrderResult, err error) {
+	return this.orderReq(ctx, trade.URI_CANCEL_ORDER, trade.URI_BATCH_CANCEL_ORDERS, trade.CancelOrders(orders))
+}
+
+/*
+	改单，多个订单时批量改单，最多 trade.BATCH_MAX 个
+*/
+func (this *RESTAPI) AmendOrders(ctx context.Context, orders ...trade.AmendOrderReq) (res *RESTAPIResult, results []trade.OrderResult, err error) {
+	return this.orderReq(ctx, trade.URI_AMEND_ORDER, trade.URI_BATCH_AMEND_ORDERS, trade.AmendOrders(orders))
+}
+
+/*
+	倒计时全部撤单，倒计时结束后撤销所有挂单
+	timeOut: 倒计时，0 表示取消倒计时，否则为 10s~120s
+	tag: 只撤销带该标签的订单，为空时撤销全部
+	triggerTime: 触发撤单的时间，取消倒计时时为零值
+*/
+func (this *RESTAPI) CancelAllAfter(ctx context.Context, timeOut time.Duration, tag string) (res *RESTAPIResult, triggerTime time.Time, err error) {
+	sec := int64(timeOut / time.Second)
+	if sec != 0 && (sec < 10 || sec > 120) {
+		err = errors.New("倒计时应为0或10s~120s")
+		return
+	}
+
+	param := map[string]interface{}{
+		"timeOut": strconv.FormatInt(sec, 10),
+	}
+	if tag != "" {
+		param["tag"] = tag
+	}
+
+	res, err = this.Post(ctx, trade.URI_CANCEL_ALL_AFTER, &param)
+	if err != nil {
+		return
+	}
+	rsp := res.V5Response
+	if rsp.Code != "0" {
+		err = errors.New("倒计时全部撤单失败:" + rsp.Code + " " + rsp.Msg)
+		return
+	}
+	if len(rsp.Data) != 0 {
+		if v, ok := rsp.Data[0]["triggerTime"].(string); ok {
+			triggerTime = MsTime(v)
+		}
+	}
+	return
+}
+
+/*
+	返回设置倒计时全部撤单的函数，可用于 ws.NewDeadManSwitch
+	tag: 只撤销带该标签的订单，为空时撤销全部
+	RESTAPI 会保存每次请求的参数，每次调用使用副本，可与其他请求并发
+*/
+func (this *RESTAPI) CancelAllAfterFunc(tag string) func(ctx context.Context, timeOut time.Duration) (time.Time, error) {
+	return func(ctx context.Context, timeOut time.Duration) (time.Time, error) {
+		cli := *this
+		_, tm, err := cli.CancelAllAfter(ctx, timeOut, tag)
+		return tm, err
+	}
+}
+
+/*
+	批量撤销某一产品类型、交易品种下的所有挂单
+	instType: 产品类型，如 OPTION
+	instFamily: 交易品种，如 BTC-USD
+*/
+func (this *RESTAPI) MassCancel(ctx context.Context, instType, instFamily string) (res *RESTAPIResult, err error) {
+	if instType == "" || instFamily == "" {
+		err = errors.New("instType和instFamily不能为空")
+		return
+	}
+
+	param := map[string]interface{}{
+		"instType":   instType,
+		"instFamily": instFamily,
+	}
+	res, err = this.Post(ctx, trade.URI_MASS_CANCEL, &param)
+	if err != nil {
+		return
+	}
+	rsp := res.V5Response
+	if rsp.Code != "0" {
+		err = errors.New("批量撤单失败:" + rsp.Code + " " + rsp.Msg)
+		return
+	}
+	if len(rsp.Data) == 0 {
+		err = errors.New("批量撤单失败")
+		return
+	}
+	if ok, _ := rsp.Data[0]["result"].(bool); !ok {
+		err = errors.New("批量撤单失败")
+	}
+	return
+}
+
+/*
+	设置分批下单/撤单/改单的限速，默认每2秒300个订单
+*/
+func (this *RESTAPI) SetOrderRateLimit(n int, per time.Duration) error {
+	l, err := NewRateLimiter(n, per)
+	if err != nil {
+		return err
+	}
+	this.limiter = l
+	return nil
+}
+
+/*
+	分批发送交易请求，每批最多 trade.BATCH_MAX 个订单
+	RESTAPI 会保存每次请求的参数，各批次使用副本并行发送
+*/
+func (this *RESTAPI) chunkedReq(ctx context.Context, batchUri string, orders []trade.Order, opts trade.BatchOptions) (res trade.BatchResult, err error) {
+	keys, err := trade.BatchKeys(orders)
+	if err != nil {
+		return
+	}
+	if opts.Limiter == nil {
+		opts.Limiter = this.limiter
+	}
+
+	res = trade.RunBatches(ctx, keys, opts, func(ctx context.Context, lo, hi int) ([]trade.OrderResult, error) {
+		cli := *this
+		// 单个订单也使用批量接口，保证返回结果的格式一致
+		rsp, results, err := cli.orderReq(ctx, batchUri, batchUri, orders[lo:hi])
+		if err != nil {
+			return nil, err
+		}
+		if len(results) != hi-lo {
+			return nil, errors.New("请求失败:" + rsp.V5Response.Code + " " + rsp.V5Response.Msg)
+		}
+		return results, nil
+	})
+	return
+}
+
+/*
+	分批下单，订单数量不限，按 trade.BATCH_MAX 拆分后限速并行发送
+	未指定 clOrdId 的订单自动生成
+	返回按 clOrdId 合并的各订单结果，参数有误时不发送任何请求
+*/
+func (this *RESTAPI) PlaceOrdersChunked(ctx context.Context, opts trade.BatchOptions, orders ...trade.PlaceOrderReq) (res trade.BatchResult, err error) {
+	return this.chunkedReq(ctx, trade.URI_BATCH_ORDERS, trade.PlaceOrders(trade.FillClOrdIds(orders)), opts)
+}
+
+/*
+	分批撤单，订单数量不限
+	返回的结果以 clOrdId 为键，未指定时以 ordId 为键
+*/
+func (this *RESTAPI) CancelOrdersChunked(ctx context.Context, opts trade.BatchOptions, orders ...trade.CancelOrderReq) (res trade.BatchResult, err error) {
+	return this.chunkedReq(ctx, trade.URI_BATCH_CANCEL_ORDERS, trade.CancelOrders(orders), opts)
+}
+
+/*
+	分批改单，订单数量不限
+	返回的结果以 clOrdId 为键，未指定时以 ordId 为键
+*/
+func (this *RESTAPI) AmendOrdersChunked(ctx context.Context, opts trade.BatchOptions, orders ...trade.AmendOrderReq) (res trade.BatchResult, err error) {
+	return this.chunkedReq(ctx, trade.URI_BATCH_AMEND_ORDERS, trade.AmendOrders(orders), opts)
+}
+
+// 未成交订单每页的最大数量
+const PENDING_PAGE_LIMIT = 100
+
+// 订单不存在的错误码
+const CODE_ORDER_NOT_EXIST = "51603"
+
+var ErrOrderNotFound = errors.New("订单不存在")
+
+/*
+	获取未成交订单列表，自动翻页
+	instType: 产品类型，为空时查询全部
+	instId: 产品ID，为空时查询全部
+*/
+func (this *RESTAPI) PendingOrders(ctx context.Context, instType, instId string) (orders []wImpl.OrderUpdate, err error) {
+	after := ""
+	for {
+		param := map[string]interface{}{
+			"limit": strconv.Itoa(PENDING_PAGE_LIMIT),
+		}
+		if instType != "" {
+			param["instType"] = instType
+		}
+		if instId != "" {
+			param["instId"] = instId
+		}
+		if after != "" {
+			param["after"] = after
+		}
+
+		var page []wImpl.OrderUpdate
+		page, err = this.getOrders(ctx, trade.URI_ORDERS_PENDING, param)
+		if err != nil {
+			return
+		}
+		orders = append(orders, page...)
+		if len(page) < PENDING_PAGE_LIMIT {
+			return
+		}
+		after = page[len(page)-1].OrdId
+	}
+}
+
+/*
+	获取订单信息，ordId 和 clOrdId 必须传一个
+	订单不存在时返回 ErrOrderNotFound
+*/
+func (this *RESTAPI) GetOrder(ctx context.Context, instId, ordId, clOrdId string) (order wImpl.OrderUpdate, err error) {
+	param := map[string]interface{}{
+		"instId": instId,
+	}
+	if ordId != "" {
+		param["ordId"] = ordId
+	}
+	if clOrdId != "" {
+		param["clOrdId"] = clOrdId
+	}
+
+	orders, err := this.getOrders(ctx, trade.URI_ORDER, param)
+	if err != nil {
+		return
+	}
+	if len(orders) == 0 {
+		err = ErrOrderNotFound
+		return
+	}
+	order = orders[0]
+	return
+}
+
+func (this *RESTAPI) getOrders(ctx context.Context, uri string, param map[string]interface{}) (orders []wImpl.OrderUpdate, err error) {
+	code, err := this.getData(ctx, uri, param, &orders)
+	if code == CODE_ORDER_NOT_EXIST {
+		err = ErrOrderNotFound
+	}
+	return
+}
@@ -0,0 +1,236 @@
+package risk
+
+import (
+	"strconv"
+	"sync"
+	"time"
+	"v5sdk_go/oms"
+	"v5sdk_go/portfolio"
+	"v5sdk_go/trade"
+	"v5sdk_go/ws"
+	"v5sdk_go/ws/wImpl"
+)
+
+/*
+	单个产品的行情快照
+	BuyLmt/SellLmt: 交易所限价，买单价格不能高于 BuyLmt，卖单价格不能低于 SellLmt
+*/
+type Quote struct {
+	Last    float64
+	Bid     float64
+	Ask     float64
+	BuyLmt  float64
+	SellLmt float64
+	// 各项数据的更新时间
+	LastTime  time.Time
+	BookTime  time.Time
+	LimitTime time.Time
+}
+
+/*
+	中间价，买卖价缺失时为 0
+*/
+func (q Quote) Mid() float64 {
+	if q.Bid <= 0 || q.Ask <= 0 {
+		return 0
+	}
+	return (q.Bid + q.Ask) / 2
+}
+
+/*
+	风控使用的行情数据，由 tickers、trades、price-limit 频道的推送维护
+*/
+type Market struct {
+	lock   sync.RWMutex
+	quotes map[string]*Quote
+}
+
+func NewMarket() *Market {
+	return &Market{
+		quotes: make(map[string]*Quote),
+	}
+}
+
+/*
+	获取产品的行情快照
+*/
+func (m *Market) Quote(instId string) (q Quote, ok bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	v, ok := m.quotes[instId]
+	if ok {
+		q = *v
+	}
+	return
+}
+
+func (m *Market) OnTicker(t wImpl.TickerDetail) {
+	m.update(t.InstId, func(q *Quote) {
+		now := time.Now()
+		if v := toFloat(t.Last); v > 0 {
+			q.Last, q.LastTime = v, now
+		}
+		bid, ask := toFloat(t.BidPx), toFloat(t.AskPx)
+		if bid > 0 && ask > 0 {
+			q.Bid, q.Ask, q.BookTime = bid, ask, now
+		}
+	})
+}
+
+func (m *Market) OnTrade(t wImpl.TradeDetail) {
+	m.update(t.InstId, func(q *Quote) {
+		if v := toFloat(t.Px); v > 0 {
+			q.Last, q.LastTime = v, time.Now()
+		}
+	})
+}
+
+/*
+	更新限价，buyLmt/sellLmt 为空时视为交易所未启用限价
+*/
+func (m *Market) OnPriceLimit(instId, buyLmt, sellLmt string) {
+	m.update(instId, func(q *Quote) {
+		q.BuyLmt, q.SellLmt, q.LimitTime = toFloat(buyLmt), toFloat(sellLmt), time.Now()
+	})
+}
+
+func (m *Market) update(instId string, fn func(*Quote)) {
+	if instId == "" {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	q, ok := m.quotes[instId]
+	if !ok {
+		q = &Quote{}
+		m.quotes[instId] = q
+	}
+	fn(q)
+}
+
+/*
+	在 WsClient 的路由上注册 tickers、trades、price-limit 频道的回调函数
+	频道需另行订阅，返回的函数用于注销
+	例如:
+	remove, _ := market.Attach(cli)
+	defer remove()
+	cli.PubTickers(OP_SUBSCRIBE, []map[string]string{{"instId": "BTC-USDT"}})
+*/
+func (m *Market) Attach(cli *ws.WsClient) (remove func(), err error) {
+	var handles []*ws.RouteHandle
+	remove = func() {
+		for _, h := range handles {
+			h.Remove()
+		}
+	}
+
+	routes := map[string]func(map[string]interface{}){
+		"tickers": func(d map[string]interface{}) {
+			m.OnTicker(wImpl.TickerDetail{InstId: str(d, "instId"), Last: str(d, "last"), BidPx: str(d, "bidPx"), AskPx: str(d, "askPx")})
+		},
+		"trades": func(d map[string]interface{}) {
+			m.OnTrade(wImpl.TradeDetail{InstId: str(d, "instId"), Px: str(d, "px")})
+		},
+		"price-limit": func(d map[string]interface{}) {
+			m.OnPriceLimit(str(d, "instId"), str(d, "buyLmt"), str(d, "sellLmt"))
+		},
+	}
+	for channel, fn := range routes {
+		fn := fn
+		h, e := cli.Router().HandleMsg(ws.RoutePattern{Channel: channel}, func(ts time.Time, data wImpl.MsgData) error {
+			for _, v := range data.Data {
+				if d, ok := v.(map[string]interface{}); ok {
+					fn(d)
+				}
+			}
+			return nil
+		})
+		if e != nil {
+			remove()
+			return nil, e
+		}
+		handles = append(handles, h)
+	}
+	return
+}
+
+/*
+	产品的净持仓，多头为正，空头为负
+*/
+type PositionSource interface {
+	NetPosition(instId string) float64
+}
+
+type portfolioPositions struct {
+	t *portfolio.Tracker
+}
+
+/*
+	使用 portfolio.Tracker 的持仓作为持仓来源
+*/
+func PortfolioPositions(t *portfolio.Tracker) PositionSource {
+	return portfolioPositions{t: t}
+}
+
+func (p portfolioPositions) NetPosition(instId string) float64 {
+	var net float64
+	for _, pos := range p.t.Positions(instId) {
+		sz := toFloat(pos.Pos)
+		if pos.PosSide == trade.POS_SIDE_SHORT {
+			// 开平仓模式下空头持仓数量为正
+			sz = -sz
+		}
+		net += sz
+	}
+	return net
+}
+
+/*
+	挂单来源，ordId 和 clOrdId 任选其一，找不到或订单已完成时返回 false
+	返回的 Request 中 Side、OrdType、TgtCcy、Px、Sz 用于补全改单
+*/
+type OrderSource interface {
+	OpenOrder(ordId, clOrdId string) (Request, bool)
+}
+
+type omsOrders struct {
+	m *oms.OMS
+}
+
+/*
+	使用 oms.OMS 跟踪的订单作为挂单来源
+*/
+func OMSOrders(m *oms.OMS) OrderSource {
+	return omsOrders{m: m}
+}
+
+func (s omsOrders) OpenOrder(ordId, clOrdId string) (Request, bool) {
+	var o oms.Order
+	var ok bool
+	if clOrdId != "" {
+		o, ok = s.m.Get(clOrdId)
+	} else {
+		o, ok = s.m.GetByOrdId(ordId)
+	}
+	if !ok || o.IsFinal() {
+		return Request{}, false
+	}
+	return Request{
+		Op:      trade.OP_ORDER,
+		InstId:  o.InstId,
+		Side:    o.Side,
+		OrdType: o.OrdType,
+		Px:      toFloat(o.Px),
+		Sz:      toFloat(o.Sz),
+	}, true
+}
+
+func str(m map[string]interface{}, k string) string {
+	v, _ := m[k].(string)
+	return v
+}
+
+func toFloat(v string) float64 {
+	f, _ := strconv.ParseFloat(v, 64)
+	return f
+}
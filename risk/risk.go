@@ -0,0 +1,454 @@
+/*
+	下单前风控检查
+	在请求发送前执行，检查未通过时返回 *Error，订单不会发送到交易所
+*/
+package risk
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+	"v5sdk_go/trade"
+)
+
+// 风控规则
+const (
+	RULE_MAX_NOTIONAL = "max-notional" // 单笔名义价值
+	RULE_MAX_POSITION = "max-position" // 单个产品的最大持仓
+	RULE_PRICE_LIMIT  = "price-limit"  // 交易所限价
+	RULE_PRICE_BAND   = "price-band"   // 相对最新成交价的偏离
+	RULE_FAT_FINGER   = "fat-finger"   // 相对中间价的偏离
+	RULE_ORDER_RATE   = "order-rate"   // 每分钟下单数量
+	RULE_NO_MARKET    = "no-market"    // 缺少行情数据
+	RULE_NO_ORDER     = "no-order"     // 改单找不到原订单
+)
+
+/*
+	风控拒绝的错误
+	Rule: 触发的规则 RULE_XXX 或自定义检查的名称
+	Index: 批量请求中的订单序号，从 0 开始
+*/
+type Error struct {
+	Rule   string
+	InstId string
+	Index  int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return "风控拒绝[" + e.Rule + "] " + e.InstId + ": " + e.Msg
+}
+
+/*
+	判断是否为风控拒绝的错误
+*/
+func IsRiskError(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+/*
+	单个产品的风控限制，各项为 0 时不检查
+	MaxNotional: 单笔最大名义价值(计价货币)
+	MaxPosition: 最大净持仓数量(绝对值)，单位与下单数量相同，减仓不受限制
+	PriceBand: 委托价相对最新成交价的最大偏离比例，如 0.05 表示 5%
+	FatFinger: 委托价相对中间价的最大偏离比例
+	CtVal: 合约面值，计算名义价值时使用，为 0 时视为 1
+*/
+type Limits struct {
+	MaxNotional float64
+	MaxPosition float64
+	PriceBand   float64
+	FatFinger   float64
+	CtVal       float64
+}
+
+/*
+	风控配置
+	Default: 默认限制
+	Insts: 单个产品的限制，key 为 instId，存在时代替默认限制
+	MaxOrdersPerMin: 每分钟最多下单数量，批量请求按订单数计算，为 0 时不检查
+	MaxDataAge: 行情数据的有效期，超过后视为没有行情，为 0 时不过期
+	Strict: 需要行情数据的检查在缺少行情时拒绝订单，改单找不到原订单时拒绝，否则跳过该检查
+*/
+type Config struct {
+	Default         Limits
+	Insts           map[string]Limits
+	MaxOrdersPerMin int
+	MaxDataAge      time.Duration
+	Strict          bool
+}
+
+/*
+	待检查的订单
+	Op: trade.OP_ORDER 或 trade.OP_AMEND_ORDER
+	Px: 委托价格，市价单时为 0
+	Sz: 委托数量
+	改单按改单后的订单检查，方向及未修改的价格和数量由 SetOrders 设置的挂单来源补全，
+	找不到原订单时方向为空，未修改的价格和数量为 0
+*/
+type Request struct {
+	Op         string
+	InstId     string
+	Side       string
+	OrdType    string
+	TgtCcy     string
+	Px         float64
+	Sz         float64
+	ReduceOnly bool
+}
+
+/*
+	自定义检查，返回错误时拒绝订单
+*/
+type CheckFunc func(ctx context.Context, req Request) error
+
+type namedCheck struct {
+	name string
+	fn   CheckFunc
+}
+
+/*
+	风控管理，实现 trade.PreTradeCheck
+	例如:
+	mgr := risk.NewManager(risk.Config{Default: risk.Limits{MaxNotional: 10000, FatFinger: 0.05}, MaxOrdersPerMin: 60})
+	mgr.SetMarket(market)
+	mgr.SetPositions(risk.PortfolioPositions(tracker))
+	mgr.SetOrders(risk.OMSOrders(orders))
+	cli.SetPreTradeCheck(mgr)
+	_, _, err := cli.PlaceOrdersCtx(ctx, "", order)
+	if e, ok := risk.IsRiskError(err); ok {
+		fmt.Println(e.Rule, e.Msg)
+	}
+*/
+type Manager struct {
+	lock      sync.Mutex
+	conf      Config
+	market    *Market
+	positions PositionSource
+	orders    OrderSource
+	checks    []namedCheck
+	// 最近一分钟内各订单的下单时间
+	sent []time.Time
+}
+
+func NewManager(conf Config) *Manager {
+	return &Manager{conf: conf}
+}
+
+/*
+	设置行情数据，未设置时跳过价格相关检查(Strict 时拒绝)
+*/
+func (m *Manager) SetMarket(market *Market) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.market = market
+}
+
+/*
+	设置持仓来源，未设置时不检查最大持仓
+*/
+func (m *Manager) SetPositions(src PositionSource) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.positions = src
+}
+
+/*
+	设置挂单来源，用于补全改单的原订单，未设置时改单只检查新价格(Strict 时拒绝)
+*/
+func (m *Manager) SetOrders(src OrderSource) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.orders = src
+}
+
+/*
+	更新风控配置
+*/
+func (m *Manager) SetConfig(conf Config) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.conf = conf
+}
+
+/*
+	添加自定义检查，在内置检查之后执行
+	注：检查函数执行时持有 Manager 的锁，不能在其中调用 Manager 的方法
+*/
+func (m *Manager) AddCheck(name string, fn CheckFunc) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.checks = append(m.checks, namedCheck{name: name, fn: fn})
+}
+
+/*
+	实现 trade.PreTradeCheck，只检查下单和改单，撤单不受限制
+	批量请求中任一订单未通过时整个请求被拒绝
+*/
+func (m *Manager) CheckOrders(ctx context.Context, op string, args []map[string]interface{}) error {
+	if op != trade.OP_ORDER && op != trade.OP_AMEND_ORDER || trade.PreTradeCheckSkipped(ctx) {
+		return nil
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// 同一批次中同一产品的订单累计计算持仓
+	pending := make(map[string]float64)
+	for i, arg := range args {
+		req := parseRequest(op, arg)
+		if op == trade.OP_AMEND_ORDER {
+			if err := m.resolveAmend(&req, arg); err != nil {
+				err.Index = i
+				return err
+			}
+		}
+		if err := m.check(req, pending); err != nil {
+			err.Index = i
+			return err
+		}
+		for _, c := range m.checks {
+			if err := c.fn(ctx, req); err != nil {
+				if e, ok := IsRiskError(err); ok {
+					e.Index = i
+					return e
+				}
+				return &Error{Rule: c.name, InstId: req.InstId, Index: i, Msg: err.Error()}
+			}
+		}
+	}
+
+	if op == trade.OP_ORDER {
+		return m.checkRate(len(args))
+	}
+	return nil
+}
+
+func (m *Manager) limits(instId string) Limits {
+	if l, ok := m.conf.Insts[instId]; ok {
+		return l
+	}
+	return m.conf.Default
+}
+
+/*
+	从挂单来源补全改单的方向、价格和数量，调用方需持有 m.lock
+*/
+func (m *Manager) resolveAmend(req *Request, arg map[string]interface{}) *Error {
+	var orig Request
+	ok := false
+	if m.orders != nil {
+		orig, ok = m.orders.OpenOrder(argStr(arg, "ordId"), argStr(arg, "clOrdId"))
+	}
+	if !ok {
+		if m.conf.Strict {
+			return &Error{Rule: RULE_NO_ORDER, InstId: req.InstId, Msg: "找不到改单的原订单"}
+		}
+		return nil
+	}
+	req.Side = orig.Side
+	req.OrdType = orig.OrdType
+	req.TgtCcy = orig.TgtCcy
+	if req.Px == 0 {
+		req.Px = orig.Px
+	}
+	if req.Sz == 0 {
+		req.Sz = orig.Sz
+	}
+	return nil
+}
+
+/*
+	内置检查，调用方需持有 m.lock
+*/
+func (m *Manager) check(req Request, pending map[string]float64) *Error {
+	l := m.limits(req.InstId)
+	q, hasQuote := m.quote(req.InstId)
+	reject := func(rule, msg string) *Error {
+		return &Error{Rule: rule, InstId: req.InstId, Msg: msg}
+	}
+
+	// 交易所限价
+	if req.Px > 0 && hasQuote && m.fresh(q.LimitTime) {
+		if req.Side == trade.SIDE_BUY && q.BuyLmt > 0 && req.Px > q.BuyLmt {
+			return reject(RULE_PRICE_LIMIT, "买入价格"+fmtFloat(req.Px)+"高于最高买价"+fmtFloat(q.BuyLmt))
+		}
+		if req.Side == trade.SIDE_SELL && q.SellLmt > 0 && req.Px < q.SellLmt {
+			return reject(RULE_PRICE_LIMIT, "卖出价格"+fmtFloat(req.Px)+"低于最低卖价"+fmtFloat(q.SellLmt))
+		}
+	}
+
+	// 相对最新成交价的偏离
+	if l.PriceBand > 0 && req.Px > 0 {
+		if q.Last <= 0 || !m.fresh(q.LastTime) {
+			if m.conf.Strict {
+				return reject(RULE_NO_MARKET, "缺少最新成交价")
+			}
+		} else if dev := math.Abs(req.Px-q.Last) / q.Last; dev > l.PriceBand {
+			return reject(RULE_PRICE_BAND, "委托价偏离最新成交价"+fmtPct(dev)+"，超过"+fmtPct(l.PriceBand))
+		}
+	}
+
+	// 相对中间价的偏离
+	if l.FatFinger > 0 && req.Px > 0 {
+		mid := q.Mid()
+		if mid <= 0 || !m.fresh(q.BookTime) {
+			if m.conf.Strict {
+				return reject(RULE_NO_MARKET, "缺少买卖价")
+			}
+		} else if dev := math.Abs(req.Px-mid) / mid; dev > l.FatFinger {
+			return reject(RULE_FAT_FINGER, "委托价偏离中间价"+fmtPct(dev)+"，超过"+fmtPct(l.FatFinger))
+		}
+	}
+
+	// 单笔名义价值
+	if l.MaxNotional > 0 && req.Sz > 0 {
+		notional, ok := m.notional(req, q, l)
+		if !ok {
+			if m.conf.Strict {
+				return reject(RULE_NO_MARKET, "无法计算名义价值")
+			}
+		} else if notional > l.MaxNotional {
+			return reject(RULE_MAX_NOTIONAL, "名义价值"+fmtFloat(notional)+"超过"+fmtFloat(l.MaxNotional))
+		}
+	}
+
+	// 最大持仓，改单不检查
+	if l.MaxPosition > 0 && m.positions != nil && req.Op == trade.OP_ORDER && !req.ReduceOnly && req.TgtCcy != trade.TGT_CCY_QUOTE {
+		base := m.positions.NetPosition(req.InstId)
+		cur := base + pending[req.InstId]
+		next := cur + req.Sz
+		if req.Side == trade.SIDE_SELL {
+			next = cur - req.Sz
+		}
+		if math.Abs(next) > l.MaxPosition && math.Abs(next) > math.Abs(cur) {
+			return reject(RULE_MAX_POSITION, "成交后持仓"+fmtFloat(next)+"超过"+fmtFloat(l.MaxPosition))
+		}
+		pending[req.InstId] = next - base
+	}
+	return nil
+}
+
+/*
+	计算名义价值，市价单使用最新成交价或中间价
+*/
+func (m *Manager) notional(req Request, q Quote, l Limits) (float64, bool) {
+	if req.TgtCcy == trade.TGT_CCY_QUOTE {
+		return req.Sz, true
+	}
+	px := req.Px
+	if px <= 0 {
+		switch {
+		case q.Last > 0 && m.fresh(q.LastTime):
+			px = q.Last
+		case q.Mid() > 0 && m.fresh(q.BookTime):
+			px = q.Mid()
+		default:
+			return 0, false
+		}
+	}
+	ctVal := l.CtVal
+	if ctVal <= 0 {
+		ctVal = 1
+	}
+	return px * req.Sz * ctVal, true
+}
+
+/*
+	每分钟下单数量，通过检查时记录本次下单，调用方需持有 m.lock
+*/
+func (m *Manager) checkRate(n int) error {
+	max := m.conf.MaxOrdersPerMin
+	if max <= 0 {
+		return nil
+	}
+	now := time.Now()
+	start := 0
+	for start < len(m.sent) && now.Sub(m.sent[start]) >= time.Minute {
+		start++
+	}
+	m.sent = m.sent[start:]
+	if len(m.sent)+n > max {
+		return &Error{Rule: RULE_ORDER_RATE, Msg: "最近一分钟已下单" + strconv.Itoa(len(m.sent)) + "个，上限" + strconv.Itoa(max)}
+	}
+	for i := 0; i < n; i++ {
+		m.sent = append(m.sent, now)
+	}
+	return nil
+}
+
+func (m *Manager) quote(instId string) (Quote, bool) {
+	if m.market == nil {
+		return Quote{}, false
+	}
+	return m.market.Quote(instId)
+}
+
+func (m *Manager) fresh(t time.Time) bool {
+	if t.IsZero() {
+		return false
+	}
+	return m.conf.MaxDataAge <= 0 || time.Since(t) <= m.conf.MaxDataAge
+}
+
+/*
+	从请求参数解析订单，参数值可以是字符串或数值
+*/
+func parseRequest(op string, arg map[string]interface{}) Request {
+	req := Request{
+		Op:      op,
+		InstId:  argStr(arg, "instId"),
+		Side:    argStr(arg, "side"),
+		OrdType: argStr(arg, "ordType"),
+		TgtCcy:  argStr(arg, "tgtCcy"),
+	}
+	if op == trade.OP_AMEND_ORDER {
+		req.Px = argFloat(arg, "newPx")
+		req.Sz = argFloat(arg, "newSz")
+	} else {
+		req.Px = argFloat(arg, "px")
+		req.Sz = argFloat(arg, "sz")
+	}
+	switch v := arg["reduceOnly"].(type) {
+	case bool:
+		req.ReduceOnly = v
+	case string:
+		req.ReduceOnly = v == "true"
+	}
+	return req
+}
+
+func argStr(arg map[string]interface{}, k string) string {
+	switch v := arg[k].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+func argFloat(arg map[string]interface{}, k string) float64 {
+	switch v := arg[k].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	}
+	return toFloat(argStr(arg, k))
+}
+
+func fmtFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func fmtPct(v float64) string {
+	return strconv.FormatFloat(v*100, 'f', 2, 64) + "%"
+}
@@ -0,0 +1,152 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"v5sdk_go/trade"
+	"v5sdk_go/ws/wImpl"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePositions map[string]float64
+
+func (p fakePositions) NetPosition(instId string) float64 {
+	return p[instId]
+}
+
+type fakeOrders map[string]Request
+
+func (o fakeOrders) OpenOrder(ordId, clOrdId string) (Request, bool) {
+	req, ok := o[ordId]
+	return req, ok
+}
+
+func order(side, px, sz string) map[string]interface{} {
+	o := trade.PlaceOrderReq{InstId: "BTC-USDT", TdMode: trade.TD_MODE_CASH, Side: side, OrdType: trade.ORD_TYPE_LIMIT, Px: px, Sz: sz}
+	if px == "" {
+		o.OrdType = trade.ORD_TYPE_MARKET
+	}
+	return o.ToMap()
+}
+
+func ruleOf(err error) string {
+	if e, ok := IsRiskError(err); ok {
+		return e.Rule
+	}
+	return ""
+}
+
+func TestManager(t *testing.T) {
+	market := NewMarket()
+	market.OnTicker(wImpl.TickerDetail{InstId: "BTC-USDT", Last: "100", BidPx: "99", AskPx: "101"})
+	market.OnPriceLimit("BTC-USDT", "105", "95")
+
+	mgr := NewManager(Config{
+		Default:         Limits{MaxNotional: 1000, PriceBand: 0.08, FatFinger: 0.03},
+		Insts:           map[string]Limits{"ETH-USDT": {}},
+		MaxOrdersPerMin: 5,
+	})
+	mgr.SetMarket(market)
+	ctx := context.Background()
+	check := func(args ...map[string]interface{}) error {
+		return mgr.CheckOrders(ctx, trade.OP_ORDER, args)
+	}
+
+	assert.Nil(t, check(order(trade.SIDE_BUY, "100", "1")))
+	assert.Equal(t, RULE_PRICE_LIMIT, ruleOf(check(order(trade.SIDE_BUY, "106", "1"))))
+	assert.Equal(t, RULE_PRICE_LIMIT, ruleOf(check(order(trade.SIDE_SELL, "94", "1"))))
+	assert.Equal(t, RULE_FAT_FINGER, ruleOf(check(order(trade.SIDE_BUY, "104", "1"))))
+	assert.Equal(t, RULE_MAX_NOTIONAL, ruleOf(check(order(trade.SIDE_BUY, "100", "11"))))
+	// 市价单使用最新成交价计算名义价值
+	assert.Equal(t, RULE_MAX_NOTIONAL, ruleOf(check(order(trade.SIDE_BUY, "", "11"))))
+
+	// 相对最新成交价的偏离
+	mgr.SetConfig(Config{Default: Limits{PriceBand: 0.02}})
+	assert.Equal(t, RULE_PRICE_BAND, ruleOf(check(order(trade.SIDE_BUY, "103", "1"))))
+
+	// 批量请求返回未通过的订单序号
+	err := check(order(trade.SIDE_BUY, "100", "1"), order(trade.SIDE_BUY, "103", "1"))
+	e, ok := IsRiskError(err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, e.Index)
+
+	// 改单检查新价格，撤单不检查
+	assert.Equal(t, RULE_PRICE_BAND, ruleOf(mgr.CheckOrders(ctx, trade.OP_AMEND_ORDER, []map[string]interface{}{{"instId": "BTC-USDT", "ordId": "1", "newPx": "110"}})))
+	assert.Nil(t, mgr.CheckOrders(ctx, trade.OP_CANCEL_ORDER, []map[string]interface{}{{"instId": "BTC-USDT", "ordId": "1"}}))
+
+	// 缺少行情
+	eth := order(trade.SIDE_BUY, "100", "1")
+	eth["instId"] = "ETH-USDT"
+	assert.Nil(t, check(eth))
+	mgr.SetConfig(Config{Default: Limits{FatFinger: 0.03}, Strict: true})
+	assert.Equal(t, RULE_NO_MARKET, ruleOf(check(eth)))
+}
+
+/*
+	改单从挂单来源补全方向、价格和数量后检查
+*/
+func TestAmendCheck(t *testing.T) {
+	market := NewMarket()
+	market.OnTicker(wImpl.TickerDetail{InstId: "BTC-USDT", Last: "100", BidPx: "99", AskPx: "101"})
+	market.OnPriceLimit("BTC-USDT", "105", "95")
+
+	mgr := NewManager(Config{Default: Limits{MaxNotional: 1000}})
+	mgr.SetMarket(market)
+	mgr.SetOrders(fakeOrders{"1": {InstId: "BTC-USDT", Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_LIMIT, Px: 100, Sz: 9}})
+	ctx := context.Background()
+	amend := func(arg map[string]interface{}) error {
+		arg["instId"] = "BTC-USDT"
+		return mgr.CheckOrders(ctx, trade.OP_AMEND_ORDER, []map[string]interface{}{arg})
+	}
+
+	assert.Nil(t, amend(map[string]interface{}{"ordId": "1", "newPx": "104"}))
+	// 买单改价超过交易所最高买价
+	assert.Equal(t, RULE_PRICE_LIMIT, ruleOf(amend(map[string]interface{}{"ordId": "1", "newPx": "106"})))
+	// 只改价格时使用原订单数量计算名义价值
+	mgr.SetConfig(Config{Default: Limits{MaxNotional: 900}})
+	assert.Equal(t, RULE_MAX_NOTIONAL, ruleOf(amend(map[string]interface{}{"ordId": "1", "newPx": "101"})))
+	assert.Nil(t, amend(map[string]interface{}{"ordId": "1", "newSz": "8"}))
+
+	// 找不到原订单
+	assert.Nil(t, amend(map[string]interface{}{"ordId": "2", "newPx": "101"}))
+	mgr.SetConfig(Config{Default: Limits{MaxNotional: 900}, Strict: true})
+	assert.Equal(t, RULE_NO_ORDER, ruleOf(amend(map[string]interface{}{"ordId": "2", "newPx": "101"})))
+}
+
+func TestMaxPositionAndRate(t *testing.T) {
+	mgr := NewManager(Config{Default: Limits{MaxPosition: 5}, MaxOrdersPerMin: 4})
+	mgr.SetPositions(fakePositions{"BTC-USDT": 3})
+	ctx := context.Background()
+	check := func(args ...map[string]interface{}) error {
+		return mgr.CheckOrders(ctx, trade.OP_ORDER, args)
+	}
+
+	assert.Nil(t, check(order(trade.SIDE_BUY, "100", "2")))
+	assert.Equal(t, RULE_MAX_POSITION, ruleOf(check(order(trade.SIDE_BUY, "100", "3"))))
+	// 同一批次累计计算
+	assert.Equal(t, RULE_MAX_POSITION, ruleOf(check(order(trade.SIDE_BUY, "100", "1"), order(trade.SIDE_BUY, "100", "2"))))
+	// 减仓不受限制
+	assert.Nil(t, check(order(trade.SIDE_SELL, "100", "1")))
+	reduce := order(trade.SIDE_BUY, "100", "9")
+	reduce["reduceOnly"] = true
+	assert.Nil(t, check(reduce))
+
+	// 已通过 3 个订单，未通过的订单不计数
+	assert.Equal(t, RULE_ORDER_RATE, ruleOf(check(order(trade.SIDE_SELL, "100", "1"), order(trade.SIDE_SELL, "100", "1"))))
+	assert.Nil(t, check(order(trade.SIDE_SELL, "100", "1")))
+	assert.Equal(t, RULE_ORDER_RATE, ruleOf(check(order(trade.SIDE_SELL, "100", "1"))))
+
+	// 自定义检查
+	mgr.SetConfig(Config{})
+	mgr.AddCheck("no-eth", func(ctx context.Context, req Request) error {
+		if req.InstId == "ETH-USDT" {
+			return errors.New("禁止交易ETH")
+		}
+		return nil
+	})
+	eth := order(trade.SIDE_BUY, "100", "1")
+	eth["instId"] = "ETH-USDT"
+	assert.Equal(t, "no-eth", ruleOf(check(eth)))
+}
@@ -0,0 +1,220 @@
+package trade
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"v5sdk_go/utils"
+)
+
+// 下单/撤单/改单的限速，每2秒最多300个订单
+const (
+	ORDER_RATE_LIMIT  = 300
+	ORDER_RATE_PERIOD = 2 * time.Second
+)
+
+/*
+	按默认限速创建下单限速器
+*/
+func NewOrderLimiter() *utils.RateLimiter {
+	// 参数为常量，不会失败
+	l, _ := utils.NewRateLimiter(ORDER_RATE_LIMIT, ORDER_RATE_PERIOD)
+	return l
+}
+
+// 默认同时发送的批量请求数
+const DEFAULT_BATCH_PARALLEL = 4
+
+/*
+	分批发送的配置
+	Parallel: 同时发送的批量请求数，为 0 时使用 DEFAULT_BATCH_PARALLEL
+	Limiter: 限速器，按订单数限速，为空时使用客户端的默认限速器
+*/
+type BatchOptions struct {
+	Parallel int
+	Limiter  *utils.RateLimiter
+}
+
+/*
+	单个订单的最终结果
+	Err: 所在批次请求失败(超时、网络错误等)时不为空，此时 OrderResult 为零值
+*/
+type OrderOutcome struct {
+	OrderResult
+	Err error
+}
+
+func (o OrderOutcome) Success() bool {
+	return o.Err == nil && o.OrderResult.Success()
+}
+
+/*
+	分批请求的合并结果，键为 clOrdId，撤单/改单未指定 clOrdId 时为 ordId
+*/
+type BatchResult map[string]OrderOutcome
+
+/*
+	失败订单的键，按字典序排列
+*/
+func (r BatchResult) Failed() []string {
+	var keys []string
+	for k, v := range r {
+		if !v.Success() {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+/*
+	发送一个批次，orders[lo:hi] 最多 BATCH_MAX 个
+	results 需与请求顺序一致，请求整体失败时返回 err
+*/
+type BatchSender func(ctx context.Context, lo, hi int) (results []OrderResult, err error)
+
+var clOrdIdSeq uint64
+
+/*
+	生成客户自定义订单ID
+*/
+func NewClOrdId() string {
+	seq := atomic.AddUint64(&clOrdIdSeq, 1)
+	return "b" + strconv.FormatInt(time.Now().UnixNano(), 36) + strconv.FormatUint(seq, 36)
+}
+
+/*
+	为未指定 clOrdId 的订单生成ID，返回新的切片，不修改原参数
+*/
+func FillClOrdIds(orders []PlaceOrderReq) []PlaceOrderReq {
+	res := make([]PlaceOrderReq, len(orders))
+	copy(res, orders)
+	for i := range res {
+		if res[i].ClOrdId == "" {
+			res[i].ClOrdId = NewClOrdId()
+		}
+	}
+	return res
+}
+
+/*
+	订单在合并结果中的键
+*/
+func OrderKey(o Order) string {
+	switch v := o.(type) {
+	case PlaceOrderReq:
+		return v.ClOrdId
+	case CancelOrderReq:
+		if v.ClOrdId != "" {
+			return v.ClOrdId
+		}
+		return v.OrdId
+	case AmendOrderReq:
+		if v.ClOrdId != "" {
+			return v.ClOrdId
+		}
+		return v.OrdId
+	}
+	return ""
+}
+
+/*
+	校验全部订单并生成合并结果的键，任一订单有误时不发送任何请求
+*/
+func BatchKeys(orders []Order) (keys []string, err error) {
+	if len(orders) == 0 {
+		err = errors.New("订单不能为空")
+		return
+	}
+	seen := make(map[string]bool, len(orders))
+	for i, o := range orders {
+		if err = o.Validate(); err != nil {
+			err = errors.New("第" + strconv.Itoa(i+1) + "个订单参数错误:" + err.Error())
+			return
+		}
+		k := OrderKey(o)
+		if k == "" {
+			err = errors.New("第" + strconv.Itoa(i+1) + "个订单缺少clOrdId")
+			return
+		}
+		if seen[k] {
+			err = errors.New("订单ID重复:" + k)
+			return
+		}
+		seen[k] = true
+		keys = append(keys, k)
+	}
+	return
+}
+
+/*
+	按 BATCH_MAX 拆分订单，限速并行发送，合并各订单的结果
+	keys: 各订单的键，由 BatchKeys 生成
+	等待并行名额时 ctx 结束，尚未发送的订单的结果为 ctx.Err()
+*/
+func RunBatches(ctx context.Context, keys []string, opts BatchOptions, send BatchSender) BatchResult {
+	parallel := opts.Parallel
+	if parallel <= 0 {
+		parallel = DEFAULT_BATCH_PARALLEL
+	}
+	limiter := opts.Limiter
+	if limiter == nil {
+		limiter = NewOrderLimiter()
+	}
+
+	res := make(BatchResult, len(keys))
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallel)
+
+chunks:
+	for lo := 0; lo < len(keys); lo += BATCH_MAX {
+		hi := lo + BATCH_MAX
+		if hi > len(keys) {
+			hi = len(keys)
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			lock.Lock()
+			for _, k := range keys[lo:] {
+				res[k] = OrderOutcome{Err: ctx.Err()}
+			}
+			lock.Unlock()
+			break chunks
+		}
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			var results []OrderResult
+			err := limiter.Wait(ctx, hi-lo)
+			if err == nil {
+				results, err = send(ctx, lo, hi)
+			}
+			if err == nil && len(results) != hi-lo {
+				err = errors.New("返回结果数量与订单数量不一致:" + strconv.Itoa(len(results)) + "/" + strconv.Itoa(hi-lo))
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			for i := lo; i < hi; i++ {
+				if err != nil {
+					res[keys[i]] = OrderOutcome{Err: err}
+				} else {
+					res[keys[i]] = OrderOutcome{OrderResult: results[i-lo]}
+				}
+			}
+		}(lo, hi)
+	}
+	wg.Wait()
+	return res
+}
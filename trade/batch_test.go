@@ -0,0 +1,95 @@
+package trade
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchKeys(t *testing.T) {
+	o := PlaceOrderReq{InstId: "BTC-USDT", TdMode: TD_MODE_CASH, Side: SIDE_BUY, OrdType: ORD_TYPE_LIMIT, Px: "1", Sz: "1"}
+
+	// 未指定 clOrdId
+	_, err := BatchKeys(PlaceOrders([]PlaceOrderReq{o}))
+	assert.NotNil(t, err)
+
+	orders := FillClOrdIds([]PlaceOrderReq{o, o})
+	assert.Equal(t, "", o.ClOrdId)
+	keys, err := BatchKeys(PlaceOrders(orders))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{orders[0].ClOrdId, orders[1].ClOrdId}, keys)
+
+	// ID重复
+	orders[1].ClOrdId = orders[0].ClOrdId
+	_, err = BatchKeys(PlaceOrders(orders))
+	assert.NotNil(t, err)
+
+	keys, err = BatchKeys(CancelOrders([]CancelOrderReq{{InstId: "BTC-USDT", OrdId: "1"}, {InstId: "BTC-USDT", OrdId: "2", ClOrdId: "c2"}}))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1", "c2"}, keys)
+}
+
+func TestRunBatches(t *testing.T) {
+	var keys []string
+	for i := 0; i < 45; i++ {
+		keys = append(keys, NewClOrdId())
+	}
+
+	var lock sync.Mutex
+	var sizes []int
+	res := RunBatches(context.Background(), keys, BatchOptions{Parallel: 2}, func(ctx context.Context, lo, hi int) ([]OrderResult, error) {
+		lock.Lock()
+		sizes = append(sizes, hi-lo)
+		lock.Unlock()
+		if lo == BATCH_MAX {
+			return nil, errors.New("timeout")
+		}
+		var results []OrderResult
+		for i := lo; i < hi; i++ {
+			r := OrderResult{ClOrdId: keys[i], SCode: "0"}
+			if i == 0 {
+				r.SCode = "51008"
+			}
+			results = append(results, r)
+		}
+		return results, nil
+	})
+
+	assert.ElementsMatch(t, []int{20, 20, 5}, sizes)
+	assert.Equal(t, 45, len(res))
+	assert.Equal(t, keys[44], res[keys[44]].ClOrdId)
+	assert.True(t, res[keys[44]].Success())
+	assert.Equal(t, "51008", res[keys[0]].SCode)
+	assert.NotNil(t, res[keys[BATCH_MAX]].Err)
+	// 第1个订单及第2批的20个订单失败
+	assert.Equal(t, 21, len(res.Failed()))
+}
+
+func TestRunBatchesCancel(t *testing.T) {
+	var keys []string
+	for i := 0; i < 45; i++ {
+		keys = append(keys, NewClOrdId())
+	}
+
+	// 第1批发送时阻塞，直到 ctx 取消
+	ctx, cancel := context.WithCancel(context.Background())
+	var lock sync.Mutex
+	var sent int
+	res := RunBatches(ctx, keys, BatchOptions{Parallel: 1}, func(ctx context.Context, lo, hi int) ([]OrderResult, error) {
+		lock.Lock()
+		sent++
+		lock.Unlock()
+		cancel()
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, 45, len(res))
+	for _, k := range keys {
+		assert.Equal(t, context.Canceled, res[k].Err)
+	}
+}
@@ -0,0 +1,315 @@
+/*
+	下单/撤单/改单请求参数，WebSocket 和 REST 共用
+*/
+package trade
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// 交易模式
+const (
+	TD_MODE_CASH          = "cash"
+	TD_MODE_CROSS         = "cross"
+	TD_MODE_ISOLATED      = "isolated"
+	TD_MODE_SPOT_ISOLATED = "spot_isolated"
+)
+
+// 订单方向
+const (
+	SIDE_BUY  = "buy"
+	SIDE_SELL = "sell"
+)
+
+// 持仓方向
+const (
+	POS_SIDE_LONG  = "long"
+	POS_SIDE_SHORT = "short"
+	POS_SIDE_NET   = "net"
+)
+
+// 订单类型
+const (
+	ORD_TYPE_MARKET            = "market"
+	ORD_TYPE_LIMIT             = "limit"
+	ORD_TYPE_POST_ONLY         = "post_only"
+	ORD_TYPE_FOK               = "fok"
+	ORD_TYPE_IOC               = "ioc"
+	ORD_TYPE_OPTIMAL_LIMIT_IOC = "optimal_limit_ioc"
+)
+
+// 市价单数量单位
+const (
+	TGT_CCY_BASE  = "base_ccy"
+	TGT_CCY_QUOTE = "quote_ccy"
+)
+
+// 自成交保护模式
+const (
+	STP_CANCEL_MAKER = "cancel_maker"
+	STP_CANCEL_TAKER = "cancel_taker"
+	STP_CANCEL_BOTH  = "cancel_both"
+)
+
+// 批量请求的最大订单数
+const BATCH_MAX = 20
+
+/*
+	单个订单的处理结果
+	SCode 为 "0" 表示成功，否则 SMsg 为失败原因
+	ReqId 仅改单请求返回
+*/
+type OrderResult struct {
+	OrdId   string `json:"ordId"`
+	ClOrdId string `json:"clOrdId"`
+	Tag     string `json:"tag"`
+	ReqId   string `json:"reqId"`
+	SCode   string `json:"sCode"`
+	SMsg    string `json:"sMsg"`
+}
+
+func (r OrderResult) Success() bool {
+	return r.SCode == "0"
+}
+
+var (
+	clOrdIdReg = regexp.MustCompile(`^[a-zA-Z0-9]{1,32}$`)
+	tagReg     = regexp.MustCompile(`^[a-zA-Z0-9]{1,16}$`)
+)
+
+/*
+	订单请求，序列化为请求参数前先在本地校验
+*/
+type Order interface {
+	Validate() error
+	ToMap() map[string]interface{}
+	// 请求的过期时间，为零值时不设置
+	Expire() time.Time
+}
+
+/*
+	下单请求
+	InstId: 产品ID，如 BTC-USDT
+	TdMode: 交易模式 TD_MODE_XXX
+	Side: 订单方向 SIDE_XXX
+	PosSide: 持仓方向 POS_SIDE_XXX，开平仓模式下必填
+	OrdType: 订单类型 ORD_TYPE_XXX
+	Px: 委托价格，市价单不填
+	Sz: 委托数量
+	ClOrdId: 客户自定义订单ID，字母和数字，最多32位
+	Tag: 订单标签，字母和数字，最多16位
+	ReduceOnly: 是否只减仓
+	TgtCcy: 币币市价单数量单位 TGT_CCY_XXX
+	StpMode: 自成交保护模式 STP_XXX
+	ExpTime: 请求的过期时间，超过该时间交易所不再处理
+*/
+type PlaceOrderReq struct {
+	InstId     string
+	TdMode     string
+	Side       string
+	PosSide    string
+	OrdType    string
+	Px         string
+	Sz         string
+	ClOrdId    string
+	Tag        string
+	ReduceOnly bool
+	TgtCcy     string
+	StpMode    string
+	ExpTime    time.Time
+}
+
+func (r PlaceOrderReq) Validate() error {
+	if r.InstId == "" {
+		return errors.New("instId不能为空")
+	}
+	switch r.TdMode {
+	case TD_MODE_CASH, TD_MODE_CROSS, TD_MODE_ISOLATED, TD_MODE_SPOT_ISOLATED:
+	default:
+		return errors.New("tdMode错误:" + r.TdMode)
+	}
+	switch r.Side {
+	case SIDE_BUY, SIDE_SELL:
+	default:
+		return errors.New("side错误:" + r.Side)
+	}
+	switch r.PosSide {
+	case "", POS_SIDE_LONG, POS_SIDE_SHORT, POS_SIDE_NET:
+	default:
+		return errors.New("posSide错误:" + r.PosSide)
+	}
+	switch r.OrdType {
+	case ORD_TYPE_MARKET, ORD_TYPE_OPTIMAL_LIMIT_IOC:
+		if r.Px != "" {
+			return errors.New(r.OrdType + "订单不能指定px")
+		}
+	case ORD_TYPE_LIMIT, ORD_TYPE_POST_ONLY, ORD_TYPE_FOK, ORD_TYPE_IOC:
+		if err := checkPositive("px", r.Px); err != nil {
+			return err
+		}
+	default:
+		return errors.New("ordType错误:" + r.OrdType)
+	}
+	if err := checkPositive("sz", r.Sz); err != nil {
+		return err
+	}
+	if r.ClOrdId != "" && !clOrdIdReg.MatchString(r.ClOrdId) {
+		return errors.New("clOrdId错误:" + r.ClOrdId)
+	}
+	if r.Tag != "" && !tagReg.MatchString(r.Tag) {
+		return errors.New("tag错误:" + r.Tag)
+	}
+	switch r.TgtCcy {
+	case "", TGT_CCY_BASE, TGT_CCY_QUOTE:
+	default:
+		return errors.New("tgtCcy错误:" + r.TgtCcy)
+	}
+	switch r.StpMode {
+	case "", STP_CANCEL_MAKER, STP_CANCEL_TAKER, STP_CANCEL_BOTH:
+	default:
+		return errors.New("stpMode错误:" + r.StpMode)
+	}
+	return nil
+}
+
+func (r PlaceOrderReq) ToMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"instId":  r.InstId,
+		"tdMode":  r.TdMode,
+		"side":    r.Side,
+		"ordType": r.OrdType,
+		"sz":      r.Sz,
+	}
+	setStr(m, "posSide", r.PosSide)
+	setStr(m, "px", r.Px)
+	setStr(m, "clOrdId", r.ClOrdId)
+	setStr(m, "tag", r.Tag)
+	setStr(m, "tgtCcy", r.TgtCcy)
+	setStr(m, "stpMode", r.StpMode)
+	if r.ReduceOnly {
+		m["reduceOnly"] = true
+	}
+	return m
+}
+
+func (r PlaceOrderReq) Expire() time.Time {
+	return r.ExpTime
+}
+
+/*
+	撤单请求，OrdId 和 ClOrdId 必须传一个，都传时以 OrdId 为准
+*/
+type CancelOrderReq struct {
+	InstId  string
+	OrdId   string
+	ClOrdId string
+	ExpTime time.Time
+}
+
+func (r CancelOrderReq) Validate() error {
+	if r.InstId == "" {
+		return errors.New("instId不能为空")
+	}
+	return checkOrderId(r.OrdId, r.ClOrdId)
+}
+
+func (r CancelOrderReq) ToMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"instId": r.InstId,
+	}
+	setStr(m, "ordId", r.OrdId)
+	setStr(m, "clOrdId", r.ClOrdId)
+	return m
+}
+
+func (r CancelOrderReq) Expire() time.Time {
+	return r.ExpTime
+}
+
+/*
+	改单请求，OrdId 和 ClOrdId 必须传一个，NewSz 和 NewPx 至少传一个
+	CxlOnFail: 改单失败时是否自动撤单
+	ReqId: 用户自定义修改事件ID，字母和数字，最多32位
+*/
+type AmendOrderReq struct {
+	InstId    string
+	OrdId     string
+	ClOrdId   string
+	ReqId     string
+	CxlOnFail bool
+	NewSz     string
+	NewPx     string
+	ExpTime   time.Time
+}
+
+func (r AmendOrderReq) Validate() error {
+	if r.InstId == "" {
+		return errors.New("instId不能为空")
+	}
+	if err := checkOrderId(r.OrdId, r.ClOrdId); err != nil {
+		return err
+	}
+	if r.ReqId != "" && !clOrdIdReg.MatchString(r.ReqId) {
+		return errors.New("reqId错误:" + r.ReqId)
+	}
+	if r.NewSz == "" && r.NewPx == "" {
+		return errors.New("newSz和newPx不能同时为空")
+	}
+	if r.NewSz != "" {
+		if err := checkPositive("newSz", r.NewSz); err != nil {
+			return err
+		}
+	}
+	if r.NewPx != "" {
+		if err := checkPositive("newPx", r.NewPx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r AmendOrderReq) ToMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"instId": r.InstId,
+	}
+	setStr(m, "ordId", r.OrdId)
+	setStr(m, "clOrdId", r.ClOrdId)
+	setStr(m, "reqId", r.ReqId)
+	setStr(m, "newSz", r.NewSz)
+	setStr(m, "newPx", r.NewPx)
+	if r.CxlOnFail {
+		m["cxlOnFail"] = true
+	}
+	return m
+}
+
+func (r AmendOrderReq) Expire() time.Time {
+	return r.ExpTime
+}
+
+func setStr(m map[string]interface{}, k, v string) {
+	if v != "" {
+		m[k] = v
+	}
+}
+
+func checkPositive(name, val string) error {
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil || f <= 0 {
+		return errors.New(name + "错误:" + val)
+	}
+	return nil
+}
+
+func checkOrderId(ordId, clOrdId string) error {
+	if ordId == "" && clOrdId == "" {
+		return errors.New("ordId和clOrdId不能同时为空")
+	}
+	if clOrdId != "" && !clOrdIdReg.MatchString(clOrdId) {
+		return errors.New("clOrdId错误:" + clOrdId)
+	}
+	return nil
+}
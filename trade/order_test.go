@@ -0,0 +1,85 @@
+package trade
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlaceOrderValidate(t *testing.T) {
+	o := PlaceOrderReq{InstId: "BTC-USDT", TdMode: TD_MODE_CASH, Side: SIDE_BUY, OrdType: ORD_TYPE_LIMIT, Px: "10000", Sz: "0.01"}
+	assert.Nil(t, o.Validate())
+
+	cases := []func(o *PlaceOrderReq){
+		func(o *PlaceOrderReq) { o.InstId = "" },
+		func(o *PlaceOrderReq) { o.TdMode = "Cash" },
+		func(o *PlaceOrderReq) { o.Side = "long" },
+		func(o *PlaceOrderReq) { o.OrdType = "ordtype" },
+		func(o *PlaceOrderReq) { o.Px = "" },
+		func(o *PlaceOrderReq) { o.Sz = "-1" },
+		func(o *PlaceOrderReq) { o.ClOrdId = "a-1" },
+		func(o *PlaceOrderReq) { o.Tag = "12345678901234567" },
+		func(o *PlaceOrderReq) { o.PosSide = "buy" },
+		func(o *PlaceOrderReq) { o.TgtCcy = "usdt" },
+		func(o *PlaceOrderReq) { o.StpMode = "none" },
+		func(o *PlaceOrderReq) { o.OrdType = ORD_TYPE_MARKET },
+	}
+	for i, fn := range cases {
+		c := o
+		fn(&c)
+		assert.NotNil(t, c.Validate(), i)
+	}
+
+	o.ReduceOnly = true
+	o.ClOrdId = "abc1"
+	assert.Equal(t, map[string]interface{}{
+		"instId":     "BTC-USDT",
+		"tdMode":     "cash",
+		"side":       "buy",
+		"ordType":    "limit",
+		"px":         "10000",
+		"sz":         "0.01",
+		"clOrdId":    "abc1",
+		"reduceOnly": true,
+	}, o.ToMap())
+}
+
+func TestCancelAmendValidate(t *testing.T) {
+	assert.NotNil(t, CancelOrderReq{InstId: "BTC-USDT"}.Validate())
+	assert.Nil(t, CancelOrderReq{InstId: "BTC-USDT", ClOrdId: "abc"}.Validate())
+
+	assert.NotNil(t, AmendOrderReq{InstId: "BTC-USDT", OrdId: "1"}.Validate())
+	assert.NotNil(t, AmendOrderReq{InstId: "BTC-USDT", OrdId: "1", NewPx: "0"}.Validate())
+	a := AmendOrderReq{InstId: "BTC-USDT", OrdId: "1", NewSz: "2", CxlOnFail: true}
+	assert.Nil(t, a.Validate())
+	assert.Equal(t, map[string]interface{}{"instId": "BTC-USDT", "ordId": "1", "newSz": "2", "cxlOnFail": true}, a.ToMap())
+}
+
+func TestNewJRPCReq(t *testing.T) {
+	exp := time.Unix(1700000000, 0)
+	orders := []CancelOrderReq{
+		{InstId: "BTC-USDT", OrdId: "1", ExpTime: exp.Add(time.Second)},
+		{InstId: "BTC-USDT", OrdId: "2", ExpTime: exp},
+		{InstId: "BTC-USDT", OrdId: "3"},
+	}
+	req, err := NewJRPCReq("r1", OP_BATCH_CANCEL_ORDERS, CancelOrders(orders)...)
+	assert.Nil(t, err)
+	assert.Equal(t, "r1", req.Id)
+	assert.Equal(t, 3, req.Len())
+	assert.Equal(t, "1700000000000", req.ExpTime)
+
+	// 任一订单参数错误时整个请求失败
+	orders[2].OrdId = ""
+	_, err = NewJRPCReq("r1", OP_BATCH_CANCEL_ORDERS, CancelOrders(orders)...)
+	assert.NotNil(t, err)
+
+	_, err = NewJRPCReq("r1", OP_BATCH_CANCEL_ORDERS)
+	assert.NotNil(t, err)
+	many := make([]CancelOrderReq, BATCH_MAX+1)
+	for i := range many {
+		many[i] = CancelOrderReq{InstId: "BTC-USDT", OrdId: "1"}
+	}
+	_, err = NewJRPCReq("r1", OP_BATCH_CANCEL_ORDERS, CancelOrders(many)...)
+	assert.NotNil(t, err)
+}
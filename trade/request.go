@@ -0,0 +1,239 @@
+package trade
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+	"v5sdk_go/ws/wImpl"
+)
+
+// websocket交易请求的 op
+const (
+	OP_ORDER               = "order"
+	OP_BATCH_ORDERS        = "batch-orders"
+	OP_CANCEL_ORDER        = "cancel-order"
+	OP_BATCH_CANCEL_ORDERS = "batch-cancel-orders"
+	OP_AMEND_ORDER         = "amend-order"
+	OP_BATCH_AMEND_ORDERS  = "batch-amend-orders"
+	OP_MASS_CANCEL         = "mass-cancel"
+)
+
+// REST交易接口地址
+const (
+	URI_ORDER               = "/api/v5/trade/order"
+	URI_BATCH_ORDERS        = "/api/v5/trade/batch-orders"
+	URI_CANCEL_ORDER        = "/api/v5/trade/cancel-order"
+	URI_BATCH_CANCEL_ORDERS = "/api/v5/trade/cancel-batch-orders"
+	URI_AMEND_ORDER         = "/api/v5/trade/amend-order"
+	URI_BATCH_AMEND_ORDERS  = "/api/v5/trade/amend-batch-orders"
+	URI_CANCEL_ALL_AFTER    = "/api/v5/trade/cancel-all-after"
+	URI_ORDERS_PENDING      = "/api/v5/trade/orders-pending"
+	URI_MASS_CANCEL         = "/api/v5/trade/mass-cancel"
+)
+
+/*
+	依次校验订单并转换为请求参数
+	expTime: 各订单中最早的过期时间，均未设置时为零值
+*/
+func BuildArgs(orders ...Order) (args []map[string]interface{}, expTime time.Time, err error) {
+	if len(orders) == 0 {
+		err = errors.New("订单不能为空")
+		return
+	}
+	if len(orders) > BATCH_MAX {
+		err = errors.New("批量请求最多" + strconv.Itoa(BATCH_MAX) + "个订单")
+		return
+	}
+
+	for i, o := range orders {
+		if err = o.Validate(); err != nil {
+			err = errors.New("第" + strconv.Itoa(i+1) + "个订单参数错误:" + err.Error())
+			return
+		}
+		args = append(args, o.ToMap())
+		exp := o.Expire()
+		if !exp.IsZero() && (expTime.IsZero() || exp.Before(expTime)) {
+			expTime = exp
+		}
+	}
+	return
+}
+
+/*
+	生成websocket交易请求
+*/
+func NewJRPCReq(id, op string, orders ...Order) (req wImpl.JRPCReq, err error) {
+	args, expTime, err := BuildArgs(orders...)
+	if err != nil {
+		return
+	}
+	req = wImpl.JRPCReq{
+		Id:      id,
+		Op:      op,
+		Args:    args,
+		ExpTime: ExpTimeString(expTime),
+	}
+	return
+}
+
+/*
+	过期时间转换为毫秒时间戳，零值返回空字符串
+*/
+func ExpTimeString(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
+
+/*
+	解析各订单的处理结果，顺序与请求一致
+*/
+func ParseResults(data []map[string]interface{}) []OrderResult {
+	res := make([]OrderResult, 0, len(data))
+	for _, d := range data {
+		str := func(k string) string {
+			v, _ := d[k].(string)
+			return v
+		}
+		res = append(res, OrderResult{
+			OrdId:   str("ordId"),
+			ClOrdId: str("clOrdId"),
+			Tag:     str("tag"),
+			ReqId:   str("reqId"),
+			SCode:   str("sCode"),
+			SMsg:    str("sMsg"),
+		})
+	}
+	return res
+}
+
+// 转换为 []Order
+func PlaceOrders(orders []PlaceOrderReq) []Order {
+	res := make([]Order, len(orders))
+	for i := range orders {
+		res[i] = orders[i]
+	}
+	return res
+}
+
+// 转换为 []Order
+func CancelOrders(orders []CancelOrderReq) []Order {
+	res := make([]Order, len(orders))
+	for i := range orders {
+		res[i] = orders[i]
+	}
+	return res
+}
+
+// 转换为 []Order
+func AmendOrders(orders []AmendOrderReq) []Order {
+	res := make([]Order, len(orders))
+	for i := range orders {
+		res[i] = orders[i]
+	}
+	return res
+}
+
+/*
+	下单前检查，返回错误时不发送请求
+	op: OP_ORDER、OP_CANCEL_ORDER、OP_AMEND_ORDER 或 OP_MASS_CANCEL，批量请求使用对应的单个订单 op
+	args: 各订单的请求参数
+*/
+type PreTradeCheck interface {
+	CheckOrders(ctx context.Context, op string, args []map[string]interface{}) error
+}
+
+/*
+	使用函数作为下单前检查
+	例如:
+	cli.SetPreTradeCheck(trade.PreTradeCheckFunc(func(ctx context.Context, op string, args []map[string]interface{}) error { return nil }))
+*/
+type PreTradeCheckFunc func(ctx context.Context, op string, args []map[string]interface{}) error
+
+func (f PreTradeCheckFunc) CheckOrders(ctx context.Context, op string, args []map[string]interface{}) error {
+	return f(ctx, op, args)
+}
+
+/*
+	请求未发送即被拒绝，如参数校验失败或下单前检查未通过
+	可继续使用 errors.Is/As 判断原始错误
+*/
+type RejectedError struct {
+	Err error
+}
+
+func (e *RejectedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RejectedError) Unwrap() error {
+	return e.Err
+}
+
+// 标记为未发送即被拒绝，err 为 nil 时返回 nil
+func Rejected(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RejectedError{Err: err}
+}
+
+/*
+	请求是否未发送即被拒绝，返回 false 时请求可能已到达交易所
+*/
+func IsRejected(err error) bool {
+	var e *RejectedError
+	return errors.As(err, &e)
+}
+
+type skipCheckKey struct{}
+
+/*
+	返回跳过风控检查的 context，用于熔断后的撤单和平仓等必须发出的请求
+	下单前检查仍会执行，由检查自行判断是否跳过，熔断开关不受影响
+*/
+func SkipPreTradeCheck(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipCheckKey{}, true)
+}
+
+/*
+	context 是否要求跳过风控检查
+*/
+func PreTradeCheckSkipped(ctx context.Context) bool {
+	v, _ := ctx.Value(skipCheckKey{}).(bool)
+	return v
+}
+
+/*
+	批量请求的 op 转换为对应的单个订单 op
+*/
+func SingleOp(op string) string {
+	switch op {
+	case OP_BATCH_ORDERS:
+		return OP_ORDER
+	case OP_BATCH_CANCEL_ORDERS:
+		return OP_CANCEL_ORDER
+	case OP_BATCH_AMEND_ORDERS:
+		return OP_AMEND_ORDER
+	}
+	return op
+}
+
+/*
+	REST交易接口地址对应的单个订单 op，非交易接口返回空字符串
+*/
+func OpOfUri(uri string) string {
+	switch uri {
+	case URI_ORDER, URI_BATCH_ORDERS:
+		return OP_ORDER
+	case URI_CANCEL_ORDER, URI_BATCH_CANCEL_ORDERS:
+		return OP_CANCEL_ORDER
+	case URI_AMEND_ORDER, URI_BATCH_AMEND_ORDERS:
+		return OP_AMEND_ORDER
+	case URI_MASS_CANCEL:
+		return OP_MASS_CANCEL
+	}
+	return ""
+}
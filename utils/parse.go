@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"strconv"
+	"time"
+)
+
+/*
+	解析交易所返回的毫秒时间戳，为空、0 或格式错误时返回零值
+*/
+func MsTime(v string) time.Time {
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || ms == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+/*
+	v 不为空时赋值给 dst，推送数据中未变化的字段可能为空
+*/
+func SetNonEmpty(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
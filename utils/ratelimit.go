@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+/*
+	令牌桶限速器，可被多个协程共用
+	例如 NewRateLimiter(300, 2*time.Second) 表示每2秒最多300次，允许突发300次
+*/
+type RateLimiter struct {
+	lock   sync.Mutex
+	rate   float64 // 每秒补充的令牌数
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(n int, per time.Duration) (*RateLimiter, error) {
+	if n <= 0 || per <= 0 {
+		return nil, errors.New("限速参数错误")
+	}
+	return &RateLimiter{
+		rate:   float64(n) / per.Seconds(),
+		burst:  float64(n),
+		tokens: float64(n),
+		last:   time.Now(),
+	}, nil
+}
+
+/*
+	等待获取 n 个令牌，n 大于桶容量时按桶容量计算
+	ctx 结束时返回 ctx.Err()，不消耗令牌
+*/
+func (l *RateLimiter) Wait(ctx context.Context, n int) error {
+	need := float64(n)
+	if need > l.burst {
+		need = l.burst
+	}
+
+	for {
+		l.lock.Lock()
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+		if l.tokens >= need {
+			l.tokens -= need
+			l.lock.Unlock()
+			return nil
+		}
+		wait := time.Duration((need - l.tokens) / l.rate * float64(time.Second))
+		l.lock.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
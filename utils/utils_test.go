@@ -1,8 +1,10 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestHmacSha256Base64Signer(t *testing.T) {
@@ -15,3 +17,43 @@ func TestHmacSha256Base64Signer(t *testing.T) {
 	fmt.Println(res)
 	t.Log(res)
 }
+
+func TestRateLimiter(t *testing.T) {
+	if _, err := NewRateLimiter(0, time.Second); err == nil {
+		t.Fatal("限速参数错误")
+	}
+	l, err := NewRateLimiter(10, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	start := time.Now()
+	if err := l.Wait(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 20*time.Millisecond {
+		t.Fatal("突发请求不应等待")
+	}
+	if err := l.Wait(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 40*time.Millisecond {
+		t.Fatal("令牌不足时应等待")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := l.Wait(ctx, 10); err != context.Canceled {
+		t.Fatal("ctx取消时应返回错误", err)
+	}
+}
+
+func TestMsTime(t *testing.T) {
+	if !MsTime("").IsZero() || !MsTime("0").IsZero() || !MsTime("abc").IsZero() {
+		t.Fatal("无效时间戳应返回零值")
+	}
+	if !MsTime("1700000000123").Equal(time.Unix(1700000000, 123*int64(time.Millisecond))) {
+		t.Fatal("时间戳解析错误")
+	}
+}
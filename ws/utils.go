@@ -67,6 +67,11 @@ func checkResult(wsReq WSReqData, wsRsps []*Msg) (res bool, err error) {
 			if info.Code != "0" {
 				return
 			}
+			//每个订单都应有对应的处理结果
+			if len(info.Data) != wsReq.Len() {
+				err = errors.New("未得到所有的期望的返回结果")
+				return
+			}
 		}
 	}
 
@@ -11,6 +11,7 @@ import (
 	"hash/crc32"
 	"log"
 	"strconv"
+	"strings"
 )
 
 // 普通推送
@@ -27,10 +28,12 @@ type DepthData struct {
 }
 
 type DepthDetail struct {
-	Asks     [][]string `json:"asks"`
-	Bids     [][]string `json:"bids"`
-	Ts       string     `json:"ts"`
-	Checksum int32      `json:"checksum"`
+	Asks      [][]string `json:"asks"`
+	Bids      [][]string `json:"bids"`
+	Ts        string     `json:"ts"`
+	Checksum  int32      `json:"checksum"`
+	SeqId     int64      `json:"seqId"`
+	PrevSeqId int64      `json:"prevSeqId"`
 }
 
 /*
@@ -47,7 +50,7 @@ func (this *DepthData) CheckSum(snap *DepthDetail) (pDepData *DepthDetail, err e
 		_, cs := CalCrc32(this.Data[0].Asks, this.Data[0].Bids)
 
 		if cs != this.Data[0].Checksum {
-			err = errors.New("校验失败！")
+			err = ErrChecksum
 			return
 		}
 		pDepData = &this.Data[0]
@@ -190,16 +193,16 @@ func mergeDepth(oldDepths [][]string, newDepths [][]string, method string) (res
 */
 func MergDepthData(snap DepthDetail, update DepthDetail, expChecksum int32) (res *DepthDetail, err error) {
 
-	newAskDepths, err1 := mergeDepth(snap.Asks, update.Asks, "asks")
-	if err1 != nil {
+	newAskDepths, err := mergeDepth(snap.Asks, update.Asks, "asks")
+	if err != nil {
 		return
 	}
 
 	// log.Println("old Ask - ", snap.Asks)
 	// log.Println("update Ask - ", update.Asks)
 	// log.Println("new Ask - ", newAskDepths)
-	newBidDepths, err2 := mergeDepth(snap.Bids, update.Bids, "bids")
-	if err2 != nil {
+	newBidDepths, err := mergeDepth(snap.Bids, update.Bids, "bids")
+	if err != nil {
 		return
 	}
 	// log.Println("old Bids - ", snap.Bids)
@@ -208,9 +211,8 @@ func MergDepthData(snap DepthDetail, update DepthDetail, expChecksum int32) (res
 
 	cBuf, checksum := CalCrc32(newAskDepths, newBidDepths)
 	if checksum != expChecksum {
-		err = errors.New("校验失败！")
-		log.Println("buffer:", cBuf.String())
-		log.Fatal(checksum, expChecksum)
+		err = ErrChecksum
+		log.Println("校验失败！buffer:", cBuf.String(), "checksum:", checksum, "expect:", expChecksum)
 		return
 	}
 
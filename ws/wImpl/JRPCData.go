@@ -10,9 +10,10 @@ import (
 
 // jrpc请求结构体
 type JRPCReq struct {
-	Id   string                   `json:"id"`
-	Op   string                   `json:"op"`
-	Args []map[string]interface{} `json:"args"`
+	Id      string                   `json:"id"`
+	Op      string                   `json:"op"`
+	ExpTime string                   `json:"expTime,omitempty"` // 请求过期时间，毫秒时间戳
+	Args    []map[string]interface{} `json:"args"`
 }
 
 func (r JRPCReq) GetType() int {
@@ -27,8 +28,9 @@ func (r JRPCReq) ToString() string {
 	return data
 }
 
+// 请求中的订单数
 func (r JRPCReq) Len() int {
-	return 1
+	return len(r.Args)
 }
 
 // jrpc响应结构体
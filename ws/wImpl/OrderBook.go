@@ -0,0 +1,604 @@
+/*
+	本地订单簿
+	按价格索引的档位(跳表)，支持 O(log n) 更新以及常用的深度查询
+*/
+
+package wImpl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"sync"
+)
+
+// 订单簿方向
+type BookSide string
+
+const (
+	BOOK_ASKS BookSide = "asks"
+	BOOK_BIDS BookSide = "bids"
+)
+
+// 参与checksum计算的档位数
+const CHECKSUM_DEPTH = 25
+
+var (
+	ErrChecksum     = errors.New("深度校验失败！")
+	ErrBookNotReady = errors.New("深度快照数据不存在！")
+)
+
+/*
+	tbt深度数据序号不连续
+	Expected: 期望的 prevSeqId，即上一次推送的 seqId
+	PrevSeqId/SeqId: 本次推送的序号
+*/
+type SeqGapError struct {
+	Expected  int64
+	PrevSeqId int64
+	SeqId     int64
+}
+
+func (e *SeqGapError) Error() string {
+	return fmt.Sprintf("深度数据序号不连续！expect prevSeqId:%v, prevSeqId:%v, seqId:%v", e.Expected, e.PrevSeqId, e.SeqId)
+}
+
+/*
+	价格档位
+	Px/Sz: 解析后的价格和数量
+	PxStr/SzStr: 原始字符串，用于checksum计算
+	LiqOrd: 强平订单数量(已废弃字段)
+	OrdCnt: 订单数量
+*/
+type PriceLevel struct {
+	Px     float64
+	Sz     float64
+	PxStr  string
+	SzStr  string
+	LiqOrd string
+	OrdCnt string
+}
+
+func parseLevel(raw []string) (lv PriceLevel, err error) {
+	if len(raw) < 2 {
+		err = errors.New("深度档位数据错误！")
+		return
+	}
+	lv.PxStr, lv.SzStr = raw[0], raw[1]
+	if lv.Px, err = strconv.ParseFloat(raw[0], 64); err != nil {
+		return
+	}
+	if lv.Sz, err = strconv.ParseFloat(raw[1], 64); err != nil {
+		return
+	}
+	if len(raw) > 2 {
+		lv.LiqOrd = raw[2]
+	}
+	if len(raw) > 3 {
+		lv.OrdCnt = raw[3]
+	}
+	return
+}
+
+func (lv *PriceLevel) toRaw() []string {
+	return []string{lv.PxStr, lv.SzStr, lv.LiqOrd, lv.OrdCnt}
+}
+
+const maxSkipLevel = 16
+
+type skipNode struct {
+	lv   PriceLevel
+	next []*skipNode
+}
+
+/*
+	订单簿单边，跳表按价格排序，asks 升序，bids 降序
+*/
+type bookSide struct {
+	desc   bool
+	head   *skipNode
+	level  int
+	length int
+	index  map[float64]*skipNode
+	seed   uint64
+	update [maxSkipLevel]*skipNode
+}
+
+func newBookSide(desc bool) *bookSide {
+	return &bookSide{
+		desc:  desc,
+		head:  &skipNode{next: make([]*skipNode, maxSkipLevel)},
+		level: 1,
+		index: make(map[float64]*skipNode),
+		seed:  0x9E3779B97F4A7C15,
+	}
+}
+
+// 价格 a 是否排在 b 之前
+func (s *bookSide) before(a, b float64) bool {
+	if s.desc {
+		return a > b
+	}
+	return a < b
+}
+
+func (s *bookSide) randomLevel() int {
+	// xorshift
+	s.seed ^= s.seed << 13
+	s.seed ^= s.seed >> 7
+	s.seed ^= s.seed << 17
+	lvl := 1
+	for x := s.seed; lvl < maxSkipLevel && x&3 == 0; x >>= 2 {
+		lvl++
+	}
+	return lvl
+}
+
+// 查找各层中位于 px 之前的最后一个节点
+func (s *bookSide) findPrev(px float64) {
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && s.before(x.next[i].lv.Px, px) {
+			x = x.next[i]
+		}
+		s.update[i] = x
+	}
+}
+
+/*
+	设置档位，数量为0时删除档位
+*/
+func (s *bookSide) set(lv PriceLevel) {
+	if lv.Sz == 0 {
+		s.remove(lv.Px)
+		return
+	}
+
+	if node, ok := s.index[lv.Px]; ok {
+		node.lv = lv
+		return
+	}
+
+	s.findPrev(lv.Px)
+	lvl := s.randomLevel()
+	if lvl > s.level {
+		for i := s.level; i < lvl; i++ {
+			s.update[i] = s.head
+		}
+		s.level = lvl
+	}
+
+	node := &skipNode{lv: lv, next: make([]*skipNode, lvl)}
+	for i := 0; i < lvl; i++ {
+		node.next[i] = s.update[i].next[i]
+		s.update[i].next[i] = node
+	}
+	s.index[lv.Px] = node
+	s.length++
+}
+
+func (s *bookSide) remove(px float64) {
+	node, ok := s.index[px]
+	if !ok {
+		return
+	}
+
+	s.findPrev(px)
+	for i := 0; i < s.level; i++ {
+		if s.update[i].next[i] != node {
+			break
+		}
+		s.update[i].next[i] = node.next[i]
+	}
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+	delete(s.index, px)
+	s.length--
+}
+
+func (s *bookSide) reset() {
+	for i := range s.head.next {
+		s.head.next[i] = nil
+	}
+	s.level = 1
+	s.length = 0
+	s.index = make(map[float64]*skipNode)
+}
+
+func (s *bookSide) first() *skipNode {
+	return s.head.next[0]
+}
+
+/*
+	从最优价格开始遍历，fn 返回 false 时停止
+*/
+func (s *bookSide) each(fn func(lv *PriceLevel) bool) {
+	for x := s.first(); x != nil; x = x.next[0] {
+		if !fn(&x.lv) {
+			return
+		}
+	}
+}
+
+/*
+	订单簿
+	可由 books、books5、books-l2-tbt、books50-l2-tbt 频道数据驱动
+*/
+type OrderBook struct {
+	lock     sync.RWMutex
+	channel  string
+	instId   string
+	asks     *bookSide
+	bids     *bookSide
+	ts       string
+	checksum int32
+	seqId    int64
+	ready    bool
+	crcBuf   bytes.Buffer
+}
+
+func NewOrderBook(channel, instId string) *OrderBook {
+	return &OrderBook{
+		channel: channel,
+		instId:  instId,
+		asks:    newBookSide(false),
+		bids:    newBookSide(true),
+	}
+}
+
+func (b *OrderBook) Channel() string {
+	return b.channel
+}
+
+func (b *OrderBook) InstId() string {
+	return b.instId
+}
+
+/*
+	是否需要checksum校验，books5 每次推送均为全量数据且不带checksum
+*/
+func (b *OrderBook) needChecksum() bool {
+	return b.channel != "books5"
+}
+
+/*
+	按频道推送的action更新订单簿
+*/
+func (b *OrderBook) Apply(action string, d DepthDetail) error {
+	if b.channel == "books5" || action == DEPTH_SNAPSHOT || action == "" {
+		return b.ApplySnapshot(d)
+	}
+	return b.ApplyUpdate(d)
+}
+
+/*
+	使用全量数据重建订单簿
+*/
+func (b *OrderBook) ApplySnapshot(d DepthDetail) (err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.ready = false
+	b.asks.reset()
+	b.bids.reset()
+	if err = b.merge(d); err != nil {
+		return
+	}
+	if err = b.verify(d.Checksum); err != nil {
+		return
+	}
+	b.ready = true
+	return
+}
+
+/*
+	合并增量数据
+*/
+func (b *OrderBook) ApplyUpdate(d DepthDetail) (err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if !b.ready {
+		return ErrBookNotReady
+	}
+
+	if b.checkSeq(d) {
+		if d.PrevSeqId != b.seqId {
+			b.ready = false
+			return &SeqGapError{Expected: b.seqId, PrevSeqId: d.PrevSeqId, SeqId: d.SeqId}
+		}
+		// 无变化的推送，只更新时间
+		if d.SeqId == d.PrevSeqId && len(d.Asks) == 0 && len(d.Bids) == 0 {
+			b.ts = d.Ts
+			return
+		}
+		// seqId 小于 prevSeqId 表示维护后序号重置，同样视为连续
+	}
+
+	if err = b.merge(d); err != nil {
+		b.ready = false
+		return
+	}
+	if err = b.verify(d.Checksum); err != nil {
+		b.ready = false
+		return
+	}
+	return
+}
+
+func (b *OrderBook) merge(d DepthDetail) error {
+	for _, raw := range d.Asks {
+		lv, err := parseLevel(raw)
+		if err != nil {
+			return err
+		}
+		b.asks.set(lv)
+	}
+	for _, raw := range d.Bids {
+		lv, err := parseLevel(raw)
+		if err != nil {
+			return err
+		}
+		b.bids.set(lv)
+	}
+	b.ts = d.Ts
+	b.checksum = d.Checksum
+	b.seqId = d.SeqId
+	return nil
+}
+
+/*
+	是否需要校验序号连续性，快照和增量数据都带有序号时才校验
+*/
+func (b *OrderBook) checkSeq(d DepthDetail) bool {
+	if !b.needChecksum() || b.seqId == 0 {
+		return false
+	}
+	return d.SeqId != 0 || d.PrevSeqId != 0
+}
+
+func (b *OrderBook) verify(expChecksum int32) error {
+	if !b.needChecksum() {
+		return nil
+	}
+	if b.calChecksum() != expChecksum {
+		return ErrChecksum
+	}
+	return nil
+}
+
+/*
+	按OKX规则计算前25档的crc32
+*/
+func (b *OrderBook) calChecksum() int32 {
+	buf := &b.crcBuf
+	buf.Reset()
+
+	bid, ask := b.bids.first(), b.asks.first()
+	for i := 0; i < CHECKSUM_DEPTH && (bid != nil || ask != nil); i++ {
+		if bid != nil {
+			if buf.Len() > 0 {
+				buf.WriteByte(':')
+			}
+			buf.WriteString(bid.lv.PxStr)
+			buf.WriteByte(':')
+			buf.WriteString(bid.lv.SzStr)
+			bid = bid.next[0]
+		}
+		if ask != nil {
+			if buf.Len() > 0 {
+				buf.WriteByte(':')
+			}
+			buf.WriteString(ask.lv.PxStr)
+			buf.WriteByte(':')
+			buf.WriteString(ask.lv.SzStr)
+			ask = ask.next[0]
+		}
+	}
+	return int32(crc32.ChecksumIEEE(buf.Bytes()))
+}
+
+/*
+	当前订单簿的checksum
+*/
+func (b *OrderBook) Checksum() int32 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.calChecksum()
+}
+
+/*
+	订单簿是否已经收到全量数据并校验通过
+*/
+func (b *OrderBook) Ready() bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.ready
+}
+
+// 最近一次更新的序号
+func (b *OrderBook) SeqId() int64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.seqId
+}
+
+// 最近一次更新的时间戳
+func (b *OrderBook) Ts() string {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.ts
+}
+
+// 买卖双方的档位数
+func (b *OrderBook) Len() (bids, asks int) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.bids.length, b.asks.length
+}
+
+func (b *OrderBook) side(side BookSide) *bookSide {
+	if side == BOOK_BIDS {
+		return b.bids
+	}
+	return b.asks
+}
+
+// 买一
+func (b *OrderBook) BestBid() (lv PriceLevel, ok bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if node := b.bids.first(); node != nil {
+		return node.lv, true
+	}
+	return
+}
+
+// 卖一
+func (b *OrderBook) BestAsk() (lv PriceLevel, ok bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if node := b.asks.first(); node != nil {
+		return node.lv, true
+	}
+	return
+}
+
+// 买卖价差
+func (b *OrderBook) Spread() (spread float64, ok bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	bid, ask := b.bids.first(), b.asks.first()
+	if bid == nil || ask == nil {
+		return
+	}
+	return ask.lv.Px - bid.lv.Px, true
+}
+
+// 中间价
+func (b *OrderBook) MidPrice() (mid float64, ok bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	bid, ask := b.bids.first(), b.asks.first()
+	if bid == nil || ask == nil {
+		return
+	}
+	return (ask.lv.Px + bid.lv.Px) / 2, true
+}
+
+/*
+	买卖双方的前N档
+*/
+func (b *OrderBook) TopN(n int) (bids, asks []PriceLevel) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	bids = topN(b.bids, n)
+	asks = topN(b.asks, n)
+	return
+}
+
+func topN(s *bookSide, n int) []PriceLevel {
+	if n > s.length {
+		n = s.length
+	}
+	res := make([]PriceLevel, 0, n)
+	s.each(func(lv *PriceLevel) bool {
+		if len(res) >= n {
+			return false
+		}
+		res = append(res, *lv)
+		return true
+	})
+	return res
+}
+
+/*
+	累计深度：从最优价格到 px(含)的挂单总数量
+*/
+func (b *OrderBook) CumDepth(side BookSide, px float64) (total float64) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	s := b.side(side)
+	s.each(func(lv *PriceLevel) bool {
+		if s.before(px, lv.Px) {
+			return false
+		}
+		total += lv.Sz
+		return true
+	})
+	return
+}
+
+/*
+	吃掉 sz 数量后到达的价格
+	ok 为 false 表示深度不足
+*/
+func (b *OrderBook) PriceAtSize(side BookSide, sz float64) (px float64, ok bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	remain := sz
+	b.side(side).each(func(lv *PriceLevel) bool {
+		px = lv.Px
+		remain -= lv.Sz
+		if remain <= 0 {
+			ok = true
+			return false
+		}
+		return true
+	})
+	return
+}
+
+/*
+	吃掉 sz 数量的成交均价
+	side 为被吃的一方，买入时为 BOOK_ASKS，卖出时为 BOOK_BIDS
+	ok 为 false 表示深度不足
+*/
+func (b *OrderBook) VWAP(side BookSide, sz float64) (vwap float64, ok bool) {
+	if sz <= 0 {
+		return
+	}
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	remain, notional := sz, 0.0
+	b.side(side).each(func(lv *PriceLevel) bool {
+		fill := lv.Sz
+		if fill > remain {
+			fill = remain
+		}
+		notional += fill * lv.Px
+		remain -= fill
+		return remain > 0
+	})
+	if remain > 0 {
+		return
+	}
+	return notional / sz, true
+}
+
+/*
+	导出当前订单簿的全量数据
+*/
+func (b *OrderBook) Snapshot() DepthDetail {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	res := DepthDetail{
+		Asks:     make([][]string, 0, b.asks.length),
+		Bids:     make([][]string, 0, b.bids.length),
+		Ts:       b.ts,
+		Checksum: b.checksum,
+	}
+	b.asks.each(func(lv *PriceLevel) bool {
+		res.Asks = append(res.Asks, lv.toRaw())
+		return true
+	})
+	b.bids.each(func(lv *PriceLevel) bool {
+		res.Bids = append(res.Bids, lv.toRaw())
+		return true
+	})
+	return res
+}
@@ -0,0 +1,200 @@
+package wImpl
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newDetail(asks, bids [][]string) DepthDetail {
+	_, cs := CalCrc32(asks, bids)
+	return DepthDetail{Asks: asks, Bids: bids, Checksum: cs}
+}
+
+func TestOrderBook(t *testing.T) {
+	asks := [][]string{{"100.5", "1", "0", "1"}, {"101", "2", "0", "2"}, {"102", "3", "0", "1"}}
+	bids := [][]string{{"100", "1.5", "0", "1"}, {"99.5", "2", "0", "1"}, {"99", "4", "0", "3"}}
+
+	book := NewOrderBook("books", "BTC-USDT")
+	assert.Equal(t, ErrBookNotReady, book.Apply(DEPTH_UPDATE, newDetail(nil, nil)))
+
+	err := book.Apply(DEPTH_SNAPSHOT, newDetail(asks, bids))
+	assert.Nil(t, err)
+	assert.True(t, book.Ready())
+
+	bid, _ := book.BestBid()
+	ask, _ := book.BestAsk()
+	assert.Equal(t, 100.0, bid.Px)
+	assert.Equal(t, 100.5, ask.Px)
+	spread, _ := book.Spread()
+	assert.Equal(t, 0.5, spread)
+	mid, _ := book.MidPrice()
+	assert.Equal(t, 100.25, mid)
+
+	topBids, topAsks := book.TopN(2)
+	assert.Equal(t, 2, len(topBids))
+	assert.Equal(t, "99.5", topBids[1].PxStr)
+	assert.Equal(t, "101", topAsks[1].PxStr)
+
+	assert.Equal(t, 3.0, book.CumDepth(BOOK_ASKS, 101))
+	assert.Equal(t, 3.5, book.CumDepth(BOOK_BIDS, 99.5))
+
+	px, ok := book.PriceAtSize(BOOK_ASKS, 2.5)
+	assert.True(t, ok)
+	assert.Equal(t, 101.0, px)
+	_, ok = book.PriceAtSize(BOOK_ASKS, 100)
+	assert.False(t, ok)
+
+	vwap, ok := book.VWAP(BOOK_ASKS, 3)
+	assert.True(t, ok)
+	assert.InDelta(t, (100.5+2*101)/3, vwap, 1e-9)
+
+	// 增量：删除 100.5，新增 100.2，修改 99
+	newAsks := [][]string{{"100.2", "0.5", "0", "1"}, {"101", "2", "0", "2"}, {"102", "3", "0", "1"}}
+	newBids := [][]string{{"100", "1.5", "0", "1"}, {"99.5", "2", "0", "1"}, {"99", "1", "0", "1"}}
+	_, cs := CalCrc32(newAsks, newBids)
+	update := DepthDetail{
+		Asks:     [][]string{{"100.2", "0.5", "0", "1"}, {"100.5", "0", "0", "0"}},
+		Bids:     [][]string{{"99", "1", "0", "1"}},
+		Checksum: cs,
+	}
+	err = book.Apply(DEPTH_UPDATE, update)
+	assert.Nil(t, err)
+
+	snap := book.Snapshot()
+	assert.Equal(t, newAsks, snap.Asks)
+	assert.Equal(t, newBids, snap.Bids)
+
+	// 校验失败后订单簿失效
+	update.Checksum++
+	assert.Equal(t, ErrChecksum, book.Apply(DEPTH_UPDATE, update))
+	assert.False(t, book.Ready())
+}
+
+func TestOrderBookBooks5(t *testing.T) {
+	book := NewOrderBook("books5", "BTC-USDT")
+	err := book.Apply("", DepthDetail{Asks: [][]string{{"2", "1", "0", "1"}}, Bids: [][]string{{"1", "1", "0", "1"}}})
+	assert.Nil(t, err)
+
+	// books5 每次推送均为全量数据
+	err = book.Apply("", DepthDetail{Asks: [][]string{{"3", "1", "0", "1"}}, Bids: [][]string{{"2", "1", "0", "1"}}})
+	assert.Nil(t, err)
+	bids, asks := book.Len()
+	assert.Equal(t, 1, bids)
+	assert.Equal(t, 1, asks)
+}
+
+func TestOrderBookSeq(t *testing.T) {
+	asks := [][]string{{"101", "1", "0", "1"}}
+	bids := [][]string{{"100", "1", "0", "1"}}
+	seqDetail := func(asks, bids [][]string, prevSeqId, seqId int64) DepthDetail {
+		d := newDetail(asks, bids)
+		d.PrevSeqId = prevSeqId
+		d.SeqId = seqId
+		return d
+	}
+
+	book := NewOrderBook("books-l2-tbt", "BTC-USDT")
+	assert.Nil(t, book.ApplySnapshot(seqDetail(asks, bids, -1, 10)))
+	assert.Equal(t, int64(10), book.SeqId())
+
+	// 连续的增量数据
+	assert.Nil(t, book.ApplyUpdate(seqDetail(asks, bids, 10, 12)))
+	assert.Equal(t, int64(12), book.SeqId())
+
+	// 无变化的推送
+	assert.Nil(t, book.ApplyUpdate(seqDetail(nil, nil, 12, 12)))
+	assert.Equal(t, int64(12), book.SeqId())
+
+	// 维护后序号重置
+	assert.Nil(t, book.ApplyUpdate(seqDetail(asks, bids, 12, 3)))
+	assert.Equal(t, int64(3), book.SeqId())
+
+	// 序号不连续
+	err := book.ApplyUpdate(seqDetail(asks, bids, 5, 6))
+	gap, ok := err.(*SeqGapError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), gap.Expected)
+	assert.Equal(t, int64(5), gap.PrevSeqId)
+	assert.False(t, book.Ready())
+}
+
+/*
+	随机增量数据，与排序后的参照结果比较
+*/
+func TestOrderBookRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	book := NewOrderBook("books-l2-tbt", "BTC-USDT")
+	ref := map[float64]string{}
+
+	err := book.ApplySnapshot(newDetail(nil, nil))
+	assert.Nil(t, err)
+
+	for i := 0; i < 2000; i++ {
+		px := 1000 + rnd.Intn(500)
+		sz := "0"
+		if rnd.Intn(3) != 0 {
+			sz = strconv.Itoa(rnd.Intn(10) + 1)
+		}
+		pxStr := strconv.Itoa(px)
+		if sz == "0" {
+			delete(ref, float64(px))
+		} else {
+			ref[float64(px)] = sz
+		}
+
+		var exp [][]string
+		for k, v := range ref {
+			exp = append(exp, []string{strconv.Itoa(int(k)), v, "0", "1"})
+		}
+		sort.Slice(exp, func(i, j int) bool {
+			a, _ := strconv.Atoi(exp[i][0])
+			b, _ := strconv.Atoi(exp[j][0])
+			return a < b
+		})
+
+		_, cs := CalCrc32(exp, nil)
+		err = book.ApplyUpdate(DepthDetail{Asks: [][]string{{pxStr, sz, "0", "1"}}, Checksum: cs})
+		if !assert.Nil(t, err) {
+			return
+		}
+		if exp == nil {
+			exp = [][]string{}
+		}
+		assert.Equal(t, exp, book.Snapshot().Asks)
+	}
+}
+
+func BenchmarkOrderBookUpdate(b *testing.B) {
+	book := NewOrderBook("books5", "BTC-USDT")
+	var asks, bids [][]string
+	for i := 0; i < 400; i++ {
+		asks = append(asks, []string{strconv.Itoa(10000 + i), "1", "0", "1"})
+		bids = append(bids, []string{strconv.Itoa(9999 - i), "1", "0", "1"})
+	}
+	book.ApplySnapshot(DepthDetail{Asks: asks, Bids: bids})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		px := strconv.Itoa(10000 + i%400)
+		book.merge(DepthDetail{Asks: [][]string{{px, strconv.Itoa(i%5 + 1), "0", "1"}}})
+	}
+}
+
+func BenchmarkMergDepthData(b *testing.B) {
+	var asks, bids [][]string
+	for i := 0; i < 400; i++ {
+		asks = append(asks, []string{strconv.Itoa(10000 + i), "1", "0", "1"})
+		bids = append(bids, []string{strconv.Itoa(9999 - i), "1", "0", "1"})
+	}
+	snap := DepthDetail{Asks: asks, Bids: bids}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		px := strconv.Itoa(10000 + i%400)
+		mergeDepth(snap.Asks, [][]string{{px, strconv.Itoa(i%5 + 1), "0", "1"}}, "asks")
+	}
+}
@@ -0,0 +1,317 @@
+/*
+	私有频道推送数据
+	account / positions / orders / orders-algo / balance_and_position
+*/
+
+package wImpl
+
+// 订单状态
+const (
+	ORDER_STATE_LIVE             = "live"
+	ORDER_STATE_PARTIALLY_FILLED = "partially_filled"
+	ORDER_STATE_FILLED           = "filled"
+	ORDER_STATE_CANCELED         = "canceled"
+	ORDER_STATE_MMP_CANCELED     = "mmp_canceled"
+)
+
+// 策略委托订单状态
+const (
+	ALGO_STATE_LIVE                = "live"
+	ALGO_STATE_PAUSE               = "pause"
+	ALGO_STATE_PARTIALLY_EFFECTIVE = "partially_effective"
+	ALGO_STATE_EFFECTIVE           = "effective"
+	ALGO_STATE_CANCELED            = "canceled"
+	ALGO_STATE_ORDER_FAILED        = "order_failed"
+	ALGO_STATE_PARTIALLY_FAILED    = "partially_failed"
+)
+
+/*
+	账户频道
+*/
+type AccountData struct {
+	Arg  map[string]string `json:"arg"`
+	Data []AccountDetail   `json:"data"`
+}
+
+type AccountDetail struct {
+	UTime       string          `json:"uTime"`
+	TotalEq     string          `json:"totalEq"`
+	IsoEq       string          `json:"isoEq"`
+	AdjEq       string          `json:"adjEq"`
+	OrdFroz     string          `json:"ordFroz"`
+	Imr         string          `json:"imr"`
+	Mmr         string          `json:"mmr"`
+	BorrowFroz  string          `json:"borrowFroz"`
+	MgnRatio    string          `json:"mgnRatio"`
+	NotionalUsd string          `json:"notionalUsd"`
+	Upl         string          `json:"upl"`
+	Details     []AccountCcyBal `json:"details"`
+}
+
+// 币种维度的资产信息
+type AccountCcyBal struct {
+	Ccy           string `json:"ccy"`
+	Eq            string `json:"eq"`
+	CashBal       string `json:"cashBal"`
+	UTime         string `json:"uTime"`
+	IsoEq         string `json:"isoEq"`
+	AvailEq       string `json:"availEq"`
+	DisEq         string `json:"disEq"`
+	FixedBal      string `json:"fixedBal"`
+	AvailBal      string `json:"availBal"`
+	FrozenBal     string `json:"frozenBal"`
+	OrdFrozen     string `json:"ordFrozen"`
+	Liab          string `json:"liab"`
+	Upl           string `json:"upl"`
+	UplLiab       string `json:"uplLiab"`
+	CrossLiab     string `json:"crossLiab"`
+	IsoLiab       string `json:"isoLiab"`
+	MgnRatio      string `json:"mgnRatio"`
+	Imr           string `json:"imr"`
+	Mmr           string `json:"mmr"`
+	Interest      string `json:"interest"`
+	Twap          string `json:"twap"`
+	MaxLoan       string `json:"maxLoan"`
+	EqUsd         string `json:"eqUsd"`
+	BorrowFroz    string `json:"borrowFroz"`
+	NotionalLever string `json:"notionalLever"`
+	StgyEq        string `json:"stgyEq"`
+	IsoUpl        string `json:"isoUpl"`
+	SpotInUseAmt  string `json:"spotInUseAmt"`
+}
+
+/*
+	持仓频道
+*/
+type PositionData struct {
+	Arg  map[string]string `json:"arg"`
+	Data []PositionDetail  `json:"data"`
+}
+
+type PositionDetail struct {
+	InstType    string `json:"instType"`
+	MgnMode     string `json:"mgnMode"`
+	PosId       string `json:"posId"`
+	PosSide     string `json:"posSide"`
+	Pos         string `json:"pos"`
+	BaseBal     string `json:"baseBal"`
+	QuoteBal    string `json:"quoteBal"`
+	PosCcy      string `json:"posCcy"`
+	AvailPos    string `json:"availPos"`
+	AvgPx       string `json:"avgPx"`
+	Upl         string `json:"upl"`
+	UplRatio    string `json:"uplRatio"`
+	UplLastPx   string `json:"uplLastPx"`
+	InstId      string `json:"instId"`
+	Lever       string `json:"lever"`
+	LiqPx       string `json:"liqPx"`
+	MarkPx      string `json:"markPx"`
+	Imr         string `json:"imr"`
+	Margin      string `json:"margin"`
+	MgnRatio    string `json:"mgnRatio"`
+	Mmr         string `json:"mmr"`
+	Liab        string `json:"liab"`
+	LiabCcy     string `json:"liabCcy"`
+	Interest    string `json:"interest"`
+	TradeId     string `json:"tradeId"`
+	NotionalUsd string `json:"notionalUsd"`
+	OptVal      string `json:"optVal"`
+	Adl         string `json:"adl"`
+	BizRefId    string `json:"bizRefId"`
+	BizRefType  string `json:"bizRefType"`
+	Ccy         string `json:"ccy"`
+	Last        string `json:"last"`
+	IdxPx       string `json:"idxPx"`
+	UsdPx       string `json:"usdPx"`
+	BePx        string `json:"bePx"`
+	DeltaBS     string `json:"deltaBS"`
+	DeltaPA     string `json:"deltaPA"`
+	GammaBS     string `json:"gammaBS"`
+	GammaPA     string `json:"gammaPA"`
+	ThetaBS     string `json:"thetaBS"`
+	ThetaPA     string `json:"thetaPA"`
+	VegaBS      string `json:"vegaBS"`
+	VegaPA      string `json:"vegaPA"`
+	RealizedPnl string `json:"realizedPnl"`
+	Pnl         string `json:"pnl"`
+	Fee         string `json:"fee"`
+	FundingFee  string `json:"fundingFee"`
+	LiqPenalty  string `json:"liqPenalty"`
+	CTime       string `json:"cTime"`
+	UTime       string `json:"uTime"`
+	PTime       string `json:"pTime"`
+}
+
+/*
+	订单频道
+*/
+type OrderData struct {
+	Arg  map[string]string `json:"arg"`
+	Data []OrderUpdate     `json:"data"`
+}
+
+type OrderUpdate struct {
+	InstType        string `json:"instType"`
+	InstId          string `json:"instId"`
+	TgtCcy          string `json:"tgtCcy"`
+	Ccy             string `json:"ccy"`
+	OrdId           string `json:"ordId"`
+	ClOrdId         string `json:"clOrdId"`
+	Tag             string `json:"tag"`
+	Px              string `json:"px"`
+	Sz              string `json:"sz"`
+	NotionalUsd     string `json:"notionalUsd"`
+	OrdType         string `json:"ordType"`
+	Side            string `json:"side"`
+	PosSide         string `json:"posSide"`
+	TdMode          string `json:"tdMode"`
+	FillPx          string `json:"fillPx"`
+	TradeId         string `json:"tradeId"`
+	FillSz          string `json:"fillSz"`
+	FillPnl         string `json:"fillPnl"`
+	FillTime        string `json:"fillTime"`
+	FillFee         string `json:"fillFee"`
+	FillFeeCcy      string `json:"fillFeeCcy"`
+	FillNotionalUsd string `json:"fillNotionalUsd"`
+	ExecType        string `json:"execType"`
+	AccFillSz       string `json:"accFillSz"`
+	AvgPx           string `json:"avgPx"`
+	State           string `json:"state"`
+	Lever           string `json:"lever"`
+	TpTriggerPx     string `json:"tpTriggerPx"`
+	TpTriggerPxType string `json:"tpTriggerPxType"`
+	TpOrdPx         string `json:"tpOrdPx"`
+	SlTriggerPx     string `json:"slTriggerPx"`
+	SlTriggerPxType string `json:"slTriggerPxType"`
+	SlOrdPx         string `json:"slOrdPx"`
+	StpId           string `json:"stpId"`
+	StpMode         string `json:"stpMode"`
+	FeeCcy          string `json:"feeCcy"`
+	Fee             string `json:"fee"`
+	RebateCcy       string `json:"rebateCcy"`
+	Rebate          string `json:"rebate"`
+	Pnl             string `json:"pnl"`
+	Source          string `json:"source"`
+	CancelSource    string `json:"cancelSource"`
+	AmendSource     string `json:"amendSource"`
+	Category        string `json:"category"`
+	ReduceOnly      string `json:"reduceOnly"`
+	QuickMgnType    string `json:"quickMgnType"`
+	AlgoClOrdId     string `json:"algoClOrdId"`
+	AlgoId          string `json:"algoId"`
+	LastPx          string `json:"lastPx"`
+	ReqId           string `json:"reqId"`
+	AmendResult     string `json:"amendResult"`
+	Code            string `json:"code"`
+	Msg             string `json:"msg"`
+	UTime           string `json:"uTime"`
+	CTime           string `json:"cTime"`
+}
+
+/*
+	订单是否已经处于终态（完全成交或已撤销）
+*/
+func (this *OrderUpdate) IsFinal() bool {
+	switch this.State {
+	case ORDER_STATE_FILLED, ORDER_STATE_CANCELED, ORDER_STATE_MMP_CANCELED:
+		return true
+	}
+	return false
+}
+
+/*
+	本次推送是否包含成交信息
+*/
+func (this *OrderUpdate) IsFill() bool {
+	return this.TradeId != "" && this.FillSz != "" && this.FillSz != "0"
+}
+
+/*
+	策略委托订单频道
+*/
+type AlgoOrderData struct {
+	Arg  map[string]string `json:"arg"`
+	Data []AlgoOrderUpdate `json:"data"`
+}
+
+type AlgoOrderUpdate struct {
+	InstType        string `json:"instType"`
+	InstId          string `json:"instId"`
+	TgtCcy          string `json:"tgtCcy"`
+	Ccy             string `json:"ccy"`
+	OrdId           string `json:"ordId"`
+	AlgoId          string `json:"algoId"`
+	AlgoClOrdId     string `json:"algoClOrdId"`
+	ClOrdId         string `json:"clOrdId"`
+	Sz              string `json:"sz"`
+	OrdType         string `json:"ordType"`
+	Side            string `json:"side"`
+	PosSide         string `json:"posSide"`
+	TdMode          string `json:"tdMode"`
+	Lever           string `json:"lever"`
+	State           string `json:"state"`
+	TpTriggerPx     string `json:"tpTriggerPx"`
+	TpTriggerPxType string `json:"tpTriggerPxType"`
+	TpOrdPx         string `json:"tpOrdPx"`
+	SlTriggerPx     string `json:"slTriggerPx"`
+	SlTriggerPxType string `json:"slTriggerPxType"`
+	SlOrdPx         string `json:"slOrdPx"`
+	TriggerPx       string `json:"triggerPx"`
+	TriggerPxType   string `json:"triggerPxType"`
+	OrdPx           string `json:"ordPx"`
+	ActualSz        string `json:"actualSz"`
+	ActualPx        string `json:"actualPx"`
+	ActualSide      string `json:"actualSide"`
+	NotionalUsd     string `json:"notionalUsd"`
+	Tag             string `json:"tag"`
+	ReduceOnly      string `json:"reduceOnly"`
+	FailCode        string `json:"failCode"`
+	ReqId           string `json:"reqId"`
+	AmendResult     string `json:"amendResult"`
+	TriggerTime     string `json:"triggerTime"`
+	CTime           string `json:"cTime"`
+	UTime           string `json:"uTime"`
+}
+
+/*
+	账户余额和持仓频道
+*/
+type BalAndPosData struct {
+	Arg  map[string]string `json:"arg"`
+	Data []BalAndPosDetail `json:"data"`
+}
+
+type BalAndPosDetail struct {
+	PTime     string        `json:"pTime"`
+	EventType string        `json:"eventType"`
+	BalData   []BalDetail   `json:"balData"`
+	PosData   []PosDetail   `json:"posData"`
+	Trades    []BalPosTrade `json:"trades"`
+}
+
+type BalDetail struct {
+	Ccy     string `json:"ccy"`
+	CashBal string `json:"cashBal"`
+	UTime   string `json:"uTime"`
+}
+
+type PosDetail struct {
+	PosId    string `json:"posId"`
+	TradeId  string `json:"tradeId"`
+	InstId   string `json:"instId"`
+	InstType string `json:"instType"`
+	MgnMode  string `json:"mgnMode"`
+	PosSide  string `json:"posSide"`
+	Pos      string `json:"pos"`
+	Ccy      string `json:"ccy"`
+	PosCcy   string `json:"posCcy"`
+	AvgPx    string `json:"avgPx"`
+	BaseBal  string `json:"baseBal"`
+	QuoteBal string `json:"quoteBal"`
+	UTime    string `json:"uTime"`
+}
+
+type BalPosTrade struct {
+	InstId  string `json:"instId"`
+	TradeId string `json:"tradeId"`
+}
@@ -0,0 +1,43 @@
+package wImpl
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderData(t *testing.T) {
+	raw := `{"arg":{"channel":"orders","instType":"SPOT","instId":"BTC-USDT","uid":"614488474791936"},"data":[{"accFillSz":"0.001","amendResult":"","avgPx":"31527.1","cTime":"1654084334977","category":"normal","ccy":"","clOrdId":"b1","code":"0","execType":"M","fee":"-0.02522168","feeCcy":"USDT","fillFee":"-0.02522168","fillFeeCcy":"USDT","fillNotionalUsd":"31.50818374","fillPx":"31527.1","fillSz":"0.001","fillTime":"1654084353263","instId":"BTC-USDT","instType":"SPOT","lever":"0","msg":"","notionalUsd":"31.50818374","ordId":"452197707845865472","ordType":"limit","pnl":"0","posSide":"","px":"31527.1","rebate":"0","rebateCcy":"BTC","reduceOnly":"false","reqId":"","side":"sell","source":"","state":"filled","sz":"0.001","tag":"","tdMode":"cash","tgtCcy":"","tradeId":"242589207","uTime":"1654084353264"}]}`
+
+	var push OrderData
+	err := json.Unmarshal([]byte(raw), &push)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(push.Data))
+
+	order := push.Data[0]
+	assert.Equal(t, "452197707845865472", order.OrdId)
+	assert.Equal(t, "b1", order.ClOrdId)
+	assert.Equal(t, "-0.02522168", order.FillFee)
+	assert.True(t, order.IsFill())
+	assert.True(t, order.IsFinal())
+
+	// 缺失的字段不会导致异常
+	var live OrderData
+	err = json.Unmarshal([]byte(`{"arg":{"channel":"orders"},"data":[{"state":"live"}]}`), &live)
+	assert.Nil(t, err)
+	assert.Equal(t, "", live.Data[0].FillSz)
+	assert.False(t, live.Data[0].IsFill())
+	assert.False(t, live.Data[0].IsFinal())
+}
+
+func TestBalAndPosData(t *testing.T) {
+	raw := `{"arg":{"channel":"balance_and_position","uid":"77982378738415879"},"data":[{"pTime":"1597026383085","eventType":"snapshot","balData":[{"ccy":"BTC","cashBal":"1","uTime":"1597026383085"}],"posData":[{"posId":"1111111111","tradeId":"2","instId":"BTC-USD-191018","instType":"FUTURES","mgnMode":"cross","posSide":"long","pos":"10","ccy":"BTC","posCcy":"","avgPx":"3320","uTime":"1597026383085"}]}]}`
+
+	var push BalAndPosData
+	err := json.Unmarshal([]byte(raw), &push)
+	assert.Nil(t, err)
+	assert.Equal(t, "snapshot", push.Data[0].EventType)
+	assert.Equal(t, "1", push.Data[0].BalData[0].CashBal)
+	assert.Equal(t, "3320", push.Data[0].PosData[0].AvgPx)
+}
@@ -0,0 +1,51 @@
+/*
+	公共频道推送数据
+	tickers / trades
+*/
+
+package wImpl
+
+/*
+	行情频道
+*/
+type TickerData struct {
+	Arg  map[string]string `json:"arg"`
+	Data []TickerDetail    `json:"data"`
+}
+
+type TickerDetail struct {
+	InstType  string `json:"instType"`
+	InstId    string `json:"instId"`
+	Last      string `json:"last"`
+	LastSz    string `json:"lastSz"`
+	AskPx     string `json:"askPx"`
+	AskSz     string `json:"askSz"`
+	BidPx     string `json:"bidPx"`
+	BidSz     string `json:"bidSz"`
+	Open24h   string `json:"open24h"`
+	High24h   string `json:"high24h"`
+	Low24h    string `json:"low24h"`
+	VolCcy24h string `json:"volCcy24h"`
+	Vol24h    string `json:"vol24h"`
+	SodUtc0   string `json:"sodUtc0"`
+	SodUtc8   string `json:"sodUtc8"`
+	Ts        string `json:"ts"`
+}
+
+/*
+	交易频道
+*/
+type TradeData struct {
+	Arg  map[string]string `json:"arg"`
+	Data []TradeDetail     `json:"data"`
+}
+
+type TradeDetail struct {
+	InstId  string `json:"instId"`
+	TradeId string `json:"tradeId"`
+	Px      string `json:"px"`
+	Sz      string `json:"sz"`
+	Side    string `json:"side"`
+	Count   string `json:"count"`
+	Ts      string `json:"ts"`
+}
@@ -63,70 +63,125 @@ const (
 	//订阅返回数据
 	EVENT_BOOKED_DATA
 	EVENT_DEPTH_DATA
+
+	//业务频道
+	EVENT_BOOK_TRADES_ALL
+	EVENT_BOOK_ALGO_ADVANCE
+	EVENT_BOOK_GRID_ORDERS_SPOT
+	EVENT_BOOK_GRID_ORDERS_CONTRACT
+	EVENT_BOOK_GRID_POSITIONS
+	EVENT_BOOK_GRID_SUB_ORDERS
+	EVENT_BOOK_DEPOSIT_INFO
+	EVENT_BOOK_WITHDRAWAL_INFO
+
+	// JRPC 批量撤销
+	EVENT_MASS_CANCEL
+)
+
+// 服务端连接地址类型
+type Endpoint int
+
+const (
+	ENDPOINT_NONE Endpoint = iota
+	// 公共频道 /ws/v5/public
+	ENDPOINT_PUBLIC
+	// 私有频道 /ws/v5/private
+	ENDPOINT_PRIVATE
+	// 业务频道 /ws/v5/business
+	ENDPOINT_BUSINESS
 )
 
+func (e Endpoint) String() string {
+	switch e {
+	case ENDPOINT_PUBLIC:
+		return "public"
+	case ENDPOINT_PRIVATE:
+		return "private"
+	case ENDPOINT_BUSINESS:
+		return "business"
+	}
+	return ""
+}
+
 /*
-	EventID，事件名称，channel
+	EventID，事件名称，channel，连接地址，是否需要登录
 	注： 带有周期参数的频道 如 行情频道 ，需要将channel写为 正则表达模式方便 类型匹配，如 "^candle*"
 */
 var EVENT_TABLE = [][]interface{}{
 	// 未知的消息
-	{EVENT_UNKNOWN, "未知", ""},
+	{EVENT_UNKNOWN, "未知", "", ENDPOINT_NONE, false},
 	// 错误的消息
-	{EVENT_ERROR, "错误", ""},
+	{EVENT_ERROR, "错误", "", ENDPOINT_NONE, false},
 	// Ping
-	{EVENT_PING, "ping", ""},
+	{EVENT_PING, "ping", "", ENDPOINT_NONE, false},
 	// 登陆
-	{EVENT_LOGIN, "登录", ""},
+	{EVENT_LOGIN, "登录", "", ENDPOINT_NONE, false},
 
 	/*
 		订阅公共频道
 	*/
 
-	{EVENT_BOOK_INSTRUMENTS, "产品", "instruments"},
-	{EVENT_STATUS, "status", "status"},
-	{EVENT_BOOK_TICKERS, "行情", "tickers"},
-	{EVENT_BOOK_OPEN_INTEREST, "持仓总量", "open-interest"},
-	{EVENT_BOOK_KLINE, "K线", "candle"},
-	{EVENT_BOOK_TRADE, "交易", "trades"},
-	{EVENT_BOOK_ESTIMATE_PRICE, "预估交割/行权价格", "estimated-price"},
-	{EVENT_BOOK_MARK_PRICE, "标记价格", "mark-price"},
-	{EVENT_BOOK_MARK_PRICE_CANDLE_CHART, "标记价格K线", "mark-price-candle"},
-	{EVENT_BOOK_LIMIT_PRICE, "限价", "price-limit"},
-	{EVENT_BOOK_ORDER_BOOK, "400档深度", "books"},
-	{EVENT_BOOK_ORDER_BOOK5, "5档深度", "books5"},
-	{EVENT_BOOK_ORDER_BOOK_TBT, "tbt深度", "books-l2-tbt"},
-	{EVENT_BOOK_ORDER_BOOK50_TBT, "tbt50深度", "books50-l2-tbt"},
-	{EVENT_BOOK_OPTION_SUMMARY, "期权定价", "opt-summary"},
-	{EVENT_BOOK_FUND_RATE, "资金费率", "funding-rate"},
-	{EVENT_BOOK_KLINE_INDEX, "指数K线", "index-candle"},
-	{EVENT_BOOK_INDEX_TICKERS, "指数行情", "index-tickers"},
+	{EVENT_BOOK_INSTRUMENTS, "产品", "instruments", ENDPOINT_PUBLIC, false},
+	{EVENT_STATUS, "status", "status", ENDPOINT_PUBLIC, false},
+	{EVENT_BOOK_TICKERS, "行情", "tickers", ENDPOINT_PUBLIC, false},
+	{EVENT_BOOK_OPEN_INTEREST, "持仓总量", "open-interest", ENDPOINT_PUBLIC, false},
+	{EVENT_BOOK_KLINE, "K线", "candle", ENDPOINT_BUSINESS, false},
+	{EVENT_BOOK_TRADE, "交易", "trades", ENDPOINT_PUBLIC, false},
+	{EVENT_BOOK_ESTIMATE_PRICE, "预估交割/行权价格", "estimated-price", ENDPOINT_PUBLIC, false},
+	{EVENT_BOOK_MARK_PRICE, "标记价格", "mark-price", ENDPOINT_PUBLIC, false},
+	{EVENT_BOOK_MARK_PRICE_CANDLE_CHART, "标记价格K线", "mark-price-candle", ENDPOINT_BUSINESS, false},
+	{EVENT_BOOK_LIMIT_PRICE, "限价", "price-limit", ENDPOINT_PUBLIC, false},
+	{EVENT_BOOK_ORDER_BOOK, "400档深度", "books", ENDPOINT_PUBLIC, false},
+	{EVENT_BOOK_ORDER_BOOK5, "5档深度", "books5", ENDPOINT_PUBLIC, false},
+	{EVENT_BOOK_ORDER_BOOK_TBT, "tbt深度", "books-l2-tbt", ENDPOINT_PUBLIC, false},
+	{EVENT_BOOK_ORDER_BOOK50_TBT, "tbt50深度", "books50-l2-tbt", ENDPOINT_PUBLIC, false},
+	{EVENT_BOOK_OPTION_SUMMARY, "期权定价", "opt-summary", ENDPOINT_PUBLIC, false},
+	{EVENT_BOOK_FUND_RATE, "资金费率", "funding-rate", ENDPOINT_PUBLIC, false},
+	{EVENT_BOOK_KLINE_INDEX, "指数K线", "index-candle", ENDPOINT_BUSINESS, false},
+	{EVENT_BOOK_INDEX_TICKERS, "指数行情", "index-tickers", ENDPOINT_PUBLIC, false},
 
 	/*
 		订阅私有频道
 	*/
-	{EVENT_BOOK_ACCOUNT, "账户", "account"},
-	{EVENT_BOOK_POSTION, "持仓", "positions"},
-	{EVENT_BOOK_ORDER, "订单", "orders"},
-	{EVENT_BOOK_ALG_ORDER, "策略委托订单", "orders-algo"},
-	{EVENT_BOOK_B_AND_P, "账户余额和持仓", "balance_and_position"},
+	{EVENT_BOOK_ACCOUNT, "账户", "account", ENDPOINT_PRIVATE, true},
+	{EVENT_BOOK_POSTION, "持仓", "positions", ENDPOINT_PRIVATE, true},
+	{EVENT_BOOK_ORDER, "订单", "orders", ENDPOINT_PRIVATE, true},
+	{EVENT_BOOK_ALG_ORDER, "策略委托订单", "orders-algo", ENDPOINT_BUSINESS, true},
+	{EVENT_BOOK_B_AND_P, "账户余额和持仓", "balance_and_position", ENDPOINT_PRIVATE, true},
 
 	/*
 		JRPC
 	*/
-	{EVENT_PLACE_ORDER, "下单", "order"},
-	{EVENT_PLACE_BATCH_ORDERS, "批量下单", "batch-orders"},
-	{EVENT_CANCEL_ORDER, "撤单", "cancel-order"},
-	{EVENT_CANCEL_BATCH_ORDERS, "批量撤单", "batch-cancel-orders"},
-	{EVENT_AMEND_ORDER, "改单", "amend-order"},
-	{EVENT_AMEND_BATCH_ORDERS, "批量改单", "batch-amend-orders"},
+	{EVENT_PLACE_ORDER, "下单", "order", ENDPOINT_PRIVATE, true},
+	{EVENT_PLACE_BATCH_ORDERS, "批量下单", "batch-orders", ENDPOINT_PRIVATE, true},
+	{EVENT_CANCEL_ORDER, "撤单", "cancel-order", ENDPOINT_PRIVATE, true},
+	{EVENT_CANCEL_BATCH_ORDERS, "批量撤单", "batch-cancel-orders", ENDPOINT_PRIVATE, true},
+	{EVENT_AMEND_ORDER, "改单", "amend-order", ENDPOINT_PRIVATE, true},
+	{EVENT_AMEND_BATCH_ORDERS, "批量改单", "batch-amend-orders", ENDPOINT_PRIVATE, true},
 
 	/*
 		订阅返回数据
 		注意：推送数据channle统一为""
 	*/
-	{EVENT_BOOKED_DATA, "普通推送", ""},
-	{EVENT_DEPTH_DATA, "深度推送", ""},
+	{EVENT_BOOKED_DATA, "普通推送", "", ENDPOINT_NONE, false},
+	{EVENT_DEPTH_DATA, "深度推送", "", ENDPOINT_NONE, false},
+
+	/*
+		业务频道
+	*/
+	{EVENT_BOOK_TRADES_ALL, "全部交易", "trades-all", ENDPOINT_BUSINESS, false},
+	{EVENT_BOOK_ALGO_ADVANCE, "高级策略委托订单", "algo-advance", ENDPOINT_BUSINESS, true},
+	{EVENT_BOOK_GRID_ORDERS_SPOT, "现货网格策略", "grid-orders-spot", ENDPOINT_BUSINESS, true},
+	{EVENT_BOOK_GRID_ORDERS_CONTRACT, "合约网格策略", "grid-orders-contract", ENDPOINT_BUSINESS, true},
+	{EVENT_BOOK_GRID_POSITIONS, "网格策略持仓", "grid-positions", ENDPOINT_BUSINESS, true},
+	{EVENT_BOOK_GRID_SUB_ORDERS, "网格策略子订单", "grid-sub-orders", ENDPOINT_BUSINESS, true},
+	{EVENT_BOOK_DEPOSIT_INFO, "充值信息", "deposit-info", ENDPOINT_BUSINESS, true},
+	{EVENT_BOOK_WITHDRAWAL_INFO, "提币信息", "withdrawal-info", ENDPOINT_BUSINESS, true},
+
+	/*
+		JRPC 批量撤销
+	*/
+	{EVENT_MASS_CANCEL, "批量撤销", "mass-cancel", ENDPOINT_PRIVATE, true},
 }
 
 /*
@@ -143,6 +198,30 @@ func (e Event) String() string {
 	return ""
 }
 
+/*
+	获取事件对应频道所在的连接地址类型
+*/
+func (e Event) Endpoint() Endpoint {
+	for _, v := range EVENT_TABLE {
+		if e == v[0].(Event) {
+			return v[3].(Endpoint)
+		}
+	}
+	return ENDPOINT_NONE
+}
+
+/*
+	事件对应的频道是否需要登录
+*/
+func (e Event) NeedLogin() bool {
+	for _, v := range EVENT_TABLE {
+		if e == v[0].(Event) {
+			return v[4].(bool)
+		}
+	}
+	return false
+}
+
 /*
 	通过事件获取对应的channel信息
 	对于频道名称有时间周期的 通过参数 pd 传入，拼接后返回完整channel信息
@@ -166,33 +245,40 @@ func (e Event) GetChannel(pd Period) string {
 	return channel + string(pd)
 }
 
-/*
-	通过channel信息匹配获取事件类型
-*/
-func GetEventId(raw string) Event {
-	evt := EVENT_UNKNOWN
-
+// channel 到事件的映射，由 EVENT_TABLE 生成
+var channelEvents = func() map[string]Event {
+	m := make(map[string]Event, len(EVENT_TABLE))
 	for _, v := range EVENT_TABLE {
 		channel := v[2].(string)
-		if raw == channel {
-			evt = v[0].(Event)
-			break
+		if channel == "" {
+			continue
+		}
+		if _, ok := m[channel]; !ok {
+			m[channel] = v[0].(Event)
 		}
+	}
+	return m
+}()
+
+// 带有周期参数的频道，如 candle1m / mark-price-candle1D
+var periodChannelReg = regexp.MustCompile(`^(.*)([1-9][0-9]?[\w])$`)
 
-		regexp := regexp.MustCompile(`^(.*)([1-9][0-9]?[\w])$`)
-		//regexp := regexp.MustCompile(`^http://www.flysnow.org/([\d]{4})/([\d]{2})/([\d]{2})/([\w-]+).html$`)
+/*
+	通过channel信息匹配获取事件类型
+*/
+func GetEventId(raw string) Event {
+	if evt, ok := channelEvents[raw]; ok {
+		return evt
+	}
 
-		substr := regexp.FindStringSubmatch(raw)
-		//fmt.Println(substr)
-		if len(substr) >= 2 {
-			if substr[1] == channel {
-				evt = v[0].(Event)
-				break
-			}
+	substr := periodChannelReg.FindStringSubmatch(raw)
+	if len(substr) >= 2 {
+		if evt, ok := channelEvents[substr[1]]; ok {
+			return evt
 		}
 	}
 
-	return evt
+	return EVENT_UNKNOWN
 }
 
 // 时间维度
@@ -0,0 +1,85 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"time"
+	"v5sdk_go/trade"
+	. "v5sdk_go/utils"
+	. "v5sdk_go/ws/wImpl"
+)
+
+/*
+	设置分批下单/撤单/改单的限速，默认每2秒300个订单
+*/
+func (a *WsClient) SetOrderRateLimit(n int, per time.Duration) error {
+	l, err := NewRateLimiter(n, per)
+	if err != nil {
+		return err
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.orderLimiter = l
+	return nil
+}
+
+/*
+	分批发送交易请求，每批最多 trade.BATCH_MAX 个订单
+*/
+func (a *WsClient) chunkedReq(ctx context.Context, evtId Event, op string, orders []trade.Order, opts trade.BatchOptions) (res trade.BatchResult, err error) {
+	keys, err := trade.BatchKeys(orders)
+	if err != nil {
+		return
+	}
+	if opts.Limiter == nil {
+		a.lock.RLock()
+		opts.Limiter = a.orderLimiter
+		a.lock.RUnlock()
+	}
+
+	res = trade.RunBatches(ctx, keys, opts, func(ctx context.Context, lo, hi int) ([]trade.OrderResult, error) {
+		_, detail, err := a.orderReqCtx(ctx, evtId, op, "", orders[lo:hi])
+		// 部分订单失败时仍有各订单的结果
+		if detail != nil && len(detail.Orders) == hi-lo {
+			return detail.Orders, nil
+		}
+		if err == nil {
+			err = errors.New("未得到各订单的处理结果")
+		}
+		return nil, err
+	})
+	return
+}
+
+/*
+	分批下单，订单数量不限，按 trade.BATCH_MAX 拆分后限速并行发送
+	未指定 clOrdId 的订单自动生成
+	参数说明：
+		opts: 并行数及限速器，零值使用默认配置
+		orders: 下单参数
+	返回按 clOrdId 合并的各订单结果，参数有误时不发送任何请求
+	例如:
+	res, err := cli.PlaceOrdersChunkedCtx(ctx, trade.BatchOptions{}, orders...)
+	for _, k := range res.Failed() {
+		fmt.Println(k, res[k].SCode, res[k].SMsg, res[k].Err)
+	}
+*/
+func (a *WsClient) PlaceOrdersChunkedCtx(ctx context.Context, opts trade.BatchOptions, orders ...trade.PlaceOrderReq) (res trade.BatchResult, err error) {
+	return a.chunkedReq(ctx, EVENT_PLACE_BATCH_ORDERS, trade.OP_BATCH_ORDERS, trade.PlaceOrders(trade.FillClOrdIds(orders)), opts)
+}
+
+/*
+	分批撤单，订单数量不限
+	返回的结果以 clOrdId 为键，未指定时以 ordId 为键
+*/
+func (a *WsClient) CancelOrdersChunkedCtx(ctx context.Context, opts trade.BatchOptions, orders ...trade.CancelOrderReq) (res trade.BatchResult, err error) {
+	return a.chunkedReq(ctx, EVENT_CANCEL_BATCH_ORDERS, trade.OP_BATCH_CANCEL_ORDERS, trade.CancelOrders(orders), opts)
+}
+
+/*
+	分批改单，订单数量不限
+	返回的结果以 clOrdId 为键，未指定时以 ordId 为键
+*/
+func (a *WsClient) AmendOrdersChunkedCtx(ctx context.Context, opts trade.BatchOptions, orders ...trade.AmendOrderReq) (res trade.BatchResult, err error) {
+	return a.chunkedReq(ctx, EVENT_AMEND_BATCH_ORDERS, trade.OP_BATCH_AMEND_ORDERS, trade.AmendOrders(orders), opts)
+}
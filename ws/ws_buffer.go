@@ -0,0 +1,372 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	. "v5sdk_go/ws/wImpl"
+)
+
+// 缓冲区满时的处理策略
+type OverflowPolicy int
+
+const (
+	// 阻塞等待(默认)，保证数据不丢失，但处理过慢时会阻塞消息接收
+	OVERFLOW_BLOCK OverflowPolicy = iota
+	// 丢弃缓冲区中最旧的消息
+	OVERFLOW_DROP_OLDEST
+	// 丢弃新收到的消息
+	OVERFLOW_DROP_NEWEST
+	// 只保留最新的一条消息，适用于 tickers、books5 等全量推送的频道
+	OVERFLOW_CONFLATE
+)
+
+// 默认缓冲区大小
+const DEFAULT_BUFFER_SIZE = 1024
+
+/*
+	缓冲策略
+	Size: 缓冲区大小
+	Overflow: 缓冲区满时的处理策略
+*/
+type BufferPolicy struct {
+	Size     int
+	Overflow OverflowPolicy
+}
+
+/*
+	缓冲区统计信息
+	Key: 订阅标识，如 channel:books,instId:BTC-USDT
+	Received: 收到的消息数
+	Dropped: 丢弃的消息数
+	Conflated: 被最新消息覆盖的消息数
+*/
+type BufferStats struct {
+	Key       string
+	Size      int
+	Pending   int
+	Received  uint64
+	Dropped   uint64
+	Conflated uint64
+}
+
+/*
+	推送消息队列，每个订阅一个队列，由独立的goroutine按顺序处理
+*/
+type pushQueue struct {
+	// 计数器放在结构体开头，保证原子操作的64位对齐
+	received  uint64
+	dropped   uint64
+	conflated uint64
+
+	key    string
+	policy BufferPolicy
+	items  chan *Msg
+	quit   <-chan struct{}
+	// 取消订阅后关闭，结束处理goroutine
+	stop chan struct{}
+	// 未处理完的消息，用于等待队列处理完毕
+	inflight sync.WaitGroup
+}
+
+func newPushQueue(key string, policy BufferPolicy, quit <-chan struct{}, handle func(*Msg)) *pushQueue {
+	size := policy.Size
+	switch policy.Overflow {
+	case OVERFLOW_CONFLATE:
+		size = 1
+	case OVERFLOW_DROP_OLDEST, OVERFLOW_DROP_NEWEST:
+		if size < 1 {
+			size = 1
+		}
+	}
+	if size < 0 {
+		size = 0
+	}
+
+	q := &pushQueue{
+		key:    key,
+		policy: policy,
+		items:  make(chan *Msg, size),
+		quit:   quit,
+		stop:   make(chan struct{}),
+	}
+
+	go func() {
+		for {
+			select {
+			case <-q.quit:
+				return
+			case <-q.stop:
+				// 丢弃未处理的消息，避免等待队列处理完毕的调用阻塞
+				for {
+					select {
+					case <-q.items:
+						q.inflight.Done()
+					default:
+						return
+					}
+				}
+			case msg := <-q.items:
+				handle(msg)
+				q.inflight.Done()
+			}
+		}
+	}()
+	return q
+}
+
+/*
+	写入队列，只允许单个写入方(消息接收goroutine)调用
+*/
+func (q *pushQueue) put(msg *Msg) {
+	atomic.AddUint64(&q.received, 1)
+	select {
+	case <-q.stop:
+		atomic.AddUint64(&q.dropped, 1)
+		return
+	default:
+	}
+	q.inflight.Add(1)
+
+	switch q.policy.Overflow {
+	case OVERFLOW_DROP_NEWEST:
+		select {
+		case q.items <- msg:
+		default:
+			atomic.AddUint64(&q.dropped, 1)
+			q.inflight.Done()
+		}
+	case OVERFLOW_DROP_OLDEST, OVERFLOW_CONFLATE:
+		for {
+			select {
+			case q.items <- msg:
+				return
+			default:
+			}
+
+			select {
+			case <-q.items:
+				q.inflight.Done()
+				if q.policy.Overflow == OVERFLOW_CONFLATE {
+					atomic.AddUint64(&q.conflated, 1)
+				} else {
+					atomic.AddUint64(&q.dropped, 1)
+				}
+			default:
+			}
+		}
+	default:
+		select {
+		case q.items <- msg:
+		case <-q.quit:
+			q.inflight.Done()
+		case <-q.stop:
+			q.inflight.Done()
+		}
+	}
+}
+
+/*
+	等待已写入的消息处理完毕，调用期间不能再写入
+*/
+func (q *pushQueue) wait() {
+	q.inflight.Wait()
+}
+
+func (q *pushQueue) stats() BufferStats {
+	return BufferStats{
+		Key:       q.key,
+		Size:      cap(q.items),
+		Pending:   len(q.items),
+		Received:  atomic.LoadUint64(&q.received),
+		Dropped:   atomic.LoadUint64(&q.dropped),
+		Conflated: atomic.LoadUint64(&q.conflated),
+	}
+}
+
+/*
+	根据推送数据的arg生成订阅标识
+*/
+func subKey(arg map[string]string) string {
+	keys := make([]string, 0, len(arg))
+	for k := range arg {
+		// uid 不参与区分订阅
+		if k == "channel" || k == "uid" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString("channel:")
+	sb.WriteString(arg["channel"])
+	for _, k := range keys {
+		sb.WriteString(",")
+		sb.WriteString(k)
+		sb.WriteString(":")
+		sb.WriteString(arg[k])
+	}
+	return sb.String()
+}
+
+/*
+	设置订阅推送数据的缓冲策略，规则的匹配方式与 RoutePattern 一致
+	只对设置之后新建的订阅队列生效
+	例如:
+	cli.SetBufferPolicy(RoutePattern{Channel: "tickers"}, BufferPolicy{Overflow: OVERFLOW_CONFLATE})
+*/
+func (a *WsClient) SetBufferPolicy(p RoutePattern, policy BufferPolicy) error {
+	if p.Channel == "" {
+		return errors.New("channel不可为空")
+	}
+
+	// 增量深度数据不能只保留最新一条
+	if policy.Overflow == OVERFLOW_CONFLATE {
+		switch p.Channel {
+		case "books", "books-l2-tbt", "books50-l2-tbt":
+			return errors.New("增量深度频道不支持 OVERFLOW_CONFLATE")
+		}
+	}
+
+	a.queueLock.Lock()
+	defer a.queueLock.Unlock()
+	a.bufPolicies[p.key()] = policy
+	return nil
+}
+
+/*
+	设置默认的缓冲策略，未单独设置的订阅使用该策略
+*/
+func (a *WsClient) SetDefaultBufferPolicy(policy BufferPolicy) error {
+	if policy.Overflow == OVERFLOW_CONFLATE {
+		return errors.New("默认缓冲策略不支持 OVERFLOW_CONFLATE")
+	}
+
+	a.queueLock.Lock()
+	defer a.queueLock.Unlock()
+	a.defaultPolicy = policy
+	return nil
+}
+
+/*
+	设置全局消息回调(AddMessageHook)的缓冲策略，需在 Start 之前调用
+*/
+func (a *WsClient) SetMessageBufferPolicy(policy BufferPolicy) error {
+	if policy.Overflow == OVERFLOW_CONFLATE {
+		return errors.New("全局消息回调不支持 OVERFLOW_CONFLATE")
+	}
+
+	a.queueLock.Lock()
+	defer a.queueLock.Unlock()
+	a.msgPolicy = policy
+	return nil
+}
+
+/*
+	获取各订阅队列的统计信息
+*/
+func (a *WsClient) GetBufferStats() map[string]BufferStats {
+	a.queueLock.Lock()
+	defer a.queueLock.Unlock()
+
+	res := make(map[string]BufferStats, len(a.queues)+1)
+	for k, q := range a.queues {
+		res[k] = q.stats()
+	}
+	if a.msgQueue != nil {
+		res[a.msgQueue.key] = a.msgQueue.stats()
+	}
+	return res
+}
+
+func (a *WsClient) lookupPolicy(arg map[string]string) BufferPolicy {
+	channel := arg["channel"]
+	keys := []string{}
+	if instId := arg["instId"]; instId != "" {
+		keys = append(keys, routeKey(channel, "instId", instId))
+	}
+	if instType := arg["instType"]; instType != "" {
+		keys = append(keys, routeKey(channel, "instType", instType))
+	}
+	keys = append(keys, channel)
+
+	for _, k := range keys {
+		if p, ok := a.bufPolicies[k]; ok {
+			return p
+		}
+	}
+	return a.defaultPolicy
+}
+
+/*
+	等待所有队列中的消息处理完毕，ctx 结束或连接关闭时提前返回
+*/
+func (a *WsClient) drainQueues(ctx context.Context) error {
+	quit := a.IsQuit()
+	a.queueLock.Lock()
+	qs := make([]*pushQueue, 0, len(a.queues)+1)
+	for _, q := range a.queues {
+		qs = append(qs, q)
+	}
+	mq := a.msgQueue
+	a.queueLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// 推送消息先处理完，再处理全局消息
+		for _, q := range qs {
+			q.wait()
+		}
+		if mq != nil {
+			mq.wait()
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-quit:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+/*
+	将推送数据写入对应订阅的队列，队列不存在时自动创建
+*/
+func (a *WsClient) enqueuePush(quit <-chan struct{}, evt Event, msg *Msg) {
+	arg := msgArg(msg)
+	key := subKey(arg)
+
+	a.queueLock.Lock()
+	q, ok := a.queues[key]
+	if !ok {
+		q = newPushQueue(key, a.lookupPolicy(arg), quit, func(m *Msg) {
+			a.handlePush(evt, m)
+		})
+		a.queues[key] = q
+	}
+	a.queueLock.Unlock()
+
+	q.put(msg)
+}
+
+/*
+	取消订阅后移除对应的队列，结束其处理goroutine
+*/
+func (a *WsClient) removeQueues(args []map[string]string) {
+	a.queueLock.Lock()
+	defer a.queueLock.Unlock()
+	for _, arg := range args {
+		key := subKey(arg)
+		if q, ok := a.queues[key]; ok {
+			close(q.stop)
+			delete(a.queues, key)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package ws
+
+import (
+	"testing"
+	"time"
+	. "v5sdk_go/ws/wImpl"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+	构造一个处理被阻塞的队列
+	taken: 消费goroutine取出消息后、阻塞前通知
+	release: 放行函数
+*/
+func blockedQueue(policy BufferPolicy) (q *pushQueue, taken, handled chan *Msg, release func()) {
+	quit := make(chan struct{})
+	gate := make(chan struct{})
+	taken = make(chan *Msg, 100)
+	handled = make(chan *Msg, 100)
+	q = newPushQueue("test", policy, quit, func(m *Msg) {
+		taken <- m
+		<-gate
+		handled <- m
+	})
+	release = func() { close(gate) }
+	return
+}
+
+func TestPushQueueDropNewest(t *testing.T) {
+	q, taken, handled, release := blockedQueue(BufferPolicy{Size: 2, Overflow: OVERFLOW_DROP_NEWEST})
+
+	// 第一条被消费goroutine取走并阻塞，后两条进入缓冲区，其余丢弃
+	q.put(&Msg{Info: 1})
+	assert.Equal(t, 1, (<-taken).Info)
+	for i := 2; i <= 5; i++ {
+		q.put(&Msg{Info: i})
+	}
+	release()
+
+	var got []interface{}
+	for i := 0; i < 3; i++ {
+		got = append(got, (<-handled).Info)
+	}
+	assert.Equal(t, []interface{}{1, 2, 3}, got)
+
+	st := q.stats()
+	assert.Equal(t, uint64(5), st.Received)
+	assert.Equal(t, uint64(2), st.Dropped)
+}
+
+func TestPushQueueDropOldest(t *testing.T) {
+	q, taken, handled, release := blockedQueue(BufferPolicy{Size: 2, Overflow: OVERFLOW_DROP_OLDEST})
+
+	q.put(&Msg{Info: 1})
+	assert.Equal(t, 1, (<-taken).Info)
+	for i := 2; i <= 5; i++ {
+		q.put(&Msg{Info: i})
+	}
+	release()
+
+	var got []interface{}
+	for i := 0; i < 3; i++ {
+		got = append(got, (<-handled).Info)
+	}
+	assert.Equal(t, []interface{}{1, 4, 5}, got)
+	assert.Equal(t, uint64(2), q.stats().Dropped)
+}
+
+func TestPushQueueConflate(t *testing.T) {
+	q, taken, handled, release := blockedQueue(BufferPolicy{Size: 100, Overflow: OVERFLOW_CONFLATE})
+
+	q.put(&Msg{Info: 1})
+	assert.Equal(t, 1, (<-taken).Info)
+	for i := 2; i <= 5; i++ {
+		q.put(&Msg{Info: i})
+	}
+	release()
+
+	assert.Equal(t, 1, (<-handled).Info)
+	assert.Equal(t, 5, (<-handled).Info)
+
+	st := q.stats()
+	assert.Equal(t, 1, st.Size)
+	assert.Equal(t, uint64(3), st.Conflated)
+	assert.Equal(t, uint64(0), st.Dropped)
+}
+
+func TestBufferPolicy(t *testing.T) {
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+
+	assert.NotNil(t, r.SetBufferPolicy(RoutePattern{Channel: "books"}, BufferPolicy{Overflow: OVERFLOW_CONFLATE}))
+	assert.Nil(t, r.SetBufferPolicy(RoutePattern{Channel: "books5"}, BufferPolicy{Overflow: OVERFLOW_CONFLATE}))
+	assert.Nil(t, r.SetBufferPolicy(RoutePattern{Channel: "tickers", InstId: "BTC-USDT"}, BufferPolicy{Size: 10, Overflow: OVERFLOW_DROP_OLDEST}))
+
+	p := r.lookupPolicy(map[string]string{"channel": "tickers", "instId": "BTC-USDT"})
+	assert.Equal(t, OVERFLOW_DROP_OLDEST, p.Overflow)
+	p = r.lookupPolicy(map[string]string{"channel": "tickers", "instId": "ETH-USDT"})
+	assert.Equal(t, OVERFLOW_BLOCK, p.Overflow)
+	p = r.lookupPolicy(map[string]string{"channel": "books5", "instId": "ETH-USDT"})
+	assert.Equal(t, OVERFLOW_CONFLATE, p.Overflow)
+
+	r.enqueuePush(r.IsQuit(), EVENT_BOOKED_DATA, &Msg{Info: &pushData{Arg: map[string]string{"channel": "tickers", "instId": "BTC-USDT", "uid": "1"}}})
+	st, ok := r.GetBufferStats()["channel:tickers,instId:BTC-USDT"]
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), st.Received)
+	assert.Equal(t, 10, st.Size)
+}
+
+func TestPushQueueStop(t *testing.T) {
+	q, taken, handled, release := blockedQueue(BufferPolicy{Size: 1, Overflow: OVERFLOW_BLOCK})
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	args := []map[string]string{{"channel": "tickers", "instId": "BTC-USDT"}}
+	r.queues[subKey(args[0])] = q
+
+	q.put(&Msg{Info: 1})
+	<-taken
+	// 取消订阅后移除队列，之后写入的消息直接丢弃
+	r.removeQueues(args)
+	assert.Equal(t, 0, len(r.GetBufferStats()))
+	q.put(&Msg{Info: 2})
+	release()
+	assert.Equal(t, 1, (<-handled).Info)
+	assert.Equal(t, uint64(1), q.stats().Dropped)
+}
+
+func TestRemoveQueues(t *testing.T) {
+	srv := newFakeServer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	r.SetDialer(srv.dialer)
+	r.SetHeartbeat(HeartbeatConfig{})
+	assert.Nil(t, r.Start())
+	defer r.Stop()
+
+	key := "channel:tickers,instId:BTC-USDT"
+	push := `{"arg":{"channel":"tickers","instId":"BTC-USDT"},"data":[{"instId":"BTC-USDT","last":"100"}]}`
+	hasQueue := func() bool {
+		_, ok := r.GetBufferStats()[key]
+		return ok
+	}
+
+	// 订阅流取消后移除队列
+	ch, cancel, err := r.StreamTickers([]map[string]string{{"instId": "BTC-USDT"}})
+	assert.Nil(t, err)
+	srv.conn(0).WriteMessage(websocket.TextMessage, []byte(push))
+	<-ch
+	assert.True(t, hasQueue())
+	r.queueLock.Lock()
+	q := r.queues[key]
+	r.queueLock.Unlock()
+	cancel()
+	assert.False(t, hasQueue())
+	select {
+	case <-q.stop:
+	default:
+		t.Fatal("队列未关闭")
+	}
+
+	// 退订后移除队列
+	param := map[string]string{"channel": "tickers", "instId": "BTC-USDT"}
+	res, _, err := r.Subscribe(param)
+	assert.True(t, res, err)
+	srv.conn(0).WriteMessage(websocket.TextMessage, []byte(push))
+	assert.Eventually(t, hasQueue, time.Second, 10*time.Millisecond)
+	res, _, err = r.UnSubscribe(param)
+	assert.True(t, res, err)
+	assert.False(t, hasQueue())
+}
@@ -0,0 +1,114 @@
+package ws
+
+import (
+	"context"
+	. "v5sdk_go/ws/wImpl"
+)
+
+/*
+	business 地址提供的频道
+*/
+
+/*
+	全部交易频道
+*/
+func (a *WsClient) PubTradesAll(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PubTradesAllCtx(ctx, op, params)
+}
+
+func (a *WsClient) PubTradesAllCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+	return a.PubChannelCtx(ctx, EVENT_BOOK_TRADES_ALL, op, params, PERIOD_NONE)
+}
+
+/*
+	订阅高级策略委托订单频道
+*/
+func (a *WsClient) PrivAlgoAdvance(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PrivAlgoAdvanceCtx(ctx, op, params)
+}
+
+func (a *WsClient) PrivAlgoAdvanceCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+	return a.PubChannelCtx(ctx, EVENT_BOOK_ALGO_ADVANCE, op, params, PERIOD_NONE)
+}
+
+/*
+	订阅现货网格策略委托订单频道
+*/
+func (a *WsClient) PrivGridOrdersSpot(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PrivGridOrdersSpotCtx(ctx, op, params)
+}
+
+func (a *WsClient) PrivGridOrdersSpotCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+	return a.PubChannelCtx(ctx, EVENT_BOOK_GRID_ORDERS_SPOT, op, params, PERIOD_NONE)
+}
+
+/*
+	订阅合约网格策略委托订单频道
+*/
+func (a *WsClient) PrivGridOrdersContract(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PrivGridOrdersContractCtx(ctx, op, params)
+}
+
+func (a *WsClient) PrivGridOrdersContractCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+	return a.PubChannelCtx(ctx, EVENT_BOOK_GRID_ORDERS_CONTRACT, op, params, PERIOD_NONE)
+}
+
+/*
+	订阅网格策略持仓频道
+*/
+func (a *WsClient) PrivGridPositions(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PrivGridPositionsCtx(ctx, op, params)
+}
+
+func (a *WsClient) PrivGridPositionsCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+	return a.PubChannelCtx(ctx, EVENT_BOOK_GRID_POSITIONS, op, params, PERIOD_NONE)
+}
+
+/*
+	订阅网格策略子订单频道
+*/
+func (a *WsClient) PrivGridSubOrders(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PrivGridSubOrdersCtx(ctx, op, params)
+}
+
+func (a *WsClient) PrivGridSubOrdersCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+	return a.PubChannelCtx(ctx, EVENT_BOOK_GRID_SUB_ORDERS, op, params, PERIOD_NONE)
+}
+
+/*
+	订阅充值信息频道
+*/
+func (a *WsClient) PrivDepositInfo(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PrivDepositInfoCtx(ctx, op, params)
+}
+
+func (a *WsClient) PrivDepositInfoCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+	return a.PubChannelCtx(ctx, EVENT_BOOK_DEPOSIT_INFO, op, params, PERIOD_NONE)
+}
+
+/*
+	订阅提币信息频道
+*/
+func (a *WsClient) PrivWithdrawalInfo(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PrivWithdrawalInfoCtx(ctx, op, params)
+}
+
+func (a *WsClient) PrivWithdrawalInfoCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+	return a.PubChannelCtx(ctx, EVENT_BOOK_WITHDRAWAL_INFO, op, params, PERIOD_NONE)
+}
@@ -5,12 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"regexp"
 	"runtime/debug"
 	"sync"
 	"time"
 	. "v5sdk_go/config"
+	"v5sdk_go/trade"
 	. "v5sdk_go/utils"
 	. "v5sdk_go/ws/wImpl"
 
@@ -26,29 +28,88 @@ type ReceivedMsgDataCallback func(time.Time, MsgData) error
 // 深度订阅推送数据回调函数
 type ReceivedDepthDataCallback func(time.Time, DepthData) error
 
-// websocket
+/*
+	websocket 客户端
+	带 Ctx 后缀的方法是同名方法的 context 版本，超时和取消由 ctx 控制；
+	不带 Ctx 的方法按 timeOut 参数(毫秒，不填时为 DEFAULT_TIMEOUT)创建超时后调用对应的 Ctx 方法。
+	Stream 系列方法的 Ctx 版本在 ctx 结束后自动取消订阅并关闭数据通道。CombinedClient 的方法遵循相同的约定
+*/
 type WsClient struct {
 	WsEndPoint string
 	WsApi      *ApiInfo
-	conn       *websocket.Conn
+	conn       Conn
+	dialer     Dialer
 	sendCh     chan string //发消息队列
-	resCh      chan *Msg   //收消息队列
 
 	errCh chan *Msg
-	regCh map[Event]chan *Msg //请求响应队列
+	regCh map[string]*waiter //请求响应队列，key 为事件类型或JRPC请求ID
 
+	// 退出信号，Stop 时关闭，其他通道均不关闭
 	quitCh chan struct{}
 	lock   sync.RWMutex
 
+	// 关闭流程
+	closing  bool                         // 正在关闭，不再接受新的请求
+	reqWg    sync.WaitGroup               // 处理中的请求
+	closeCh  chan chan error              // 发送关闭帧
+	recvDone chan struct{}                // 接收协程已退出
+	subs     map[string]map[string]string // 当前订阅，key 为 subKey
+	subRefs  map[string]int               // 各订阅的订阅次数，订阅流取消时据此判断是否退订
+	stopped  bool                         // 已主动关闭，不再重连
+	doneCh   chan struct{}                // 客户端停止且不再重连时关闭
+	connTime time.Time                    // 连接建立的时间
+
+	// 连接状态回调函数及重连配置
+	onConnectHook     ConnEventCallback
+	onDisconnectHook  ConnEventCallback
+	onLoginHook       ConnEventCallback
+	onReconnectHook   ConnEventCallback
+	onResubscribeHook ConnEventCallback
+	reconnConf        ReconnectConfig
+	reconnecting      bool
+
+	orderLimiter *RateLimiter        // 分批下单/撤单/改单共用的限速器
+	preTrade     trade.PreTradeCheck // 下单前检查
+
 	onMessageHook ReceivedDataCallback      //全局消息回调函数
 	onBookMsgHook ReceivedMsgDataCallback   //普通订阅消息回调函数
 	onDepthHook   ReceivedDepthDataCallback //深度订阅消息回调函数
 	OnErrorHook   ReceivedDataCallback      //错误处理回调函数
 
-	// 记录深度信息
-	DepthDataList map[string]DepthDetail
-	autoDepthMgr  bool // 深度数据管理（checksum等）
-	DepthDataLock sync.RWMutex
+	// 私有频道推送数据回调函数
+	onAccountHook   ReceivedAccountDataCallback
+	onPositionHook  ReceivedPositionDataCallback
+	onOrderHook     ReceivedOrderDataCallback
+	onAlgoOrderHook ReceivedAlgoOrderDataCallback
+	onBalAndPosHook ReceivedBalAndPosDataCallback
+
+	// 按频道/产品分发推送消息
+	router *Router
+	// 订阅流数据通道缓冲区大小
+	streamBuf int
+
+	// 推送消息队列，每个订阅一个
+	queues        map[string]*pushQueue
+	msgQueue      *pushQueue // 全局消息回调队列
+	bufPolicies   map[string]BufferPolicy
+	defaultPolicy BufferPolicy
+	msgPolicy     BufferPolicy
+	queueLock     sync.Mutex
+
+	// 本地订单簿
+	books            map[string]*OrderBook
+	bookStates       map[string]*bookState
+	autoDepthMgr     bool // 深度数据管理（checksum等）
+	bookLock         sync.RWMutex
+	onBookStatusHook BookStatusCallback // 订单簿状态变化回调函数
+	onSeqGapHook     SeqGapCallback     // 深度数据序号不连续回调函数
+
+	// 会话录制
+	recorder *Recorder
+	// 心跳配置及连接质量统计
+	hbConf  HeartbeatConfig
+	metrics *connMetrics
+	pingSem chan struct{} // pong 按事件类型匹配，心跳和 Ping 同一时间只发送一个
 
 	isStarted   bool //防止重复启动和关闭
 	dailTimeout time.Duration
@@ -80,6 +141,9 @@ type ProcessDetail struct {
 	RecvTime time.Time     `json:"recvTime"` //接受到订阅结果的时间
 	UsedTime time.Duration `json:"UsedTime"` //耗时
 	Data     []*Msg        `json:"data"`     //订阅结果数据
+
+	ReqId  string              `json:"reqId,omitempty"`  //JRPC请求ID
+	Orders []trade.OrderResult `json:"orders,omitempty"` //JRPC请求各订单的处理结果
 }
 
 func (p *ProcessDetail) String() string {
@@ -97,13 +161,28 @@ func NewWsClient(ep string) (r *WsClient, err error) {
 	r = &WsClient{
 		WsEndPoint: ep,
 		sendCh:     make(chan string),
-		resCh:      make(chan *Msg),
 		errCh:      make(chan *Msg),
-		regCh:      make(map[Event]chan *Msg),
+		regCh:      make(map[string]*waiter),
+		closeCh:    make(chan chan error),
+		subs:       make(map[string]map[string]string),
+		subRefs:    make(map[string]int),
 		//cbs:        make(map[Event]ReceivedDataCallback),
 		quitCh:        make(chan struct{}),
-		DepthDataList: make(map[string]DepthDetail),
+		doneCh:        make(chan struct{}),
+		books:         make(map[string]*OrderBook),
+		bookStates:    make(map[string]*bookState),
+		router:        NewRouter(),
+		streamBuf:     DEFAULT_STREAM_BUFFER,
+		queues:        make(map[string]*pushQueue),
+		bufPolicies:   make(map[string]BufferPolicy),
+		defaultPolicy: BufferPolicy{Size: DEFAULT_BUFFER_SIZE, Overflow: OVERFLOW_BLOCK},
+		msgPolicy:     BufferPolicy{Size: DEFAULT_BUFFER_SIZE, Overflow: OVERFLOW_BLOCK},
 		dailTimeout:   time.Second * 5,
+		hbConf:        DEFAULT_HEARTBEAT,
+		metrics:       &connMetrics{},
+		pingSem:       make(chan struct{}, 1),
+		dialer:        &GorillaDialer{},
+		orderLimiter:  trade.NewOrderLimiter(),
 		// 自动深度校验默认开启
 		autoDepthMgr: true,
 	}
@@ -111,82 +190,6 @@ func NewWsClient(ep string) (r *WsClient, err error) {
 	return
 }
 
-/*
-	新增记录深度信息
-*/
-func (a *WsClient) addDepthDataList(key string, dd DepthDetail) error {
-	a.DepthDataLock.Lock()
-	defer a.DepthDataLock.Unlock()
-	a.DepthDataList[key] = dd
-	return nil
-}
-
-/*
-	更新记录深度信息（如果没有记录不会更新成功）
-*/
-func (a *WsClient) updateDepthDataList(key string, dd DepthDetail) error {
-	a.DepthDataLock.Lock()
-	defer a.DepthDataLock.Unlock()
-	if _, ok := a.DepthDataList[key]; !ok {
-		return errors.New("更新失败！未发现记录" + key)
-	}
-
-	a.DepthDataList[key] = dd
-	return nil
-}
-
-/*
-	删除记录深度信息
-*/
-func (a *WsClient) deleteDepthDataList(key string) error {
-	a.DepthDataLock.Lock()
-	defer a.DepthDataLock.Unlock()
-	delete(a.DepthDataList, key)
-	return nil
-}
-
-/*
-	设置是否自动深度管理，开启 true，关闭 false
-*/
-func (a *WsClient) EnableAutoDepthMgr(b bool) error {
-	a.DepthDataLock.Lock()
-	defer a.DepthDataLock.Unlock()
-
-	if len(a.DepthDataList) != 0 {
-		err := errors.New("当前有深度数据处于订阅中")
-		return err
-	}
-
-	a.autoDepthMgr = b
-	return nil
-}
-
-/*
-	获取当前的深度快照信息(合并后的)
-*/
-func (a *WsClient) GetSnapshotByChannel(data DepthData) (snapshot *DepthDetail, err error) {
-	key, err := json.Marshal(data.Arg)
-	if err != nil {
-		return
-	}
-	a.DepthDataLock.Lock()
-	defer a.DepthDataLock.Unlock()
-	val, ok := a.DepthDataList[string(key)]
-	if !ok {
-		return
-	}
-	snapshot = new(DepthDetail)
-	raw, err := json.Marshal(val)
-	if err != nil {
-		return
-	}
-	err = json.Unmarshal(raw, &snapshot)
-	if err != nil {
-		return
-	}
-	return
-}
-
 // 设置dial超时时间
 func (a *WsClient) SetDailTimeout(tm time.Duration) {
 	a.dailTimeout = tm
@@ -194,6 +197,19 @@ func (a *WsClient) SetDailTimeout(tm time.Duration) {
 
 // 非阻塞启动
 func (a *WsClient) Start() error {
+	a.lock.Lock()
+	a.stopped = false
+	if isDone(a.doneCh) {
+		a.doneCh = make(chan struct{})
+	}
+	a.lock.Unlock()
+	return a.connect()
+}
+
+/*
+	建立连接，主动关闭后不再连接
+*/
+func (a *WsClient) connect() error {
 	a.lock.RLock()
 	if a.isStarted {
 		a.lock.RUnlock()
@@ -202,48 +218,70 @@ func (a *WsClient) Start() error {
 	} else {
 		a.lock.RUnlock()
 		a.lock.Lock()
-		defer a.lock.Unlock()
+		if a.stopped {
+			a.lock.Unlock()
+			return ErrClientClosed
+		}
 		// 增加超时处理
-		done := make(chan struct{})
+		start := time.Now()
 		ctx, cancel := context.WithTimeout(context.Background(), a.dailTimeout)
 		defer cancel()
-		go func(ctx context.Context) {
-			defer func() {
-				close(done)
-			}()
-			var c *websocket.Conn
-			c, _, err := websocket.DefaultDialer.Dial(a.WsEndPoint, nil)
-			if err != nil {
-				err = errors.New("dial error:" + err.Error())
-				return
+		c, err := a.dialer.Dial(ctx, a.WsEndPoint)
+		if err != nil {
+			a.lock.Unlock()
+			if ctx.Err() != nil {
+				return errors.New("连接超时退出！")
 			}
-			a.conn = c
-
-		}(ctx)
-		select {
-		case <-ctx.Done():
-			err := errors.New("连接超时退出！")
-			return err
-		case <-done:
-
+			return errors.New("dial error:" + err.Error())
 		}
+		a.conn = c
 
-		go a.receive()
-		go a.work()
-		a.isStarted = true
+		a.run()
+		a.lock.Unlock()
 		log.Println("客户端已启动!", a.WsEndPoint)
+		a.fireConnEvent(a.onConnectHook, ConnEvent{Duration: time.Since(start)})
 		return nil
 	}
 }
 
+/*
+	连接建立后启动消息收发，调用方需持有 a.lock
+	每个连接使用独立的退出信号，上一个连接的协程随旧信号退出
+*/
+func (a *WsClient) run() {
+	select {
+	case <-a.quitCh:
+		a.quitCh = make(chan struct{})
+	default:
+	}
+	quit := a.quitCh
+
+	a.queueLock.Lock()
+	a.queues = make(map[string]*pushQueue)
+	a.msgQueue = newPushQueue("message", a.msgPolicy, quit, a.handleMessage)
+	mq := a.msgQueue
+	a.queueLock.Unlock()
+
+	a.closing = false
+	a.connTime = time.Now()
+	a.metrics.reset(a.connTime)
+	a.recvDone = make(chan struct{})
+	go a.receive(a.conn, quit, mq, a.recvDone)
+	go a.work(a.conn, quit)
+	a.isStarted = true
+}
+
 // 客户端退出消息channel
 func (a *WsClient) IsQuit() <-chan struct{} {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
 	return a.quitCh
 }
 
-func (a *WsClient) work() {
+func (a *WsClient) work(conn Conn, quit <-chan struct{}) {
+	var reason error
 	defer func() {
-		a.Stop()
+		a.stopConn(conn, reason)
 		err := recover()
 		if err != nil {
 			log.Printf("work End. Recover msg: %+v", a)
@@ -252,36 +290,20 @@ func (a *WsClient) work() {
 
 	}()
 
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
+	var tick <-chan time.Time
+	if a.hbConf.Interval > 0 {
+		ticker := time.NewTicker(a.heartbeatTick())
+		defer ticker.Stop()
+		tick = ticker.C
+	}
 
 	for {
 		select {
-		case <-ticker.C: // 保持心跳
-			// go a.Ping(1000)
-			go func() {
-				_, _, err := a.Ping(1000)
-				if err != nil {
-					fmt.Println("心跳检测失败！", err)
-					a.Stop()
-					return
-				}
+		case now := <-tick: // 保持心跳
+			a.heartbeat(conn, quit, now)
 
-			}()
-
-		case <-a.quitCh: // 保持心跳
+		case <-quit: // 保持心跳
 			return
-		case data, ok := <-a.resCh: //接收到服务端发来的消息
-			if !ok {
-				return
-			}
-			//log.Println("接收到来自resCh的消息:", data)
-			if a.onMessageHook != nil {
-				err := a.onMessageHook(data)
-				if err != nil {
-					log.Println("执行onMessageHook函数错误！", err)
-				}
-			}
 		case errMsg, ok := <-a.errCh: //错误处理
 			if !ok {
 				return
@@ -297,12 +319,18 @@ func (a *WsClient) work() {
 				return
 			}
 			//log.Println("接收到来自req的消息:", req)
-			err := a.conn.WriteMessage(websocket.TextMessage, []byte(req))
+			err := conn.WriteMessage(websocket.TextMessage, []byte(req))
 			if err != nil {
 				log.Printf("发送请求失败: %s\n", err)
+				reason = err
 				return
 			}
 			log.Printf("[发送请求] %v\n", req)
+			if a.recorder != nil {
+				a.recorder.Record(RECORD_OUT, []byte(req), time.Now())
+			}
+		case res := <-a.closeCh: //发送关闭帧
+			res <- conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
 		}
 	}
 
@@ -311,9 +339,11 @@ func (a *WsClient) work() {
 /*
 	处理接受到的消息
 */
-func (a *WsClient) receive() {
+func (a *WsClient) receive(conn Conn, quit <-chan struct{}, mq *pushQueue, done chan struct{}) {
+	var reason error
+	defer close(done)
 	defer func() {
-		a.Stop()
+		a.stopConn(conn, reason)
 		err := recover()
 		if err != nil {
 			log.Printf("Receive End. Recover msg: %+v", a)
@@ -323,17 +353,27 @@ func (a *WsClient) receive() {
 	}()
 
 	for {
-		messageType, message, err := a.conn.ReadMessage()
+		messageType, message, err := conn.ReadMessage()
 		if err != nil {
-			if a.isStarted {
+			// 回放结束，等待已收到的消息处理完毕
+			if err == io.EOF {
+				a.drainQueues(context.Background())
+				break
+			}
+			if a.isRunning() && !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
 				log.Println("receive message error!" + err.Error())
 			}
 
+			reason = err
 			break
 		}
 
 		txtMsg := message
 		switch messageType {
+		case websocket.CloseMessage:
+			// 对端关闭连接
+			reason = ErrPeerClosed
+			return
 		case websocket.TextMessage:
 		case websocket.BinaryMessage:
 			txtMsg, err = GzipDecode(message)
@@ -348,9 +388,16 @@ func (a *WsClient) receive() {
 		//发送结果到默认消息处理通道
 
 		timestamp := time.Now()
+		if ft, ok := conn.(frameTimer); ok {
+			timestamp = ft.frameTime()
+		}
+		if a.recorder != nil {
+			a.recorder.Record(RECORD_IN, txtMsg, timestamp)
+		}
+		a.metrics.onMessage(timestamp)
 		msg := &Msg{Timestamp: timestamp, Info: string(txtMsg)}
 
-		a.resCh <- msg
+		mq.put(msg)
 
 		evt, data, err := a.parseMessage(txtMsg)
 		if err != nil {
@@ -360,139 +407,86 @@ func (a *WsClient) receive() {
 
 		//log.Println("解析消息成功!消息类型 =", evt)
 
+		//推送消息按订阅写入各自的消费队列
+		if evt == EVENT_BOOKED_DATA || evt == EVENT_DEPTH_DATA {
+			a.enqueuePush(quit, evt, &Msg{Timestamp: timestamp, Info: data})
+			continue
+		}
+
 		a.lock.RLock()
-		ch, ok := a.regCh[evt]
+		w, ok := a.regCh[rspKey(evt, data)]
 		a.lock.RUnlock()
 		if !ok {
-			//只有推送消息才会主动创建通道和消费队列
-			if evt == EVENT_BOOKED_DATA || evt == EVENT_DEPTH_DATA {
-				//log.Println("channel不存在！event:", evt)
-				//a.lock.RUnlock()
-				a.lock.Lock()
-				a.regCh[evt] = make(chan *Msg)
-				ch = a.regCh[evt]
-				a.lock.Unlock()
-
-				//log.Println("创建", evt, "通道")
-
-				// 创建消费队列
-				go func(evt Event) {
-					//log.Println("创建goroutine  evt:", evt)
-
-					for msg := range a.regCh[evt] {
-						//log.Println(msg)
-						// msg.Print()
-						switch evt {
-						// 处理普通推送数据
-						case EVENT_BOOKED_DATA:
-							fn := a.onBookMsgHook
-							if fn != nil {
-								err = fn(msg.Timestamp, msg.Info.(MsgData))
-								if err != nil {
-									log.Println("订阅数据回调函数执行失败！", err)
-								}
-								//log.Println("函数执行成功！", err)
-							}
-						// 处理深度推送数据
-						case EVENT_DEPTH_DATA:
-							fn := a.onDepthHook
-
-							depData := msg.Info.(DepthData)
-
-							// 开启深度数据管理功能的，会合并深度数据
-							if a.autoDepthMgr {
-								a.MergeDepth(depData)
-							}
-
-							// 运行用户定义回调函数
-							if fn != nil {
-								err = fn(msg.Timestamp, msg.Info.(DepthData))
-								if err != nil {
-									log.Println("深度回调函数执行失败！", err)
-								}
-
-							}
-						}
-
-					}
-					//log.Println("退出goroutine  evt:", evt)
-				}(evt)
-
-				//continue
-			} else {
-				//log.Println("程序异常！通道已关闭", evt)
-				continue
-			}
-
+			//log.Println("程序异常！通道已关闭", evt)
+			continue
 		}
 
-		//log.Println(evt,"事件已注册",ch)
+		//log.Println(evt,"事件已注册",w)
 
-		ctx := context.Background()
-		ctx, cancel := context.WithTimeout(ctx, time.Millisecond*1000)
+		// 等待方已超时退出时丢弃该响应
 		select {
-		/*
-			丢弃消息容易引发数据处理处理错误
-		*/
-		// case <-ctx.Done():
-		// 	log.Println("等待超时，消息丢弃 - ", data)
-		case ch <- &Msg{Timestamp: timestamp, Info: data}:
+		case w.ch <- &Msg{Timestamp: timestamp, Info: data}:
+		case <-w.done:
+		case <-quit:
+			return
 		}
-		cancel()
 	}
 }
 
 /*
-	开启了深度数据管理功能后，系统会自动合并深度信息
+	处理全局消息回调
 */
-func (a *WsClient) MergeDepth(depData DepthData) (err error) {
-	if !a.autoDepthMgr {
-		return
-	}
-
-	key, err := json.Marshal(depData.Arg)
-	if err != nil {
-		err = errors.New("数据错误")
-		return
-	}
-
-	// books5 不需要做checksum
-	if depData.Arg["channel"] == "books5" {
-		a.addDepthDataList(string(key), depData.Data[0])
-		return
+func (a *WsClient) handleMessage(msg *Msg) {
+	if a.onMessageHook != nil {
+		err := a.onMessageHook(msg)
+		if err != nil {
+			log.Println("执行onMessageHook函数错误！", err)
+		}
 	}
+}
 
-	if depData.Action == "snapshot" {
-
-		_, err = depData.CheckSum(nil)
-		if err != nil {
-			log.Println("校验失败", err)
-			return
+/*
+	处理推送数据，同一订阅的推送数据按顺序处理
+*/
+func (a *WsClient) handlePush(evt Event, msg *Msg) {
+	switch evt {
+	// 处理普通推送数据
+	case EVENT_BOOKED_DATA:
+		fn := a.onBookMsgHook
+		if fn != nil {
+			err := fn(msg.Timestamp, msg.Info.(*pushData).msgData())
+			if err != nil {
+				log.Println("订阅数据回调函数执行失败！", err)
+			}
 		}
 
-		a.addDepthDataList(string(key), depData.Data[0])
+		// 私有频道结构化数据回调
+		a.dispatchPrivData(msg)
 
-	} else {
+		// 按频道/产品分发
+		a.router.dispatch(msg)
+	// 处理深度推送数据
+	case EVENT_DEPTH_DATA:
+		fn := a.onDepthHook
 
-		var newSnapshot *DepthDetail
-		a.DepthDataLock.RLock()
-		oldSnapshot, ok := a.DepthDataList[string(key)]
-		if !ok {
-			log.Println("深度数据错误，全量数据未发现！")
-			err = errors.New("数据错误")
-			return
+		depData := msg.Info.(DepthData)
+
+		// 开启深度数据管理功能的，会合并深度数据
+		if a.autoDepthMgr {
+			a.MergeDepth(depData)
 		}
-		a.DepthDataLock.RUnlock()
-		newSnapshot, err = depData.CheckSum(&oldSnapshot)
-		if err != nil {
-			log.Println("深度校验失败", err)
-			err = errors.New("校验失败")
-			return
+
+		// 运行用户定义回调函数
+		if fn != nil {
+			err := fn(msg.Timestamp, depData)
+			if err != nil {
+				log.Println("深度回调函数执行失败！", err)
+			}
 		}
 
-		a.updateDepthDataList(string(key), *newSnapshot)
+		// 按频道/产品分发
+		a.router.dispatch(msg)
 	}
-	return
 }
 
 /*
@@ -532,14 +526,11 @@ func GetInfoFromErrCode(data ErrData) Event {
    error信息样例
  {"event":"error","msg":"channel:index-tickers,instId:BTC-USDT1 doesn't exist","code":"60018"}
 */
+var errMsgChannelReg = regexp.MustCompile(`channel:(.*?),`)
+
 func GetInfoFromErrMsg(raw string) (channel string) {
-	reg := regexp.MustCompile(`channel:(.*?),`)
-	if reg == nil {
-		fmt.Println("MustCompile err")
-		return
-	}
 	//提取关键信息
-	result := reg.FindAllStringSubmatch(raw, -1)
+	result := errMsgChannelReg.FindAllStringSubmatch(raw, -1)
 	for _, text := range result {
 		channel = text[1]
 	}
@@ -547,116 +538,28 @@ func GetInfoFromErrMsg(raw string) (channel string) {
 }
 
 /*
-	解析消息类型
+	主动关闭连接，不再自动重连
 */
-func (a *WsClient) parseMessage(raw []byte) (evt Event, data interface{}, err error) {
-	evt = EVENT_UNKNOWN
-	//log.Println("解析消息")
-	//log.Println("消息内容:", string(raw))
-	if string(raw) == "pong" {
-		evt = EVENT_PING
-		data = raw
-		return
-	}
-	//log.Println(0, evt)
-	var rspData = RspData{}
-	err = json.Unmarshal(raw, &rspData)
-	if err == nil {
-		op := rspData.Event
-		if op == OP_SUBSCRIBE || op == OP_UNSUBSCRIBE {
-			channel := rspData.Arg["channel"]
-			evt = GetEventId(channel)
-			data = rspData
-			return
-		}
-	}
-
-	//log.Println("ErrData")
-	var errData = ErrData{}
-	err = json.Unmarshal(raw, &errData)
-	if err == nil {
-		op := errData.Event
-		switch op {
-		case OP_LOGIN:
-			evt = EVENT_LOGIN
-			data = errData
-			//log.Println(3, evt)
-			return
-		case OP_ERROR:
-			data = errData
-			// TODO:细化报错对应的事件判断
-
-			//尝试从msg字段中解析对应的事件类型
-			evt = GetInfoFromErrCode(errData)
-			if evt != EVENT_UNKNOWN {
-				return
-			}
-			evt = GetEventId(GetInfoFromErrMsg(errData.Msg))
-			if evt == EVENT_UNKNOWN {
-				evt = EVENT_ERROR
-				return
-			}
-			return
-		}
-		//log.Println(5, evt)
-	}
-
-	//log.Println("JRPCRsp")
-	var jRPCRsp = JRPCRsp{}
-	err = json.Unmarshal(raw, &jRPCRsp)
-	if err == nil {
-		data = jRPCRsp
-		evt = GetEventId(jRPCRsp.Op)
-		if evt != EVENT_UNKNOWN {
-			return
-		}
-	}
-
-	var depthData = DepthData{}
-	err = json.Unmarshal(raw, &depthData)
-	if err == nil {
-		evt = EVENT_DEPTH_DATA
-		data = depthData
-		//log.Println("-->>EVENT_DEPTH_DATA", evt)
-		//log.Println(evt, data)
-		//log.Println(6)
-		switch depthData.Arg["channel"] {
-		case "books":
-			return
-		case "books-l2-tbt":
-			return
-		case "books50-l2-tbt":
-			return
-		case "books5":
-			return
-		default:
-
-		}
-	}
-
-	//log.Println("MsgData")
-	var msgData = MsgData{}
-	err = json.Unmarshal(raw, &msgData)
-	if err == nil {
-		evt = EVENT_BOOKED_DATA
-		data = msgData
-		//log.Println("-->>EVENT_BOOK_DATA", evt)
-		//log.Println(evt, data)
-		//log.Println(6)
-		return
-	}
+func (a *WsClient) Stop() error {
+	a.lock.Lock()
+	a.stopped = true
+	a.finish()
+	conn := a.conn
+	a.lock.Unlock()
 
-	evt = EVENT_UNKNOWN
-	err = errors.New("message unknown")
-	return
+	a.stopConn(conn, nil)
+	return nil
 }
 
-func (a *WsClient) Stop() error {
-
+/*
+	关闭指定连接，连接已被替换时忽略
+	reason: 断开原因，为 nil 表示主动关闭
+*/
+func (a *WsClient) stopConn(conn Conn, reason error) {
 	a.lock.Lock()
-	defer a.lock.Unlock()
-	if !a.isStarted {
-		return nil
+	if !a.isStarted || a.conn != conn {
+		a.lock.Unlock()
+		return
 	}
 
 	a.isStarted = false
@@ -664,17 +567,26 @@ func (a *WsClient) Stop() error {
 	if a.conn != nil {
 		a.conn.Close()
 	}
-	close(a.errCh)
-	close(a.sendCh)
-	close(a.resCh)
+	// 只关闭退出信号，各发送方通过 quitCh 感知退出，避免向已关闭的通道发送数据
 	close(a.quitCh)
-
-	for _, ch := range a.regCh {
-		close(ch)
+	lived := time.Since(a.connTime)
+	// 重连协程运行中时由其继续重试
+	retry := reason != nil && !a.stopped && !a.closing && !a.reconnecting && a.reconnConf.Interval > 0
+	if retry {
+		a.reconnecting = true
+	} else if !a.reconnecting {
+		a.finish()
 	}
+	a.lock.Unlock()
 
-	log.Println("ws客户端退出!")
-	return nil
+	log.Println("ws客户端退出!", reason)
+	a.fireConnEvent(a.onDisconnectHook, ConnEvent{Duration: lived, Err: reason})
+	if reason != nil {
+		a.invalidateBooks(reason)
+	}
+	if retry {
+		go a.reconnect(time.Now())
+	}
 }
 
 /*
@@ -703,6 +615,13 @@ func (a *WsClient) AddDepthHook(fn ReceivedDepthDataCallback) error {
 	return nil
 }
 
+/*
+	获取推送消息路由，可按频道/产品注册多个回调函数
+*/
+func (a *WsClient) Router() *Router {
+	return a.router
+}
+
 /*
 	添加错误类型消息处理的回调函数
 */
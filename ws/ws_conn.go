@@ -0,0 +1,177 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrConnClosed = errors.New("连接已关闭")
+
+/*
+	websocket连接
+	*websocket.Conn 实现了该接口
+*/
+type Conn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
+/*
+	建立连接，WsClient 启动时调用
+*/
+type Dialer interface {
+	Dial(ctx context.Context, url string) (Conn, error)
+}
+
+/*
+	可提供消息原始接收时间的连接，如回放连接
+*/
+type frameTimer interface {
+	frameTime() time.Time
+}
+
+/*
+	基于 gorilla/websocket 的连接
+	Dialer: 可设置代理、TLS、压缩等参数，为空时使用 websocket.DefaultDialer
+	Header: 握手请求的附加请求头
+	例如:
+	cli.SetDialer(&GorillaDialer{Dialer: &websocket.Dialer{Proxy: http.ProxyFromEnvironment, EnableCompression: true}})
+*/
+type GorillaDialer struct {
+	Dialer *websocket.Dialer
+	Header http.Header
+}
+
+func (d *GorillaDialer) Dial(ctx context.Context, url string) (Conn, error) {
+	dialer := d.Dialer
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+	c, _, err := dialer.DialContext(ctx, url, d.Header)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+type pipeFrame struct {
+	messageType int
+	data        []byte
+}
+
+/*
+	内存管道连接的一端
+*/
+type pipeConn struct {
+	in   <-chan pipeFrame
+	out  chan<- pipeFrame
+	done chan struct{}
+	once *sync.Once
+}
+
+// 管道缓冲的消息数
+const PIPE_BUFFER_SIZE = 64
+
+/*
+	创建内存管道，一端写入的消息从另一端读出，任一端关闭后两端均不可再读写
+*/
+func NewPipe() (client, server Conn) {
+	c2s := make(chan pipeFrame, PIPE_BUFFER_SIZE)
+	s2c := make(chan pipeFrame, PIPE_BUFFER_SIZE)
+	done := make(chan struct{})
+	once := &sync.Once{}
+	client = &pipeConn{in: s2c, out: c2s, done: done, once: once}
+	server = &pipeConn{in: c2s, out: s2c, done: done, once: once}
+	return
+}
+
+func (c *pipeConn) ReadMessage() (messageType int, p []byte, err error) {
+	select {
+	case f := <-c.in:
+		return f.messageType, f.data, nil
+	case <-c.done:
+		return 0, nil, ErrConnClosed
+	}
+}
+
+func (c *pipeConn) WriteMessage(messageType int, data []byte) error {
+	buf := make([]byte, len(data))
+	copy(buf, data)
+
+	// 已关闭时不再写入
+	select {
+	case <-c.done:
+		return ErrConnClosed
+	default:
+	}
+
+	select {
+	case c.out <- pipeFrame{messageType: messageType, data: buf}:
+		return nil
+	case <-c.done:
+		return ErrConnClosed
+	}
+}
+
+func (c *pipeConn) Close() error {
+	c.once.Do(func() {
+		close(c.done)
+	})
+	return nil
+}
+
+/*
+	内存管道连接，用于测试和模拟服务端
+	每次 Dial 创建一个管道，服务端通过 Accept 获取另一端
+	例如:
+	d := NewPipeDialer()
+	cli.SetDialer(d)
+	go func() {
+		srv, _ := d.Accept(context.Background())
+		srv.WriteMessage(websocket.TextMessage, []byte("pong"))
+	}()
+	cli.Start()
+*/
+type PipeDialer struct {
+	conns chan Conn
+}
+
+func NewPipeDialer() *PipeDialer {
+	return &PipeDialer{conns: make(chan Conn)}
+}
+
+func (d *PipeDialer) Dial(ctx context.Context, url string) (Conn, error) {
+	client, server := NewPipe()
+	select {
+	case d.conns <- server:
+		return client, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+/*
+	等待客户端连接，返回服务端的一端
+*/
+func (d *PipeDialer) Accept(ctx context.Context) (Conn, error) {
+	select {
+	case c := <-d.conns:
+		return c, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+/*
+	设置建立连接的方式，需在 Start 之前调用
+	默认使用 websocket.DefaultDialer
+*/
+func (a *WsClient) SetDialer(d Dialer) {
+	a.dialer = d
+}
@@ -0,0 +1,69 @@
+package ws
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipe(t *testing.T) {
+	client, server := NewPipe()
+
+	assert.Nil(t, client.WriteMessage(websocket.TextMessage, []byte("ping")))
+	typ, data, err := server.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, websocket.TextMessage, typ)
+	assert.Equal(t, "ping", string(data))
+
+	server.Close()
+	_, _, err = client.ReadMessage()
+	assert.Equal(t, ErrConnClosed, err)
+	assert.Equal(t, ErrConnClosed, client.WriteMessage(websocket.TextMessage, nil))
+}
+
+/*
+	通过内存管道模拟服务端，驱动完整的收发流程
+*/
+func TestPipeDialer(t *testing.T) {
+	d := NewPipeDialer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	r.SetDialer(d)
+
+	go func() {
+		srv, err := d.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		_, req, err := srv.ReadMessage()
+		if err != nil || !strings.Contains(string(req), `"op":"subscribe"`) {
+			return
+		}
+		srv.WriteMessage(websocket.TextMessage, []byte(testSubFrame))
+		srv.WriteMessage(websocket.TextMessage, []byte(testTickerFrame))
+	}()
+
+	assert.Nil(t, r.Start())
+	defer r.Stop()
+
+	ch, cancel, err := r.StreamTickers([]map[string]string{{"instId": "BTC-USDT"}}, 1000)
+	assert.Nil(t, err)
+	defer cancel()
+
+	select {
+	case evt := <-ch:
+		assert.Equal(t, "9999.99", evt.Ticker.Last)
+	case <-time.After(2 * time.Second):
+		t.Fatal("未收到推送数据")
+	}
+}
+
+func TestDialTimeout(t *testing.T) {
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	r.SetDialer(NewPipeDialer())
+	r.SetDailTimeout(50 * time.Millisecond)
+	assert.NotNil(t, r.Start())
+}
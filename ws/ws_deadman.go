@@ -0,0 +1,220 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+/*
+	倒计时全部撤单的保活配置
+	TimeOut: 倒计时，10s~120s
+	Interval: 续期间隔，需小于 TimeOut
+	MaxMsgAge: 超过该时间未收到消息视为连接异常，为 0 时不检查
+*/
+type DeadManConfig struct {
+	TimeOut   time.Duration
+	Interval  time.Duration
+	MaxMsgAge time.Duration
+}
+
+/*
+	设置倒计时全部撤单，timeOut 为 0 表示取消倒计时
+	返回触发撤单的时间，REST 客户端可使用 RESTAPI.CancelAllAfterFunc
+*/
+type CancelAllAfterFunc func(ctx context.Context, timeOut time.Duration) (time.Time, error)
+
+/*
+	保活状态
+	Armed: 倒计时是否生效中
+	LastArm: 最近一次续期成功的时间
+	TriggerTime: 倒计时结束、触发撤单的时间
+	Skipped: 因连接异常跳过续期的次数
+	Failures: 续期请求失败的次数
+*/
+type DeadManStats struct {
+	Armed       bool
+	LastArm     time.Time
+	TriggerTime time.Time
+	Skipped     int
+	Failures    int
+}
+
+/*
+	倒计时全部撤单保活(dead man's switch)
+	连接正常时按间隔续期 cancel-all-after，连接断开或心跳失败时停止续期，
+	倒计时结束后交易所自动撤销所有挂单。连接恢复后继续续期
+	例如:
+	sw, _ := NewDeadManSwitch(cli, restCli.CancelAllAfterFunc(""), DeadManConfig{TimeOut: 60 * time.Second, Interval: 20 * time.Second})
+	sw.Start()
+	defer sw.Disarm(context.Background())
+*/
+type DeadManSwitch struct {
+	cli  *WsClient
+	conf DeadManConfig
+	arm  CancelAllAfterFunc
+
+	lock    sync.Mutex
+	stats   DeadManStats
+	running bool
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+func NewDeadManSwitch(cli *WsClient, arm CancelAllAfterFunc, conf DeadManConfig) (sw *DeadManSwitch, err error) {
+	if cli == nil || arm == nil {
+		err = errors.New("客户端不能为空")
+		return
+	}
+	if conf.TimeOut < 10*time.Second || conf.TimeOut > 120*time.Second {
+		err = errors.New("倒计时应为10s~120s")
+		return
+	}
+	if conf.Interval <= 0 || conf.Interval >= conf.TimeOut {
+		err = errors.New("续期间隔需大于0且小于倒计时")
+		return
+	}
+
+	sw = &DeadManSwitch{
+		cli:  cli,
+		conf: conf,
+		arm:  arm,
+	}
+	return
+}
+
+/*
+	设置倒计时并开始续期
+*/
+func (s *DeadManSwitch) Start() error {
+	s.lock.Lock()
+	if s.running {
+		s.lock.Unlock()
+		return nil
+	}
+	s.running = true
+	quit, done := make(chan struct{}), make(chan struct{})
+	s.quit, s.done = quit, done
+	s.lock.Unlock()
+
+	err := s.rearm()
+	if err != nil {
+		// 续期协程尚未启动，恢复为未运行状态，并结束可能在等待的 Stop
+		s.lock.Lock()
+		if s.quit == quit {
+			s.running = false
+			s.quit, s.done = nil, nil
+		}
+		s.lock.Unlock()
+		close(done)
+		return err
+	}
+	go s.loop(quit, done)
+	return nil
+}
+
+/*
+	停止续期，已设置的倒计时仍然生效
+*/
+func (s *DeadManSwitch) Stop() {
+	s.lock.Lock()
+	if !s.running {
+		s.lock.Unlock()
+		return
+	}
+	s.running = false
+	quit, done := s.quit, s.done
+	s.lock.Unlock()
+
+	close(quit)
+	<-done
+}
+
+/*
+	停止续期并取消倒计时，正常退出时调用
+*/
+func (s *DeadManSwitch) Disarm(ctx context.Context) error {
+	s.Stop()
+	_, err := s.arm(ctx, 0)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.stats.Armed = false
+	s.stats.TriggerTime = time.Time{}
+	s.lock.Unlock()
+	return nil
+}
+
+/*
+	获取保活状态
+*/
+func (s *DeadManSwitch) Stats() DeadManStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	st := s.stats
+	// 倒计时已结束
+	if st.Armed && !st.TriggerTime.IsZero() && time.Now().After(st.TriggerTime) {
+		st.Armed = false
+	}
+	return st
+}
+
+func (s *DeadManSwitch) loop(quit, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(s.conf.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			if !s.healthy() {
+				s.lock.Lock()
+				s.stats.Skipped++
+				s.lock.Unlock()
+				log.Println("连接异常，停止续期倒计时全部撤单！")
+				continue
+			}
+			s.rearm()
+		}
+	}
+}
+
+/*
+	连接存活、心跳正常且最近收到过消息
+*/
+func (s *DeadManSwitch) healthy() bool {
+	if !s.cli.isRunning() {
+		return false
+	}
+	if s.cli.GetConnStats().ConsecutiveFailures > 0 {
+		return false
+	}
+	if s.conf.MaxMsgAge > 0 && s.cli.metrics.idle(time.Now()) > s.conf.MaxMsgAge {
+		return false
+	}
+	return true
+}
+
+func (s *DeadManSwitch) rearm() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.conf.Interval)
+	defer cancel()
+
+	tm, err := s.arm(ctx, s.conf.TimeOut)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err != nil {
+		s.stats.Failures++
+		log.Println("续期倒计时全部撤单失败！", err)
+		return err
+	}
+	s.stats.Armed = true
+	s.stats.LastArm = time.Now()
+	s.stats.TriggerTime = tm
+	return nil
+}
@@ -0,0 +1,107 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadManSwitch(t *testing.T) {
+	srv := newFakeServer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/private")
+	r.SetDialer(srv.dialer)
+	r.SetHeartbeat(HeartbeatConfig{})
+	assert.Nil(t, r.Start())
+	defer r.Stop()
+
+	var lock sync.Mutex
+	var arms []time.Duration
+	count := func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(arms)
+	}
+	arm := func(ctx context.Context, timeOut time.Duration) (time.Time, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		arms = append(arms, timeOut)
+		if timeOut == 0 {
+			return time.Time{}, nil
+		}
+		return time.Now().Add(timeOut), nil
+	}
+
+	_, err := NewDeadManSwitch(r, nil, DeadManConfig{TimeOut: 10 * time.Second, Interval: time.Second})
+	assert.NotNil(t, err)
+	_, err = NewDeadManSwitch(r, arm, DeadManConfig{TimeOut: 5 * time.Second, Interval: time.Second})
+	assert.NotNil(t, err)
+	_, err = NewDeadManSwitch(r, arm, DeadManConfig{TimeOut: 10 * time.Second, Interval: 10 * time.Second})
+	assert.NotNil(t, err)
+
+	sw, err := NewDeadManSwitch(r, arm, DeadManConfig{TimeOut: 10 * time.Second, Interval: 20 * time.Millisecond})
+	assert.Nil(t, err)
+
+	assert.Nil(t, sw.Start())
+	assert.True(t, sw.Stats().Armed)
+	assert.Eventually(t, func() bool { return count() >= 3 }, time.Second, 5*time.Millisecond)
+
+	// 连接断开后停止续期
+	r.Stop()
+	time.Sleep(30 * time.Millisecond)
+	n := count()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, n, count())
+	st := sw.Stats()
+	assert.True(t, st.Skipped > 0)
+	assert.Equal(t, 0, st.Failures)
+
+	// 取消倒计时
+	assert.Nil(t, sw.Disarm(context.Background()))
+	assert.False(t, sw.Stats().Armed)
+	lock.Lock()
+	assert.Equal(t, time.Duration(0), arms[len(arms)-1])
+	assert.Equal(t, 10*time.Second, arms[0])
+	lock.Unlock()
+}
+
+/*
+	首次设置倒计时失败时 Start 返回错误，之后可以重新启动
+*/
+func TestDeadManSwitchArmFailed(t *testing.T) {
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/private")
+
+	var lock sync.Mutex
+	fail := true
+	arm := func(ctx context.Context, timeOut time.Duration) (time.Time, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if fail {
+			return time.Time{}, errors.New("boom")
+		}
+		return time.Now().Add(timeOut), nil
+	}
+	sw, err := NewDeadManSwitch(r, arm, DeadManConfig{TimeOut: 10 * time.Second, Interval: time.Second})
+	assert.Nil(t, err)
+
+	res := make(chan error, 1)
+	go func() { res <- sw.Start() }()
+	select {
+	case err = <-res:
+		assert.NotNil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Start 未返回")
+	}
+	assert.False(t, sw.Stats().Armed)
+	assert.Equal(t, 1, sw.Stats().Failures)
+
+	lock.Lock()
+	fail = false
+	lock.Unlock()
+	assert.Nil(t, sw.Start())
+	assert.True(t, sw.Stats().Armed)
+	sw.Stop()
+}
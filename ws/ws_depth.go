@@ -0,0 +1,393 @@
+package ws
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+	. "v5sdk_go/ws/wImpl"
+)
+
+// 订单簿状态
+type BookStatus int
+
+const (
+	// 等待全量数据
+	BOOK_STATUS_SYNCING BookStatus = iota
+	// 数据正常
+	BOOK_STATUS_VALID
+	// 数据异常，正在重新订阅
+	BOOK_STATUS_INVALID
+	// 已取消订阅
+	BOOK_STATUS_CLOSED
+)
+
+func (s BookStatus) String() string {
+	switch s {
+	case BOOK_STATUS_SYNCING:
+		return "syncing"
+	case BOOK_STATUS_VALID:
+		return "valid"
+	case BOOK_STATUS_INVALID:
+		return "invalid"
+	case BOOK_STATUS_CLOSED:
+		return "closed"
+	}
+	return ""
+}
+
+// 重新订阅的最大尝试次数
+const RESYNC_MAX_RETRY = 5
+
+/*
+	订单簿状态变化通知
+	Reason: 状态变为 BOOK_STATUS_INVALID 的原因
+	ResyncCount: 该产品累计重新订阅的次数
+*/
+type BookStatusEvent struct {
+	Timestamp   time.Time
+	Channel     string
+	InstId      string
+	Status      BookStatus
+	Reason      error
+	ResyncCount int
+}
+
+// 订单簿状态变化回调函数
+type BookStatusCallback func(BookStatusEvent)
+
+/*
+	tbt深度数据序号不连续通知
+	ExpectedPrevSeqId: 期望的 prevSeqId，即上一次推送的 seqId
+*/
+type SeqGapEvent struct {
+	Timestamp         time.Time
+	Channel           string
+	InstId            string
+	ExpectedPrevSeqId int64
+	PrevSeqId         int64
+	SeqId             int64
+	GapCount          int
+}
+
+// 深度数据序号不连续回调函数
+type SeqGapCallback func(SeqGapEvent)
+
+type bookState struct {
+	status  BookStatus
+	resyncs int
+	gaps    int
+}
+
+func bookKey(channel, instId string) string {
+	return channel + ":" + instId
+}
+
+/*
+	设置是否自动深度管理，开启 true，关闭 false
+*/
+func (a *WsClient) EnableAutoDepthMgr(b bool) error {
+	a.bookLock.Lock()
+	defer a.bookLock.Unlock()
+
+	if len(a.books) != 0 {
+		err := errors.New("当前有深度数据处于订阅中")
+		return err
+	}
+
+	a.autoDepthMgr = b
+	return nil
+}
+
+/*
+	添加订单簿状态变化的回调函数
+	订单簿校验失败或缺少全量数据时会通知 BOOK_STATUS_INVALID，重新同步完成后通知 BOOK_STATUS_VALID
+*/
+func (a *WsClient) AddBookStatusHook(fn BookStatusCallback) error {
+	a.onBookStatusHook = fn
+	return nil
+}
+
+/*
+	添加深度数据序号不连续的回调函数，发现序号不连续后会自动重新订阅
+*/
+func (a *WsClient) AddSeqGapHook(fn SeqGapCallback) error {
+	a.onSeqGapHook = fn
+	return nil
+}
+
+/*
+	获取本地订单簿，未订阅或未开启深度数据管理时返回 nil
+	channel: books / books5 / books-l2-tbt / books50-l2-tbt
+*/
+func (a *WsClient) GetOrderBook(channel, instId string) *OrderBook {
+	a.bookLock.RLock()
+	defer a.bookLock.RUnlock()
+	return a.books[bookKey(channel, instId)]
+}
+
+/*
+	获取订单簿状态
+*/
+func (a *WsClient) GetBookStatus(channel, instId string) (status BookStatus, ok bool) {
+	a.bookLock.RLock()
+	defer a.bookLock.RUnlock()
+	st, ok := a.bookStates[bookKey(channel, instId)]
+	if !ok {
+		return
+	}
+	return st.status, true
+}
+
+/*
+	获取各产品重新订阅的次数，key 为 channel:instId
+*/
+func (a *WsClient) GetResyncStats() map[string]int {
+	a.bookLock.RLock()
+	defer a.bookLock.RUnlock()
+	res := make(map[string]int, len(a.bookStates))
+	for k, v := range a.bookStates {
+		res[k] = v.resyncs
+	}
+	return res
+}
+
+/*
+	获取各产品序号不连续的次数，key 为 channel:instId
+*/
+func (a *WsClient) GetSeqGapStats() map[string]int {
+	a.bookLock.RLock()
+	defer a.bookLock.RUnlock()
+	res := make(map[string]int, len(a.bookStates))
+	for k, v := range a.bookStates {
+		res[k] = v.gaps
+	}
+	return res
+}
+
+/*
+	获取当前的深度快照信息(合并后的)
+*/
+func (a *WsClient) GetSnapshotByChannel(data DepthData) (snapshot *DepthDetail, err error) {
+	book := a.GetOrderBook(data.Arg["channel"], data.Arg["instId"])
+	if book == nil {
+		return
+	}
+	if !book.Ready() {
+		err = ErrBookNotReady
+		return
+	}
+	val := book.Snapshot()
+	snapshot = &val
+	return
+}
+
+/*
+	取消订阅深度频道后删除对应的本地订单簿
+*/
+func (a *WsClient) closeOrderBooks(channel string, params []map[string]string) {
+	switch channel {
+	case "books", "books5", "books-l2-tbt", "books50-l2-tbt":
+	default:
+		return
+	}
+
+	a.bookLock.Lock()
+	defer a.bookLock.Unlock()
+	for _, p := range params {
+		key := bookKey(channel, p["instId"])
+		delete(a.books, key)
+		if st, ok := a.bookStates[key]; ok {
+			st.status = BOOK_STATUS_CLOSED
+		}
+	}
+}
+
+/*
+	连接断开后本地订单簿不再可靠，标记为失效并删除，重新订阅收到全量数据后恢复
+*/
+func (a *WsClient) invalidateBooks(reason error) {
+	evts := []BookStatusEvent{}
+	a.bookLock.Lock()
+	for key, st := range a.bookStates {
+		if st.status == BOOK_STATUS_INVALID || st.status == BOOK_STATUS_CLOSED {
+			continue
+		}
+		st.status = BOOK_STATUS_INVALID
+		delete(a.books, key)
+		ks := strings.SplitN(key, ":", 2)
+		evts = append(evts, BookStatusEvent{
+			Timestamp:   time.Now(),
+			Channel:     ks[0],
+			InstId:      ks[1],
+			Status:      BOOK_STATUS_INVALID,
+			Reason:      reason,
+			ResyncCount: st.resyncs,
+		})
+	}
+	a.bookLock.Unlock()
+
+	for _, evt := range evts {
+		a.notifyBookStatus(evt)
+	}
+}
+
+func (a *WsClient) notifyBookStatus(evt BookStatusEvent) {
+	fn := a.onBookStatusHook
+	if fn != nil {
+		fn(evt)
+	}
+}
+
+/*
+	开启了深度数据管理功能后，系统会自动合并深度信息
+	校验失败或缺少全量数据时，自动重新订阅该产品的深度频道
+*/
+func (a *WsClient) MergeDepth(depData DepthData) (err error) {
+	if !a.autoDepthMgr {
+		return
+	}
+
+	if len(depData.Data) != 1 {
+		err = errors.New("深度数据错误！")
+		return
+	}
+
+	channel, instId := depData.Arg["channel"], depData.Arg["instId"]
+	key := bookKey(channel, instId)
+	isSnapshot := channel == "books5" || depData.Action == DEPTH_SNAPSHOT
+
+	a.bookLock.Lock()
+	st, ok := a.bookStates[key]
+	if !ok {
+		st = &bookState{status: BOOK_STATUS_SYNCING}
+		a.bookStates[key] = st
+	}
+	// 等待重新订阅后的全量数据，忽略期间的增量数据
+	if (st.status == BOOK_STATUS_INVALID || st.status == BOOK_STATUS_CLOSED) && !isSnapshot {
+		a.bookLock.Unlock()
+		err = ErrBookNotReady
+		return
+	}
+	if st.status == BOOK_STATUS_CLOSED {
+		st.status = BOOK_STATUS_SYNCING
+	}
+	book, ok := a.books[key]
+	if !ok {
+		book = NewOrderBook(channel, instId)
+		a.books[key] = book
+	}
+	a.bookLock.Unlock()
+
+	err = book.Apply(depData.Action, depData.Data[0])
+	if err != nil {
+		log.Println("深度数据合并失败！", key, err)
+		var gap *SeqGapError
+		if errors.As(err, &gap) {
+			a.notifySeqGap(channel, instId, gap)
+		}
+		a.resyncBook(channel, instId, err)
+		return
+	}
+
+	a.bookLock.Lock()
+	changed := st.status != BOOK_STATUS_VALID
+	st.status = BOOK_STATUS_VALID
+	cnt := st.resyncs
+	a.bookLock.Unlock()
+
+	if changed {
+		a.notifyBookStatus(BookStatusEvent{
+			Timestamp:   time.Now(),
+			Channel:     channel,
+			InstId:      instId,
+			Status:      BOOK_STATUS_VALID,
+			ResyncCount: cnt,
+		})
+	}
+	return
+}
+
+func (a *WsClient) notifySeqGap(channel, instId string, gap *SeqGapError) {
+	a.bookLock.Lock()
+	cnt := 0
+	if st, ok := a.bookStates[bookKey(channel, instId)]; ok {
+		st.gaps++
+		cnt = st.gaps
+	}
+	a.bookLock.Unlock()
+
+	fn := a.onSeqGapHook
+	if fn != nil {
+		fn(SeqGapEvent{
+			Timestamp:         time.Now(),
+			Channel:           channel,
+			InstId:            instId,
+			ExpectedPrevSeqId: gap.Expected,
+			PrevSeqId:         gap.PrevSeqId,
+			SeqId:             gap.SeqId,
+			GapCount:          cnt,
+		})
+	}
+}
+
+/*
+	标记订单簿失效并重新订阅，获取新的全量数据
+*/
+func (a *WsClient) resyncBook(channel, instId string, reason error) {
+	key := bookKey(channel, instId)
+
+	a.bookLock.Lock()
+	st, ok := a.bookStates[key]
+	if !ok {
+		st = &bookState{}
+		a.bookStates[key] = st
+	}
+	if st.status == BOOK_STATUS_INVALID {
+		a.bookLock.Unlock()
+		return
+	}
+	st.status = BOOK_STATUS_INVALID
+	st.resyncs++
+	cnt := st.resyncs
+	a.bookLock.Unlock()
+
+	log.Println("深度数据异常，重新订阅", key, reason)
+	a.notifyBookStatus(BookStatusEvent{
+		Timestamp:   time.Now(),
+		Channel:     channel,
+		InstId:      instId,
+		Status:      BOOK_STATUS_INVALID,
+		Reason:      reason,
+		ResyncCount: cnt,
+	})
+
+	go a.resubscribeBook(channel, instId)
+}
+
+func (a *WsClient) resubscribeBook(channel, instId string) {
+	evtId := GetEventId(channel)
+	params := []map[string]string{{"instId": instId}}
+
+	for i := 0; i < RESYNC_MAX_RETRY; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(i) * 500 * time.Millisecond)
+		}
+
+		status, _ := a.GetBookStatus(channel, instId)
+		if !a.isRunning() || status != BOOK_STATUS_INVALID {
+			return
+		}
+
+		// 退订失败时仍然尝试重新订阅
+		res, _, err := a.pubChannel(evtId, OP_UNSUBSCRIBE, params, PERIOD_NONE)
+		if !res {
+			log.Println("重新同步深度数据，取消订阅失败！", channel, instId, err)
+		}
+		res, _, err = a.pubChannel(evtId, OP_SUBSCRIBE, params, PERIOD_NONE)
+		if res {
+			return
+		}
+		log.Println("重新同步深度数据，订阅失败！", channel, instId, err)
+	}
+}
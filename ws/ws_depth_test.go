@@ -0,0 +1,108 @@
+package ws
+
+import (
+	"testing"
+	. "v5sdk_go/ws/wImpl"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func depthMsg(action string, asks, bids [][]string, checksum int32) DepthData {
+	return DepthData{
+		Arg:    map[string]string{"channel": "books", "instId": "BTC-USDT"},
+		Action: action,
+		Data:   []DepthDetail{{Asks: asks, Bids: bids, Checksum: checksum}},
+	}
+}
+
+func TestMergeDepthResync(t *testing.T) {
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+
+	var events []BookStatusEvent
+	r.AddBookStatusHook(func(evt BookStatusEvent) {
+		events = append(events, evt)
+	})
+
+	asks := [][]string{{"101", "1", "0", "1"}}
+	bids := [][]string{{"100", "1", "0", "1"}}
+	_, cs := CalCrc32(asks, bids)
+
+	// 缺少全量数据
+	err := r.MergeDepth(depthMsg(DEPTH_UPDATE, asks, bids, cs))
+	assert.Equal(t, ErrBookNotReady, err)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, BOOK_STATUS_INVALID, events[0].Status)
+	assert.Equal(t, 1, events[0].ResyncCount)
+
+	// 全量数据到达后恢复
+	err = r.MergeDepth(depthMsg(DEPTH_SNAPSHOT, asks, bids, cs))
+	assert.Nil(t, err)
+	assert.Equal(t, BOOK_STATUS_VALID, events[1].Status)
+	status, _ := r.GetBookStatus("books", "BTC-USDT")
+	assert.Equal(t, BOOK_STATUS_VALID, status)
+
+	// 校验失败
+	err = r.MergeDepth(depthMsg(DEPTH_UPDATE, [][]string{{"102", "1", "0", "1"}}, nil, cs))
+	assert.Equal(t, ErrChecksum, err)
+	assert.Equal(t, BOOK_STATUS_INVALID, events[2].Status)
+	assert.Equal(t, ErrChecksum, events[2].Reason)
+
+	// 等待重新同步期间的增量数据被忽略，不会重复触发
+	err = r.MergeDepth(depthMsg(DEPTH_UPDATE, asks, bids, cs))
+	assert.Equal(t, ErrBookNotReady, err)
+	assert.Equal(t, 3, len(events))
+	assert.Equal(t, 2, r.GetResyncStats()["books:BTC-USDT"])
+
+	err = r.MergeDepth(depthMsg(DEPTH_SNAPSHOT, asks, bids, cs))
+	assert.Nil(t, err)
+	snap, err := r.GetSnapshotByChannel(depthMsg(DEPTH_SNAPSHOT, nil, nil, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, asks, snap.Asks)
+
+	// 取消订阅后删除订单簿
+	r.closeOrderBooks("books", []map[string]string{{"instId": "BTC-USDT"}})
+	assert.Nil(t, r.GetOrderBook("books", "BTC-USDT"))
+	err = r.MergeDepth(depthMsg(DEPTH_UPDATE, asks, bids, cs))
+	assert.Equal(t, ErrBookNotReady, err)
+	assert.Equal(t, 2, r.GetResyncStats()["books:BTC-USDT"])
+}
+
+func TestMergeDepthSeqGap(t *testing.T) {
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+
+	var gaps []SeqGapEvent
+	r.AddSeqGapHook(func(evt SeqGapEvent) {
+		gaps = append(gaps, evt)
+	})
+	r.EnableAutoDepthMgr(true)
+
+	asks := [][]string{{"101", "1", "0", "1"}}
+	bids := [][]string{{"100", "1", "0", "1"}}
+	_, cs := CalCrc32(asks, bids)
+	seqMsg := func(action string, prevSeqId, seqId int64) DepthData {
+		d := depthMsg(action, asks, bids, cs)
+		d.Arg["channel"] = "books-l2-tbt"
+		d.Data[0].PrevSeqId = prevSeqId
+		d.Data[0].SeqId = seqId
+		return d
+	}
+
+	assert.Nil(t, r.MergeDepth(seqMsg(DEPTH_SNAPSHOT, -1, 100)))
+	assert.Nil(t, r.MergeDepth(seqMsg(DEPTH_UPDATE, 100, 101)))
+
+	// 丢失一条推送
+	err := r.MergeDepth(seqMsg(DEPTH_UPDATE, 102, 103))
+	assert.IsType(t, &SeqGapError{}, err)
+	assert.Equal(t, 1, len(gaps))
+	assert.Equal(t, int64(101), gaps[0].ExpectedPrevSeqId)
+	assert.Equal(t, int64(102), gaps[0].PrevSeqId)
+	assert.Equal(t, 1, r.GetSeqGapStats()["books-l2-tbt:BTC-USDT"])
+
+	status, _ := r.GetBookStatus("books-l2-tbt", "BTC-USDT")
+	assert.Equal(t, BOOK_STATUS_INVALID, status)
+	assert.Equal(t, 1, r.GetResyncStats()["books-l2-tbt:BTC-USDT"])
+
+	// 重新订阅后的全量数据
+	assert.Nil(t, r.MergeDepth(seqMsg(DEPTH_SNAPSHOT, -1, 200)))
+	assert.Nil(t, r.MergeDepth(seqMsg(DEPTH_UPDATE, 200, 201)))
+}
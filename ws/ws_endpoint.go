@@ -0,0 +1,313 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	. "v5sdk_go/ws/wImpl"
+)
+
+/*
+	各类频道的连接地址
+*/
+type Endpoints struct {
+	Public   string
+	Private  string
+	Business string
+}
+
+/*
+	根据服务地址生成连接地址
+	例如:
+	eps := NewEndpoints("wss://ws.okex.com:8443")
+	eps := NewEndpoints("wss://wspap.okex.com:8443", "brokerId=9999")
+*/
+func NewEndpoints(host string, query ...string) Endpoints {
+	host = strings.TrimRight(host, "/")
+	suffix := ""
+	if len(query) != 0 && query[0] != "" {
+		suffix = "?" + query[0]
+	}
+	return Endpoints{
+		Public:   host + "/ws/v5/public" + suffix,
+		Private:  host + "/ws/v5/private" + suffix,
+		Business: host + "/ws/v5/business" + suffix,
+	}
+}
+
+func (e Endpoints) get(ep Endpoint) string {
+	switch ep {
+	case ENDPOINT_PUBLIC:
+		return e.Public
+	case ENDPOINT_PRIVATE:
+		return e.Private
+	case ENDPOINT_BUSINESS:
+		return e.Business
+	}
+	return ""
+}
+
+/*
+	根据连接地址判断地址类型，无法识别时返回 ENDPOINT_NONE
+*/
+func EndpointOf(raw string) Endpoint {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ENDPOINT_NONE
+	}
+	switch strings.TrimRight(u.Path, "/") {
+	case "/ws/v5/public":
+		return ENDPOINT_PUBLIC
+	case "/ws/v5/private":
+		return ENDPOINT_PRIVATE
+	case "/ws/v5/business":
+		return ENDPOINT_BUSINESS
+	}
+	return ENDPOINT_NONE
+}
+
+/*
+	检查频道是否由当前连接地址提供
+*/
+func checkEndpoint(wsEndPoint string, evtId Event) error {
+	cur, want := EndpointOf(wsEndPoint), evtId.Endpoint()
+	if cur == ENDPOINT_NONE || want == ENDPOINT_NONE || cur == want {
+		return nil
+	}
+	return errors.New("频道" + evtId.String() + "需连接 " + want.String() + " 地址，当前为 " + cur.String())
+}
+
+/*
+	组合客户端，按频道自动选择 public / private / business 连接
+	连接在首次使用时建立，需要登录的连接自动登录
+	所有连接共用同一组回调函数和同一个 Router
+*/
+type CombinedClient struct {
+	endpoints Endpoints
+	clients   map[Endpoint]*WsClient
+	lock      sync.Mutex
+	// 各地址建立连接时持有的锁，同一地址同时只建立一个连接，不同地址互不阻塞
+	dialing map[Endpoint]*sync.Mutex
+	// 每次 Stop 加一，Stop 之前开始建立的连接不再保存
+	gen int
+
+	router        *Router
+	dialer        Dialer
+	dailTimeout   time.Duration
+	onBookMsgHook ReceivedMsgDataCallback
+	onDepthHook   ReceivedDepthDataCallback
+	onErrorHook   ReceivedDataCallback
+
+	// 私有频道推送数据回调函数
+	onAccountHook   ReceivedAccountDataCallback
+	onPositionHook  ReceivedPositionDataCallback
+	onOrderHook     ReceivedOrderDataCallback
+	onAlgoOrderHook ReceivedAlgoOrderDataCallback
+	onBalAndPosHook ReceivedBalAndPosDataCallback
+
+	// 登录信息
+	apiKey, secKey, passPhrase string
+}
+
+func NewCombinedClient(eps Endpoints) *CombinedClient {
+	return &CombinedClient{
+		endpoints:   eps,
+		clients:     make(map[Endpoint]*WsClient),
+		dialing:     make(map[Endpoint]*sync.Mutex),
+		router:      NewRouter(),
+		dialer:      &GorillaDialer{},
+		dailTimeout: time.Second * 5,
+	}
+}
+
+// 设置建立连接的方式，需在建立连接之前调用
+func (c *CombinedClient) SetDialer(d Dialer) {
+	c.dialer = d
+}
+
+// 设置dial超时时间
+func (c *CombinedClient) SetDailTimeout(tm time.Duration) {
+	c.dailTimeout = tm
+}
+
+// 设置登录信息，private 连接及 business 连接建立后自动登录
+func (c *CombinedClient) SetLogin(apiKey, secKey, passPhrase string) {
+	c.apiKey = apiKey
+	c.secKey = secKey
+	c.passPhrase = passPhrase
+}
+
+// 获取推送消息路由，所有连接共用
+func (c *CombinedClient) Router() *Router {
+	return c.router
+}
+
+func (c *CombinedClient) AddBookMsgHook(fn ReceivedMsgDataCallback) error {
+	c.onBookMsgHook = fn
+	return nil
+}
+
+func (c *CombinedClient) AddDepthHook(fn ReceivedDepthDataCallback) error {
+	c.onDepthHook = fn
+	return nil
+}
+
+func (c *CombinedClient) AddErrMsgHook(fn ReceivedDataCallback) error {
+	c.onErrorHook = fn
+	return nil
+}
+
+func (c *CombinedClient) AddAccountHook(fn ReceivedAccountDataCallback) error {
+	c.onAccountHook = fn
+	return nil
+}
+
+func (c *CombinedClient) AddPositionHook(fn ReceivedPositionDataCallback) error {
+	c.onPositionHook = fn
+	return nil
+}
+
+func (c *CombinedClient) AddOrderHook(fn ReceivedOrderDataCallback) error {
+	c.onOrderHook = fn
+	return nil
+}
+
+func (c *CombinedClient) AddAlgoOrderHook(fn ReceivedAlgoOrderDataCallback) error {
+	c.onAlgoOrderHook = fn
+	return nil
+}
+
+func (c *CombinedClient) AddBalAndPosHook(fn ReceivedBalAndPosDataCallback) error {
+	c.onBalAndPosHook = fn
+	return nil
+}
+
+/*
+	获取已建立的连接，同时返回该地址建立连接时使用的锁
+*/
+func (c *CombinedClient) cached(ep Endpoint) (cli *WsClient, dial *sync.Mutex, gen int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if cli = c.clients[ep]; cli != nil && cli.isRunning() {
+		return
+	}
+	dial = c.dialing[ep]
+	if dial == nil {
+		dial = &sync.Mutex{}
+		c.dialing[ep] = dial
+	}
+	return nil, dial, c.gen
+}
+
+/*
+	获取对应地址的连接，尚未建立时建立连接
+	建立连接和登录时不持有 c.lock，同时请求同一地址的调用等待同一次连接的结果
+*/
+func (c *CombinedClient) Client(ep Endpoint) (cli *WsClient, err error) {
+	cli, dial, _ := c.cached(ep)
+	if cli != nil {
+		return
+	}
+	dial.Lock()
+	defer dial.Unlock()
+
+	// 等待期间其他调用可能已建立连接
+	cli, _, gen := c.cached(ep)
+	if cli != nil {
+		return
+	}
+
+	addr := c.endpoints.get(ep)
+	if addr == "" {
+		err = errors.New("未设置 " + ep.String() + " 连接地址")
+		return
+	}
+	cli, err = NewWsClient(addr)
+	if err != nil {
+		return
+	}
+	cli.SetDialer(c.dialer)
+	cli.SetDailTimeout(c.dailTimeout)
+	cli.router = c.router
+	cli.AddBookMsgHook(c.onBookMsgHook)
+	cli.AddDepthHook(c.onDepthHook)
+	cli.AddErrMsgHook(c.onErrorHook)
+	cli.AddAccountHook(c.onAccountHook)
+	cli.AddPositionHook(c.onPositionHook)
+	cli.AddOrderHook(c.onOrderHook)
+	cli.AddAlgoOrderHook(c.onAlgoOrderHook)
+	cli.AddBalAndPosHook(c.onBalAndPosHook)
+
+	err = cli.Start()
+	if err != nil {
+		return
+	}
+
+	// public 连接不需要登录
+	if ep != ENDPOINT_PUBLIC && c.apiKey != "" {
+		var res bool
+		res, _, err = cli.Login(c.apiKey, c.secKey, c.passPhrase)
+		if !res {
+			cli.Stop()
+			if err == nil {
+				err = errors.New("登录失败")
+			}
+			return
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if gen != c.gen {
+		cli.Stop()
+		return nil, errors.New("连接已关闭")
+	}
+	c.clients[ep] = cli
+	return
+}
+
+/*
+	订阅或取消订阅频道，根据频道自动选择连接
+	例如:
+	cli.PubChannel(EVENT_BOOK_KLINE, OP_SUBSCRIBE, []map[string]string{{"instId": "BTC-USDT"}}, PERIOD_1MIN)
+*/
+func (c *CombinedClient) PubChannel(evtId Event, op string, params []map[string]string, pd Period, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return c.PubChannelCtx(ctx, evtId, op, params, pd)
+}
+
+func (c *CombinedClient) PubChannelCtx(ctx context.Context, evtId Event, op string, params []map[string]string, pd Period) (res bool, msg []*Msg, err error) {
+	ep := evtId.Endpoint()
+	if ep == ENDPOINT_NONE {
+		err = errors.New("参数校验失败!未知的类型:" + evtId.String())
+		return
+	}
+	if evtId.NeedLogin() && c.apiKey == "" {
+		err = errors.New("频道" + evtId.String() + "需要登录")
+		return
+	}
+
+	cli, err := c.Client(ep)
+	if err != nil {
+		return
+	}
+	return cli.PubChannelCtx(ctx, evtId, op, params, pd)
+}
+
+/*
+	关闭所有连接
+*/
+func (c *CombinedClient) Stop() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for ep, cli := range c.clients {
+		cli.Stop()
+		delete(c.clients, ep)
+	}
+	c.gen++
+	return nil
+}
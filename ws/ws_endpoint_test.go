@@ -0,0 +1,132 @@
+package ws
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+	. "v5sdk_go/ws/wImpl"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointOf(t *testing.T) {
+	eps := NewEndpoints("wss://ws.okex.com:8443/", "brokerId=9999")
+	assert.Equal(t, "wss://ws.okex.com:8443/ws/v5/business?brokerId=9999", eps.Business)
+	assert.Equal(t, ENDPOINT_PUBLIC, EndpointOf(eps.Public))
+	assert.Equal(t, ENDPOINT_PRIVATE, EndpointOf(eps.Private))
+	assert.Equal(t, ENDPOINT_BUSINESS, EndpointOf(eps.Business))
+	assert.Equal(t, ENDPOINT_NONE, EndpointOf("wss://127.0.0.1:8443/"))
+
+	assert.Equal(t, ENDPOINT_BUSINESS, EVENT_BOOK_KLINE.Endpoint())
+	assert.True(t, EVENT_BOOK_ALGO_ADVANCE.NeedLogin())
+	assert.False(t, EVENT_BOOK_TRADES_ALL.NeedLogin())
+
+	assert.NotNil(t, checkEndpoint(eps.Public, EVENT_BOOK_KLINE))
+	assert.Nil(t, checkEndpoint(eps.Business, EVENT_BOOK_KLINE))
+	assert.Nil(t, checkEndpoint(eps.Public, EVENT_BOOK_TICKERS))
+	// 无法识别的地址不做检查
+	assert.Nil(t, checkEndpoint("wss://127.0.0.1:8443/", EVENT_BOOK_KLINE))
+}
+
+/*
+	记录连接地址
+*/
+type urlDialer struct {
+	Dialer
+	lock sync.Mutex
+	urls []string
+}
+
+func (d *urlDialer) Dial(ctx context.Context, url string) (Conn, error) {
+	d.lock.Lock()
+	d.urls = append(d.urls, url)
+	d.lock.Unlock()
+	return d.Dialer.Dial(ctx, url)
+}
+
+func TestCombinedClient(t *testing.T) {
+	srv := newFakeServer()
+	d := &urlDialer{Dialer: srv.dialer}
+	eps := NewEndpoints("wss://ws.okex.com:8443")
+
+	cli := NewCombinedClient(eps)
+	cli.SetDialer(d)
+	defer cli.Stop()
+
+	args := []map[string]string{{"instId": "BTC-USDT"}}
+	res, _, err := cli.PubChannel(EVENT_BOOK_KLINE, OP_SUBSCRIBE, args, PERIOD_1MIN)
+	assert.True(t, res, err)
+	res, _, err = cli.PubChannel(EVENT_BOOK_TICKERS, OP_SUBSCRIBE, args, PERIOD_NONE)
+	assert.True(t, res, err)
+	res, _, err = cli.PubChannel(EVENT_BOOK_TRADES_ALL, OP_SUBSCRIBE, args, PERIOD_NONE)
+	assert.True(t, res, err)
+
+	// 同一地址只建立一次连接
+	assert.Equal(t, []string{eps.Business, eps.Public}, d.urls)
+
+	// 私有频道需要登录信息
+	res, _, err = cli.PubChannel(EVENT_BOOK_ALGO_ADVANCE, OP_SUBSCRIBE, args, PERIOD_NONE)
+	assert.False(t, res)
+	assert.NotNil(t, err)
+}
+
+/*
+	public 地址的连接在 gate 关闭前阻塞
+*/
+type gateDialer struct {
+	urlDialer
+	started chan struct{}
+	gate    chan struct{}
+}
+
+func (d *gateDialer) Dial(ctx context.Context, url string) (Conn, error) {
+	if EndpointOf(url) == ENDPOINT_PUBLIC {
+		d.started <- struct{}{}
+		<-d.gate
+	}
+	return d.urlDialer.Dial(ctx, url)
+}
+
+func TestCombinedClientDial(t *testing.T) {
+	srv := newFakeServer()
+	d := &gateDialer{urlDialer: urlDialer{Dialer: srv.dialer}, started: make(chan struct{}, 2), gate: make(chan struct{})}
+	eps := NewEndpoints("wss://ws.okex.com:8443")
+
+	cli := NewCombinedClient(eps)
+	cli.SetDialer(d)
+	defer cli.Stop()
+
+	var wg sync.WaitGroup
+	pubs := make([]*WsClient, 2)
+	for i := range pubs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			pubs[i], err = cli.Client(ENDPOINT_PUBLIC)
+			assert.Nil(t, err)
+		}(i)
+	}
+
+	// public 连接阻塞时，business 连接不受影响
+	<-d.started
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := cli.Client(ENDPOINT_BUSINESS)
+		assert.Nil(t, err)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("business 连接被 public 连接阻塞")
+	}
+
+	// 同时请求同一地址只建立一次连接
+	close(d.gate)
+	wg.Wait()
+	assert.NotNil(t, pubs[0])
+	assert.Equal(t, pubs[0], pubs[1])
+	assert.Equal(t, []string{eps.Business, eps.Public}, d.urls)
+}
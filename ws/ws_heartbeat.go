@@ -0,0 +1,298 @@
+package ws
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	心跳配置
+	Interval: 连接空闲超过该时间后发送ping，为0时不发送心跳
+	Timeout: 等待pong的超时时间
+	MaxFailures: 连续失败达到该次数后断开连接
+*/
+type HeartbeatConfig struct {
+	Interval    time.Duration
+	Timeout     time.Duration
+	MaxFailures int
+}
+
+// 心跳连续失败达到上限时的断开原因
+var ErrHeartbeatFailed = errors.New("心跳检测失败")
+
+// 默认心跳配置
+var DEFAULT_HEARTBEAT = HeartbeatConfig{
+	Interval:    time.Second * 10,
+	Timeout:     time.Second,
+	MaxFailures: 1,
+}
+
+// 保留最近的RTT样本数
+const RTT_WINDOW = 100
+
+// RTT分布区间上限
+var RTT_BUCKETS = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+/*
+	RTT分布区间
+	Le: 区间上限，最后一个区间为0表示无上限
+*/
+type RTTBucket struct {
+	Le    time.Duration
+	Count int
+}
+
+/*
+	最近 RTT_WINDOW 次心跳的往返时间统计
+*/
+type RTTStats struct {
+	Samples int
+	Last    time.Duration
+	Min     time.Duration
+	Max     time.Duration
+	Mean    time.Duration
+	P50     time.Duration
+	P90     time.Duration
+	P99     time.Duration
+	Buckets []RTTBucket
+}
+
+/*
+	连接质量统计
+	LastMsgTime: 最近一次收到消息的时间
+	LastMsgAge: 距最近一次收到消息的时长
+	MaxMsgGap: 相邻两条消息的最大间隔
+	PingSent/PingFailed: 发送的心跳数/失败的心跳数
+	ConsecutiveFailures: 当前连续失败的心跳数
+*/
+type ConnStats struct {
+	RTT                 RTTStats
+	LastMsgTime         time.Time
+	LastMsgAge          time.Duration
+	MaxMsgGap           time.Duration
+	PingSent            uint64
+	PingFailed          uint64
+	ConsecutiveFailures int
+}
+
+type connMetrics struct {
+	// 原子操作的字段放在结构体开头，保证64位对齐
+	start      int64 // 连接建立时间，unix纳秒
+	lastRecv   int64 // unix纳秒
+	maxGap     int64
+	pingSent   uint64
+	pingFailed uint64
+	pinging    int32
+
+	lock     sync.Mutex
+	rtts     []time.Duration
+	next     int
+	failures int
+}
+
+/*
+	收到消息时更新
+*/
+func (m *connMetrics) onMessage(ts time.Time) {
+	now := ts.UnixNano()
+	last := atomic.SwapInt64(&m.lastRecv, now)
+	if last == 0 {
+		return
+	}
+	gap := now - last
+	for {
+		max := atomic.LoadInt64(&m.maxGap)
+		if gap <= max || atomic.CompareAndSwapInt64(&m.maxGap, max, gap) {
+			return
+		}
+	}
+}
+
+/*
+	建立新连接时调用，空闲时长和连续失败次数按连接计算
+*/
+func (m *connMetrics) reset(ts time.Time) {
+	atomic.StoreInt64(&m.start, ts.UnixNano())
+	atomic.StoreInt64(&m.lastRecv, 0)
+	m.lock.Lock()
+	m.failures = 0
+	m.lock.Unlock()
+}
+
+/*
+	连接空闲时长，尚未收到消息时从连接建立开始计算
+*/
+func (m *connMetrics) idle(now time.Time) time.Duration {
+	last := atomic.LoadInt64(&m.lastRecv)
+	if last == 0 {
+		last = atomic.LoadInt64(&m.start)
+	}
+	return now.Sub(time.Unix(0, last))
+}
+
+func (m *connMetrics) addRTT(rtt time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.failures = 0
+	if len(m.rtts) < RTT_WINDOW {
+		m.rtts = append(m.rtts, rtt)
+	} else {
+		m.rtts[m.next] = rtt
+	}
+	m.next = (m.next + 1) % RTT_WINDOW
+}
+
+// 返回当前连续失败次数
+func (m *connMetrics) addFailure() int {
+	atomic.AddUint64(&m.pingFailed, 1)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.failures++
+	return m.failures
+}
+
+func (m *connMetrics) stats() ConnStats {
+	res := ConnStats{
+		MaxMsgGap:  time.Duration(atomic.LoadInt64(&m.maxGap)),
+		PingSent:   atomic.LoadUint64(&m.pingSent),
+		PingFailed: atomic.LoadUint64(&m.pingFailed),
+	}
+	if last := atomic.LoadInt64(&m.lastRecv); last != 0 {
+		res.LastMsgTime = time.Unix(0, last)
+		res.LastMsgAge = time.Since(res.LastMsgTime)
+	}
+
+	m.lock.Lock()
+	res.ConsecutiveFailures = m.failures
+	samples := make([]time.Duration, len(m.rtts))
+	copy(samples, m.rtts)
+	if len(m.rtts) != 0 {
+		res.RTT.Last = m.rtts[(m.next+len(m.rtts)-1)%len(m.rtts)]
+	}
+	m.lock.Unlock()
+
+	res.RTT.Samples = len(samples)
+	res.RTT.Buckets = make([]RTTBucket, len(RTT_BUCKETS)+1)
+	for i, le := range RTT_BUCKETS {
+		res.RTT.Buckets[i].Le = le
+	}
+	if len(samples) == 0 {
+		return res
+	}
+
+	var sum time.Duration
+	for _, v := range samples {
+		sum += v
+		i := sort.Search(len(RTT_BUCKETS), func(i int) bool { return v <= RTT_BUCKETS[i] })
+		res.RTT.Buckets[i].Count++
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	pct := func(p int) time.Duration {
+		return samples[(len(samples)-1)*p/100]
+	}
+	res.RTT.Min = samples[0]
+	res.RTT.Max = samples[len(samples)-1]
+	res.RTT.Mean = sum / time.Duration(len(samples))
+	res.RTT.P50 = pct(50)
+	res.RTT.P90 = pct(90)
+	res.RTT.P99 = pct(99)
+	return res
+}
+
+/*
+	设置心跳，需在 Start 之前调用
+	例如:
+	cli.SetHeartbeat(HeartbeatConfig{Interval: 20 * time.Second, Timeout: 2 * time.Second, MaxFailures: 3})
+*/
+func (a *WsClient) SetHeartbeat(cfg HeartbeatConfig) error {
+	if cfg.Interval < 0 || cfg.Timeout < 0 {
+		return errors.New("心跳参数错误")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DEFAULT_HEARTBEAT.Timeout
+	}
+	if cfg.MaxFailures < 1 {
+		cfg.MaxFailures = 1
+	}
+	a.hbConf = cfg
+	return nil
+}
+
+/*
+	获取连接质量统计
+*/
+func (a *WsClient) GetConnStats() ConnStats {
+	return a.metrics.stats()
+}
+
+/*
+	心跳检查周期
+*/
+func (a *WsClient) heartbeatTick() time.Duration {
+	tick := a.hbConf.Interval / 2
+	if tick < 10*time.Millisecond {
+		tick = 10 * time.Millisecond
+	}
+	return tick
+}
+
+/*
+	连接空闲时发送心跳，连续失败达到上限后断开连接
+	quit: 连接的退出信号，连接断开后不再发送心跳也不再计入失败
+*/
+func (a *WsClient) heartbeat(conn Conn, quit <-chan struct{}, now time.Time) {
+	// 关闭过程中不再发送心跳
+	if a.isClosing() || isDone(quit) {
+		return
+	}
+	if a.metrics.idle(now) < a.hbConf.Interval {
+		return
+	}
+	// 上一次心跳尚未完成
+	if !atomic.CompareAndSwapInt32(&a.metrics.pinging, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&a.metrics.pinging, 0)
+
+		atomic.AddUint64(&a.metrics.pingSent, 1)
+		res, detail, err := a.Ping(int(a.hbConf.Timeout / time.Millisecond))
+		if res {
+			a.metrics.addRTT(detail.UsedTime)
+			return
+		}
+
+		// 等待期间连接已断开，失败不是心跳超时导致的
+		if isDone(quit) {
+			return
+		}
+		n := a.metrics.addFailure()
+		log.Println("心跳检测失败！", n, err)
+		if n >= a.hbConf.MaxFailures {
+			a.stopConn(conn, ErrHeartbeatFailed)
+		}
+	}()
+}
+
+func isDone(quit <-chan struct{}) bool {
+	select {
+	case <-quit:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,127 @@
+package ws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnMetrics(t *testing.T) {
+	m := &connMetrics{}
+	base := time.Now()
+	m.onMessage(base)
+	m.onMessage(base.Add(300 * time.Millisecond))
+	m.onMessage(base.Add(400 * time.Millisecond))
+	assert.Equal(t, 100*time.Millisecond, m.idle(base.Add(500*time.Millisecond)))
+
+	for i := 1; i <= RTT_WINDOW+10; i++ {
+		m.addRTT(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, 1, m.addFailure())
+
+	st := m.stats()
+	assert.Equal(t, 300*time.Millisecond, st.MaxMsgGap)
+	assert.Equal(t, RTT_WINDOW, st.RTT.Samples)
+	assert.Equal(t, 110*time.Millisecond, st.RTT.Last)
+	assert.Equal(t, 11*time.Millisecond, st.RTT.Min)
+	assert.Equal(t, 110*time.Millisecond, st.RTT.Max)
+	assert.Equal(t, 1, st.ConsecutiveFailures)
+
+	total := 0
+	for _, b := range st.RTT.Buckets {
+		total += b.Count
+	}
+	assert.Equal(t, RTT_WINDOW, total)
+	// 11ms ~ 25ms
+	assert.Equal(t, 15, st.RTT.Buckets[2].Count)
+
+	// 新连接重新计算空闲时长和连续失败次数
+	m.reset(base.Add(time.Second))
+	assert.Equal(t, 100*time.Millisecond, m.idle(base.Add(1100*time.Millisecond)))
+	st = m.stats()
+	assert.Equal(t, 0, st.ConsecutiveFailures)
+	assert.Equal(t, RTT_WINDOW, st.RTT.Samples)
+}
+
+/*
+	只在连接空闲时发送心跳，连续失败达到上限后断开
+*/
+func TestHeartbeat(t *testing.T) {
+	d := NewPipeDialer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	r.SetDialer(d)
+	r.SetHeartbeat(HeartbeatConfig{Interval: 50 * time.Millisecond, Timeout: 50 * time.Millisecond, MaxFailures: 2})
+
+	pings := make(chan struct{}, 10)
+	reply := make(chan bool, 1)
+	reply <- true
+	go func() {
+		srv, err := d.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		for {
+			_, data, err := srv.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(data) != "ping" {
+				continue
+			}
+			pings <- struct{}{}
+			select {
+			case <-reply:
+				srv.WriteMessage(websocket.TextMessage, []byte("pong"))
+			default:
+			}
+		}
+	}()
+
+	assert.Nil(t, r.Start())
+	defer r.Stop()
+
+	select {
+	case <-pings:
+	case <-time.After(time.Second):
+		t.Fatal("未发送心跳")
+	}
+	assert.Eventually(t, func() bool {
+		return r.GetConnStats().RTT.Samples == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// 之后的心跳均无响应，连续失败2次后断开
+	select {
+	case <-r.IsQuit():
+	case <-time.After(2 * time.Second):
+		t.Fatal("心跳失败后未断开连接")
+	}
+	st := r.GetConnStats()
+	assert.Equal(t, uint64(2), st.PingFailed)
+	assert.Equal(t, 2, st.ConsecutiveFailures)
+}
+
+/*
+	心跳与用户的 Ping 同时进行时不计为心跳失败
+*/
+func TestHeartbeatConcurrentPing(t *testing.T) {
+	srv := newFakeServer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	r.SetDialer(srv.dialer)
+	r.SetHeartbeat(HeartbeatConfig{Interval: 10 * time.Millisecond, Timeout: time.Second, MaxFailures: 1})
+	assert.Nil(t, r.Start())
+	defer r.Stop()
+
+	// 间隔不同的时长调用 Ping，使部分心跳与之同时发送
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for i := 0; time.Now().Before(deadline); i++ {
+		assert.True(t, r.IsAlive())
+		time.Sleep(time.Duration(i%4) * 4 * time.Millisecond)
+	}
+	st := r.GetConnStats()
+	assert.True(t, st.PingSent > 0)
+	assert.Equal(t, uint64(0), st.PingFailed)
+	assert.True(t, r.isRunning())
+}
@@ -2,41 +2,97 @@ package ws
 
 import (
 	"context"
+	"errors"
 	"log"
+	"strconv"
+	"sync/atomic"
 	"time"
+	"v5sdk_go/trade"
 	. "v5sdk_go/ws/wImpl"
 )
 
+var (
+	jrpcSeq    uint64
+	jrpcPrefix = strconv.FormatInt(time.Now().UnixNano(), 36)
+)
+
+/*
+	生成请求ID，同一进程内唯一
+*/
+func NewRequestId() string {
+	return jrpcPrefix + strconv.FormatUint(atomic.AddUint64(&jrpcSeq, 1), 36)
+}
+
+/*
+	从JRPC响应中取出各订单的处理结果
+*/
+func fillOrders(detail *ProcessDetail, msg []*Msg) {
+	if len(msg) == 0 {
+		return
+	}
+	if rsp, ok := msg[0].Info.(JRPCRsp); ok {
+		detail.Orders = trade.ParseResults(rsp.Data)
+	}
+}
+
+/*
+	设置下单前检查，所有交易请求发送前执行，检查失败时不发送请求，返回 trade.RejectedError 包装的错误
+	例如:
+	cli.SetPreTradeCheck(risk.NewManager(conf))
+*/
+func (a *WsClient) SetPreTradeCheck(check trade.PreTradeCheck) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.preTrade = check
+}
+
 /*
 	websocket交易 通用请求
 	参数说明：
 		evtId：封装的事件类型
-		id: 请求ID
+		id: 请求ID，为空时自动生成，响应按请求ID匹配
 		op: 请求参数op
 		params: 请求参数
 		timeOut: 超时时间
 */
 func (a *WsClient) jrpcReq(evtId Event, op string, id string, params []map[string]interface{}, timeOut ...int) (res bool, detail *ProcessDetail, err error) {
-	res = true
-	tm := 5000
-	if len(timeOut) != 0 {
-		tm = timeOut[0]
-	}
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.jrpcReqCtx(ctx, evtId, op, id, params)
+}
 
+func (a *WsClient) jrpcReqCtx(ctx context.Context, evtId Event, op string, id string, params []map[string]interface{}) (res bool, detail *ProcessDetail, err error) {
+	if id == "" {
+		id = NewRequestId()
+	}
 	req := &JRPCReq{
 		Id:   id,
 		Op:   op,
 		Args: params,
 	}
+	return a.doJrpc(ctx, evtId, req)
+}
 
+func (a *WsClient) doJrpc(ctx context.Context, evtId Event, req *JRPCReq) (res bool, detail *ProcessDetail, err error) {
+	res = true
 	detail = &ProcessDetail{
 		EndPoint: a.WsEndPoint,
+		ReqId:    req.Id,
 	}
 
-	ctx := context.Background()
-	ctx, cancel := context.WithTimeout(ctx, time.Duration(tm)*time.Millisecond)
-	defer cancel()
-	ctx = context.WithValue(ctx, "detail", detail)
+	ctx = context.WithValue(ctx, detailKey, detail)
+
+	a.lock.RLock()
+	check := a.preTrade
+	a.lock.RUnlock()
+	if check != nil {
+		if err = check.CheckOrders(ctx, trade.SingleOp(req.Op), req.Args); err != nil {
+			err = trade.Rejected(err)
+			res = false
+			log.Println("下单前检查未通过!", req, err)
+			return
+		}
+	}
 
 	msg, err := a.process(ctx, evtId, req)
 	if err != nil {
@@ -45,6 +101,7 @@ func (a *WsClient) jrpcReq(evtId Event, op string, id string, params []map[strin
 		return
 	}
 	detail.Data = msg
+	fillOrders(detail, msg)
 
 	res, err = checkResult(req, msg)
 	if err != nil {
@@ -58,44 +115,62 @@ func (a *WsClient) jrpcReq(evtId Event, op string, id string, params []map[strin
 /*
 	单个下单
 	参数说明：
-		id: 请求ID
+		id: 请求ID，为空时自动生成，响应按请求ID匹配
 		params: 请求参数
 		timeOut: 超时时间
 */
 func (a *WsClient) PlaceOrder(id string, param map[string]interface{}, timeOut ...int) (res bool, detail *ProcessDetail, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PlaceOrderCtx(ctx, id, param)
+}
+
+func (a *WsClient) PlaceOrderCtx(ctx context.Context, id string, param map[string]interface{}) (res bool, detail *ProcessDetail, err error) {
 	op := "order"
 	evtId := EVENT_PLACE_ORDER
 
 	var args []map[string]interface{}
 	args = append(args, param)
 
-	return a.jrpcReq(evtId, op, id, args, timeOut...)
+	return a.jrpcReqCtx(ctx, evtId, op, id, args)
 
 }
 
 /*
 	批量下单
 	参数说明：
-		id: 请求ID
+		id: 请求ID，为空时自动生成，响应按请求ID匹配
 		params: 请求参数
 		timeOut: 超时时间
 */
 func (a *WsClient) BatchPlaceOrders(id string, params []map[string]interface{}, timeOut ...int) (res bool, detail *ProcessDetail, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.BatchPlaceOrdersCtx(ctx, id, params)
+}
+
+func (a *WsClient) BatchPlaceOrdersCtx(ctx context.Context, id string, params []map[string]interface{}) (res bool, detail *ProcessDetail, err error) {
 
 	op := "batch-orders"
 	evtId := EVENT_PLACE_BATCH_ORDERS
-	return a.jrpcReq(evtId, op, id, params, timeOut...)
+	return a.jrpcReqCtx(ctx, evtId, op, id, params)
 
 }
 
 /*
 	单个撤单
 	参数说明：
-		id: 请求ID
+		id: 请求ID，为空时自动生成，响应按请求ID匹配
 		params: 请求参数
 		timeOut: 超时时间
 */
 func (a *WsClient) CancelOrder(id string, param map[string]interface{}, timeOut ...int) (res bool, detail *ProcessDetail, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.CancelOrderCtx(ctx, id, param)
+}
+
+func (a *WsClient) CancelOrderCtx(ctx context.Context, id string, param map[string]interface{}) (res bool, detail *ProcessDetail, err error) {
 
 	op := "cancel-order"
 	evtId := EVENT_CANCEL_ORDER
@@ -103,33 +178,45 @@ func (a *WsClient) CancelOrder(id string, param map[string]interface{}, timeOut
 	var args []map[string]interface{}
 	args = append(args, param)
 
-	return a.jrpcReq(evtId, op, id, args, timeOut...)
+	return a.jrpcReqCtx(ctx, evtId, op, id, args)
 
 }
 
 /*
 	批量撤单
 	参数说明：
-		id: 请求ID
+		id: 请求ID，为空时自动生成，响应按请求ID匹配
 		params: 请求参数
 		timeOut: 超时时间
 */
 func (a *WsClient) BatchCancelOrders(id string, params []map[string]interface{}, timeOut ...int) (res bool, detail *ProcessDetail, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.BatchCancelOrdersCtx(ctx, id, params)
+}
+
+func (a *WsClient) BatchCancelOrdersCtx(ctx context.Context, id string, params []map[string]interface{}) (res bool, detail *ProcessDetail, err error) {
 
 	op := "batch-cancel-orders"
 	evtId := EVENT_CANCEL_BATCH_ORDERS
-	return a.jrpcReq(evtId, op, id, params, timeOut...)
+	return a.jrpcReqCtx(ctx, evtId, op, id, params)
 
 }
 
 /*
 	单个改单
 	参数说明：
-		id: 请求ID
+		id: 请求ID，为空时自动生成，响应按请求ID匹配
 		params: 请求参数
 		timeOut: 超时时间
 */
 func (a *WsClient) AmendOrder(id string, param map[string]interface{}, timeOut ...int) (res bool, detail *ProcessDetail, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.AmendOrderCtx(ctx, id, param)
+}
+
+func (a *WsClient) AmendOrderCtx(ctx context.Context, id string, param map[string]interface{}) (res bool, detail *ProcessDetail, err error) {
 
 	op := "amend-order"
 	evtId := EVENT_AMEND_ORDER
@@ -137,21 +224,114 @@ func (a *WsClient) AmendOrder(id string, param map[string]interface{}, timeOut .
 	var args []map[string]interface{}
 	args = append(args, param)
 
-	return a.jrpcReq(evtId, op, id, args, timeOut...)
+	return a.jrpcReqCtx(ctx, evtId, op, id, args)
 
 }
 
 /*
 	批量改单
 	参数说明：
-		id: 请求ID
+		id: 请求ID，为空时自动生成，响应按请求ID匹配
 		params: 请求参数
 		timeOut: 超时时间
 */
 func (a *WsClient) BatchAmendOrders(id string, params []map[string]interface{}, timeOut ...int) (res bool, detail *ProcessDetail, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.BatchAmendOrdersCtx(ctx, id, params)
+}
+
+func (a *WsClient) BatchAmendOrdersCtx(ctx context.Context, id string, params []map[string]interface{}) (res bool, detail *ProcessDetail, err error) {
 
 	op := "batch-amend-orders"
 	evtId := EVENT_AMEND_BATCH_ORDERS
-	return a.jrpcReq(evtId, op, id, params, timeOut...)
+	return a.jrpcReqCtx(ctx, evtId, op, id, params)
+
+}
+
+/*
+	使用类型化参数的交易请求，参数在本地校验后发送
+*/
+func (a *WsClient) orderReqCtx(ctx context.Context, evtId Event, op string, id string, orders []trade.Order) (res bool, detail *ProcessDetail, err error) {
+	if id == "" {
+		id = NewRequestId()
+	}
+	req, err := trade.NewJRPCReq(id, op, orders...)
+	if err != nil {
+		err = trade.Rejected(err)
+		return
+	}
+	return a.doJrpc(ctx, evtId, &req)
+}
 
+/*
+	下单，多个订单时批量下单，最多 trade.BATCH_MAX 个
+	参数说明：
+		id: 请求ID，为空时自动生成，响应按请求ID匹配
+		orders: 下单参数
+	各订单的处理结果见 detail.Orders
+	例如:
+	cli.PlaceOrdersCtx(ctx, "", trade.PlaceOrderReq{InstId: "BTC-USDT", TdMode: trade.TD_MODE_CASH, Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_LIMIT, Px: "10000", Sz: "0.01"})
+*/
+func (a *WsClient) PlaceOrdersCtx(ctx context.Context, id string, orders ...trade.PlaceOrderReq) (res bool, detail *ProcessDetail, err error) {
+	if len(orders) > 1 {
+		return a.orderReqCtx(ctx, EVENT_PLACE_BATCH_ORDERS, trade.OP_BATCH_ORDERS, id, trade.PlaceOrders(orders))
+	}
+	return a.orderReqCtx(ctx, EVENT_PLACE_ORDER, trade.OP_ORDER, id, trade.PlaceOrders(orders))
+}
+
+/*
+	撤单，多个订单时批量撤单，最多 trade.BATCH_MAX 个
+	参数说明：
+		id: 请求ID，为空时自动生成，响应按请求ID匹配
+		orders: 撤单参数
+*/
+func (a *WsClient) CancelOrdersCtx(ctx context.Context, id string, orders ...trade.CancelOrderReq) (res bool, detail *ProcessDetail, err error) {
+	if len(orders) > 1 {
+		return a.orderReqCtx(ctx, EVENT_CANCEL_BATCH_ORDERS, trade.OP_BATCH_CANCEL_ORDERS, id, trade.CancelOrders(orders))
+	}
+	return a.orderReqCtx(ctx, EVENT_CANCEL_ORDER, trade.OP_CANCEL_ORDER, id, trade.CancelOrders(orders))
+}
+
+/*
+	改单，多个订单时批量改单，最多 trade.BATCH_MAX 个
+	参数说明：
+		id: 请求ID，为空时自动生成，响应按请求ID匹配
+		orders: 改单参数
+*/
+func (a *WsClient) AmendOrdersCtx(ctx context.Context, id string, orders ...trade.AmendOrderReq) (res bool, detail *ProcessDetail, err error) {
+	if len(orders) > 1 {
+		return a.orderReqCtx(ctx, EVENT_AMEND_BATCH_ORDERS, trade.OP_BATCH_AMEND_ORDERS, id, trade.AmendOrders(orders))
+	}
+	return a.orderReqCtx(ctx, EVENT_AMEND_ORDER, trade.OP_AMEND_ORDER, id, trade.AmendOrders(orders))
+}
+
+/*
+	批量撤销某一产品类型、交易品种下的所有挂单
+	参数说明：
+		id: 请求ID，为空时自动生成
+		instType: 产品类型，如 OPTION
+		instFamily: 交易品种，如 BTC-USD
+*/
+func (a *WsClient) MassCancelCtx(ctx context.Context, id string, instType, instFamily string) (res bool, detail *ProcessDetail, err error) {
+	if instType == "" || instFamily == "" {
+		err = errors.New("instType和instFamily不能为空")
+		return
+	}
+
+	args := []map[string]interface{}{{"instType": instType, "instFamily": instFamily}}
+	res, detail, err = a.jrpcReqCtx(ctx, EVENT_MASS_CANCEL, trade.OP_MASS_CANCEL, id, args)
+	if detail != nil {
+		// 响应中没有订单结果
+		detail.Orders = nil
+	}
+	if !res {
+		return
+	}
+
+	rsp := detail.Data[0].Info.(JRPCRsp)
+	if ok, _ := rsp.Data[0]["result"].(bool); !ok {
+		res = false
+	}
+	return
 }
@@ -1,10 +1,18 @@
 package ws
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
+	"v5sdk_go/trade"
 	. "v5sdk_go/ws/wImpl"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
 )
 
 func PrintDetail(d *ProcessDetail) {
@@ -184,3 +192,288 @@ func TestAmendlOrder(t *testing.T) {
 		t.Fatal("修改订单失败！")
 	}
 }
+
+/*
+	响应按请求ID匹配，后发的请求先响应
+*/
+func TestJrpcCorrelation(t *testing.T) {
+	d := NewPipeDialer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/private")
+	r.SetDialer(d)
+	r.SetHeartbeat(HeartbeatConfig{})
+
+	go func() {
+		srv, err := d.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		var reqs []JRPCReq
+		for len(reqs) < 2 {
+			_, data, err := srv.ReadMessage()
+			if err != nil {
+				return
+			}
+			var req JRPCReq
+			json.Unmarshal(data, &req)
+			reqs = append(reqs, req)
+		}
+		for i := len(reqs) - 1; i >= 0; i-- {
+			rsp := JRPCRsp{Id: reqs[i].Id, Op: reqs[i].Op, Code: "0"}
+			for _, arg := range reqs[i].Args {
+				rsp.Data = append(rsp.Data, map[string]interface{}{"clOrdId": arg["clOrdId"], "ordId": "1", "sCode": "0", "sMsg": ""})
+			}
+			raw, _ := json.Marshal(rsp)
+			srv.WriteMessage(websocket.TextMessage, raw)
+		}
+	}()
+	assert.Nil(t, r.Start())
+	defer r.Stop()
+
+	var single, batch *ProcessDetail
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		res, detail, err := r.PlaceOrder("", map[string]interface{}{"clOrdId": "a1"})
+		assert.True(t, res, err)
+		single = detail
+	}()
+	go func() {
+		defer wg.Done()
+		res, detail, err := r.BatchPlaceOrders("batch01", []map[string]interface{}{{"clOrdId": "b1"}, {"clOrdId": "b2"}})
+		assert.True(t, res, err)
+		batch = detail
+	}()
+	wg.Wait()
+
+	assert.NotEqual(t, "", single.ReqId)
+	assert.Equal(t, 1, len(single.Orders))
+	assert.Equal(t, "a1", single.Orders[0].ClOrdId)
+	assert.True(t, single.Orders[0].Success())
+
+	assert.Equal(t, "batch01", batch.ReqId)
+	assert.Equal(t, 2, len(batch.Orders))
+	assert.Equal(t, "b1", batch.Orders[0].ClOrdId)
+	assert.Equal(t, "b2", batch.Orders[1].ClOrdId)
+}
+
+func TestNewRequestId(t *testing.T) {
+	ids := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		id := NewRequestId()
+		assert.True(t, len(id) <= 32)
+		ids[id] = true
+	}
+	assert.Equal(t, 1000, len(ids))
+}
+
+func TestTypedOrders(t *testing.T) {
+	d := NewPipeDialer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/private")
+	r.SetDialer(d)
+	r.SetHeartbeat(HeartbeatConfig{})
+
+	reqs := make(chan JRPCReq, 1)
+	go func() {
+		srv, err := d.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		for {
+			_, data, err := srv.ReadMessage()
+			if err != nil {
+				return
+			}
+			var req JRPCReq
+			json.Unmarshal(data, &req)
+			reqs <- req
+			rsp := JRPCRsp{Id: req.Id, Op: req.Op, Code: "0"}
+			for range req.Args {
+				rsp.Data = append(rsp.Data, map[string]interface{}{"ordId": "1", "sCode": "0", "sMsg": ""})
+			}
+			raw, _ := json.Marshal(rsp)
+			srv.WriteMessage(websocket.TextMessage, raw)
+		}
+	}()
+	assert.Nil(t, r.Start())
+	defer r.Stop()
+
+	ctx := context.Background()
+	o := trade.PlaceOrderReq{InstId: "BTC-USDT", TdMode: trade.TD_MODE_CASH, Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_LIMIT, Px: "1", Sz: "1", ExpTime: time.Unix(1700000000, 0)}
+	res, detail, err := r.PlaceOrdersCtx(ctx, "", o, o)
+	assert.True(t, res, err)
+	assert.Equal(t, 2, len(detail.Orders))
+	req := <-reqs
+	assert.Equal(t, trade.OP_BATCH_ORDERS, req.Op)
+	assert.Equal(t, "1700000000000", req.ExpTime)
+	assert.Equal(t, "limit", req.Args[0]["ordType"])
+
+	res, _, err = r.CancelOrdersCtx(ctx, "c1", trade.CancelOrderReq{InstId: "BTC-USDT", OrdId: "1"})
+	assert.True(t, res, err)
+	req = <-reqs
+	assert.Equal(t, trade.OP_CANCEL_ORDER, req.Op)
+	assert.Equal(t, "", req.ExpTime)
+
+	// 参数错误时不发送请求
+	o.OrdType = "ordtype"
+	res, _, err = r.PlaceOrdersCtx(ctx, "", o)
+	assert.False(t, res)
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(reqs))
+}
+
+func TestMassCancel(t *testing.T) {
+	d := NewPipeDialer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/private")
+	r.SetDialer(d)
+	r.SetHeartbeat(HeartbeatConfig{})
+
+	go func() {
+		srv, err := d.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		for {
+			_, data, err := srv.ReadMessage()
+			if err != nil {
+				return
+			}
+			var req JRPCReq
+			json.Unmarshal(data, &req)
+			// 只撤销期权
+			ok := req.Args[0]["instType"] == "OPTION"
+			raw, _ := json.Marshal(JRPCRsp{Id: req.Id, Op: req.Op, Code: "0", Data: []map[string]interface{}{{"result": ok}}})
+			srv.WriteMessage(websocket.TextMessage, raw)
+		}
+	}()
+	assert.Nil(t, r.Start())
+	defer r.Stop()
+
+	res, detail, err := r.MassCancelCtx(context.Background(), "", "OPTION", "BTC-USD")
+	assert.True(t, res, err)
+	assert.Nil(t, detail.Orders)
+
+	res, _, _ = r.MassCancelCtx(context.Background(), "", "SWAP", "BTC-USD")
+	assert.False(t, res)
+
+	_, _, err = r.MassCancelCtx(context.Background(), "", "OPTION", "")
+	assert.NotNil(t, err)
+}
+
+func TestChunkedOrders(t *testing.T) {
+	d := NewPipeDialer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/private")
+	r.SetDialer(d)
+	r.SetHeartbeat(HeartbeatConfig{})
+	assert.NotNil(t, r.SetOrderRateLimit(0, time.Second))
+
+	sizes := make(chan int, 10)
+	go func() {
+		srv, err := d.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		for {
+			_, data, err := srv.ReadMessage()
+			if err != nil {
+				return
+			}
+			var req JRPCReq
+			json.Unmarshal(data, &req)
+			sizes <- len(req.Args)
+			rsp := JRPCRsp{Id: req.Id, Op: req.Op, Code: "0"}
+			for _, arg := range req.Args {
+				rsp.Data = append(rsp.Data, map[string]interface{}{"ordId": "1", "clOrdId": arg["clOrdId"], "sCode": "0", "sMsg": ""})
+			}
+			raw, _ := json.Marshal(rsp)
+			srv.WriteMessage(websocket.TextMessage, raw)
+		}
+	}()
+	assert.Nil(t, r.Start())
+	defer r.Stop()
+
+	o := trade.PlaceOrderReq{InstId: "BTC-USDT", TdMode: trade.TD_MODE_CASH, Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_LIMIT, Px: "1", Sz: "1"}
+	var orders []trade.PlaceOrderReq
+	for i := 0; i < 45; i++ {
+		orders = append(orders, o)
+	}
+	res, err := r.PlaceOrdersChunkedCtx(context.Background(), trade.BatchOptions{}, orders...)
+	assert.Nil(t, err)
+	assert.Equal(t, 45, len(res))
+	assert.Equal(t, 0, len(res.Failed()))
+	for k, v := range res {
+		assert.Equal(t, k, v.ClOrdId)
+	}
+	close(sizes)
+	var total int
+	for n := range sizes {
+		assert.True(t, n <= trade.BATCH_MAX)
+		total += n
+	}
+	assert.Equal(t, 45, total)
+
+	// 参数错误时不发送请求
+	orders[44].Sz = "0"
+	_, err = r.PlaceOrdersChunkedCtx(context.Background(), trade.BatchOptions{}, orders...)
+	assert.NotNil(t, err)
+}
+
+func TestPreTradeCheck(t *testing.T) {
+	d := NewPipeDialer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/private")
+	r.SetDialer(d)
+	r.SetHeartbeat(HeartbeatConfig{})
+
+	reqs := make(chan JRPCReq, 10)
+	go func() {
+		srv, err := d.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		for {
+			_, data, err := srv.ReadMessage()
+			if err != nil {
+				return
+			}
+			var req JRPCReq
+			json.Unmarshal(data, &req)
+			reqs <- req
+			rsp := JRPCRsp{Id: req.Id, Op: req.Op, Code: "0"}
+			for range req.Args {
+				rsp.Data = append(rsp.Data, map[string]interface{}{"ordId": "1", "sCode": "0", "sMsg": ""})
+			}
+			raw, _ := json.Marshal(rsp)
+			srv.WriteMessage(websocket.TextMessage, raw)
+		}
+	}()
+	assert.Nil(t, r.Start())
+	defer r.Stop()
+
+	rejected := errors.New("rejected")
+	var ops []string
+	r.SetPreTradeCheck(trade.PreTradeCheckFunc(func(ctx context.Context, op string, args []map[string]interface{}) error {
+		ops = append(ops, op)
+		if args[0]["instId"] == "ETH-USDT" {
+			return rejected
+		}
+		return nil
+	}))
+
+	ctx := context.Background()
+	o := trade.PlaceOrderReq{InstId: "ETH-USDT", TdMode: trade.TD_MODE_CASH, Side: trade.SIDE_BUY, OrdType: trade.ORD_TYPE_LIMIT, Px: "1", Sz: "1"}
+	res, _, err := r.PlaceOrdersCtx(ctx, "", o, o)
+	assert.False(t, res)
+	assert.True(t, errors.Is(err, rejected) && trade.IsRejected(err))
+	// 原始参数的请求同样检查
+	_, _, err = r.PlaceOrderCtx(ctx, "", o.ToMap())
+	assert.True(t, errors.Is(err, rejected) && trade.IsRejected(err))
+	assert.Equal(t, 0, len(reqs))
+
+	o.InstId = "BTC-USDT"
+	res, _, err = r.PlaceOrdersCtx(ctx, "", o)
+	assert.True(t, res, err)
+	res, _, err = r.CancelOrdersCtx(ctx, "", trade.CancelOrderReq{InstId: "BTC-USDT", OrdId: "1"}, trade.CancelOrderReq{InstId: "BTC-USDT", OrdId: "2"})
+	assert.True(t, res, err)
+	assert.Equal(t, 2, len(reqs))
+	assert.Equal(t, []string{trade.OP_ORDER, trade.OP_ORDER, trade.OP_ORDER, trade.OP_CANCEL_ORDER}, ops)
+}
@@ -0,0 +1,245 @@
+package ws
+
+import (
+	"errors"
+	"log"
+	"time"
+	. "v5sdk_go/ws/wImpl"
+)
+
+// 服务端发送关闭帧时的断开原因
+var ErrPeerClosed = errors.New("服务端关闭连接")
+
+/*
+	连接状态变化通知
+	Duration:
+		连接: 建立连接的耗时
+		登录: 登录请求的耗时
+		断开: 连接持续的时间
+		重连: 距连接断开的时间
+		重新订阅: 重新订阅的耗时
+	Attempt: 重连尝试的次数
+	Subscriptions: 重新订阅成功的频道数
+	Err: 失败原因，断开时为断开原因，为 nil 表示主动关闭
+*/
+type ConnEvent struct {
+	Timestamp     time.Time
+	EndPoint      string
+	Duration      time.Duration
+	Attempt       int
+	Subscriptions int
+	Err           error
+}
+
+// 连接状态变化回调函数
+type ConnEventCallback func(ConnEvent)
+
+/*
+	自动重连配置
+	Interval: 首次重连的等待时间，为 0 时不自动重连
+	MaxInterval: 每次失败后等待时间翻倍，最大不超过该值，为 0 时不翻倍
+	MaxRetry: 最大重连次数，为 0 时不限次数
+*/
+type ReconnectConfig struct {
+	Interval    time.Duration
+	MaxInterval time.Duration
+	MaxRetry    int
+}
+
+/*
+	设置自动重连，默认不重连
+	连接异常断开后自动重连，已登录的重新登录，并恢复断开前的订阅
+	主动调用 Stop 或 Shutdown 后不再重连
+	订阅流(StreamXxx)在重连后随订阅一同恢复，停止重连后关闭
+*/
+func (a *WsClient) SetReconnect(conf ReconnectConfig) error {
+	if conf.Interval < 0 || conf.MaxInterval < 0 || conf.MaxRetry < 0 {
+		return errors.New("重连参数错误")
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.reconnConf = conf
+	return nil
+}
+
+/*
+	添加连接建立的回调函数
+*/
+func (a *WsClient) AddConnectHook(fn ConnEventCallback) error {
+	a.onConnectHook = fn
+	return nil
+}
+
+/*
+	添加连接断开的回调函数，Err 为断开原因
+	私有频道数据在断开期间不可靠，可在此撤销挂单等
+*/
+func (a *WsClient) AddDisconnectHook(fn ConnEventCallback) error {
+	a.onDisconnectHook = fn
+	return nil
+}
+
+/*
+	添加登录结果的回调函数，Err 为 nil 表示登录成功
+*/
+func (a *WsClient) AddLoginHook(fn ConnEventCallback) error {
+	a.onLoginHook = fn
+	return nil
+}
+
+/*
+	添加重连尝试的回调函数，每次尝试后调用，Err 为 nil 表示重连成功
+*/
+func (a *WsClient) AddReconnectHook(fn ConnEventCallback) error {
+	a.onReconnectHook = fn
+	return nil
+}
+
+/*
+	添加重连后重新订阅完成的回调函数
+*/
+func (a *WsClient) AddResubscribeHook(fn ConnEventCallback) error {
+	a.onResubscribeHook = fn
+	return nil
+}
+
+func (a *WsClient) fireConnEvent(fn ConnEventCallback, evt ConnEvent) {
+	if fn == nil {
+		return
+	}
+	evt.Timestamp = time.Now()
+	evt.EndPoint = a.WsEndPoint
+	fn(evt)
+}
+
+/*
+	断开后按配置重连，直到成功、达到最大次数或主动关闭
+	lost: 连接断开的时间
+*/
+func (a *WsClient) reconnect(lost time.Time) {
+	a.lock.RLock()
+	conf := a.reconnConf
+	a.lock.RUnlock()
+
+	wait := conf.Interval
+	for attempt := 1; conf.MaxRetry == 0 || attempt <= conf.MaxRetry; attempt++ {
+		time.Sleep(wait)
+		if conf.MaxInterval > 0 {
+			wait *= 2
+			if wait > conf.MaxInterval {
+				wait = conf.MaxInterval
+			}
+		}
+
+		a.lock.RLock()
+		stopped := a.stopped
+		a.lock.RUnlock()
+		if stopped {
+			break
+		}
+
+		err := a.connect()
+		if err == nil {
+			err = a.relogin()
+		}
+		a.fireConnEvent(a.onReconnectHook, ConnEvent{Duration: time.Since(lost), Attempt: attempt, Err: err})
+		if err != nil {
+			log.Println("重连失败！", attempt, err)
+			a.lock.RLock()
+			conn := a.conn
+			a.lock.RUnlock()
+			a.stopConn(conn, err)
+			continue
+		}
+
+		log.Println("重连成功！", attempt)
+		a.resubscribe()
+
+		a.lock.Lock()
+		// 重新订阅期间连接再次断开时继续重连
+		if a.isStarted || a.stopped {
+			a.reconnecting = false
+			a.lock.Unlock()
+			return
+		}
+		a.lock.Unlock()
+	}
+
+	log.Println("停止重连！", a.WsEndPoint)
+	a.lock.Lock()
+	a.reconnecting = false
+	if !a.isStarted {
+		a.finish()
+	}
+	a.lock.Unlock()
+}
+
+/*
+	客户端停止且不再重连的信号，主动关闭、未设置重连时断开或停止重连后关闭
+*/
+func (a *WsClient) stopSignal() <-chan struct{} {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.doneCh
+}
+
+/*
+	关闭停止信号，调用方需持有 a.lock
+*/
+func (a *WsClient) finish() {
+	if !isDone(a.doneCh) {
+		close(a.doneCh)
+	}
+}
+
+/*
+	断开前已登录的重新登录
+*/
+func (a *WsClient) relogin() error {
+	api := a.WsApi
+	if api == nil {
+		return nil
+	}
+	res, _, err := a.Login(api.ApiKey, api.SecretKey, api.Passphrase)
+	if !res && err == nil {
+		err = errors.New("登录失败")
+	}
+	return err
+}
+
+/*
+	恢复断开前的订阅
+*/
+func (a *WsClient) resubscribe() {
+	start := time.Now()
+	a.lock.RLock()
+	groups := a.groupSubs()
+	a.lock.RUnlock()
+
+	cnt := 0
+	var lastErr error
+	for evtId, args := range groups {
+		req := ReqData{
+			Op:   OP_SUBSCRIBE,
+			Args: args,
+		}
+		ctx, cancel := timeoutCtx()
+		msg, err := a.process(ctx, evtId, req)
+		cancel()
+		if err == nil {
+			var res bool
+			res, err = checkResult(req, msg)
+			if res {
+				cnt += len(args)
+			} else if err == nil {
+				err = errors.New("重新订阅失败")
+			}
+		}
+		if err != nil {
+			log.Println("重新订阅失败！", evtId, err)
+			lastErr = err
+		}
+	}
+
+	a.fireConnEvent(a.onResubscribeHook, ConnEvent{Duration: time.Since(start), Subscriptions: cnt, Err: lastErr})
+}
@@ -0,0 +1,102 @@
+package ws
+
+import (
+	"errors"
+	"testing"
+	"time"
+	. "v5sdk_go/ws/wImpl"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycleHooks(t *testing.T) {
+	srv := newFakeServer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	r.SetDialer(srv.dialer)
+	r.SetHeartbeat(HeartbeatConfig{})
+	assert.Nil(t, r.SetReconnect(ReconnectConfig{Interval: 20 * time.Millisecond, MaxRetry: 3}))
+
+	type namedEvent struct {
+		name string
+		ConnEvent
+	}
+	evts := make(chan namedEvent, 16)
+	var last ConnEvent
+	hook := func(name string) ConnEventCallback {
+		return func(e ConnEvent) {
+			evts <- namedEvent{name, e}
+		}
+	}
+	r.AddConnectHook(hook("connect"))
+	r.AddDisconnectHook(hook("disconnect"))
+	r.AddLoginHook(hook("login"))
+	r.AddReconnectHook(hook("reconnect"))
+	r.AddResubscribeHook(hook("resubscribe"))
+
+	next := func() string {
+		select {
+		case e := <-evts:
+			last = e.ConnEvent
+			return e.name
+		case <-time.After(2 * time.Second):
+			return ""
+		}
+	}
+
+	assert.Nil(t, r.Start())
+	assert.Equal(t, "connect", next())
+	assert.Equal(t, r.WsEndPoint, last.EndPoint)
+
+	params := []map[string]string{{"instId": "BTC-USDT"}, {"instId": "ETH-USDT"}}
+	res, _, err := r.PubChannel(EVENT_BOOK_TICKERS, OP_SUBSCRIBE, params, PERIOD_NONE)
+	assert.True(t, res, err)
+
+	// 服务端断开后自动重连并恢复订阅
+	srv.conn(0).Close()
+	assert.Equal(t, "disconnect", next())
+	assert.NotNil(t, last.Err)
+	assert.Equal(t, "connect", next())
+	assert.Equal(t, "reconnect", next())
+	assert.Equal(t, 1, last.Attempt)
+	assert.Nil(t, last.Err)
+	assert.Equal(t, "resubscribe", next())
+	assert.Equal(t, 2, last.Subscriptions)
+	assert.Nil(t, last.Err)
+	assert.True(t, r.isRunning())
+
+	// 登录失败
+	res, _, _ = r.Login("key", "secret", "pass")
+	assert.False(t, res)
+	assert.Equal(t, "login", next())
+	assert.NotNil(t, last.Err)
+
+	// 主动关闭后不再重连
+	r.Stop()
+	assert.Equal(t, "disconnect", next())
+	assert.Nil(t, last.Err)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, len(evts))
+	assert.False(t, r.isRunning())
+}
+
+func TestInvalidateBooks(t *testing.T) {
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	key := bookKey("books", "BTC-USDT")
+	r.books[key] = NewOrderBook("books", "BTC-USDT")
+	r.bookStates[key] = &bookState{status: BOOK_STATUS_VALID}
+	r.bookStates[bookKey("books", "ETH-USDT")] = &bookState{status: BOOK_STATUS_CLOSED}
+
+	var got []BookStatusEvent
+	r.AddBookStatusHook(func(e BookStatusEvent) {
+		got = append(got, e)
+	})
+
+	reason := errors.New("断开")
+	r.invalidateBooks(reason)
+	assert.Nil(t, r.GetOrderBook("books", "BTC-USDT"))
+	status, _ := r.GetBookStatus("books", "BTC-USDT")
+	assert.Equal(t, BOOK_STATUS_INVALID, status)
+	assert.Equal(t, 1, len(got))
+	assert.Equal(t, "BTC-USDT", got[0].InstId)
+	assert.Equal(t, reason, got[0].Reason)
+}
@@ -3,8 +3,8 @@ package ws
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
-	"sync"
 	"time"
 	. "v5sdk_go/config"
 	"v5sdk_go/rest"
@@ -13,24 +13,57 @@ import (
 	. "v5sdk_go/ws/wInterface"
 )
 
+// 默认请求超时时间(毫秒)
+const DEFAULT_TIMEOUT = 5000
+
+type ctxKey int
+
+// ProcessDetail 在 context 中的 key
+const detailKey ctxKey = 0
+
 /*
-	Ping服务端保持心跳。
-	timeOut:超时时间(毫秒)，如果不填默认为5000ms
+	根据超时时间(毫秒)创建 context，不填时使用 DEFAULT_TIMEOUT
+	调用方需 defer cancel() 及时释放计时器，不带 ctx 的方法均通过此函数创建超时
 */
-func (a *WsClient) Ping(timeOut ...int) (res bool, detail *ProcessDetail, err error) {
-	tm := 5000
+func timeoutCtx(timeOut ...int) (context.Context, context.CancelFunc) {
+	tm := DEFAULT_TIMEOUT
 	if len(timeOut) != 0 {
 		tm = timeOut[0]
 	}
+	return context.WithTimeout(context.Background(), time.Duration(tm)*time.Millisecond)
+}
+
+/*
+	Ping服务端保持心跳。
+	timeOut:超时时间(毫秒)，如果不填默认为5000ms
+*/
+func (a *WsClient) Ping(timeOut ...int) (res bool, detail *ProcessDetail, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PingCtx(ctx)
+}
+
+/*
+	同一连接同时只发送一个ping，等待其他ping完成的时间也计入 ctx 的超时
+*/
+func (a *WsClient) PingCtx(ctx context.Context) (res bool, detail *ProcessDetail, err error) {
 	res = true
 
 	detail = &ProcessDetail{
 		EndPoint: a.WsEndPoint,
 	}
 
-	ctx := context.Background()
-	ctx, _ = context.WithTimeout(ctx, time.Duration(tm)*time.Millisecond)
-	ctx = context.WithValue(ctx, "detail", detail)
+	// 等待其他 ping 完成，避免 pong 被错误匹配
+	select {
+	case a.pingSem <- struct{}{}:
+		defer func() { <-a.pingSem }()
+	case <-ctx.Done():
+		res = false
+		err = fmt.Errorf("等待其他ping完成超时: %w", ctx.Err())
+		return
+	}
+
+	ctx = context.WithValue(ctx, detailKey, detail)
 	msg, err := a.process(ctx, EVENT_PING, nil)
 	if err != nil {
 		res = false
@@ -57,6 +90,12 @@ func (a *WsClient) Ping(timeOut ...int) (res bool, detail *ProcessDetail, err er
 	登录私有频道
 */
 func (a *WsClient) Login(apiKey, secKey, passPhrase string, timeOut ...int) (res bool, detail *ProcessDetail, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.LoginCtx(ctx, apiKey, secKey, passPhrase)
+}
+
+func (a *WsClient) LoginCtx(ctx context.Context, apiKey, secKey, passPhrase string) (res bool, detail *ProcessDetail, err error) {
 
 	if apiKey == "" {
 		err = errors.New("ApiKey cannot be null")
@@ -79,10 +118,6 @@ func (a *WsClient) Login(apiKey, secKey, passPhrase string, timeOut ...int) (res
 		Passphrase: passPhrase,
 	}
 
-	tm := 5000
-	if len(timeOut) != 0 {
-		tm = timeOut[0]
-	}
 	res = true
 
 	timestamp := EpochTime()
@@ -109,20 +144,20 @@ func (a *WsClient) Login(apiKey, secKey, passPhrase string, timeOut ...int) (res
 		EndPoint: a.WsEndPoint,
 	}
 
-	ctx := context.Background()
-	ctx, _ = context.WithTimeout(ctx, time.Duration(tm)*time.Millisecond)
-	ctx = context.WithValue(ctx, "detail", detail)
+	ctx = context.WithValue(ctx, detailKey, detail)
 
 	msg, err := a.process(ctx, EVENT_LOGIN, req)
 	if err != nil {
 		res = false
 		log.Println("处理请求失败!", req, err)
+		a.fireConnEvent(a.onLoginHook, ConnEvent{Duration: detail.UsedTime, Err: err})
 		return
 	}
 	detail.Data = msg
 
 	if len(msg) == 0 {
 		res = false
+		a.fireConnEvent(a.onLoginHook, ConnEvent{Duration: detail.UsedTime, Err: errors.New("登录失败")})
 		return
 	}
 
@@ -130,9 +165,11 @@ func (a *WsClient) Login(apiKey, secKey, passPhrase string, timeOut ...int) (res
 
 	if info.Code == "0" && info.Event == OP_LOGIN {
 		log.Println("登录成功!")
+		a.fireConnEvent(a.onLoginHook, ConnEvent{Duration: detail.UsedTime})
 	} else {
 		log.Println("登录失败!")
 		res = false
+		a.fireConnEvent(a.onLoginHook, ConnEvent{Duration: detail.UsedTime, Err: errors.New("登录失败:" + info.Code + " " + info.Msg)})
 		return
 	}
 
@@ -140,54 +177,78 @@ func (a *WsClient) Login(apiKey, secKey, passPhrase string, timeOut ...int) (res
 }
 
 /*
-	等待结果响应
+	发送消息到服务端
 */
-func (a *WsClient) waitForResult(e Event, timeOut int) (data interface{}, err error) {
-
-	if _, ok := a.regCh[e]; !ok {
-		a.lock.Lock()
-		a.regCh[e] = make(chan *Msg)
-		a.lock.Unlock()
-		//log.Println("注册", e, "事件成功")
-	}
-
-	a.lock.RLock()
-	defer a.lock.RUnlock()
-	ch := a.regCh[e]
-	//log.Println(e, "等待响应！")
+func (a *WsClient) Send(ctx context.Context, op WSReqData) (err error) {
+	quit := a.IsQuit()
 	select {
-	case <-time.After(time.Duration(timeOut) * time.Millisecond):
-		log.Println(e, "超时未响应！")
-		err = errors.New(e.String() + "超时未响应！")
-		return
-	case data = <-ch:
-		//log.Println(data)
+	case <-ctx.Done():
+		log.Println("发生失败退出！")
+		err = fmt.Errorf("发送超时退出！%w", ctx.Err())
+	case <-quit:
+		err = ErrClientClosed
+	case a.sendCh <- op.ToString():
 	}
 
 	return
 }
 
 /*
-	发送消息到服务端
+	请求响应的等待方
+	done 在等待方退出后关闭，接收协程据此丢弃迟到的响应
 */
-func (a *WsClient) Send(ctx context.Context, op WSReqData) (err error) {
-	select {
-	case <-ctx.Done():
-		log.Println("发生失败退出！")
-		err = errors.New("发送超时退出！")
-	case a.sendCh <- op.ToString():
+type waiter struct {
+	ch   chan *Msg
+	done chan struct{}
+}
+
+/*
+	请求在 regCh 中的 key，JRPC请求按请求ID区分
+*/
+func reqKey(e Event, op WSReqData) string {
+	switch r := op.(type) {
+	case JRPCReq:
+		return jrpcKey(r.Id)
+	case *JRPCReq:
+		return jrpcKey(r.Id)
+	}
+	return e.String()
+}
+
+/*
+	响应在 regCh 中的 key
+*/
+func rspKey(e Event, data interface{}) string {
+	if rsp, ok := data.(JRPCRsp); ok {
+		return jrpcKey(rsp.Id)
 	}
+	return e.String()
+}
 
-	return
+func jrpcKey(id string) string {
+	return "jrpc:" + id
 }
 
+/*
+	发送请求并等待响应，关闭流程开始后不再接受新的请求
+*/
 func (a *WsClient) process(ctx context.Context, e Event, op WSReqData) (data []*Msg, err error) {
-	defer func() {
-		_ = recover()
-	}()
+	a.lock.Lock()
+	if a.closing {
+		a.lock.Unlock()
+		err = ErrClientClosing
+		return
+	}
+	a.reqWg.Add(1)
+	a.lock.Unlock()
+	defer a.reqWg.Done()
 
+	return a.request(ctx, e, op)
+}
+
+func (a *WsClient) request(ctx context.Context, e Event, op WSReqData) (data []*Msg, err error) {
 	var detail *ProcessDetail
-	if val := ctx.Value("detail"); val != nil {
+	if val := ctx.Value(detailKey); val != nil {
 		detail = val.(*ProcessDetail)
 	} else {
 		detail = &ProcessDetail{
@@ -199,92 +260,94 @@ func (a *WsClient) process(ctx context.Context, e Event, op WSReqData) (data []*
 		detail.UsedTime = detail.RecvTime.Sub(detail.SendTime)
 	}()
 
-	//查看事件是否被注册
-	if _, ok := a.regCh[e]; !ok {
-		a.lock.Lock()
-		a.regCh[e] = make(chan *Msg)
+	quit := a.IsQuit()
+
+	//注册事件，同一事件(JRPC为同一请求ID)同时只能有一个请求
+	key := reqKey(e, op)
+	w := &waiter{ch: make(chan *Msg), done: make(chan struct{})}
+	a.lock.Lock()
+	if _, ok := a.regCh[key]; ok {
 		a.lock.Unlock()
-		//log.Println("注册", e, "事件成功")
-	} else {
 		//log.Println("事件", e, "已注册！")
-		err = errors.New("事件" + e.String() + "尚未处理完毕")
+		err = errors.New("事件" + key + "尚未处理完毕")
 		return
 	}
+	a.regCh[key] = w
+	a.lock.Unlock()
 
-	//预期请求响应的条数
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	//预期请求响应的条数，JRPC请求只有一条响应
 	expectCnt := 1
-	if op != nil {
+	if op != nil && op.GetType() != MSG_JRPC {
 		expectCnt = op.Len()
 	}
 	recvCnt := 0
+	// 响应数据由等待协程写入，完成后再返回给调用方
+	var rsp []*Msg
+	var rspErr error
 
 	//等待完成通知
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-	go func(ctx context.Context) {
+	go func() {
 		defer func() {
 			a.lock.Lock()
-			delete(a.regCh, e)
+			delete(a.regCh, key)
 			//log.Println("事件已注销!",e)
 			a.lock.Unlock()
-			wg.Done()
+			close(w.done)
 		}()
 
-		a.lock.RLock()
-		ch := a.regCh[e]
-		a.lock.RUnlock()
-
 		//log.Println(e, "等待响应！")
-		done := false
-		ok := true
 		for {
-			var item *Msg
 			select {
 			case <-ctx.Done():
 				log.Println(e, "超时未响应！")
-				err = errors.New(e.String() + "超时未响应！")
+				rspErr = fmt.Errorf("%s超时未响应！%w", e.String(), ctx.Err())
 				return
-			case item, ok = <-ch:
-				if !ok {
-					return
-				}
+			case <-quit:
+				rspErr = ErrClientClosed
+				return
+			case item := <-w.ch:
 				detail.RecvTime = time.Now()
 				//log.Println(e, "接受到数据", item)
-				data = append(data, item)
+				rsp = append(rsp, item)
 				recvCnt++
-				//log.Println(data)
 				if recvCnt == expectCnt {
-					done = true
-					break
+					return
 				}
 			}
-			if done {
-				break
-			}
-		}
-		if ok {
-			close(ch)
 		}
-
-	}(ctx)
+	}()
 
 	switch e {
 	case EVENT_PING:
 		msg := "ping"
 		detail.ReqInfo = msg
-		a.sendCh <- msg
-		detail.SendTime = time.Now()
+		select {
+		case a.sendCh <- msg:
+		case <-quit:
+			err = ErrClientClosed
+		case <-ctx.Done():
+			err = fmt.Errorf("发送超时退出！%w", ctx.Err())
+		}
 	default:
 		detail.ReqInfo = op.ToString()
 		err = a.Send(ctx, op)
 		if err != nil {
 			log.Println("发送[", e, "]消息失败！", err)
-			return
 		}
-		detail.SendTime = time.Now()
 	}
+	if err != nil {
+		cancel()
+		<-w.done
+		return
+	}
+	detail.SendTime = time.Now()
 
-	wg.Wait()
+	<-w.done
+	data = rsp
+	err = rspErr
 	return
 }
 
@@ -308,12 +371,13 @@ func GetEventByParam(param map[string]string) (evtId Event) {
 	req：请求json字符串
 */
 func (a *WsClient) Subscribe(param map[string]string, timeOut ...int) (res bool, detail *ProcessDetail, err error) {
-	res = true
-	tm := 5000
-	if len(timeOut) != 0 {
-		tm = timeOut[0]
-	}
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.SubscribeCtx(ctx, param)
+}
 
+func (a *WsClient) SubscribeCtx(ctx context.Context, param map[string]string) (res bool, detail *ProcessDetail, err error) {
+	res = true
 	evtid := GetEventByParam(param)
 	if evtid == EVENT_UNKNOWN {
 		err = errors.New("非法的请求参数！")
@@ -332,9 +396,7 @@ func (a *WsClient) Subscribe(param map[string]string, timeOut ...int) (res bool,
 		EndPoint: a.WsEndPoint,
 	}
 
-	ctx := context.Background()
-	ctx, _ = context.WithTimeout(ctx, time.Duration(tm)*time.Millisecond)
-	ctx = context.WithValue(ctx, "detail", detail)
+	ctx = context.WithValue(ctx, detailKey, detail)
 
 	msg, err := a.process(ctx, evtid, req)
 	if err != nil {
@@ -350,6 +412,7 @@ func (a *WsClient) Subscribe(param map[string]string, timeOut ...int) (res bool,
 		res = false
 		return
 	}
+	a.trackSubs(req)
 
 	return
 }
@@ -359,12 +422,13 @@ func (a *WsClient) Subscribe(param map[string]string, timeOut ...int) (res bool,
 	req：请求json字符串
 */
 func (a *WsClient) UnSubscribe(param map[string]string, timeOut ...int) (res bool, detail *ProcessDetail, err error) {
-	res = true
-	tm := 5000
-	if len(timeOut) != 0 {
-		tm = timeOut[0]
-	}
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.UnSubscribeCtx(ctx, param)
+}
 
+func (a *WsClient) UnSubscribeCtx(ctx context.Context, param map[string]string) (res bool, detail *ProcessDetail, err error) {
+	res = true
 	evtid := GetEventByParam(param)
 	if evtid == EVENT_UNKNOWN {
 		err = errors.New("非法的请求参数！")
@@ -383,9 +447,7 @@ func (a *WsClient) UnSubscribe(param map[string]string, timeOut ...int) (res boo
 		EndPoint: a.WsEndPoint,
 	}
 
-	ctx := context.Background()
-	ctx, _ = context.WithTimeout(ctx, time.Duration(tm)*time.Millisecond)
-	ctx = context.WithValue(ctx, "detail", detail)
+	ctx = context.WithValue(ctx, detailKey, detail)
 	msg, err := a.process(ctx, evtid, req)
 	if err != nil {
 		res = false
@@ -400,24 +462,34 @@ func (a *WsClient) UnSubscribe(param map[string]string, timeOut ...int) (res boo
 		return
 	}
 
+	if res {
+		a.trackSubs(req)
+		a.closeOrderBooks(param["channel"], args)
+	}
+
 	return
 }
 
 /*
 	jrpc请求
+	id 为空时自动生成，响应按 id 匹配
 */
 func (a *WsClient) Jrpc(id, op string, params []map[string]interface{}, timeOut ...int) (res bool, detail *ProcessDetail, err error) {
-	res = true
-	tm := 5000
-	if len(timeOut) != 0 {
-		tm = timeOut[0]
-	}
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.JrpcCtx(ctx, id, op, params)
+}
 
+func (a *WsClient) JrpcCtx(ctx context.Context, id, op string, params []map[string]interface{}) (res bool, detail *ProcessDetail, err error) {
+	res = true
 	evtid := GetEventId(op)
 	if evtid == EVENT_UNKNOWN {
 		err = errors.New("非法的请求参数！")
 		return
 	}
+	if id == "" {
+		id = NewRequestId()
+	}
 
 	req := JRPCReq{
 		Id:   id,
@@ -426,11 +498,10 @@ func (a *WsClient) Jrpc(id, op string, params []map[string]interface{}, timeOut
 	}
 	detail = &ProcessDetail{
 		EndPoint: a.WsEndPoint,
+		ReqId:    id,
 	}
 
-	ctx := context.Background()
-	ctx, _ = context.WithTimeout(ctx, time.Duration(tm)*time.Millisecond)
-	ctx = context.WithValue(ctx, "detail", detail)
+	ctx = context.WithValue(ctx, detailKey, detail)
 	msg, err := a.process(ctx, evtid, req)
 	if err != nil {
 		res = false
@@ -438,6 +509,7 @@ func (a *WsClient) Jrpc(id, op string, params []map[string]interface{}, timeOut
 		return
 	}
 	detail.Data = msg
+	fillOrders(detail, msg)
 
 	//检查所有频道是否都更新成功
 	res, err = checkResult(req, msg)
@@ -450,26 +522,43 @@ func (a *WsClient) Jrpc(id, op string, params []map[string]interface{}, timeOut
 }
 
 func (a *WsClient) PubChannel(evtId Event, op string, params []map[string]string, pd Period, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PubChannelCtx(ctx, evtId, op, params, pd)
+}
+
+func (a *WsClient) PubChannelCtx(ctx context.Context, evtId Event, op string, params []map[string]string, pd Period) (res bool, msg []*Msg, err error) {
+	res, msg, err = a.pubChannelCtx(ctx, evtId, op, params, pd)
+	if res && op == OP_UNSUBSCRIBE {
+		a.closeOrderBooks(evtId.GetChannel(pd), params)
+	}
+	return
+}
+
+func (a *WsClient) pubChannel(evtId Event, op string, params []map[string]string, pd Period, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.pubChannelCtx(ctx, evtId, op, params, pd)
+}
+
+func (a *WsClient) pubChannelCtx(ctx context.Context, evtId Event, op string, params []map[string]string, pd Period) (res bool, msg []*Msg, err error) {
 
 	// 参数校验
 	pa, err := checkParams(evtId, params, pd)
 	if err != nil {
 		return
 	}
-
-	res = true
-	tm := 5000
-	if len(timeOut) != 0 {
-		tm = timeOut[0]
+	err = checkEndpoint(a.WsEndPoint, evtId)
+	if err != nil {
+		return
 	}
 
+	res = true
 	req := ReqData{
 		Op:   op,
 		Args: pa,
 	}
 
-	ctx := context.Background()
-	ctx, _ = context.WithTimeout(ctx, time.Duration(tm)*time.Millisecond)
 	msg, err = a.process(ctx, evtId, req)
 	if err != nil {
 		res = false
@@ -484,7 +573,55 @@ func (a *WsClient) PubChannel(evtId Event, op string, params []map[string]string
 		res = false
 		return
 	}
+	a.trackSubs(req)
+
+	return
+}
+
+/*
+	记录订阅成功的频道，关闭时据此取消订阅
+	每次订阅成功计数加一，退订时不论计数直接移除，并移除对应的推送队列
+*/
+func (a *WsClient) trackSubs(req ReqData) {
+	if req.Op == OP_UNSUBSCRIBE {
+		defer a.removeQueues(req.Args)
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for _, arg := range req.Args {
+		key := subKey(arg)
+		switch req.Op {
+		case OP_SUBSCRIBE:
+			a.subs[key] = arg
+			a.subRefs[key]++
+		case OP_UNSUBSCRIBE:
+			delete(a.subs, key)
+			delete(a.subRefs, key)
+		}
+	}
+}
 
+/*
+	释放一次订阅，返回计数归零、需要退订的频道参数
+	计数归零的频道同时移除推送队列，退订成功后 trackSubs 会再移除一次期间新建的队列
+*/
+func (a *WsClient) releaseSubs(args []map[string]string) (last []map[string]string) {
+	defer func() { a.removeQueues(last) }()
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for _, arg := range args {
+		key := subKey(arg)
+		if _, ok := a.subs[key]; !ok {
+			continue
+		}
+		a.subRefs[key]--
+		if a.subRefs[key] > 0 {
+			continue
+		}
+		delete(a.subs, key)
+		delete(a.subRefs, key)
+		last = append(last, arg)
+	}
 	return
 }
 
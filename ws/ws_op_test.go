@@ -0,0 +1,62 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPingCtxCancel(t *testing.T) {
+	d := NewPipeDialer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	r.SetDialer(d)
+	r.SetHeartbeat(HeartbeatConfig{})
+	// 服务端不响应
+	go d.Accept(context.Background())
+	assert.Nil(t, r.Start())
+	defer r.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	res, _, err := r.PingCtx(ctx)
+	assert.False(t, res)
+	assert.True(t, errors.Is(err, context.Canceled), err)
+	assert.True(t, time.Since(start) < time.Second)
+
+	// 超时错误可通过 errors.Is 判断
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err = r.PingCtx(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err)
+}
+
+func TestStreamCtx(t *testing.T) {
+	srv := newFakeServer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	r.SetDialer(srv.dialer)
+	assert.Nil(t, r.Start())
+	defer r.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, _, err := r.StreamTickersCtx(ctx, []map[string]string{{"instId": "BTC-USDT"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, r.router.Len())
+
+	// ctx 结束后取消订阅并关闭数据通道
+	cancel()
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok)
+	case <-time.After(2 * time.Second):
+		t.Fatal("数据通道未关闭")
+	}
+	assert.Equal(t, 0, r.router.Len())
+}
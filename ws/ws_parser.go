@@ -0,0 +1,240 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	. "v5sdk_go/ws/wImpl"
+)
+
+/*
+	消息帧的公共字段，只解析一次用于判断消息类型
+	data 字段保留原始数据，确定类型后直接解析为目标结构体
+*/
+type frameHeader struct {
+	Event  string            `json:"event"`
+	Op     string            `json:"op"`
+	Id     string            `json:"id"`
+	Code   string            `json:"code"`
+	Msg    string            `json:"msg"`
+	Arg    map[string]string `json:"arg"`
+	Action string            `json:"action"`
+	Data   json.RawMessage   `json:"data"`
+}
+
+/*
+	普通推送数据
+	data 字段按频道只解析一次为结构化数据(如 TickerData)，
+	通用格式 MsgData 在订阅回调或路由回调需要时才解析
+*/
+type pushData struct {
+	Arg   map[string]string
+	typed interface{} // 结构化数据，未知频道为 nil
+	raw   json.RawMessage
+
+	once    sync.Once
+	generic MsgData
+
+	typesOnce sync.Once
+	types     []string
+}
+
+func newPushData(arg map[string]string, raw json.RawMessage) (p *pushData, err error) {
+	p = &pushData{Arg: arg, raw: raw}
+	if decode, ok := pushDecoders[GetEventId(arg["channel"])]; ok {
+		p.typed, err = decode(arg, raw)
+	}
+	return
+}
+
+/*
+	通用格式的推送数据，首次调用时解析
+*/
+func (p *pushData) msgData() MsgData {
+	p.once.Do(func() {
+		p.generic = MsgData{Arg: p.Arg}
+		if err := unmarshalData(p.raw, &p.generic.Data); err != nil {
+			log.Println("解析推送数据失败！", err)
+		}
+	})
+	return p.generic
+}
+
+/*
+	普通推送的结构化数据，其他消息或未知频道返回 nil
+*/
+func typedPush(msg *Msg) interface{} {
+	p, ok := msg.Info.(*pushData)
+	if !ok {
+		return nil
+	}
+	return p.typed
+}
+
+/*
+	推送数据中出现的产品类型，首次调用时解析
+*/
+func (p *pushData) instTypes() []string {
+	p.typesOnce.Do(func() {
+		var items []struct {
+			InstType string `json:"instType"`
+		}
+		if err := unmarshalData(p.raw, &items); err != nil {
+			return
+		}
+		seen := map[string]bool{}
+		for _, v := range items {
+			if v.InstType != "" && !seen[v.InstType] {
+				seen[v.InstType] = true
+				p.types = append(p.types, v.InstType)
+			}
+		}
+	})
+	return p.types
+}
+
+func unmarshalData(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// 各频道结构化数据的解析函数
+var pushDecoders = map[Event]func(arg map[string]string, raw json.RawMessage) (interface{}, error){
+	EVENT_BOOK_TICKERS: func(arg map[string]string, raw json.RawMessage) (interface{}, error) {
+		v := TickerData{Arg: arg}
+		err := unmarshalData(raw, &v.Data)
+		return v, err
+	},
+	EVENT_BOOK_TRADE: func(arg map[string]string, raw json.RawMessage) (interface{}, error) {
+		v := TradeData{Arg: arg}
+		err := unmarshalData(raw, &v.Data)
+		return v, err
+	},
+	EVENT_BOOK_ACCOUNT: func(arg map[string]string, raw json.RawMessage) (interface{}, error) {
+		v := AccountData{Arg: arg}
+		err := unmarshalData(raw, &v.Data)
+		return v, err
+	},
+	EVENT_BOOK_POSTION: func(arg map[string]string, raw json.RawMessage) (interface{}, error) {
+		v := PositionData{Arg: arg}
+		err := unmarshalData(raw, &v.Data)
+		return v, err
+	},
+	EVENT_BOOK_ORDER: func(arg map[string]string, raw json.RawMessage) (interface{}, error) {
+		v := OrderData{Arg: arg}
+		err := unmarshalData(raw, &v.Data)
+		return v, err
+	},
+	EVENT_BOOK_ALG_ORDER: func(arg map[string]string, raw json.RawMessage) (interface{}, error) {
+		v := AlgoOrderData{Arg: arg}
+		err := unmarshalData(raw, &v.Data)
+		return v, err
+	},
+	EVENT_BOOK_B_AND_P: func(arg map[string]string, raw json.RawMessage) (interface{}, error) {
+		v := BalAndPosData{Arg: arg}
+		err := unmarshalData(raw, &v.Data)
+		return v, err
+	},
+}
+
+/*
+	是否为深度频道
+*/
+func isDepthChannel(channel string) bool {
+	switch channel {
+	case "books", "books5", "books-l2-tbt", "books50-l2-tbt":
+		return true
+	}
+	return false
+}
+
+/*
+	解析消息类型
+*/
+func (a *WsClient) parseMessage(raw []byte) (evt Event, data interface{}, err error) {
+	evt = EVENT_UNKNOWN
+	if string(raw) == "pong" {
+		evt = EVENT_PING
+		data = raw
+		return
+	}
+
+	var h frameHeader
+	err = json.Unmarshal(raw, &h)
+	if err != nil {
+		return
+	}
+
+	switch h.Event {
+	case OP_SUBSCRIBE, OP_UNSUBSCRIBE:
+		evt = GetEventId(h.Arg["channel"])
+		data = RspData{Event: h.Event, Arg: h.Arg}
+		return
+	case OP_LOGIN:
+		evt = EVENT_LOGIN
+		data = ErrData{Event: h.Event, Code: h.Code, Msg: h.Msg}
+		return
+	case OP_ERROR:
+		errData := ErrData{Event: h.Event, Code: h.Code, Msg: h.Msg}
+		data = errData
+		//尝试从msg字段中解析对应的事件类型
+		evt = GetInfoFromErrCode(errData)
+		if evt != EVENT_UNKNOWN {
+			return
+		}
+		evt = GetEventId(GetInfoFromErrMsg(errData.Msg))
+		if evt == EVENT_UNKNOWN {
+			evt = EVENT_ERROR
+		}
+		return
+	}
+
+	// JRPC响应
+	if h.Op != "" {
+		evt = GetEventId(h.Op)
+		if evt == EVENT_UNKNOWN {
+			err = errors.New("message unknown")
+			return
+		}
+		rsp := JRPCRsp{Id: h.Id, Op: h.Op, Code: h.Code, Msg: h.Msg}
+		if len(h.Data) != 0 {
+			err = json.Unmarshal(h.Data, &rsp.Data)
+			if err != nil {
+				return
+			}
+		}
+		data = rsp
+		return
+	}
+
+	// 推送数据
+	if h.Arg != nil {
+		if isDepthChannel(h.Arg["channel"]) {
+			depthData := DepthData{Arg: h.Arg, Action: h.Action}
+			if len(h.Data) != 0 {
+				err = json.Unmarshal(h.Data, &depthData.Data)
+				if err != nil {
+					return
+				}
+			}
+			evt = EVENT_DEPTH_DATA
+			data = depthData
+			return
+		}
+
+		var push *pushData
+		push, err = newPushData(h.Arg, h.Data)
+		if err != nil {
+			return
+		}
+		evt = EVENT_BOOKED_DATA
+		data = push
+		return
+	}
+
+	err = errors.New("message unknown")
+	return
+}
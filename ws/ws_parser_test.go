@@ -0,0 +1,113 @@
+package ws
+
+import (
+	"testing"
+	"v5sdk_go/trade"
+	. "v5sdk_go/ws/wImpl"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testDepthFrame  = `{"arg":{"channel":"books-l2-tbt","instId":"BTC-USDT"},"action":"update","data":[{"asks":[["41006.8","0.60038921","0","1"],["41007","0","0","0"]],"bids":[["41006.3","0.30178218","0","2"]],"ts":"1629966436396","checksum":-1348213839,"prevSeqId":123456,"seqId":123457}]}`
+	testTickerFrame = `{"arg":{"channel":"tickers","instId":"BTC-USDT"},"data":[{"instType":"SPOT","instId":"BTC-USDT","last":"9999.99","lastSz":"0.1","askPx":"9999.99","askSz":"11","bidPx":"8888.88","bidSz":"5","open24h":"9000","high24h":"10000","low24h":"8888.88","volCcy24h":"2222","vol24h":"2222","sodUtc0":"2222","sodUtc8":"2222","ts":"1597026383085"}]}`
+	testJrpcFrame   = `{"id":"1512","op":"order","data":[{"clOrdId":"","ordId":"12345689","tag":"","sCode":"0","sMsg":""}],"code":"0","msg":""}`
+	testSubFrame    = `{"event":"subscribe","arg":{"channel":"tickers","instId":"BTC-USDT"}}`
+)
+
+func TestParseMessageKinds(t *testing.T) {
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+
+	evt, data, err := r.parseMessage([]byte(testDepthFrame))
+	assert.Nil(t, err)
+	assert.Equal(t, EVENT_DEPTH_DATA, evt)
+	depth := data.(DepthData)
+	assert.Equal(t, "update", depth.Action)
+	assert.Equal(t, int64(123457), depth.Data[0].SeqId)
+	assert.Equal(t, int32(-1348213839), depth.Data[0].Checksum)
+
+	evt, data, err = r.parseMessage([]byte(testTickerFrame))
+	assert.Nil(t, err)
+	assert.Equal(t, EVENT_BOOKED_DATA, evt)
+	push := data.(*pushData)
+	assert.Equal(t, "tickers", push.Arg["channel"])
+	// 已知频道直接解析为结构化数据，通用格式按需解析
+	assert.Equal(t, 1, len(push.typed.(TickerData).Data))
+	assert.Equal(t, 1, len(push.msgData().Data))
+
+	// 未知频道只保留通用格式
+	evt, data, err = r.parseMessage([]byte(`{"arg":{"channel":"foo"},"data":[{"a":"1"}]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, EVENT_BOOKED_DATA, evt)
+	assert.Nil(t, data.(*pushData).typed)
+	assert.Equal(t, "1", data.(*pushData).msgData().Data[0].(map[string]interface{})["a"])
+
+	evt, data, err = r.parseMessage([]byte(testJrpcFrame))
+	assert.Nil(t, err)
+	assert.Equal(t, EVENT_PLACE_ORDER, evt)
+	assert.Equal(t, "12345689", data.(JRPCRsp).Data[0]["ordId"])
+	assert.Equal(t, []trade.OrderResult{{OrdId: "12345689", SCode: "0"}}, trade.ParseResults(data.(JRPCRsp).Data))
+
+	evt, data, err = r.parseMessage([]byte(testSubFrame))
+	assert.Nil(t, err)
+	assert.Equal(t, EVENT_BOOK_TICKERS, evt)
+	assert.Equal(t, OP_SUBSCRIBE, data.(RspData).Event)
+
+	evt, _, err = r.parseMessage([]byte(`{"event":"login","code":"0","msg":""}`))
+	assert.Nil(t, err)
+	assert.Equal(t, EVENT_LOGIN, evt)
+
+	evt, _, _ = r.parseMessage([]byte("pong"))
+	assert.Equal(t, EVENT_PING, evt)
+
+	_, _, err = r.parseMessage([]byte(`{"foo":"bar"}`))
+	assert.NotNil(t, err)
+	_, _, err = r.parseMessage([]byte(`not json`))
+	assert.NotNil(t, err)
+}
+
+func TestGetEventIdPeriod(t *testing.T) {
+	assert.Equal(t, EVENT_BOOK_KLINE, GetEventId("candle1m"))
+	assert.Equal(t, EVENT_BOOK_KLINE, GetEventId("candle30m"))
+	assert.Equal(t, EVENT_BOOK_MARK_PRICE_CANDLE_CHART, GetEventId("mark-price-candle1D"))
+	assert.Equal(t, EVENT_BOOK_ORDER_BOOK5, GetEventId("books5"))
+	assert.Equal(t, EVENT_BOOK_ORDER_BOOK50_TBT, GetEventId("books50-l2-tbt"))
+	assert.Equal(t, EVENT_UNKNOWN, GetEventId("foo"))
+	assert.Equal(t, EVENT_UNKNOWN, GetEventId(""))
+}
+
+func benchmarkParse(b *testing.B, frame string) {
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	raw := []byte(frame)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := r.parseMessage(raw)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseDepth(b *testing.B) {
+	benchmarkParse(b, testDepthFrame)
+}
+
+func BenchmarkParseTicker(b *testing.B) {
+	benchmarkParse(b, testTickerFrame)
+}
+
+func BenchmarkParseJrpc(b *testing.B) {
+	benchmarkParse(b, testJrpcFrame)
+}
+
+func BenchmarkParseSubscribe(b *testing.B) {
+	benchmarkParse(b, testSubFrame)
+}
+
+func BenchmarkGetEventId(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		GetEventId("books-l2-tbt")
+		GetEventId("candle1m")
+	}
+}
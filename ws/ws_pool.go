@@ -0,0 +1,647 @@
+package ws
+
+import (
+	"errors"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+	. "v5sdk_go/ws/wImpl"
+)
+
+// 订阅分配策略
+type PoolPolicy int
+
+const (
+	// 按订阅标识哈希分配，同一订阅总是分配到同一连接
+	POOL_HASH PoolPolicy = iota
+	// 分配到订阅数最少的连接
+	POOL_LEAST_LOADED
+)
+
+// 连接断开后重连的间隔
+const POOL_RECONNECT_INTERVAL = time.Second * 3
+
+/*
+	连接池中单个连接的统计信息
+*/
+type PoolStats struct {
+	Index         int
+	Alive         bool
+	Subscriptions int
+	Reconnects    int
+}
+
+type poolSub struct {
+	evtId Event
+	pd    Period
+	param map[string]string
+	// 所在连接，-1 表示等待迁移
+	conn int
+}
+
+type poolConn struct {
+	cli        *WsClient
+	alive      bool
+	subs       int
+	reconnects int
+}
+
+/*
+	websocket连接池，将订阅分散到多个连接上
+	所有连接共用同一组回调函数和同一个 Router
+	连接断开后，该连接上的订阅自动迁移到其他连接，同时在后台重连
+	重连成功后按分配策略将订阅移回：POOL_HASH 移回哈希对应的连接，POOL_LEAST_LOADED 移到订阅较少的连接
+	移动订阅时先在新连接订阅再退订旧连接，期间可能收到重复的推送
+*/
+type WsPool struct {
+	WsEndPoint string
+	policy     PoolPolicy
+	conns      []*poolConn
+	subs       map[string]*poolSub
+	closed     bool
+	lock       sync.RWMutex
+	// 订阅/退订/迁移操作串行执行
+	opLock sync.Mutex
+
+	router         *Router
+	dialer         Dialer
+	dailTimeout    time.Duration
+	reconnInterval time.Duration
+	autoDepthMgr   bool
+	onBookMsgHook  ReceivedMsgDataCallback
+	onDepthHook    ReceivedDepthDataCallback
+
+	// 私有频道登录信息
+	apiKey, secKey, passPhrase string
+}
+
+/*
+	创建连接池
+	size: 连接数
+	policy: 订阅分配策略
+*/
+func NewWsPool(ep string, size int, policy PoolPolicy) (p *WsPool, err error) {
+	if ep == "" {
+		err = errors.New("websocket endpoint cannot be null")
+		return
+	}
+	if size < 1 {
+		err = errors.New("连接数必须大于0")
+		return
+	}
+
+	p = &WsPool{
+		WsEndPoint:   ep,
+		policy:       policy,
+		conns:        make([]*poolConn, size),
+		subs:         make(map[string]*poolSub),
+		router:       NewRouter(),
+		dialer:       &GorillaDialer{},
+		dailTimeout:  time.Second * 5,
+		autoDepthMgr: true,
+
+		reconnInterval: POOL_RECONNECT_INTERVAL,
+	}
+	for i := range p.conns {
+		p.conns[i] = &poolConn{}
+	}
+	return
+}
+
+// 设置建立连接的方式，需在 Start 之前调用
+func (p *WsPool) SetDialer(d Dialer) {
+	p.dialer = d
+}
+
+// 设置dial超时时间
+func (p *WsPool) SetDailTimeout(tm time.Duration) {
+	p.dailTimeout = tm
+}
+
+// 设置是否自动深度管理，需在 Start 之前调用
+func (p *WsPool) EnableAutoDepthMgr(b bool) {
+	p.autoDepthMgr = b
+}
+
+/*
+	设置私有频道登录信息，连接建立后自动登录，需在 Start 之前调用
+*/
+func (p *WsPool) SetLogin(apiKey, secKey, passPhrase string) {
+	p.apiKey = apiKey
+	p.secKey = secKey
+	p.passPhrase = passPhrase
+}
+
+/*
+	添加订阅消息处理的回调函数，需在 Start 之前调用
+*/
+func (p *WsPool) AddBookMsgHook(fn ReceivedMsgDataCallback) error {
+	p.onBookMsgHook = fn
+	return nil
+}
+
+/*
+	添加深度消息处理的回调函数，需在 Start 之前调用
+*/
+func (p *WsPool) AddDepthHook(fn ReceivedDepthDataCallback) error {
+	p.onDepthHook = fn
+	return nil
+}
+
+/*
+	获取推送消息路由，所有连接共用
+*/
+func (p *WsPool) Router() *Router {
+	return p.router
+}
+
+func (p *WsPool) newClient() (cli *WsClient, err error) {
+	cli, err = NewWsClient(p.WsEndPoint)
+	if err != nil {
+		return
+	}
+	cli.SetDialer(p.dialer)
+	cli.SetDailTimeout(p.dailTimeout)
+	cli.router = p.router
+	cli.autoDepthMgr = p.autoDepthMgr
+	cli.AddBookMsgHook(p.onBookMsgHook)
+	cli.AddDepthHook(p.onDepthHook)
+
+	err = cli.Start()
+	if err != nil {
+		return
+	}
+
+	if p.apiKey != "" {
+		var res bool
+		res, _, err = cli.Login(p.apiKey, p.secKey, p.passPhrase)
+		if !res {
+			cli.Stop()
+			if err == nil {
+				err = errors.New("登录失败")
+			}
+			return
+		}
+	}
+	return
+}
+
+/*
+	启动连接池，任一连接建立失败时关闭本次建立的连接并返回错误
+*/
+func (p *WsPool) Start() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	started := map[int]*WsClient{}
+	for i, c := range p.conns {
+		if c.alive {
+			continue
+		}
+		cli, err := p.newClient()
+		if err != nil {
+			for _, cli := range started {
+				cli.Stop()
+			}
+			return err
+		}
+		started[i] = cli
+	}
+	// 全部建立成功后再开始监控，避免关闭连接时触发重连
+	for i, cli := range started {
+		c := p.conns[i]
+		c.cli = cli
+		c.alive = true
+		go p.monitor(i, cli)
+	}
+	return nil
+}
+
+/*
+	关闭连接池
+*/
+func (p *WsPool) Stop() error {
+	p.lock.Lock()
+	p.closed = true
+	clis := []*WsClient{}
+	for _, c := range p.conns {
+		if c.cli != nil {
+			clis = append(clis, c.cli)
+		}
+		c.alive = false
+	}
+	p.lock.Unlock()
+
+	for _, cli := range clis {
+		cli.Stop()
+	}
+	return nil
+}
+
+/*
+	监控连接，断开后迁移订阅并重连
+*/
+func (p *WsPool) monitor(idx int, cli *WsClient) {
+	<-cli.IsQuit()
+
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return
+	}
+	p.conns[idx].alive = false
+	p.conns[idx].subs = 0
+	for _, s := range p.subs {
+		if s.conn == idx {
+			s.conn = -1
+		}
+	}
+	p.lock.Unlock()
+
+	log.Println("连接池连接断开，迁移订阅", idx)
+	p.rebalance()
+	go p.reconnect(idx)
+}
+
+func (p *WsPool) reconnect(idx int) {
+	for {
+		time.Sleep(p.reconnInterval)
+
+		p.lock.RLock()
+		closed := p.closed
+		p.lock.RUnlock()
+		if closed {
+			return
+		}
+
+		cli, err := p.newClient()
+		if err != nil {
+			log.Println("连接池重连失败！", idx, err)
+			continue
+		}
+
+		p.lock.Lock()
+		if p.closed {
+			p.lock.Unlock()
+			cli.Stop()
+			return
+		}
+		c := p.conns[idx]
+		c.cli = cli
+		c.alive = true
+		c.reconnects++
+		p.lock.Unlock()
+
+		log.Println("连接池重连成功！", idx)
+		go p.monitor(idx, cli)
+		// 没有可用连接时未能迁移的订阅，以及需要移回该连接的订阅
+		p.rebalance()
+		return
+	}
+}
+
+/*
+	将断开连接上的订阅迁移到其他连接，再按分配策略调整订阅所在的连接
+*/
+func (p *WsPool) rebalance() {
+	p.opLock.Lock()
+	defer p.opLock.Unlock()
+
+	p.lock.RLock()
+	moved := []*poolSub{}
+	for _, s := range p.subs {
+		if s.conn == -1 {
+			moved = append(moved, s)
+		}
+	}
+	p.lock.RUnlock()
+
+	for _, s := range moved {
+		err := p.subscribeOne(s)
+		if err != nil {
+			log.Println("迁移订阅失败！", s.param, err)
+		}
+	}
+
+	p.lock.RLock()
+	moves := p.placements()
+	p.lock.RUnlock()
+	for s, to := range moves {
+		if err := p.moveSub(s, to); err != nil {
+			log.Println("移动订阅失败！", s.param, err)
+		}
+	}
+}
+
+/*
+	计算需要移动的订阅及目标连接，调用方需持有 p.lock
+*/
+func (p *WsPool) placements() map[*poolSub]int {
+	moves := map[*poolSub]int{}
+	switch p.policy {
+	case POOL_LEAST_LOADED:
+		// 从订阅最多的连接移到最少的连接，直到相差不超过1
+		counts := make([]int, len(p.conns))
+		subs := make([][]*poolSub, len(p.conns))
+		for _, s := range p.subs {
+			if s.conn >= 0 {
+				subs[s.conn] = append(subs[s.conn], s)
+			}
+		}
+		for i, c := range p.conns {
+			counts[i] = c.subs
+		}
+		for {
+			max, min := -1, -1
+			for i, c := range p.conns {
+				if !c.alive {
+					continue
+				}
+				if max == -1 || counts[i] > counts[max] {
+					max = i
+				}
+				if min == -1 || counts[i] < counts[min] {
+					min = i
+				}
+			}
+			if max == -1 || counts[max]-counts[min] <= 1 || len(subs[max]) == 0 {
+				break
+			}
+			s := subs[max][len(subs[max])-1]
+			subs[max] = subs[max][:len(subs[max])-1]
+			moves[s] = min
+			counts[max]--
+			counts[min]++
+		}
+	default:
+		for key, s := range p.subs {
+			if s.conn < 0 {
+				continue
+			}
+			if idx, err := p.pick(key); err == nil && idx != s.conn {
+				moves[s] = idx
+			}
+		}
+	}
+	return moves
+}
+
+/*
+	将订阅移到连接 to，先订阅再退订原连接，调用方需持有 p.opLock
+*/
+func (p *WsPool) moveSub(s *poolSub, to int) error {
+	p.lock.RLock()
+	from := s.conn
+	if from < 0 || !p.conns[to].alive {
+		p.lock.RUnlock()
+		return nil
+	}
+	fromCli, toCli := p.conns[from].cli, p.conns[to].cli
+	p.lock.RUnlock()
+
+	args := []map[string]string{s.param}
+	res, _, err := toCli.PubChannel(s.evtId, OP_SUBSCRIBE, args, s.pd)
+	if !res {
+		if err == nil {
+			err = errors.New("订阅失败")
+		}
+		return err
+	}
+
+	p.lock.Lock()
+	if p.conns[to].alive && p.conns[to].cli == toCli {
+		s.conn = to
+		p.conns[to].subs++
+	} else {
+		// 订阅期间目标连接已断开，等待迁移
+		s.conn = -1
+	}
+	// 原连接断开时计数已被清零
+	if p.conns[from].alive && p.conns[from].cli == fromCli {
+		p.conns[from].subs--
+	}
+	p.lock.Unlock()
+
+	res, _, err = fromCli.PubChannel(s.evtId, OP_UNSUBSCRIBE, args, s.pd)
+	if !res && fromCli.isRunning() {
+		log.Println("退订原连接失败！", s.param, err)
+	}
+	return nil
+}
+
+func (p *WsPool) hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+/*
+	选择连接，调用方需持有 p.lock
+*/
+func (p *WsPool) pick(key string) (idx int, err error) {
+	n := len(p.conns)
+	switch p.policy {
+	case POOL_LEAST_LOADED:
+		idx = -1
+		for i, c := range p.conns {
+			if !c.alive {
+				continue
+			}
+			if idx == -1 || c.subs < p.conns[idx].subs {
+				idx = i
+			}
+		}
+	default:
+		// 目标连接不可用时顺延到下一个
+		start := int(p.hashKey(key) % uint32(n))
+		idx = -1
+		for i := 0; i < n; i++ {
+			j := (start + i) % n
+			if p.conns[j].alive {
+				idx = j
+				break
+			}
+		}
+	}
+	if idx == -1 {
+		err = errors.New("没有可用的连接")
+	}
+	return
+}
+
+func (p *WsPool) keyOf(evtId Event, pd Period, param map[string]string) string {
+	arg := map[string]string{}
+	for k, v := range param {
+		arg[k] = v
+	}
+	arg["channel"] = evtId.GetChannel(pd)
+	return subKey(arg)
+}
+
+func (p *WsPool) subscribeOne(s *poolSub) error {
+	key := p.keyOf(s.evtId, s.pd, s.param)
+
+	p.lock.Lock()
+	idx, err := p.pick(key)
+	if err != nil {
+		p.lock.Unlock()
+		return err
+	}
+	cli := p.conns[idx].cli
+	p.lock.Unlock()
+
+	res, _, err := cli.PubChannel(s.evtId, OP_SUBSCRIBE, []map[string]string{s.param}, s.pd)
+	if !res {
+		if err == nil {
+			err = errors.New("订阅失败")
+		}
+		return err
+	}
+
+	p.lock.Lock()
+	s.conn = idx
+	p.subs[key] = s
+	if p.conns[idx].alive && p.conns[idx].cli == cli {
+		p.conns[idx].subs++
+	} else {
+		// 订阅期间连接已断开，等待迁移
+		s.conn = -1
+	}
+	p.lock.Unlock()
+	return nil
+}
+
+/*
+	订阅频道，每个参数按分配策略选择连接
+	部分参数订阅失败时取消本次已成功的订阅并返回错误
+	例如:
+	pool.Subscribe(EVENT_BOOK_ORDER_BOOK, []map[string]string{{"instId": "BTC-USDT"}}, PERIOD_NONE)
+*/
+func (p *WsPool) Subscribe(evtId Event, params []map[string]string, pd Period) (err error) {
+	if evtId.GetChannel(pd) == "" {
+		return errors.New("参数校验失败!未知的类型:" + evtId.String())
+	}
+
+	p.opLock.Lock()
+	defer p.opLock.Unlock()
+
+	added := []map[string]string{}
+	for _, param := range params {
+		p.lock.RLock()
+		_, ok := p.subs[p.keyOf(evtId, pd, param)]
+		p.lock.RUnlock()
+		if ok {
+			continue
+		}
+		err = p.subscribeOne(&poolSub{evtId: evtId, pd: pd, param: param})
+		if err != nil {
+			break
+		}
+		added = append(added, param)
+	}
+	if err == nil {
+		return
+	}
+
+	for _, param := range added {
+		if e := p.unsubscribeOne(evtId, pd, param); e != nil {
+			log.Println("回滚订阅失败！", param, e)
+		}
+	}
+	return
+}
+
+/*
+	取消订阅
+*/
+func (p *WsPool) UnSubscribe(evtId Event, params []map[string]string, pd Period) (err error) {
+	channel := evtId.GetChannel(pd)
+	if channel == "" {
+		return errors.New("参数校验失败!未知的类型:" + evtId.String())
+	}
+
+	p.opLock.Lock()
+	defer p.opLock.Unlock()
+
+	for _, param := range params {
+		err = p.unsubscribeOne(evtId, pd, param)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+/*
+	取消单个订阅，调用方需持有 p.opLock
+*/
+func (p *WsPool) unsubscribeOne(evtId Event, pd Period, param map[string]string) error {
+	key := p.keyOf(evtId, pd, param)
+
+	p.lock.Lock()
+	s, ok := p.subs[key]
+	if !ok {
+		p.lock.Unlock()
+		return nil
+	}
+	if s.conn == -1 {
+		// 等待迁移的订阅直接删除
+		delete(p.subs, key)
+		p.lock.Unlock()
+		return nil
+	}
+	idx := s.conn
+	cli := p.conns[idx].cli
+	p.lock.Unlock()
+
+	res, _, err := cli.PubChannel(evtId, OP_UNSUBSCRIBE, []map[string]string{param}, pd)
+	if !res {
+		if err == nil {
+			err = errors.New("取消订阅失败")
+		}
+		return err
+	}
+
+	p.lock.Lock()
+	delete(p.subs, key)
+	// 取消订阅期间连接可能已断开，计数已被清零
+	if s.conn >= 0 && s.conn == idx && p.conns[idx].cli == cli {
+		p.conns[idx].subs--
+	}
+	p.lock.Unlock()
+	return nil
+}
+
+/*
+	获取本地订单簿，未订阅时返回 nil
+*/
+func (p *WsPool) GetOrderBook(channel, instId string) *OrderBook {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	s, ok := p.subs[subKey(map[string]string{"channel": channel, "instId": instId})]
+	if !ok || s.conn == -1 {
+		return nil
+	}
+	return p.conns[s.conn].cli.GetOrderBook(channel, instId)
+}
+
+/*
+	获取各连接的统计信息
+*/
+func (p *WsPool) Stats() []PoolStats {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	res := make([]PoolStats, len(p.conns))
+	for i, c := range p.conns {
+		res[i] = PoolStats{
+			Index:         i,
+			Alive:         c.alive,
+			Subscriptions: c.subs,
+			Reconnects:    c.reconnects,
+		}
+	}
+	return res
+}
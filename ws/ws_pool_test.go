@@ -0,0 +1,247 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	. "v5sdk_go/ws/wImpl"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+	模拟服务端，响应订阅/退订请求
+*/
+type fakeServer struct {
+	dialer *PipeDialer
+	lock   sync.Mutex
+	conns  []Conn
+	closes int // 收到的关闭帧数
+	ended  int // 已断开的连接数
+	unsubs int // 收到的退订频道数
+}
+
+func newFakeServer() *fakeServer {
+	s := &fakeServer{dialer: NewPipeDialer()}
+	go func() {
+		for {
+			c, err := s.dialer.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			s.lock.Lock()
+			s.conns = append(s.conns, c)
+			s.lock.Unlock()
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(c Conn) {
+	defer func() {
+		s.lock.Lock()
+		s.ended++
+		s.lock.Unlock()
+	}()
+	for {
+		mt, data, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		if mt == websocket.CloseMessage {
+			s.lock.Lock()
+			s.closes++
+			s.lock.Unlock()
+			c.WriteMessage(websocket.CloseMessage, data)
+			c.Close()
+			return
+		}
+		if string(data) == "ping" {
+			c.WriteMessage(websocket.TextMessage, []byte("pong"))
+			continue
+		}
+		var req ReqData
+		if json.Unmarshal(data, &req) != nil {
+			continue
+		}
+		if req.Op == OP_UNSUBSCRIBE {
+			s.lock.Lock()
+			s.unsubs += len(req.Args)
+			s.lock.Unlock()
+		}
+		for _, arg := range req.Args {
+			rsp, _ := json.Marshal(RspData{Event: req.Op, Arg: arg})
+			c.WriteMessage(websocket.TextMessage, rsp)
+		}
+	}
+}
+
+func (s *fakeServer) closeCount() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.closes
+}
+
+func (s *fakeServer) endCount() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.ended
+}
+
+func (s *fakeServer) unsubCount() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.unsubs
+}
+
+func (s *fakeServer) conn(i int) Conn {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.conns[i]
+}
+
+func TestWsPool(t *testing.T) {
+	srv := newFakeServer()
+	pool, err := NewWsPool("wss://ws.okex.com:8443/ws/v5/public", 3, POOL_LEAST_LOADED)
+	assert.Nil(t, err)
+	pool.SetDialer(srv.dialer)
+	assert.Nil(t, pool.Start())
+	defer pool.Stop()
+
+	params := []map[string]string{}
+	for _, instId := range []string{"BTC-USDT", "ETH-USDT", "LTC-USDT", "DOT-USDT", "XRP-USDT", "EOS-USDT"} {
+		params = append(params, map[string]string{"instId": instId})
+	}
+	assert.Nil(t, pool.Subscribe(EVENT_BOOK_TICKERS, params, PERIOD_NONE))
+
+	for _, st := range pool.Stats() {
+		assert.True(t, st.Alive)
+		assert.Equal(t, 2, st.Subscriptions)
+	}
+
+	// 断开一个连接后订阅迁移到其他连接
+	srv.conn(0).Close()
+	assert.Eventually(t, func() bool {
+		stats := pool.Stats()
+		return !stats[0].Alive && stats[1].Subscriptions+stats[2].Subscriptions == 6
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, pool.UnSubscribe(EVENT_BOOK_TICKERS, params[:3], PERIOD_NONE))
+	stats := pool.Stats()
+	assert.Equal(t, 3, stats[1].Subscriptions+stats[2].Subscriptions)
+}
+
+func TestWsPoolHash(t *testing.T) {
+	srv := newFakeServer()
+	pool, _ := NewWsPool("wss://ws.okex.com:8443/ws/v5/public", 4, POOL_HASH)
+	pool.SetDialer(srv.dialer)
+	assert.Nil(t, pool.Start())
+	defer pool.Stop()
+
+	param := []map[string]string{{"instId": "BTC-USDT"}}
+	assert.Nil(t, pool.Subscribe(EVENT_BOOK_ORDER_BOOK, param, PERIOD_NONE))
+	// 重复订阅不会分配到其他连接
+	assert.Nil(t, pool.Subscribe(EVENT_BOOK_ORDER_BOOK, param, PERIOD_NONE))
+
+	total := 0
+	for _, st := range pool.Stats() {
+		total += st.Subscriptions
+	}
+	assert.Equal(t, 1, total)
+}
+
+/*
+	断开的连接重连后，订阅按分配策略移回
+*/
+func TestWsPoolRestore(t *testing.T) {
+	params := []map[string]string{}
+	for _, instId := range []string{"BTC-USDT", "ETH-USDT", "LTC-USDT", "DOT-USDT", "XRP-USDT", "EOS-USDT", "ADA-USDT", "SOL-USDT"} {
+		params = append(params, map[string]string{"instId": instId})
+	}
+	subs := func(pool *WsPool) []int {
+		res := []int{}
+		for _, st := range pool.Stats() {
+			res = append(res, st.Subscriptions)
+		}
+		return res
+	}
+
+	for _, policy := range []PoolPolicy{POOL_HASH, POOL_LEAST_LOADED} {
+		srv := newFakeServer()
+		pool, _ := NewWsPool("wss://ws.okex.com:8443/ws/v5/public", 3, policy)
+		pool.SetDialer(srv.dialer)
+		pool.reconnInterval = 20 * time.Millisecond
+		assert.Nil(t, pool.Start())
+
+		assert.Nil(t, pool.Subscribe(EVENT_BOOK_TICKERS, params, PERIOD_NONE))
+		before := subs(pool)
+		assert.True(t, before[0] > 0)
+
+		srv.conn(0).Close()
+		assert.Eventually(t, func() bool {
+			st := pool.Stats()
+			return st[0].Reconnects == 1 && st[0].Alive
+		}, 2*time.Second, 10*time.Millisecond)
+		assert.Eventually(t, func() bool {
+			st := subs(pool)
+			if policy == POOL_HASH {
+				return st[0] == before[0] && st[1] == before[1] && st[2] == before[2]
+			}
+			// 8个订阅分到3个连接
+			for _, n := range st {
+				if n != 2 && n != 3 {
+					return false
+				}
+			}
+			return st[0]+st[1]+st[2] == len(params)
+		}, 2*time.Second, 10*time.Millisecond, "订阅未移回", policy)
+		pool.Stop()
+	}
+}
+
+type failDialer struct {
+	Dialer
+	lock  sync.Mutex
+	dials int
+	fail  int // 第几次建立连接时失败
+}
+
+func (d *failDialer) Dial(ctx context.Context, url string) (Conn, error) {
+	d.lock.Lock()
+	d.dials++
+	n := d.dials
+	d.lock.Unlock()
+	if n == d.fail {
+		return nil, errors.New("dial failed")
+	}
+	return d.Dialer.Dial(ctx, url)
+}
+
+/*
+	启动失败时关闭已建立的连接
+*/
+func TestWsPoolStartFailed(t *testing.T) {
+	srv := newFakeServer()
+	pool, _ := NewWsPool("wss://ws.okex.com:8443/ws/v5/public", 3, POOL_LEAST_LOADED)
+	pool.SetDialer(&failDialer{Dialer: srv.dialer, fail: 3})
+	assert.NotNil(t, pool.Start())
+
+	assert.Eventually(t, func() bool {
+		return srv.endCount() == 2
+	}, time.Second, 10*time.Millisecond)
+	for _, st := range pool.Stats() {
+		assert.False(t, st.Alive)
+	}
+
+	// 再次启动时重新建立全部连接
+	assert.Nil(t, pool.Start())
+	defer pool.Stop()
+	for _, st := range pool.Stats() {
+		assert.True(t, st.Alive)
+	}
+}
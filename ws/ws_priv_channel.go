@@ -1,6 +1,9 @@
 package ws
 
 import (
+	"context"
+	"log"
+	"time"
 	. "v5sdk_go/ws/wImpl"
 )
 
@@ -8,33 +11,204 @@ import (
 	订阅账户频道
 */
 func (a *WsClient) PrivAccout(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
-	return a.PubChannel(EVENT_BOOK_ACCOUNT, op, params, PERIOD_NONE, timeOut...)
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PrivAccoutCtx(ctx, op, params)
+}
+
+func (a *WsClient) PrivAccoutCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+	return a.PubChannelCtx(ctx, EVENT_BOOK_ACCOUNT, op, params, PERIOD_NONE)
 }
 
 /*
 	订阅持仓频道
 */
 func (a *WsClient) PrivPostion(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
-	return a.PubChannel(EVENT_BOOK_POSTION, op, params, PERIOD_NONE, timeOut...)
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PrivPostionCtx(ctx, op, params)
+}
+
+func (a *WsClient) PrivPostionCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+	return a.PubChannelCtx(ctx, EVENT_BOOK_POSTION, op, params, PERIOD_NONE)
 }
 
 /*
 	订阅订单频道
 */
 func (a *WsClient) PrivBookOrder(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
-	return a.PubChannel(EVENT_BOOK_ORDER, op, params, PERIOD_NONE, timeOut...)
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PrivBookOrderCtx(ctx, op, params)
+}
+
+func (a *WsClient) PrivBookOrderCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+	return a.PubChannelCtx(ctx, EVENT_BOOK_ORDER, op, params, PERIOD_NONE)
 }
 
 /*
 	订阅策略委托订单频道
+	注：该频道需连接 business 地址
 */
 func (a *WsClient) PrivBookAlgoOrder(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
-	return a.PubChannel(EVENT_BOOK_ALG_ORDER, op, params, PERIOD_NONE, timeOut...)
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PrivBookAlgoOrderCtx(ctx, op, params)
+}
+
+func (a *WsClient) PrivBookAlgoOrderCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+	return a.PubChannelCtx(ctx, EVENT_BOOK_ALG_ORDER, op, params, PERIOD_NONE)
 }
 
 /*
 	订阅账户余额和持仓频道
 */
 func (a *WsClient) PrivBalAndPos(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
-	return a.PubChannel(EVENT_BOOK_B_AND_P, op, params, PERIOD_NONE, timeOut...)
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PrivBalAndPosCtx(ctx, op, params)
+}
+
+func (a *WsClient) PrivBalAndPosCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+	return a.PubChannelCtx(ctx, EVENT_BOOK_B_AND_P, op, params, PERIOD_NONE)
+}
+
+// 账户频道推送数据回调函数
+type ReceivedAccountDataCallback func(time.Time, AccountDetail) error
+
+// 持仓频道推送数据回调函数
+type ReceivedPositionDataCallback func(time.Time, PositionDetail) error
+
+// 订单频道推送数据回调函数
+type ReceivedOrderDataCallback func(time.Time, OrderUpdate) error
+
+// 策略委托订单频道推送数据回调函数
+type ReceivedAlgoOrderDataCallback func(time.Time, AlgoOrderUpdate) error
+
+// 账户余额和持仓频道推送数据回调函数
+type ReceivedBalAndPosDataCallback func(time.Time, BalAndPosDetail) error
+
+/*
+	添加账户频道推送数据的回调函数
+*/
+func (a *WsClient) AddAccountHook(fn ReceivedAccountDataCallback) error {
+	a.onAccountHook = fn
+	return nil
+}
+
+/*
+	添加持仓频道推送数据的回调函数
+*/
+func (a *WsClient) AddPositionHook(fn ReceivedPositionDataCallback) error {
+	a.onPositionHook = fn
+	return nil
+}
+
+/*
+	添加订单频道推送数据的回调函数
+	例如:
+	cli.AddOrderHook(func(ts time.Time, order OrderUpdate) error { return nil })
+*/
+func (a *WsClient) AddOrderHook(fn ReceivedOrderDataCallback) error {
+	a.onOrderHook = fn
+	return nil
+}
+
+/*
+	添加策略委托订单频道推送数据的回调函数
+*/
+func (a *WsClient) AddAlgoOrderHook(fn ReceivedAlgoOrderDataCallback) error {
+	a.onAlgoOrderHook = fn
+	return nil
+}
+
+/*
+	添加账户余额和持仓频道推送数据的回调函数
+*/
+func (a *WsClient) AddBalAndPosHook(fn ReceivedBalAndPosDataCallback) error {
+	a.onBalAndPosHook = fn
+	return nil
+}
+
+/*
+	将私有频道解析后的结构化数据逐条交给对应的回调函数
+*/
+func (a *WsClient) dispatchPrivData(msg *Msg) {
+	data, ok := msg.Info.(*pushData)
+	if !ok {
+		return
+	}
+
+	switch GetEventId(data.Arg["channel"]) {
+	case EVENT_BOOK_ACCOUNT:
+		fn := a.onAccountHook
+		if fn == nil {
+			return
+		}
+		push, ok := data.typed.(AccountData)
+		if !ok {
+			return
+		}
+		for _, v := range push.Data {
+			if e := fn(msg.Timestamp, v); e != nil {
+				log.Println("账户频道回调函数执行失败！", e)
+			}
+		}
+	case EVENT_BOOK_POSTION:
+		fn := a.onPositionHook
+		if fn == nil {
+			return
+		}
+		push, ok := data.typed.(PositionData)
+		if !ok {
+			return
+		}
+		for _, v := range push.Data {
+			if e := fn(msg.Timestamp, v); e != nil {
+				log.Println("持仓频道回调函数执行失败！", e)
+			}
+		}
+	case EVENT_BOOK_ORDER:
+		fn := a.onOrderHook
+		if fn == nil {
+			return
+		}
+		push, ok := data.typed.(OrderData)
+		if !ok {
+			return
+		}
+		for _, v := range push.Data {
+			if e := fn(msg.Timestamp, v); e != nil {
+				log.Println("订单频道回调函数执行失败！", e)
+			}
+		}
+	case EVENT_BOOK_ALG_ORDER:
+		fn := a.onAlgoOrderHook
+		if fn == nil {
+			return
+		}
+		push, ok := data.typed.(AlgoOrderData)
+		if !ok {
+			return
+		}
+		for _, v := range push.Data {
+			if e := fn(msg.Timestamp, v); e != nil {
+				log.Println("策略委托订单频道回调函数执行失败！", e)
+			}
+		}
+	case EVENT_BOOK_B_AND_P:
+		fn := a.onBalAndPosHook
+		if fn == nil {
+			return
+		}
+		push, ok := data.typed.(BalAndPosData)
+		if !ok {
+			return
+		}
+		for _, v := range push.Data {
+			if e := fn(msg.Timestamp, v); e != nil {
+				log.Println("账户余额和持仓频道回调函数执行失败！", e)
+			}
+		}
+	}
 }
@@ -5,6 +5,7 @@ import (
 	"log"
 	"testing"
 	"time"
+	. "v5sdk_go/ws/wImpl"
 )
 
 const (
@@ -246,3 +247,31 @@ func TestPrivBalAndPos(t *testing.T) {
 	}
 
 }
+
+// 私有频道结构化数据回调 测试
+func TestDispatchPrivData(t *testing.T) {
+	r, err := NewWsClient("wss://ws.okex.com:8443/ws/v5/private")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var orders []OrderUpdate
+	r.AddOrderHook(func(ts time.Time, order OrderUpdate) error {
+		orders = append(orders, order)
+		return nil
+	})
+
+	raw := []byte(`{"arg":{"channel":"orders","instType":"SPOT"},"data":[{"instId":"BTC-USDT","ordId":"1","state":"live"},{"instId":"BTC-USDT","ordId":"2","state":"canceled"}]}`)
+	evt, data, err := r.parseMessage(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evt != EVENT_BOOKED_DATA {
+		t.Fatal("事件类型错误", evt)
+	}
+
+	r.dispatchPrivData(&Msg{Timestamp: time.Now(), Info: data})
+	if len(orders) != 2 || orders[0].OrdId != "1" || orders[1].State != ORDER_STATE_CANCELED {
+		t.Fatal("订单回调数据错误", orders)
+	}
+}
@@ -1,6 +1,7 @@
 package ws
 
 import (
+	"context"
 	"errors"
 	. "v5sdk_go/ws/wImpl"
 )
@@ -9,51 +10,94 @@ import (
 	产品频道
 */
 func (a *WsClient) PubInstruemnts(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PubInstruemntsCtx(ctx, op, params)
+}
+
+func (a *WsClient) PubInstruemntsCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
 
-	return a.PubChannel(EVENT_BOOK_INSTRUMENTS, op, params, PERIOD_NONE, timeOut...)
+	return a.PubChannelCtx(ctx, EVENT_BOOK_INSTRUMENTS, op, params, PERIOD_NONE)
 }
 
 func (a *WsClient) PubStatus(op string, timeOut ...int) (res bool, msg []*Msg, err error) {
-	return a.PubChannel(EVENT_STATUS, op, nil, PERIOD_NONE, timeOut...)
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PubStatusCtx(ctx, op)
+}
+
+func (a *WsClient) PubStatusCtx(ctx context.Context, op string) (res bool, msg []*Msg, err error) {
+	return a.PubChannelCtx(ctx, EVENT_STATUS, op, nil, PERIOD_NONE)
 }
 
 /*
 	行情频道
 */
 func (a *WsClient) PubTickers(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PubTickersCtx(ctx, op, params)
+}
+
+func (a *WsClient) PubTickersCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
 
-	return a.PubChannel(EVENT_BOOK_TICKERS, op, params, PERIOD_NONE, timeOut...)
+	return a.PubChannelCtx(ctx, EVENT_BOOK_TICKERS, op, params, PERIOD_NONE)
 }
 
 /*
 	持仓总量频道
 */
 func (a *WsClient) PubOpenInsterest(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
-	return a.PubChannel(EVENT_BOOK_OPEN_INTEREST, op, params, PERIOD_NONE, timeOut...)
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PubOpenInsterestCtx(ctx, op, params)
+}
+
+func (a *WsClient) PubOpenInsterestCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+	return a.PubChannelCtx(ctx, EVENT_BOOK_OPEN_INTEREST, op, params, PERIOD_NONE)
 }
 
 /*
 	K线频道
+	注：该频道需连接 business 地址
 */
 func (a *WsClient) PubKLine(op string, period Period, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PubKLineCtx(ctx, op, period, params)
+}
+
+func (a *WsClient) PubKLineCtx(ctx context.Context, op string, period Period, params []map[string]string) (res bool, msg []*Msg, err error) {
 
-	return a.PubChannel(EVENT_BOOK_KLINE, op, params, period, timeOut...)
+	return a.PubChannelCtx(ctx, EVENT_BOOK_KLINE, op, params, period)
 }
 
 /*
 	交易频道
 */
 func (a *WsClient) PubTrade(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PubTradeCtx(ctx, op, params)
+}
+
+func (a *WsClient) PubTradeCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
 
-	return a.PubChannel(EVENT_BOOK_TRADE, op, params, PERIOD_NONE, timeOut...)
+	return a.PubChannelCtx(ctx, EVENT_BOOK_TRADE, op, params, PERIOD_NONE)
 }
 
 /*
 	预估交割/行权价格频道
 */
 func (a *WsClient) PubEstDePrice(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PubEstDePriceCtx(ctx, op, params)
+}
+
+func (a *WsClient) PubEstDePriceCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
 
-	return a.PubChannel(EVENT_BOOK_ESTIMATE_PRICE, op, params, PERIOD_NONE, timeOut...)
+	return a.PubChannelCtx(ctx, EVENT_BOOK_ESTIMATE_PRICE, op, params, PERIOD_NONE)
 
 }
 
@@ -61,44 +105,69 @@ func (a *WsClient) PubEstDePrice(op string, params []map[string]string, timeOut
 	标记价格频道
 */
 func (a *WsClient) PubMarkPrice(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PubMarkPriceCtx(ctx, op, params)
+}
 
-	return a.PubChannel(EVENT_BOOK_MARK_PRICE, op, params, PERIOD_NONE, timeOut...)
+func (a *WsClient) PubMarkPriceCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+
+	return a.PubChannelCtx(ctx, EVENT_BOOK_MARK_PRICE, op, params, PERIOD_NONE)
 }
 
 /*
 	标记价格K线频道
+	注：该频道需连接 business 地址
 */
 func (a *WsClient) PubMarkPriceCandle(op string, pd Period, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PubMarkPriceCandleCtx(ctx, op, pd, params)
+}
 
-	return a.PubChannel(EVENT_BOOK_MARK_PRICE_CANDLE_CHART, op, params, pd, timeOut...)
+func (a *WsClient) PubMarkPriceCandleCtx(ctx context.Context, op string, pd Period, params []map[string]string) (res bool, msg []*Msg, err error) {
+
+	return a.PubChannelCtx(ctx, EVENT_BOOK_MARK_PRICE_CANDLE_CHART, op, params, pd)
 }
 
 /*
 	限价频道
 */
 func (a *WsClient) PubLimitPrice(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PubLimitPriceCtx(ctx, op, params)
+}
 
-	return a.PubChannel(EVENT_BOOK_LIMIT_PRICE, op, params, PERIOD_NONE, timeOut...)
+func (a *WsClient) PubLimitPriceCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+
+	return a.PubChannelCtx(ctx, EVENT_BOOK_LIMIT_PRICE, op, params, PERIOD_NONE)
 }
 
 /*
 	深度频道
 */
 func (a *WsClient) PubOrderBooks(op string, channel string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PubOrderBooksCtx(ctx, op, channel, params)
+}
+
+func (a *WsClient) PubOrderBooksCtx(ctx context.Context, op string, channel string, params []map[string]string) (res bool, msg []*Msg, err error) {
 
 	switch channel {
 	// 400档快照
 	case "books":
-		return a.PubChannel(EVENT_BOOK_ORDER_BOOK, op, params, PERIOD_NONE, timeOut...)
+		return a.PubChannelCtx(ctx, EVENT_BOOK_ORDER_BOOK, op, params, PERIOD_NONE)
 	// 5档快照
 	case "books5":
-		return a.PubChannel(EVENT_BOOK_ORDER_BOOK5, op, params, PERIOD_NONE, timeOut...)
+		return a.PubChannelCtx(ctx, EVENT_BOOK_ORDER_BOOK5, op, params, PERIOD_NONE)
 	// 400 tbt
 	case "books-l2-tbt":
-		return a.PubChannel(EVENT_BOOK_ORDER_BOOK_TBT, op, params, PERIOD_NONE, timeOut...)
+		return a.PubChannelCtx(ctx, EVENT_BOOK_ORDER_BOOK_TBT, op, params, PERIOD_NONE)
 	// 50 tbt
 	case "books50-l2-tbt":
-		return a.PubChannel(EVENT_BOOK_ORDER_BOOK50_TBT, op, params, PERIOD_NONE, timeOut...)
+		return a.PubChannelCtx(ctx, EVENT_BOOK_ORDER_BOOK50_TBT, op, params, PERIOD_NONE)
 
 	default:
 		err = errors.New("未知的channel")
@@ -111,30 +180,55 @@ func (a *WsClient) PubOrderBooks(op string, channel string, params []map[string]
 	期权定价频道
 */
 func (a *WsClient) PubOptionSummary(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PubOptionSummaryCtx(ctx, op, params)
+}
 
-	return a.PubChannel(EVENT_BOOK_OPTION_SUMMARY, op, params, PERIOD_NONE, timeOut...)
+func (a *WsClient) PubOptionSummaryCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+
+	return a.PubChannelCtx(ctx, EVENT_BOOK_OPTION_SUMMARY, op, params, PERIOD_NONE)
 }
 
 /*
 	资金费率频道
 */
 func (a *WsClient) PubFundRate(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PubFundRateCtx(ctx, op, params)
+}
 
-	return a.PubChannel(EVENT_BOOK_FUND_RATE, op, params, PERIOD_NONE, timeOut...)
+func (a *WsClient) PubFundRateCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
+
+	return a.PubChannelCtx(ctx, EVENT_BOOK_FUND_RATE, op, params, PERIOD_NONE)
 }
 
 /*
 	指数K线频道
+	注：该频道需连接 business 地址
 */
 func (a *WsClient) PubKLineIndex(op string, pd Period, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PubKLineIndexCtx(ctx, op, pd, params)
+}
 
-	return a.PubChannel(EVENT_BOOK_KLINE_INDEX, op, params, pd, timeOut...)
+func (a *WsClient) PubKLineIndexCtx(ctx context.Context, op string, pd Period, params []map[string]string) (res bool, msg []*Msg, err error) {
+
+	return a.PubChannelCtx(ctx, EVENT_BOOK_KLINE_INDEX, op, params, pd)
 }
 
 /*
 	指数行情频道
 */
 func (a *WsClient) PubIndexTickers(op string, params []map[string]string, timeOut ...int) (res bool, msg []*Msg, err error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.PubIndexTickersCtx(ctx, op, params)
+}
+
+func (a *WsClient) PubIndexTickersCtx(ctx context.Context, op string, params []map[string]string) (res bool, msg []*Msg, err error) {
 
-	return a.PubChannel(EVENT_BOOK_INDEX_TICKERS, op, params, PERIOD_NONE, timeOut...)
+	return a.PubChannelCtx(ctx, EVENT_BOOK_INDEX_TICKERS, op, params, PERIOD_NONE)
 }
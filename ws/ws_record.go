@@ -0,0 +1,184 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+	. "v5sdk_go/ws/wImpl"
+)
+
+// 消息方向
+const (
+	RECORD_IN  = "in"
+	RECORD_OUT = "out"
+)
+
+/*
+	录制的消息帧，每行一条
+	Ts: 收发时间，unix纳秒
+	Dir: 消息方向 in / out
+	Data: 消息内容(已解压)
+*/
+type RecordFrame struct {
+	Ts   int64  `json:"ts"`
+	Dir  string `json:"dir"`
+	Data string `json:"data"`
+}
+
+func (f *RecordFrame) Time() time.Time {
+	return time.Unix(0, f.Ts)
+}
+
+/*
+	会话录制，将收发的消息写入 gzip 压缩的 JSONL 文件
+*/
+type Recorder struct {
+	lock   sync.Mutex
+	f      *os.File
+	gz     *gzip.Writer
+	enc    *json.Encoder
+	closed bool
+}
+
+/*
+	创建录制文件，文件已存在时覆盖
+	例如:
+	rec, _ := NewRecorder("session.jsonl.gz")
+	cli.SetRecorder(rec)
+*/
+func NewRecorder(path string) (r *Recorder, err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	gz := gzip.NewWriter(f)
+	r = &Recorder{
+		f:   f,
+		gz:  gz,
+		enc: json.NewEncoder(gz),
+	}
+	return
+}
+
+/*
+	写入一条消息，登录请求中的密钥和签名替换为 REDACTED
+*/
+func (r *Recorder) Record(dir string, data []byte, ts time.Time) error {
+	if dir == RECORD_OUT {
+		data = redactLogin(data)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return errors.New("录制已结束")
+	}
+	return r.enc.Encode(RecordFrame{Ts: ts.UnixNano(), Dir: dir, Data: string(data)})
+}
+
+// 录制文件中代替敏感字段的内容
+const REDACTED = "***"
+
+// 登录请求中不写入录制文件的字段
+var loginSecrets = []string{"apiKey", "passphrase", "sign"}
+
+func redactLogin(data []byte) []byte {
+	if !bytes.Contains(data, []byte(OP_LOGIN)) {
+		return data
+	}
+	var req ReqData
+	if json.Unmarshal(data, &req) != nil || req.Op != OP_LOGIN {
+		return data
+	}
+	for _, arg := range req.Args {
+		for _, k := range loginSecrets {
+			if _, ok := arg[k]; ok {
+				arg[k] = REDACTED
+			}
+		}
+	}
+	res, err := json.Marshal(req)
+	if err != nil {
+		return data
+	}
+	return res
+}
+
+/*
+	结束录制，写入剩余数据并关闭文件
+*/
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	err := r.gz.Close()
+	if e := r.f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+/*
+	读取录制文件
+*/
+type RecordReader struct {
+	f  *os.File
+	gz *gzip.Reader
+	sc *bufio.Scanner
+}
+
+func OpenRecord(path string) (r *RecordReader, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return
+	}
+	sc := bufio.NewScanner(gz)
+	// 深度全量数据单条可能较大
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	r = &RecordReader{f: f, gz: gz, sc: sc}
+	return
+}
+
+/*
+	读取下一条消息，读取完毕返回 io.EOF
+*/
+func (r *RecordReader) Next() (frame RecordFrame, err error) {
+	for r.sc.Scan() {
+		line := r.sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		err = json.Unmarshal(line, &frame)
+		return
+	}
+	err = r.sc.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	return
+}
+
+func (r *RecordReader) Close() error {
+	r.gz.Close()
+	return r.f.Close()
+}
+
+/*
+	设置会话录制，需在 Start 之前调用
+*/
+func (a *WsClient) SetRecorder(r *Recorder) {
+	a.recorder = r
+}
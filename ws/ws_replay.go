@@ -0,0 +1,141 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+/*
+	回放连接，按录制顺序返回收到的消息，发送的消息直接丢弃
+*/
+type replayConn struct {
+	reader   *RecordReader
+	realtime bool
+
+	// 回放开始的时间和第一条消息的录制时间
+	start time.Time
+	first int64
+	last  time.Time
+
+	closeCh chan struct{}
+	once    sync.Once
+}
+
+func newReplayConn(path string, realtime bool) (c *replayConn, err error) {
+	reader, err := OpenRecord(path)
+	if err != nil {
+		return
+	}
+	c = &replayConn{
+		reader:   reader,
+		realtime: realtime,
+		closeCh:  make(chan struct{}),
+	}
+	return
+}
+
+func (c *replayConn) ReadMessage() (messageType int, p []byte, err error) {
+	// 录制文件只在读取方关闭，避免与读取并发
+	defer func() {
+		if err != nil {
+			c.reader.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-c.closeCh:
+			err = errors.New("replay closed")
+			return
+		default:
+		}
+
+		var frame RecordFrame
+		frame, err = c.reader.Next()
+		if err != nil {
+			return
+		}
+		if frame.Dir != RECORD_IN {
+			continue
+		}
+
+		if c.realtime {
+			if c.start.IsZero() {
+				c.start = time.Now()
+				c.first = frame.Ts
+			}
+			wait := time.Until(c.start.Add(time.Duration(frame.Ts - c.first)))
+			if wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-c.closeCh:
+					timer.Stop()
+					err = errors.New("replay closed")
+					return
+				}
+			}
+		}
+
+		c.last = frame.Time()
+		return websocket.TextMessage, []byte(frame.Data), nil
+	}
+}
+
+func (c *replayConn) WriteMessage(messageType int, data []byte) error {
+	select {
+	case <-c.closeCh:
+		return errors.New("replay closed")
+	default:
+	}
+	return nil
+}
+
+func (c *replayConn) Close() error {
+	c.once.Do(func() {
+		close(c.closeCh)
+	})
+	return nil
+}
+
+// 消息的录制时间
+func (c *replayConn) frameTime() time.Time {
+	return c.last
+}
+
+/*
+	回放录制文件的连接方式
+	Realtime: true 按录制时的时间间隔回放，false 以最快速度回放
+*/
+type ReplayDialer struct {
+	Path     string
+	Realtime bool
+}
+
+func NewReplayDialer(path string, realtime bool) *ReplayDialer {
+	return &ReplayDialer{Path: path, Realtime: realtime}
+}
+
+func (d *ReplayDialer) Dial(ctx context.Context, url string) (Conn, error) {
+	return newReplayConn(d.Path, d.Realtime)
+}
+
+/*
+	回放录制文件，不连接服务端
+	录制文件中收到的消息依次经过消息解析和各回调函数，推送消息的时间为录制时的接收时间
+	realtime: true 按录制时的时间间隔回放，false 以最快速度回放
+	回放完成且所有消息处理完毕后客户端自动退出，可通过 IsQuit() 等待
+	例如:
+	cli.StartReplay("session.jsonl.gz", false)
+	<-cli.IsQuit()
+*/
+func (a *WsClient) StartReplay(path string, realtime bool) error {
+	a.SetDialer(NewReplayDialer(path, realtime))
+	// 回放时没有服务端响应心跳
+	a.hbConf.Interval = 0
+	return a.Start()
+}
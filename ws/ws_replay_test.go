@@ -0,0 +1,147 @@
+package ws
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	. "v5sdk_go/ws/wImpl"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeRecord(t *testing.T, frames []RecordFrame) string {
+	dir, err := ioutil.TempDir("", "replay")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "session.jsonl.gz")
+	rec, err := NewRecorder(path)
+	assert.Nil(t, err)
+	for _, f := range frames {
+		assert.Nil(t, rec.Record(f.Dir, []byte(f.Data), time.Unix(0, f.Ts)))
+	}
+	assert.Nil(t, rec.Close())
+	return path
+}
+
+func TestRecordReader(t *testing.T) {
+	frames := []RecordFrame{
+		{Ts: 1, Dir: RECORD_OUT, Data: `{"op":"subscribe","args":[{"channel":"tickers","instId":"BTC-USDT"}]}`},
+		{Ts: 2, Dir: RECORD_IN, Data: testSubFrame},
+	}
+	path := writeRecord(t, frames)
+
+	r, err := OpenRecord(path)
+	assert.Nil(t, err)
+	defer r.Close()
+	for _, exp := range frames {
+		f, err := r.Next()
+		assert.Nil(t, err)
+		assert.Equal(t, exp, f)
+	}
+	_, err = r.Next()
+	assert.Equal(t, "EOF", err.Error())
+}
+
+/*
+	录制文件不包含登录的密钥和签名
+*/
+func TestRecordRedactLogin(t *testing.T) {
+	login := `{"op":"login","args":[{"apiKey":"key1","passphrase":"pass1","sign":"sign1","timestamp":"1538054050"}]}`
+	path := writeRecord(t, []RecordFrame{
+		{Ts: 1, Dir: RECORD_OUT, Data: login},
+		{Ts: 2, Dir: RECORD_IN, Data: `{"event":"login","code":"0","msg":""}`},
+	})
+
+	r, err := OpenRecord(path)
+	assert.Nil(t, err)
+	defer r.Close()
+	f, err := r.Next()
+	assert.Nil(t, err)
+	for _, secret := range []string{"key1", "pass1", "sign1"} {
+		assert.NotContains(t, f.Data, secret)
+	}
+	var req ReqData
+	assert.Nil(t, json.Unmarshal([]byte(f.Data), &req))
+	assert.Equal(t, OP_LOGIN, req.Op)
+	assert.Equal(t, REDACTED, req.Args[0]["apiKey"])
+	assert.Equal(t, "1538054050", req.Args[0]["timestamp"])
+
+	f, err = r.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, `{"event":"login","code":"0","msg":""}`, f.Data)
+}
+
+func TestStartReplay(t *testing.T) {
+	asks := [][]string{{"101", "1", "0", "1"}}
+	bids := [][]string{{"100", "1", "0", "1"}}
+	_, cs := CalCrc32(asks, bids)
+	snapshot := `{"arg":{"channel":"books","instId":"BTC-USDT"},"action":"snapshot","data":[{"asks":[["101","1","0","1"]],"bids":[["100","1","0","1"]],"ts":"1","checksum":` + strconv.Itoa(int(cs)) + `}]}`
+
+	base := time.Now().Add(-time.Hour).UnixNano()
+	path := writeRecord(t, []RecordFrame{
+		{Ts: base, Dir: RECORD_OUT, Data: `{"op":"subscribe","args":[{"channel":"books","instId":"BTC-USDT"}]}`},
+		{Ts: base + 1, Dir: RECORD_IN, Data: `{"event":"subscribe","arg":{"channel":"books","instId":"BTC-USDT"}}`},
+		{Ts: base + 2, Dir: RECORD_IN, Data: snapshot},
+		{Ts: base + 3, Dir: RECORD_IN, Data: testTickerFrame},
+	})
+
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	var lock sync.Mutex
+	var depthTs []time.Time
+	var msgCnt, bookedCnt int
+	r.AddDepthHook(func(ts time.Time, data DepthData) error {
+		lock.Lock()
+		defer lock.Unlock()
+		depthTs = append(depthTs, ts)
+		return nil
+	})
+	r.AddBookMsgHook(func(ts time.Time, data MsgData) error {
+		lock.Lock()
+		defer lock.Unlock()
+		bookedCnt++
+		return nil
+	})
+	r.AddMessageHook(func(msg *Msg) error {
+		lock.Lock()
+		defer lock.Unlock()
+		msgCnt++
+		return nil
+	})
+
+	assert.Nil(t, r.StartReplay(path, false))
+	select {
+	case <-r.IsQuit():
+	case <-time.After(5 * time.Second):
+		t.Fatal("回放超时")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 3, msgCnt)
+	assert.Equal(t, 1, bookedCnt)
+	assert.Equal(t, []time.Time{time.Unix(0, base+2)}, depthTs)
+
+	book := r.GetOrderBook("books", "BTC-USDT")
+	assert.NotNil(t, book)
+	assert.True(t, book.Ready())
+}
+
+func TestStartReplayRealtime(t *testing.T) {
+	base := time.Now().UnixNano()
+	path := writeRecord(t, []RecordFrame{
+		{Ts: base, Dir: RECORD_IN, Data: testTickerFrame},
+		{Ts: base + int64(100*time.Millisecond), Dir: RECORD_IN, Data: testTickerFrame},
+	})
+
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	start := time.Now()
+	assert.Nil(t, r.StartReplay(path, true))
+	<-r.IsQuit()
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+}
@@ -0,0 +1,233 @@
+package ws
+
+import (
+	"errors"
+	"log"
+	"sync"
+	. "v5sdk_go/ws/wImpl"
+)
+
+/*
+	推送消息路由规则
+	Channel: 频道名称，必填(带周期的频道需填写完整名称，如 candle1m)
+	InstId: 产品ID，为空时不限制
+	InstType: 产品类型，为空时不限制
+		推送的 arg 中没有 instType(如公共频道)或为 ANY 时，按推送数据中各条记录的 instType 匹配
+		深度频道的推送数据中没有 instType，只按 arg 匹配
+	注：InstId 与 InstType 同时填写时以 InstId 为准
+*/
+type RoutePattern struct {
+	Channel  string
+	InstId   string
+	InstType string
+}
+
+func (p RoutePattern) key() string {
+	switch {
+	case p.InstId != "":
+		return routeKey(p.Channel, "instId", p.InstId)
+	case p.InstType != "":
+		return routeKey(p.Channel, "instType", p.InstType)
+	}
+	return p.Channel
+}
+
+func routeKey(channel, field, val string) string {
+	return channel + "|" + field + ":" + val
+}
+
+type routeEntry struct {
+	id uint64
+	fn func(*Msg)
+	// 按 instType 注册的频道，为空表示不是按 instType 注册
+	instTypeOf string
+}
+
+/*
+	推送消息路由
+	按 channel、channel+instId、channel+instType 注册回调函数，同一规则可注册多个回调函数
+*/
+type Router struct {
+	lock   sync.RWMutex
+	seq    uint64
+	routes map[string][]routeEntry
+	// 各频道按 instType 注册的回调函数数量
+	instTypes map[string]int
+}
+
+/*
+	路由注册后返回的句柄，用于注销
+*/
+type RouteHandle struct {
+	router *Router
+	key    string
+	id     uint64
+}
+
+func NewRouter() *Router {
+	return &Router{
+		routes:    make(map[string][]routeEntry),
+		instTypes: make(map[string]int),
+	}
+}
+
+/*
+	注销回调函数，可重复调用
+*/
+func (h *RouteHandle) Remove() {
+	if h == nil || h.router == nil {
+		return
+	}
+	h.router.remove(h.key, h.id)
+}
+
+func (r *Router) add(p RoutePattern, fn func(*Msg)) (h *RouteHandle, err error) {
+	if p.Channel == "" {
+		err = errors.New("路由规则channel不可为空")
+		return
+	}
+	if fn == nil {
+		err = errors.New("回调函数不可为空")
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.seq++
+	key := p.key()
+	entry := routeEntry{id: r.seq, fn: fn}
+	if p.InstId == "" && p.InstType != "" {
+		entry.instTypeOf = p.Channel
+		r.instTypes[p.Channel]++
+	}
+	r.routes[key] = append(r.routes[key], entry)
+	h = &RouteHandle{router: r, key: key, id: r.seq}
+	return
+}
+
+func (r *Router) remove(key string, id uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	entries := r.routes[key]
+	for i, v := range entries {
+		if v.id != id {
+			continue
+		}
+		if v.instTypeOf != "" {
+			r.instTypes[v.instTypeOf]--
+			if r.instTypes[v.instTypeOf] == 0 {
+				delete(r.instTypes, v.instTypeOf)
+			}
+		}
+		// 复制一份，避免影响正在分发中的切片
+		res := make([]routeEntry, 0, len(entries)-1)
+		res = append(res, entries[:i]...)
+		res = append(res, entries[i+1:]...)
+		if len(res) == 0 {
+			delete(r.routes, key)
+		} else {
+			r.routes[key] = res
+		}
+		return
+	}
+}
+
+/*
+	注册普通推送数据的回调函数
+	例如:
+	h, _ := cli.Router().HandleMsg(RoutePattern{Channel: "tickers", InstId: "BTC-USDT"}, fn)
+	defer h.Remove()
+*/
+func (r *Router) HandleMsg(p RoutePattern, fn ReceivedMsgDataCallback) (*RouteHandle, error) {
+	if fn == nil {
+		return nil, errors.New("回调函数不可为空")
+	}
+	return r.add(p, func(msg *Msg) {
+		push, ok := msg.Info.(*pushData)
+		if !ok {
+			return
+		}
+		if err := fn(msg.Timestamp, push.msgData()); err != nil {
+			log.Println("路由回调函数执行失败！", err)
+		}
+	})
+}
+
+/*
+	注册深度推送数据的回调函数
+*/
+func (r *Router) HandleDepth(p RoutePattern, fn ReceivedDepthDataCallback) (*RouteHandle, error) {
+	if fn == nil {
+		return nil, errors.New("回调函数不可为空")
+	}
+	return r.add(p, func(msg *Msg) {
+		data, ok := msg.Info.(DepthData)
+		if !ok {
+			return
+		}
+		if err := fn(msg.Timestamp, data); err != nil {
+			log.Println("深度路由回调函数执行失败！", err)
+		}
+	})
+}
+
+/*
+	当前注册的回调函数数量
+*/
+func (r *Router) Len() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	cnt := 0
+	for _, v := range r.routes {
+		cnt += len(v)
+	}
+	return cnt
+}
+
+/*
+	按推送数据的arg分发消息
+*/
+func (r *Router) dispatch(msg *Msg) {
+	var arg map[string]string
+	switch data := msg.Info.(type) {
+	case *pushData:
+		arg = data.Arg
+	case DepthData:
+		arg = data.Arg
+	default:
+		return
+	}
+
+	channel := arg["channel"]
+	if channel == "" {
+		return
+	}
+
+	keys := []string{channel}
+	if instId, ok := arg["instId"]; ok && instId != "" {
+		keys = append(keys, routeKey(channel, "instId", instId))
+	}
+
+	var fns []func(*Msg)
+	r.lock.RLock()
+	if instType := arg["instType"]; instType != "" && instType != "ANY" {
+		keys = append(keys, routeKey(channel, "instType", instType))
+	} else if r.instTypes[channel] > 0 {
+		// 只在有按 instType 注册的回调函数时解析推送数据中的 instType
+		if p, ok := msg.Info.(*pushData); ok {
+			for _, v := range p.instTypes() {
+				keys = append(keys, routeKey(channel, "instType", v))
+			}
+		}
+	}
+	for _, k := range keys {
+		for _, v := range r.routes[k] {
+			fns = append(fns, v.fn)
+		}
+	}
+	r.lock.RUnlock()
+
+	for _, fn := range fns {
+		fn(msg)
+	}
+}
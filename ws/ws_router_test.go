@@ -0,0 +1,99 @@
+package ws
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	. "v5sdk_go/ws/wImpl"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter(t *testing.T) {
+	r := NewRouter()
+
+	var all, btc, eth, swap int
+	r.HandleMsg(RoutePattern{Channel: "tickers"}, func(ts time.Time, data MsgData) error {
+		all++
+		return nil
+	})
+	hBtc, err := r.HandleMsg(RoutePattern{Channel: "tickers", InstId: "BTC-USDT"}, func(ts time.Time, data MsgData) error {
+		btc++
+		return nil
+	})
+	assert.Nil(t, err)
+	r.HandleMsg(RoutePattern{Channel: "tickers", InstId: "ETH-USDT"}, func(ts time.Time, data MsgData) error {
+		eth++
+		return nil
+	})
+	r.HandleMsg(RoutePattern{Channel: "positions", InstType: "SWAP"}, func(ts time.Time, data MsgData) error {
+		swap++
+		return nil
+	})
+
+	_, err = r.HandleMsg(RoutePattern{InstId: "BTC-USDT"}, func(ts time.Time, data MsgData) error { return nil })
+	assert.NotNil(t, err)
+
+	push := func(arg map[string]string) {
+		r.dispatch(&Msg{Timestamp: time.Now(), Info: &pushData{Arg: arg}})
+	}
+
+	push(map[string]string{"channel": "tickers", "instId": "BTC-USDT"})
+	push(map[string]string{"channel": "tickers", "instId": "ETH-USDT"})
+	push(map[string]string{"channel": "positions", "instType": "SWAP"})
+	push(map[string]string{"channel": "positions", "instType": "FUTURES"})
+	assert.Equal(t, 2, all)
+	assert.Equal(t, 1, btc)
+	assert.Equal(t, 1, eth)
+	assert.Equal(t, 1, swap)
+
+	// 注销后不再收到推送
+	hBtc.Remove()
+	hBtc.Remove()
+	push(map[string]string{"channel": "tickers", "instId": "BTC-USDT"})
+	assert.Equal(t, 3, all)
+	assert.Equal(t, 1, btc)
+	assert.Equal(t, 3, r.Len())
+
+	// 深度数据只会分发给深度回调
+	var depth int
+	r.HandleDepth(RoutePattern{Channel: "books5", InstId: "BTC-USDT"}, func(ts time.Time, data DepthData) error {
+		depth++
+		return nil
+	})
+	r.dispatch(&Msg{Timestamp: time.Now(), Info: DepthData{Arg: map[string]string{"channel": "books5", "instId": "BTC-USDT"}}})
+	assert.Equal(t, 1, depth)
+}
+
+/*
+	推送的 arg 中没有 instType 或为 ANY 时按推送数据中的 instType 匹配
+*/
+func TestRouterInstTypeFromData(t *testing.T) {
+	r := NewRouter()
+	var swap, spot int
+	h, _ := r.HandleMsg(RoutePattern{Channel: "orders", InstType: "SWAP"}, func(ts time.Time, data MsgData) error {
+		swap++
+		return nil
+	})
+	r.HandleMsg(RoutePattern{Channel: "tickers", InstType: "SPOT"}, func(ts time.Time, data MsgData) error {
+		spot++
+		return nil
+	})
+
+	push := func(arg map[string]string, data string) {
+		r.dispatch(&Msg{Timestamp: time.Now(), Info: &pushData{Arg: arg, raw: json.RawMessage(data)}})
+	}
+	push(map[string]string{"channel": "orders", "instType": "ANY"}, `[{"instType":"SWAP"},{"instType":"SWAP"}]`)
+	push(map[string]string{"channel": "orders", "instType": "ANY"}, `[{"instType":"SPOT"}]`)
+	push(map[string]string{"channel": "tickers", "instId": "BTC-USDT"}, `[{"instType":"SPOT","instId":"BTC-USDT"}]`)
+	assert.Equal(t, 1, swap)
+	assert.Equal(t, 1, spot)
+
+	// 注销后不再解析推送数据中的 instType
+	h.Remove()
+	assert.Equal(t, 0, r.instTypes["orders"])
+	p := &pushData{Arg: map[string]string{"channel": "orders", "instType": "ANY"}, raw: json.RawMessage(`[{"instType":"SWAP"}]`)}
+	r.dispatch(&Msg{Timestamp: time.Now(), Info: p})
+	assert.Nil(t, p.types)
+	assert.Equal(t, 1, swap)
+}
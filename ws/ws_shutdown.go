@@ -0,0 +1,173 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+	. "v5sdk_go/ws/wImpl"
+)
+
+var (
+	ErrClientClosed  = errors.New("客户端已关闭")
+	ErrClientClosing = errors.New("客户端正在关闭")
+)
+
+// 发送关闭帧后等待服务端关闭连接的最长时间
+const CLOSE_WAIT = time.Second
+
+func (a *WsClient) isClosing() bool {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.closing
+}
+
+/*
+	获取当前订阅的频道参数
+*/
+func (a *WsClient) GetSubscriptions() []map[string]string {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	res := make([]map[string]string, 0, len(a.subs))
+	for _, arg := range a.subs {
+		tmp := make(map[string]string, len(arg))
+		for k, v := range arg {
+			tmp[k] = v
+		}
+		res = append(res, tmp)
+	}
+	return res
+}
+
+/*
+	优雅关闭连接，依次执行:
+	1. 不再接受新的请求
+	2. 取消所有订阅
+	3. 等待处理中的请求和推送回调函数完成
+	4. 发送关闭帧，等待服务端关闭连接
+	ctx 结束时立即断开连接并返回 ctx.Err()
+	例如:
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cli.Shutdown(ctx)
+*/
+func (a *WsClient) Shutdown(ctx context.Context) (err error) {
+	a.lock.Lock()
+	if !a.isStarted || a.closing {
+		a.lock.Unlock()
+		return
+	}
+	a.closing = true
+	groups := a.groupSubs()
+	recvDone := a.recvDone
+	a.lock.Unlock()
+	defer a.Stop()
+
+	err = a.unsubscribeAll(ctx, groups)
+	if err != nil {
+		return
+	}
+
+	err = a.waitRequests(ctx)
+	if err != nil {
+		return
+	}
+
+	err = a.drainQueues(ctx)
+	if err != nil {
+		return
+	}
+
+	err = a.sendClose(ctx)
+	if err != nil {
+		return
+	}
+
+	select {
+	case <-recvDone:
+	case <-time.After(CLOSE_WAIT):
+		log.Println("等待服务端关闭连接超时！")
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
+
+/*
+	按事件类型分组当前订阅，调用方需持有 a.lock
+*/
+func (a *WsClient) groupSubs() map[Event][]map[string]string {
+	groups := make(map[Event][]map[string]string)
+	for _, arg := range a.subs {
+		evtId := GetEventByParam(arg)
+		groups[evtId] = append(groups[evtId], arg)
+	}
+	return groups
+}
+
+/*
+	取消所有订阅，单个频道失败时继续处理其他频道
+*/
+func (a *WsClient) unsubscribeAll(ctx context.Context, groups map[Event][]map[string]string) error {
+	for evtId, args := range groups {
+		req := ReqData{
+			Op:   OP_UNSUBSCRIBE,
+			Args: args,
+		}
+		msg, err := a.request(ctx, evtId, req)
+		if err == nil {
+			var res bool
+			res, err = checkResult(req, msg)
+			if res {
+				a.trackSubs(req)
+			}
+		}
+		if err != nil {
+			log.Println("关闭时取消订阅失败！", evtId, err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+/*
+	等待处理中的请求完成
+*/
+func (a *WsClient) waitRequests(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		a.reqWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/*
+	由发送协程写入关闭帧，保证与其他消息不会并发写入
+*/
+func (a *WsClient) sendClose(ctx context.Context) error {
+	quit := a.IsQuit()
+	res := make(chan error, 1)
+	select {
+	case a.closeCh <- res:
+	case <-quit:
+		return ErrClientClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-res:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
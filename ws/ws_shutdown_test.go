@@ -0,0 +1,78 @@
+package ws
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	. "v5sdk_go/ws/wImpl"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdown(t *testing.T) {
+	srv := newFakeServer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	r.SetDialer(srv.dialer)
+	assert.Nil(t, r.Start())
+
+	params := []map[string]string{{"instId": "BTC-USDT"}, {"instId": "ETH-USDT"}}
+	res, _, err := r.PubChannel(EVENT_BOOK_TICKERS, OP_SUBSCRIBE, params, PERIOD_NONE)
+	assert.True(t, res, err)
+	res, _, err = r.PubChannel(EVENT_BOOK_TICKERS, OP_UNSUBSCRIBE, params[1:], PERIOD_NONE)
+	assert.True(t, res, err)
+	assert.Equal(t, 1, len(r.GetSubscriptions()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	assert.Nil(t, r.Shutdown(ctx))
+
+	// 已取消订阅并发送关闭帧
+	assert.Equal(t, 0, len(r.GetSubscriptions()))
+	assert.Equal(t, 1, srv.closeCount())
+	select {
+	case <-r.IsQuit():
+	default:
+		t.Fatal("客户端未退出")
+	}
+
+	res, _, err = r.Ping()
+	assert.False(t, res)
+	assert.Equal(t, ErrClientClosing, err)
+	// 重复关闭
+	assert.Nil(t, r.Shutdown(ctx))
+	assert.Nil(t, r.Stop())
+}
+
+func TestStopWithPendingRequests(t *testing.T) {
+	d := NewPipeDialer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	r.SetDialer(d)
+	r.SetHeartbeat(HeartbeatConfig{})
+	// 服务端不响应
+	go d.Accept(context.Background())
+	assert.Nil(t, r.Start())
+
+	var failed int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, _, _ := r.Ping(2000)
+			if !res {
+				atomic.AddInt32(&failed, 1)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	r.Stop()
+	wg.Wait()
+
+	// 等待中的请求随连接关闭立即返回
+	assert.Equal(t, int32(10), failed)
+	assert.True(t, time.Since(start) < time.Second)
+}
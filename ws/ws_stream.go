@@ -0,0 +1,532 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+	. "v5sdk_go/ws/wImpl"
+)
+
+// 订阅流默认缓冲区大小
+const DEFAULT_STREAM_BUFFER = 256
+
+// 取消订阅流，关闭数据通道，没有其他订阅流或回调使用该频道时退订，可重复调用
+type CancelFunc func()
+
+// 行情推送
+type TickerEvent struct {
+	Timestamp time.Time
+	Ticker    TickerDetail
+}
+
+// 成交推送
+type TradeEvent struct {
+	Timestamp time.Time
+	Trade     TradeDetail
+}
+
+// 深度推送
+type BookEvent struct {
+	Timestamp time.Time
+	Arg       map[string]string
+	Action    string
+	Book      DepthDetail
+}
+
+// 账户推送
+type AccountEvent struct {
+	Timestamp time.Time
+	Account   AccountDetail
+}
+
+// 持仓推送
+type PositionEvent struct {
+	Timestamp time.Time
+	Position  PositionDetail
+}
+
+// 订单推送
+type OrderEvent struct {
+	Timestamp time.Time
+	Order     OrderUpdate
+}
+
+// 策略委托订单推送
+type AlgoOrderEvent struct {
+	Timestamp time.Time
+	Order     AlgoOrderUpdate
+}
+
+// 账户余额和持仓推送
+type BalAndPosEvent struct {
+	Timestamp time.Time
+	BalAndPos BalAndPosDetail
+}
+
+/*
+	订阅流
+	负责数据通道的关闭，保证关闭后不会再向数据通道写入
+*/
+type stream struct {
+	lock    sync.RWMutex
+	closed  bool
+	done    chan struct{}
+	once    sync.Once
+	closeCh func()
+}
+
+func newStream(closeCh func()) *stream {
+	return &stream{
+		done:    make(chan struct{}),
+		closeCh: closeCh,
+	}
+}
+
+/*
+	向数据通道写入数据，fn 中的写入操作需要同时监听 done 信号
+*/
+func (s *stream) send(fn func(done <-chan struct{})) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return
+	}
+	fn(s.done)
+}
+
+func (s *stream) close() {
+	s.once.Do(func() {
+		// 先通知写入方退出，再关闭数据通道
+		close(s.done)
+		s.lock.Lock()
+		s.closed = true
+		s.closeCh()
+		s.lock.Unlock()
+	})
+}
+
+/*
+	判断推送数据的arg是否属于某个订阅参数
+*/
+func argMatches(params []map[string]string, arg map[string]string) bool {
+	for _, p := range params {
+		ok := true
+		for k, v := range p {
+			if arg[k] != v {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func msgArg(msg *Msg) map[string]string {
+	switch data := msg.Info.(type) {
+	case *pushData:
+		return data.Arg
+	case DepthData:
+		return data.Arg
+	}
+	return nil
+}
+
+/*
+	设置订阅流数据通道的缓冲区大小
+*/
+func (a *WsClient) SetStreamBufferSize(size int) {
+	if size < 0 {
+		size = 0
+	}
+	a.streamBuf = size
+}
+
+func (a *WsClient) isRunning() bool {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.isStarted
+}
+
+/*
+	订阅频道并将推送数据交给 onMsg 处理
+	ctx: 控制订阅请求的超时和取消
+	life: 关闭后自动取消订阅，为 nil 时只能通过 cancel 取消
+	连接断开重连后订阅流继续接收数据，客户端停止且不再重连时关闭
+*/
+func (a *WsClient) openStream(ctx context.Context, life <-chan struct{}, evtId Event, params []map[string]string, st *stream, onMsg func(*Msg)) (cancel CancelFunc, err error) {
+	pa, err := checkParams(evtId, params, PERIOD_NONE)
+	if err != nil {
+		return
+	}
+
+	h, err := a.router.add(RoutePattern{Channel: pa[0]["channel"]}, func(msg *Msg) {
+		if !argMatches(pa, msgArg(msg)) {
+			return
+		}
+		onMsg(msg)
+	})
+	if err != nil {
+		return
+	}
+
+	res, _, err := a.PubChannelCtx(ctx, evtId, OP_SUBSCRIBE, pa, PERIOD_NONE)
+	if !res {
+		h.Remove()
+		st.close()
+		if err == nil {
+			err = errors.New("订阅失败！")
+		}
+		return
+	}
+
+	done := a.stopSignal()
+	var once sync.Once
+	cancel = func() {
+		once.Do(func() {
+			h.Remove()
+			// 其他订阅流或回调仍在使用的频道不退订；连接断开期间取消时，释放后重连不再恢复
+			last := a.releaseSubs(pa)
+			if len(last) != 0 && a.isRunning() {
+				res, _, err := a.PubChannel(evtId, OP_UNSUBSCRIBE, last, PERIOD_NONE)
+				if !res {
+					log.Println("取消订阅失败！", err)
+				}
+			}
+			st.close()
+		})
+	}
+
+	go func() {
+		select {
+		case <-done:
+			// 客户端已停止，不再恢复该订阅
+			h.Remove()
+			a.releaseSubs(pa)
+			st.close()
+		case <-life:
+			cancel()
+		case <-st.done:
+		}
+	}()
+	return
+}
+
+/*
+	以数据通道的方式订阅行情频道
+	例如:
+	ch, cancel, err := cli.StreamTickers([]map[string]string{{"instId": "BTC-USDT"}})
+	defer cancel()
+	for evt := range ch { ... }
+*/
+func (a *WsClient) StreamTickers(params []map[string]string, timeOut ...int) (<-chan TickerEvent, CancelFunc, error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.streamTickers(ctx, nil, params)
+}
+
+func (a *WsClient) StreamTickersCtx(ctx context.Context, params []map[string]string) (<-chan TickerEvent, CancelFunc, error) {
+	return a.streamTickers(ctx, ctx.Done(), params)
+}
+
+func (a *WsClient) streamTickers(ctx context.Context, life <-chan struct{}, params []map[string]string) (<-chan TickerEvent, CancelFunc, error) {
+	ch := make(chan TickerEvent, a.streamBuf)
+	st := newStream(func() { close(ch) })
+	cancel, err := a.openStream(ctx, life, EVENT_BOOK_TICKERS, params, st, func(msg *Msg) {
+		push, ok := typedPush(msg).(TickerData)
+		if !ok {
+			return
+		}
+		st.send(func(done <-chan struct{}) {
+			for _, v := range push.Data {
+				select {
+				case ch <- TickerEvent{Timestamp: msg.Timestamp, Ticker: v}:
+				case <-done:
+					return
+				}
+			}
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch, cancel, nil
+}
+
+/*
+	以数据通道的方式订阅交易频道
+*/
+func (a *WsClient) StreamTrades(params []map[string]string, timeOut ...int) (<-chan TradeEvent, CancelFunc, error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.streamTrades(ctx, nil, params)
+}
+
+func (a *WsClient) StreamTradesCtx(ctx context.Context, params []map[string]string) (<-chan TradeEvent, CancelFunc, error) {
+	return a.streamTrades(ctx, ctx.Done(), params)
+}
+
+func (a *WsClient) streamTrades(ctx context.Context, life <-chan struct{}, params []map[string]string) (<-chan TradeEvent, CancelFunc, error) {
+	ch := make(chan TradeEvent, a.streamBuf)
+	st := newStream(func() { close(ch) })
+	cancel, err := a.openStream(ctx, life, EVENT_BOOK_TRADE, params, st, func(msg *Msg) {
+		push, ok := typedPush(msg).(TradeData)
+		if !ok {
+			return
+		}
+		st.send(func(done <-chan struct{}) {
+			for _, v := range push.Data {
+				select {
+				case ch <- TradeEvent{Timestamp: msg.Timestamp, Trade: v}:
+				case <-done:
+					return
+				}
+			}
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch, cancel, nil
+}
+
+/*
+	以数据通道的方式订阅深度频道
+	channel: books / books5 / books-l2-tbt / books50-l2-tbt
+*/
+func (a *WsClient) StreamOrderBooks(channel string, params []map[string]string, timeOut ...int) (<-chan BookEvent, CancelFunc, error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.streamOrderBooks(ctx, nil, channel, params)
+}
+
+func (a *WsClient) StreamOrderBooksCtx(ctx context.Context, channel string, params []map[string]string) (<-chan BookEvent, CancelFunc, error) {
+	return a.streamOrderBooks(ctx, ctx.Done(), channel, params)
+}
+
+func (a *WsClient) streamOrderBooks(ctx context.Context, life <-chan struct{}, channel string, params []map[string]string) (<-chan BookEvent, CancelFunc, error) {
+	var evtId Event
+	switch channel {
+	case "books":
+		evtId = EVENT_BOOK_ORDER_BOOK
+	case "books5":
+		evtId = EVENT_BOOK_ORDER_BOOK5
+	case "books-l2-tbt":
+		evtId = EVENT_BOOK_ORDER_BOOK_TBT
+	case "books50-l2-tbt":
+		evtId = EVENT_BOOK_ORDER_BOOK50_TBT
+	default:
+		return nil, nil, errors.New("未知的channel")
+	}
+
+	ch := make(chan BookEvent, a.streamBuf)
+	st := newStream(func() { close(ch) })
+	cancel, err := a.openStream(ctx, life, evtId, params, st, func(msg *Msg) {
+		data, ok := msg.Info.(DepthData)
+		if !ok {
+			return
+		}
+		st.send(func(done <-chan struct{}) {
+			for _, v := range data.Data {
+				select {
+				case ch <- BookEvent{Timestamp: msg.Timestamp, Arg: data.Arg, Action: data.Action, Book: v}:
+				case <-done:
+					return
+				}
+			}
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch, cancel, nil
+}
+
+/*
+	以数据通道的方式订阅账户频道
+*/
+func (a *WsClient) StreamAccount(params []map[string]string, timeOut ...int) (<-chan AccountEvent, CancelFunc, error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.streamAccount(ctx, nil, params)
+}
+
+func (a *WsClient) StreamAccountCtx(ctx context.Context, params []map[string]string) (<-chan AccountEvent, CancelFunc, error) {
+	return a.streamAccount(ctx, ctx.Done(), params)
+}
+
+func (a *WsClient) streamAccount(ctx context.Context, life <-chan struct{}, params []map[string]string) (<-chan AccountEvent, CancelFunc, error) {
+	ch := make(chan AccountEvent, a.streamBuf)
+	st := newStream(func() { close(ch) })
+	cancel, err := a.openStream(ctx, life, EVENT_BOOK_ACCOUNT, params, st, func(msg *Msg) {
+		push, ok := typedPush(msg).(AccountData)
+		if !ok {
+			return
+		}
+		st.send(func(done <-chan struct{}) {
+			for _, v := range push.Data {
+				select {
+				case ch <- AccountEvent{Timestamp: msg.Timestamp, Account: v}:
+				case <-done:
+					return
+				}
+			}
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch, cancel, nil
+}
+
+/*
+	以数据通道的方式订阅持仓频道
+*/
+func (a *WsClient) StreamPositions(params []map[string]string, timeOut ...int) (<-chan PositionEvent, CancelFunc, error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.streamPositions(ctx, nil, params)
+}
+
+func (a *WsClient) StreamPositionsCtx(ctx context.Context, params []map[string]string) (<-chan PositionEvent, CancelFunc, error) {
+	return a.streamPositions(ctx, ctx.Done(), params)
+}
+
+func (a *WsClient) streamPositions(ctx context.Context, life <-chan struct{}, params []map[string]string) (<-chan PositionEvent, CancelFunc, error) {
+	ch := make(chan PositionEvent, a.streamBuf)
+	st := newStream(func() { close(ch) })
+	cancel, err := a.openStream(ctx, life, EVENT_BOOK_POSTION, params, st, func(msg *Msg) {
+		push, ok := typedPush(msg).(PositionData)
+		if !ok {
+			return
+		}
+		st.send(func(done <-chan struct{}) {
+			for _, v := range push.Data {
+				select {
+				case ch <- PositionEvent{Timestamp: msg.Timestamp, Position: v}:
+				case <-done:
+					return
+				}
+			}
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch, cancel, nil
+}
+
+/*
+	以数据通道的方式订阅订单频道
+*/
+func (a *WsClient) StreamOrders(params []map[string]string, timeOut ...int) (<-chan OrderEvent, CancelFunc, error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.streamOrders(ctx, nil, params)
+}
+
+func (a *WsClient) StreamOrdersCtx(ctx context.Context, params []map[string]string) (<-chan OrderEvent, CancelFunc, error) {
+	return a.streamOrders(ctx, ctx.Done(), params)
+}
+
+func (a *WsClient) streamOrders(ctx context.Context, life <-chan struct{}, params []map[string]string) (<-chan OrderEvent, CancelFunc, error) {
+	ch := make(chan OrderEvent, a.streamBuf)
+	st := newStream(func() { close(ch) })
+	cancel, err := a.openStream(ctx, life, EVENT_BOOK_ORDER, params, st, func(msg *Msg) {
+		push, ok := typedPush(msg).(OrderData)
+		if !ok {
+			return
+		}
+		st.send(func(done <-chan struct{}) {
+			for _, v := range push.Data {
+				select {
+				case ch <- OrderEvent{Timestamp: msg.Timestamp, Order: v}:
+				case <-done:
+					return
+				}
+			}
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch, cancel, nil
+}
+
+/*
+	以数据通道的方式订阅策略委托订单频道
+*/
+func (a *WsClient) StreamAlgoOrders(params []map[string]string, timeOut ...int) (<-chan AlgoOrderEvent, CancelFunc, error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.streamAlgoOrders(ctx, nil, params)
+}
+
+func (a *WsClient) StreamAlgoOrdersCtx(ctx context.Context, params []map[string]string) (<-chan AlgoOrderEvent, CancelFunc, error) {
+	return a.streamAlgoOrders(ctx, ctx.Done(), params)
+}
+
+func (a *WsClient) streamAlgoOrders(ctx context.Context, life <-chan struct{}, params []map[string]string) (<-chan AlgoOrderEvent, CancelFunc, error) {
+	ch := make(chan AlgoOrderEvent, a.streamBuf)
+	st := newStream(func() { close(ch) })
+	cancel, err := a.openStream(ctx, life, EVENT_BOOK_ALG_ORDER, params, st, func(msg *Msg) {
+		push, ok := typedPush(msg).(AlgoOrderData)
+		if !ok {
+			return
+		}
+		st.send(func(done <-chan struct{}) {
+			for _, v := range push.Data {
+				select {
+				case ch <- AlgoOrderEvent{Timestamp: msg.Timestamp, Order: v}:
+				case <-done:
+					return
+				}
+			}
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch, cancel, nil
+}
+
+/*
+	以数据通道的方式订阅账户余额和持仓频道
+*/
+func (a *WsClient) StreamBalAndPos(params []map[string]string, timeOut ...int) (<-chan BalAndPosEvent, CancelFunc, error) {
+	ctx, cancel := timeoutCtx(timeOut...)
+	defer cancel()
+	return a.streamBalAndPos(ctx, nil, params)
+}
+
+func (a *WsClient) StreamBalAndPosCtx(ctx context.Context, params []map[string]string) (<-chan BalAndPosEvent, CancelFunc, error) {
+	return a.streamBalAndPos(ctx, ctx.Done(), params)
+}
+
+func (a *WsClient) streamBalAndPos(ctx context.Context, life <-chan struct{}, params []map[string]string) (<-chan BalAndPosEvent, CancelFunc, error) {
+	ch := make(chan BalAndPosEvent, a.streamBuf)
+	st := newStream(func() { close(ch) })
+	cancel, err := a.openStream(ctx, life, EVENT_BOOK_B_AND_P, params, st, func(msg *Msg) {
+		push, ok := typedPush(msg).(BalAndPosData)
+		if !ok {
+			return
+		}
+		st.send(func(done <-chan struct{}) {
+			for _, v := range push.Data {
+				select {
+				case ch <- BalAndPosEvent{Timestamp: msg.Timestamp, BalAndPos: v}:
+				case <-done:
+					return
+				}
+			}
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch, cancel, nil
+}
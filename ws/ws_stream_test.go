@@ -0,0 +1,175 @@
+package ws
+
+import (
+	"testing"
+	"time"
+	. "v5sdk_go/ws/wImpl"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArgMatches(t *testing.T) {
+	params := []map[string]string{
+		{"channel": "tickers", "instId": "BTC-USDT"},
+		{"channel": "tickers", "instId": "ETH-USDT"},
+	}
+
+	assert.True(t, argMatches(params, map[string]string{"channel": "tickers", "instId": "BTC-USDT"}))
+	assert.True(t, argMatches(params, map[string]string{"channel": "tickers", "instId": "ETH-USDT", "uid": "1"}))
+	assert.False(t, argMatches(params, map[string]string{"channel": "tickers", "instId": "LTC-USDT"}))
+	assert.False(t, argMatches(params, map[string]string{"channel": "trades", "instId": "BTC-USDT"}))
+}
+
+func TestStreamClose(t *testing.T) {
+	ch := make(chan TickerEvent)
+	st := newStream(func() { close(ch) })
+
+	// 消费方不读取时，写入会阻塞直到订阅流关闭
+	sent := make(chan struct{})
+	go func() {
+		st.send(func(done <-chan struct{}) {
+			select {
+			case ch <- TickerEvent{Timestamp: time.Now()}:
+			case <-done:
+			}
+		})
+		close(sent)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	st.close()
+	st.close()
+	<-sent
+
+	_, ok := <-ch
+	assert.False(t, ok)
+
+	// 关闭后写入直接忽略
+	st.send(func(done <-chan struct{}) {
+		t.Fatal("订阅流已关闭")
+	})
+}
+
+/*
+	同一频道多次订阅时，最后一次释放才需要退订
+*/
+func TestReleaseSubs(t *testing.T) {
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	req := ReqData{Op: OP_SUBSCRIBE, Args: []map[string]string{{"channel": "tickers", "instId": "BTC-USDT"}}}
+	r.trackSubs(req)
+	r.trackSubs(req)
+
+	assert.Nil(t, r.releaseSubs(req.Args))
+	assert.Equal(t, req.Args, r.releaseSubs(req.Args))
+	assert.Nil(t, r.releaseSubs(req.Args))
+}
+
+/*
+	订阅流在重连后继续接收数据，客户端停止后关闭
+*/
+func TestStreamReconnect(t *testing.T) {
+	srv := newFakeServer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	r.SetDialer(srv.dialer)
+	r.SetHeartbeat(HeartbeatConfig{})
+	assert.Nil(t, r.SetReconnect(ReconnectConfig{Interval: 20 * time.Millisecond, MaxRetry: 3}))
+	assert.Nil(t, r.Start())
+	defer r.Stop()
+
+	ch, _, err := r.StreamTickers([]map[string]string{{"instId": "BTC-USDT"}})
+	assert.Nil(t, err)
+
+	srv.conn(0).Close()
+	assert.Eventually(t, func() bool {
+		srv.lock.Lock()
+		n := len(srv.conns)
+		srv.lock.Unlock()
+		return n == 2 && r.isRunning()
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, len(r.GetSubscriptions()))
+	assert.Equal(t, 1, r.router.Len())
+
+	push := `{"arg":{"channel":"tickers","instId":"BTC-USDT"},"data":[{"instId":"BTC-USDT","last":"100"}]}`
+	srv.conn(1).WriteMessage(websocket.TextMessage, []byte(push))
+	select {
+	case evt, ok := <-ch:
+		assert.True(t, ok)
+		assert.Equal(t, "100", evt.Ticker.Last)
+	case <-time.After(2 * time.Second):
+		t.Fatal("重连后未收到推送")
+	}
+
+	r.Stop()
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok)
+	case <-time.After(2 * time.Second):
+		t.Fatal("数据通道未关闭")
+	}
+	assert.Equal(t, 0, r.router.Len())
+}
+
+/*
+	未设置重连时连接断开即关闭订阅流
+*/
+func TestStreamDisconnect(t *testing.T) {
+	srv := newFakeServer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	r.SetDialer(srv.dialer)
+	r.SetHeartbeat(HeartbeatConfig{})
+	assert.Nil(t, r.Start())
+	defer r.Stop()
+
+	ch, _, err := r.StreamTickers([]map[string]string{{"instId": "BTC-USDT"}})
+	assert.Nil(t, err)
+
+	srv.conn(0).Close()
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok)
+	case <-time.After(2 * time.Second):
+		t.Fatal("数据通道未关闭")
+	}
+	assert.Equal(t, 0, len(r.GetSubscriptions()))
+}
+
+/*
+	同一频道的多个订阅流，最后一个取消时才退订
+*/
+func TestStreamShared(t *testing.T) {
+	srv := newFakeServer()
+	r, _ := NewWsClient("wss://ws.okex.com:8443/ws/v5/public")
+	r.SetDialer(srv.dialer)
+	r.SetHeartbeat(HeartbeatConfig{})
+	assert.Nil(t, r.Start())
+	defer r.Stop()
+
+	params := []map[string]string{{"instId": "BTC-USDT"}}
+	ch1, cancel1, err := r.StreamTickers(params)
+	assert.Nil(t, err)
+	ch2, cancel2, err := r.StreamTickers(params)
+	assert.Nil(t, err)
+
+	cancel1()
+	_, ok := <-ch1
+	assert.False(t, ok)
+	assert.Equal(t, 0, srv.unsubCount())
+	assert.Equal(t, 1, len(r.GetSubscriptions()))
+
+	push := `{"arg":{"channel":"tickers","instId":"BTC-USDT"},"data":[{"instId":"BTC-USDT","last":"100"}]}`
+	srv.conn(0).WriteMessage(websocket.TextMessage, []byte(push))
+	select {
+	case evt, ok := <-ch2:
+		assert.True(t, ok)
+		assert.Equal(t, "100", evt.Ticker.Last)
+	case <-time.After(2 * time.Second):
+		t.Fatal("另一个订阅流未收到推送")
+	}
+
+	cancel2()
+	_, ok = <-ch2
+	assert.False(t, ok)
+	assert.Equal(t, 1, srv.unsubCount())
+	assert.Equal(t, 0, len(r.GetSubscriptions()))
+}